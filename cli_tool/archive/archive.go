@@ -0,0 +1,236 @@
+// Package archive packs directories into tar streams, so that a whole tree is encrypted as one file.
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	commonio "forgetti-common/io"
+	"forgetti-common/logging"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type Entry struct {
+	Path    string // relative, with forward slashes
+	IsDir   bool
+	Mode    fs.FileMode
+	Size    int64
+	ModTime time.Time
+}
+
+// Pack writes the regular files and directories below root into a tar stream, keeping their relative paths, modes and
+// modification times. Symbolic links and special files are skipped, as they could point outside of the tree.
+func Pack(root string) ([]byte, error) {
+	logger := logging.MakeLogger("archive.Pack")
+
+	var buffer bytes.Buffer
+	writer := tar.NewWriter(&buffer)
+
+	err := filepath.WalkDir(root, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relativePath, err := filepath.Rel(root, filePath)
+		if err != nil {
+			return err
+		}
+		if relativePath == "." {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() && !info.IsDir() {
+			logger.Warning("Skipping '%s', only regular files and directories are archived", filePath)
+			return nil
+		}
+
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return fmt.Errorf("failed to create archive header of '%s': %w", filePath, err)
+		}
+		header.Name = filepath.ToSlash(relativePath)
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		// Owners of the packing machine mean nothing where the archive is extracted
+		header.Uid, header.Gid, header.Uname, header.Gname = 0, 0, "", ""
+
+		if err := writer.WriteHeader(header); err != nil {
+			return fmt.Errorf("failed to write archive header of '%s': %w", filePath, err)
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		file, err := os.Open(filePath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		if _, err := io.Copy(writer, file); err != nil {
+			return fmt.Errorf("failed to archive '%s': %w", filePath, err)
+		}
+		logger.Verbose("Archived '%s' (%d bytes)", header.Name, header.Size)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish archive: %w", err)
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// List returns the entries of a tar stream, rejecting entries that Extract would refuse
+func List(data []byte) ([]Entry, error) {
+	var entries []Entry
+	err := walk(data, func(entry Entry, _ io.Reader) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	return entries, err
+}
+
+// Extract restores the tree of a tar stream below destination. Entries are checked before anything is written, so that
+// an archive with paths leaving the destination, links or special files is rejected as a whole.
+func Extract(data []byte, destination string, overwrite bool) ([]Entry, error) {
+	logger := logging.MakeLogger("archive.Extract")
+
+	entries, err := List(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(destination, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory '%s': %w", destination, err)
+	}
+
+	var directories []Entry
+	err = walk(data, func(entry Entry, content io.Reader) error {
+		target := filepath.Join(destination, filepath.FromSlash(entry.Path))
+		if err := checkNoLinkInPath(destination, entry.Path); err != nil {
+			return err
+		}
+
+		if entry.IsDir {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return fmt.Errorf("failed to create directory '%s': %w", target, err)
+			}
+			// Modes and times of directories are restored last, as writing their files changes them
+			directories = append(directories, entry)
+			return nil
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("failed to create directory of '%s': %w", target, err)
+		}
+		if err := commonio.WriteFileFrom(target, overwrite, entry.Mode, content); err != nil {
+			return err
+		}
+		logger.Verbose("Extracted '%s' (%d bytes)", entry.Path, entry.Size)
+		return os.Chtimes(target, entry.ModTime, entry.ModTime)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(directories) - 1; i >= 0; i-- {
+		target := filepath.Join(destination, filepath.FromSlash(directories[i].Path))
+		if err := os.Chmod(target, directories[i].Mode); err != nil {
+			return nil, fmt.Errorf("failed to restore mode of '%s': %w", target, err)
+		}
+		if err := os.Chtimes(target, directories[i].ModTime, directories[i].ModTime); err != nil {
+			return nil, fmt.Errorf("failed to restore times of '%s': %w", target, err)
+		}
+	}
+
+	return entries, nil
+}
+
+// checkNoLinkInPath refuses to write through symbolic links that already exist below the destination, which could
+// redirect the entry outside of it
+func checkNoLinkInPath(destination string, entryPath string) error {
+	current := destination
+	for _, part := range strings.Split(entryPath, "/") {
+		current = filepath.Join(current, part)
+		info, err := os.Lstat(current)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			return fmt.Errorf("refusing to extract '%s' through the symbolic link '%s'", entryPath, current)
+		}
+	}
+	return nil
+}
+
+// walk calls visit for every entry of the tar stream, after checking that it is safe to extract
+func walk(data []byte, visit func(entry Entry, content io.Reader) error) error {
+	reader := tar.NewReader(bytes.NewReader(data))
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("invalid archive: %w", err)
+		}
+
+		entry, err := toEntry(header)
+		if err != nil {
+			return err
+		}
+		if entry == nil {
+			continue
+		}
+		if err := visit(*entry, reader); err != nil {
+			return err
+		}
+	}
+}
+
+// toEntry returns nil for the entry of the archive root, which is the destination itself
+func toEntry(header *tar.Header) (*Entry, error) {
+	name := path.Clean(header.Name)
+	if name == "." {
+		if header.Typeflag == tar.TypeDir {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("invalid archive: entry '%s' has no name", header.Name)
+	}
+	// IsLocal rejects absolute paths, paths leaving the destination through "..", empty paths and reserved names
+	if !filepath.IsLocal(filepath.FromSlash(name)) {
+		return nil, fmt.Errorf("invalid archive: entry '%s' would be extracted outside of the destination", header.Name)
+	}
+
+	switch header.Typeflag {
+	case tar.TypeDir:
+	case tar.TypeReg:
+	default:
+		return nil, fmt.Errorf("invalid archive: entry '%s' is neither a regular file nor a directory", header.Name)
+	}
+
+	return &Entry{
+		Path:    name,
+		IsDir:   header.Typeflag == tar.TypeDir,
+		Mode:    fs.FileMode(header.Mode).Perm(),
+		Size:    header.Size,
+		ModTime: header.ModTime,
+	}, nil
+}
@@ -0,0 +1,237 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// craftedArchive writes a tar stream with the given headers, and content of the size of each regular file
+func craftedArchive(t *testing.T, headers ...tar.Header) []byte {
+	t.Helper()
+
+	var buffer bytes.Buffer
+	writer := tar.NewWriter(&buffer)
+	for _, header := range headers {
+		if err := writer.WriteHeader(&header); err != nil {
+			t.Fatalf("failed to write header '%s': %v", header.Name, err)
+		}
+		if header.Typeflag == tar.TypeReg {
+			if _, err := writer.Write(bytes.Repeat([]byte("x"), int(header.Size))); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func regularFile(name string) tar.Header {
+	return tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: 4, ModTime: time.Now()}
+}
+
+func TestExtractRejectsUnsafeEntries(t *testing.T) {
+	tests := []struct {
+		name   string
+		header tar.Header
+	}{
+		{"parent directory", regularFile("../escaped.txt")},
+		{"parent directory below a directory", regularFile("sub/../../escaped.txt")},
+		{"absolute path", regularFile("/tmp/escaped.txt")},
+		{"empty path", regularFile("")},
+		{"symbolic link", tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd", Mode: 0777}},
+		{"hard link", tar.Header{Name: "link", Typeflag: tar.TypeLink, Linkname: "/etc/passwd", Mode: 0644}},
+		{"device", tar.Header{Name: "device", Typeflag: tar.TypeChar, Mode: 0644}},
+		{"fifo", tar.Header{Name: "fifo", Typeflag: tar.TypeFifo, Mode: 0644}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			parent := t.TempDir()
+			destination := filepath.Join(parent, "out")
+			// A safe entry first, the archive must be rejected as a whole
+			data := craftedArchive(t, regularFile("safe.txt"), test.header)
+
+			if _, err := Extract(data, destination, false); err == nil {
+				t.Fatal("expected the archive to be rejected")
+			}
+			if _, err := List(data); err == nil {
+				t.Error("expected List to reject the archive")
+			}
+
+			entries, err := os.ReadDir(parent)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 0 {
+				t.Errorf("expected nothing to be written, found '%s'", entries[0].Name())
+			}
+		})
+	}
+}
+
+func TestExtractRefusesExistingSymbolicLink(t *testing.T) {
+	outside := t.TempDir()
+	destination := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(destination, "sub")); err != nil {
+		t.Fatal(err)
+	}
+
+	data := craftedArchive(t,
+		tar.Header{Name: "sub/", Typeflag: tar.TypeDir, Mode: 0755, ModTime: time.Now()},
+		regularFile("sub/escaped.txt"),
+	)
+	if _, err := Extract(data, destination, true); err == nil {
+		t.Fatal("expected extraction through a symbolic link to be refused")
+	}
+
+	if _, err := os.Stat(filepath.Join(outside, "escaped.txt")); err == nil {
+		t.Error("a file was written through the symbolic link")
+	}
+}
+
+func TestExtractRefusesExistingFileWithoutOverwrite(t *testing.T) {
+	destination := t.TempDir()
+	if err := os.WriteFile(filepath.Join(destination, "file.txt"), []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Extract(craftedArchive(t, regularFile("file.txt")), destination, false); err == nil {
+		t.Fatal("expected an existing file to be refused without overwrite")
+	}
+
+	content, err := os.ReadFile(filepath.Join(destination, "file.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "keep" {
+		t.Errorf("the existing file was changed to %q", content)
+	}
+}
+
+func TestPackExtractRoundTrip(t *testing.T) {
+	source := t.TempDir()
+	modTime := time.Date(2024, 5, 17, 10, 30, 0, 0, time.UTC)
+	dirTime := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	files := []struct {
+		path    string
+		content string
+		mode    fs.FileMode
+	}{
+		{"readme.txt", "hello", 0644},
+		{"bin/run.sh", "#!/bin/sh\necho hi\n", 0755},
+		{"bin/secret/key.pem", "private", 0600},
+	}
+	for _, file := range files {
+		path := filepath.Join(source, filepath.FromSlash(file.path))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(file.content), file.mode); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(path, file.mode); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chmod(filepath.Join(source, "bin", "secret"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Join(source, "bin", "secret"), dirTime, dirTime); err != nil {
+		t.Fatal(err)
+	}
+	// Links are skipped by Pack
+	if err := os.Symlink("/etc/passwd", filepath.Join(source, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := Pack(source)
+	if err != nil {
+		t.Fatalf("Pack failed: %v", err)
+	}
+
+	destination := filepath.Join(t.TempDir(), "restored")
+	entries, err := Extract(data, destination, false)
+	if err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+	// readme.txt, bin/, bin/run.sh, bin/secret/ and bin/secret/key.pem
+	if len(entries) != 5 {
+		t.Errorf("expected 5 entries, got %d: %+v", len(entries), entries)
+	}
+
+	for _, file := range files {
+		path := filepath.Join(destination, filepath.FromSlash(file.path))
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read '%s': %v", file.path, err)
+		}
+		if string(content) != file.content {
+			t.Errorf("'%s': expected content %q, got %q", file.path, file.content, content)
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != file.mode {
+			t.Errorf("'%s': expected mode %o, got %o", file.path, file.mode, info.Mode().Perm())
+		}
+		if !info.ModTime().Equal(modTime) {
+			t.Errorf("'%s': expected modification time %s, got %s", file.path, modTime, info.ModTime())
+		}
+	}
+
+	info, err := os.Stat(filepath.Join(destination, "bin", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0700 {
+		t.Errorf("expected directory mode 700, got %o", info.Mode().Perm())
+	}
+	if !info.ModTime().Equal(dirTime) {
+		t.Errorf("expected directory modification time %s, got %s", dirTime, info.ModTime())
+	}
+
+	if _, err := os.Lstat(filepath.Join(destination, "link")); err == nil {
+		t.Error("the symbolic link was archived")
+	}
+}
+
+func TestExtractSkipsRootDirectoryEntry(t *testing.T) {
+	destination := t.TempDir()
+	if err := os.Chmod(destination, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	// Archives created with "tar -C dir ." start with an entry of the root itself
+	data := craftedArchive(t,
+		tar.Header{Name: "./", Typeflag: tar.TypeDir, Mode: 0777, ModTime: time.Now()},
+		regularFile("./file.txt"),
+	)
+	entries, err := Extract(data, destination, false)
+	if err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Path != "file.txt" {
+		t.Errorf("expected only the entry 'file.txt', got %+v", entries)
+	}
+
+	info, err := os.Stat(destination)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0700 {
+		t.Errorf("the mode of the destination was changed to %o", info.Mode().Perm())
+	}
+}
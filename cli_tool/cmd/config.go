@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"Forgetti/commands"
+	"Forgetti/output"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	configCmd.AddCommand(configListCmd)
+	configCmd.AddCommand(configGetCmd)
+	configCmd.AddCommand(configSetCmd)
+	configCmd.AddCommand(configUseCmd)
+	configAliasCmd.AddCommand(configAliasListCmd)
+	configAliasCmd.AddCommand(configAliasAddCmd)
+	configAliasCmd.AddCommand(configAliasRemoveCmd)
+	configCmd.AddCommand(configAliasCmd)
+	rootCmd.AddCommand(configCmd)
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage the profiles of the config file",
+	Long: `Profiles hold the server address, API token, TLS pin, default expiration and default algorithm version of a server.
+'get' and 'set' change the profile given with --profile, or the current profile. Fields: server_address, token, tls_pin,
+default_expiration, default_alg_version.`,
+}
+
+var configListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the profiles",
+	Args:  cobra.ExactArgs(0),
+	Run: func(cmd *cobra.Command, args []string) {
+		result, err := commands.ListConfig()
+		output.Report("config list", result, err)
+	},
+}
+
+var configGetCmd = &cobra.Command{
+	Use:   "get <field>",
+	Short: "Print a field of a profile",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		result, err := commands.GetConfig(args[0])
+		output.Report("config get", result, err)
+	},
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set <field> <value>",
+	Short: "Set a field of a profile, creating the profile if needed",
+	Long:  `Set a field of a profile, creating the profile if needed. An empty value removes the field.`,
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		result, err := commands.SetConfig(args[0], args[1])
+		output.Report("config set", result, err)
+	},
+}
+
+var configUseCmd = &cobra.Command{
+	Use:   "use <profile>",
+	Short: "Make a profile the current profile",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		result, err := commands.UseConfig(args[0])
+		output.Report("config use", result, err)
+	},
+}
+
+var configAliasCmd = &cobra.Command{
+	Use:   "alias",
+	Short: "Manage the addresses of servers that moved",
+	Long: `Files store the address of their server. When a server moves, an alias sends the requests for files of the old
+address to the new one, for all profiles. 'retarget' changes the address stored in the files instead.`,
+}
+
+var configAliasListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the server aliases",
+	Args:  cobra.ExactArgs(0),
+	Run: func(cmd *cobra.Command, args []string) {
+		result, err := commands.ListServerAliases()
+		output.Report("config alias list", result, err)
+	},
+}
+
+var configAliasAddCmd = &cobra.Command{
+	Use:   "add <old address> <new address>",
+	Short: "Send the requests for a server to its new address",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		result, err := commands.AddServerAlias(args[0], args[1])
+		output.Report("config alias add", result, err)
+	},
+}
+
+var configAliasRemoveCmd = &cobra.Command{
+	Use:   "remove <old address>",
+	Short: "Remove the alias of a server",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		result, err := commands.RemoveServerAlias(args[0])
+		output.Report("config alias remove", result, err)
+	},
+}
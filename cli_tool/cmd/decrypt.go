@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"Forgetti/commands"
+	"Forgetti/output"
 	"fmt"
 
 	"github.com/spf13/cobra"
@@ -12,19 +13,35 @@ var decrypt_outputPath string
 var decrypt_password string
 var decrypt_serverAddress string
 var decrypt_overwrite bool
+var decrypt_preserveMode bool
 var decrypt_verbose bool
 var decrypt_quiet bool
 var decrypt_nonInteractive bool
+var decrypt_files []string
+var decrypt_fileList string
+var decrypt_outputDir string
+var decrypt_jobs int
+var decrypt_summary string
 
 func init() {
 	decryptCmd.Flags().StringVarP(&decrypt_inputPath, "input", "i", "", "The path to the encrypted file")
-	decryptCmd.Flags().StringVarP(&decrypt_outputPath, "output", "o", "", "The path to the output file")
+	decryptCmd.Flags().StringVarP(&decrypt_outputPath, "output-file", "o", "", "The path to the output file")
 	decryptCmd.Flags().StringVarP(&decrypt_password, "password", "p", "", "The password to decrypt the file with")
 	decryptCmd.Flags().StringVarP(&decrypt_serverAddress, "server-address", "s", "", "The address of the server to decrypt the file with")
 	decryptCmd.Flags().BoolVarP(&decrypt_overwrite, "overwrite", "w", false, "Overwrite the output file if it already exists")
+	decryptCmd.Flags().BoolVar(&decrypt_preserveMode, "preserve-mode", false, "Give the output the permissions the file had when it was encrypted (default: readable only by its owner)")
 	decryptCmd.Flags().BoolVarP(&decrypt_verbose, "verbose", "v", false, "Verbose output")
 	decryptCmd.Flags().BoolVarP(&decrypt_quiet, "quiet", "q", false, "Quiet output")
 	decryptCmd.Flags().BoolVarP(&decrypt_nonInteractive, "non-interactive", "n", false, "Non-interactive mode - no prompts will be shown")
+	decryptCmd.Flags().StringArrayVar(&decrypt_files, "files", nil, "Batch mode: decrypt the files matching this glob pattern (can be repeated)")
+	decryptCmd.Flags().StringVar(&decrypt_fileList, "file-list", "", "Batch mode: decrypt the files listed in this file, one path per line")
+	decryptCmd.Flags().StringVar(&decrypt_outputDir, "output-dir", "", "Batch mode: write the decrypted files to this directory instead of next to their inputs")
+	decryptCmd.Flags().IntVarP(&decrypt_jobs, "jobs", "j", 4, "Batch mode: number of files decrypted at the same time")
+	decryptCmd.Flags().StringVar(&decrypt_summary, "summary", "", "Batch mode: write a JSON summary of outputs, key ids and failures to this file ('-' for stdout)")
+	decryptCmd.MarkFlagsMutuallyExclusive("input", "files")
+	decryptCmd.MarkFlagsMutuallyExclusive("input", "file-list")
+	decryptCmd.MarkFlagsMutuallyExclusive("output-file", "output-dir")
+	acceptLegacyOutputPath(decryptCmd)
 
 	rootCmd.AddCommand(decryptCmd)
 }
@@ -32,10 +49,20 @@ func init() {
 var decryptCmd = &cobra.Command{
 	Use:   "decrypt",
 	Short: "Decrypt a file",
-	Long:  `Decrypt contents of a given file, writing the output to another specified file.`,
+	Long: `Decrypt contents of a given file, writing the output to another specified file.
+With --files or --file-list, decrypt many files at once with the same password.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		if err := promptForDecryptPasswordIfEmpty(&decrypt_password, decrypt_nonInteractive); err != nil {
-			fmt.Println(err)
+			output.Report("decrypt", nil, invalidInput(err))
+			return
+		}
+
+		if len(decrypt_files) > 0 || decrypt_fileList != "" {
+			decryptBatch()
+			return
+		}
+		if decrypt_outputDir != "" || decrypt_summary != "" {
+			output.Report("decrypt", nil, invalidInput(fmt.Errorf("--output-dir and --summary require --files or --file-list")))
 			return
 		}
 
@@ -45,18 +72,40 @@ var decryptCmd = &cobra.Command{
 			decrypt_password,
 			decrypt_serverAddress,
 			decrypt_overwrite,
+			decrypt_preserveMode,
 			decrypt_verbose,
 			decrypt_quiet,
 		)
 		if err != nil {
-			fmt.Println(err)
+			output.Report("decrypt", nil, invalidInput(err))
 			return
 		}
 
-		err = commands.Decrypt(*input)
-		if err != nil {
-			fmt.Println(err)
-			return
-		}
+		result, err := commands.Decrypt(*input)
+		output.Report("decrypt", result, err)
 	},
 }
+
+func decryptBatch() {
+	batch, err := commands.CreateBatchInput(decrypt_files, decrypt_fileList, decrypt_outputDir, decrypt_jobs, decrypt_summary)
+	if err != nil {
+		output.Report("decrypt", nil, invalidInput(err))
+		return
+	}
+
+	input, err := commands.CreateDecryptOptions(
+		decrypt_password,
+		decrypt_serverAddress,
+		decrypt_overwrite,
+		decrypt_preserveMode,
+		decrypt_verbose,
+		decrypt_quiet,
+	)
+	if err != nil {
+		output.Report("decrypt", nil, invalidInput(err))
+		return
+	}
+
+	summary, err := commands.DecryptBatch(*input, *batch)
+	output.Report("decrypt", summary, err)
+}
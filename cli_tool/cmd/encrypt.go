@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"Forgetti/commands"
+	"Forgetti/output"
 	"fmt"
 
 	"github.com/spf13/cobra"
@@ -9,14 +10,31 @@ import (
 
 func init() {
 	encryptCmd.Flags().StringVarP(&encrypt_password, "password", "p", "", "The password to encrypt the file with")
-	encryptCmd.Flags().StringVarP(&encrypt_expiresIn, "expires-in", "e", "1d", "The time after which the encrypted file will expire (format: 1y/2/mo/3w/4d/5h/6min)")
+	encryptCmd.Flags().StringVarP(&encrypt_expiresIn, "expires-in", "e", "", "The time after which the encrypted file will expire (format: 1y/2/mo/3w/4d/5h/6min, default: the default expiration of the profile, or 1d)")
 	encryptCmd.Flags().StringVarP(&encrypt_serverAddress, "server-address", "s", "", "The address of the server to encrypt the file with")
 	encryptCmd.Flags().StringVarP(&encrypt_inputPath, "input", "i", "", "The path to the input file")
-	encryptCmd.Flags().StringVarP(&encrypt_outputPath, "output", "o", "", "The path to the output file")
+	encryptCmd.Flags().StringVarP(&encrypt_outputPath, "output-file", "o", "", "The path to the output file")
 	encryptCmd.Flags().BoolVarP(&encrypt_overwrite, "overwrite", "w", false, "Overwrite the output file if it already exists")
+	encryptCmd.Flags().BoolVar(&encrypt_shredInput, "shred-input", false, "Overwrite and remove the input once a test decryption of the output succeeded (see 'shred --help' for its limits)")
 	encryptCmd.Flags().BoolVarP(&encrypt_verbose, "verbose", "v", false, "Verbose output")
 	encryptCmd.Flags().BoolVarP(&encrypt_quiet, "quiet", "q", false, "Quiet output")
 	encryptCmd.Flags().BoolVarP(&encrypt_nonInteractive, "non-interactive", "n", false, "Non-interactive mode - generate random password without prompts")
+	encryptCmd.Flags().StringVarP(&encrypt_group, "group", "g", "", "Share one key among many files: reuse the key of this key group, creating it on first use (requires an API token)")
+	encryptCmd.Flags().StringVarP(&encrypt_keyId, "key-id", "k", "", "Reuse the key with this id, which must belong to a key group of this machine")
+	encryptCmd.Flags().BoolVarP(&encrypt_recursive, "recursive", "r", false, "Encrypt a directory, packing its files into one archive")
+	encryptCmd.Flags().StringArrayVar(&encrypt_files, "files", nil, "Batch mode: encrypt the files matching this glob pattern (can be repeated)")
+	encryptCmd.Flags().StringVar(&encrypt_fileList, "file-list", "", "Batch mode: encrypt the files listed in this file, one path per line")
+	encryptCmd.Flags().StringVar(&encrypt_outputDir, "output-dir", "", "Batch mode: write the encrypted files to this directory instead of next to their inputs")
+	encryptCmd.Flags().IntVarP(&encrypt_jobs, "jobs", "j", 4, "Batch mode: number of files encrypted at the same time")
+	encryptCmd.Flags().StringVar(&encrypt_summary, "summary", "", "Batch mode: write a JSON summary of outputs, key ids and failures to this file ('-' for stdout)")
+	encryptCmd.Flags().BoolVar(&encrypt_sharedKey, "shared-key", false, "Batch mode: encrypt all files with one new key instead of a key per file")
+	encryptCmd.MarkFlagsMutuallyExclusive("group", "key-id")
+	encryptCmd.MarkFlagsMutuallyExclusive("input", "files")
+	encryptCmd.MarkFlagsMutuallyExclusive("input", "file-list")
+	encryptCmd.MarkFlagsMutuallyExclusive("output-file", "output-dir")
+	acceptLegacyOutputPath(encryptCmd)
+	encryptCmd.MarkFlagsMutuallyExclusive("recursive", "files")
+	encryptCmd.MarkFlagsMutuallyExclusive("recursive", "file-list")
 
 	rootCmd.AddCommand(encryptCmd)
 }
@@ -27,18 +45,39 @@ var encrypt_serverAddress string
 var encrypt_inputPath string
 var encrypt_outputPath string
 var encrypt_overwrite bool
+var encrypt_shredInput bool
 var encrypt_verbose bool
 var encrypt_quiet bool
 var encrypt_nonInteractive bool
+var encrypt_group string
+var encrypt_keyId string
+var encrypt_recursive bool
+var encrypt_files []string
+var encrypt_fileList string
+var encrypt_outputDir string
+var encrypt_jobs int
+var encrypt_summary string
+var encrypt_sharedKey bool
 
 var encryptCmd = &cobra.Command{
 	Use:   "encrypt",
 	Short: "Encrypt a file",
-	Long:  `Encrypt contents of a given file, writing the output to another specified file.`,
-	Args:  cobra.ExactArgs(0),
+	Long: `Encrypt contents of a given file, or of a whole directory with --recursive, writing the output to another specified file.
+With --files or --file-list, encrypt many files at once with the same password.`,
+	Args: cobra.ExactArgs(0),
 	Run: func(cmd *cobra.Command, args []string) {
-		if err := promptForEncryptPasswordIfEmpty(&encrypt_password, encrypt_nonInteractive); err != nil {
-			fmt.Println(err)
+		generatedPassword, err := promptForEncryptPasswordIfEmpty(&encrypt_password, encrypt_nonInteractive)
+		if err != nil {
+			output.Report("encrypt", nil, invalidInput(err))
+			return
+		}
+
+		if len(encrypt_files) > 0 || encrypt_fileList != "" {
+			encryptBatch(generatedPassword)
+			return
+		}
+		if encrypt_outputDir != "" || encrypt_summary != "" || encrypt_sharedKey {
+			output.Report("encrypt", nil, invalidInput(fmt.Errorf("--output-dir, --summary and --shared-key require --files or --file-list")))
 			return
 		}
 
@@ -49,18 +88,52 @@ var encryptCmd = &cobra.Command{
 			encrypt_expiresIn,
 			encrypt_serverAddress,
 			encrypt_overwrite,
+			encrypt_shredInput,
 			encrypt_verbose,
 			encrypt_quiet,
+			encrypt_keyId,
+			encrypt_group,
+			encrypt_recursive,
 		)
 		if err != nil {
-			fmt.Println(err)
+			output.Report("encrypt", nil, invalidInput(err))
 			return
 		}
 
-		err = commands.Encrypt(*input)
-		if err != nil {
-			fmt.Println(err)
-			return
+		result, err := commands.Encrypt(*input)
+		if result != nil {
+			result.GeneratedPassword = generatedPassword
 		}
+		output.Report("encrypt", result, err)
 	},
 }
+
+func encryptBatch(generatedPassword string) {
+	batch, err := commands.CreateBatchInput(encrypt_files, encrypt_fileList, encrypt_outputDir, encrypt_jobs, encrypt_summary)
+	if err != nil {
+		output.Report("encrypt", nil, invalidInput(err))
+		return
+	}
+
+	input, err := commands.CreateEncryptOptions(
+		encrypt_password,
+		encrypt_expiresIn,
+		encrypt_serverAddress,
+		encrypt_overwrite,
+		encrypt_shredInput,
+		encrypt_verbose,
+		encrypt_quiet,
+		encrypt_keyId,
+		encrypt_group,
+	)
+	if err != nil {
+		output.Report("encrypt", nil, invalidInput(err))
+		return
+	}
+
+	summary, err := commands.EncryptBatch(*input, *batch, encrypt_sharedKey)
+	if summary != nil {
+		summary.GeneratedPassword = generatedPassword
+	}
+	output.Report("encrypt", summary, err)
+}
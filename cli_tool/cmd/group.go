@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"Forgetti/commands"
+	"Forgetti/output"
+
+	"github.com/spf13/cobra"
+)
+
+var groupDestroy_serverAddress string
+var groupDestroy_verbose bool
+
+func init() {
+	groupDestroyCmd.Flags().StringVarP(&groupDestroy_serverAddress, "server-address", "s", "", "The address of the server the key group belongs to")
+	groupDestroyCmd.Flags().BoolVarP(&groupDestroy_verbose, "verbose", "v", false, "Verbose output")
+
+	groupCmd.AddCommand(groupListCmd)
+	groupCmd.AddCommand(groupDestroyCmd)
+	rootCmd.AddCommand(groupCmd)
+}
+
+var groupCmd = &cobra.Command{
+	Use:   "group",
+	Short: "Manage key groups",
+	Long: `Key groups share one server key among many files, see 'encrypt --group'.
+Expiring or destroying the key of a group makes all of its files unreadable.`,
+}
+
+var groupListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the key groups of this machine",
+	Args:  cobra.ExactArgs(0),
+	Run: func(cmd *cobra.Command, args []string) {
+		result, err := commands.ListGroups()
+		output.Report("group list", result, err)
+	},
+}
+
+var groupDestroyCmd = &cobra.Command{
+	Use:   "destroy <name>",
+	Short: "Destroy the key of a group before it expires",
+	Long:  `Destroy the key of a group on the server, so that none of the files encrypted with it can be decrypted anymore. Requires the API token that created the group.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		input, err := commands.CreateDestroyGroupInput(args[0], groupDestroy_serverAddress, groupDestroy_verbose)
+		if err != nil {
+			output.Report("group destroy", nil, invalidInput(err))
+			return
+		}
+
+		result, err := commands.DestroyGroup(*input)
+		output.Report("group destroy", result, err)
+	},
+}
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"Forgetti/commands"
+	"Forgetti/output"
+
+	"github.com/spf13/cobra"
+)
+
+var list_expiringWithin string
+var list_expired bool
+
+func init() {
+	listCmd.Flags().StringVar(&list_expiringWithin, "expiring-within", "", "Only list files that expire within this duration (<number><unit> where unit is y/mo/w/d/h/min/s, e.g. 2d)")
+	listCmd.Flags().BoolVar(&list_expired, "expired", false, "Only list files whose key has expired")
+
+	listCmd.MarkFlagsMutuallyExclusive("expiring-within", "expired")
+
+	rootCmd.AddCommand(listCmd)
+}
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the encrypted files of this machine, the first to expire first",
+	Long: `List the files encrypted, rekeyed or retargeted on this machine, sorted by the time until their key expires.
+Files that were moved or encrypted elsewhere are added by 'scan'. Files that no longer exist at their path are marked
+as missing.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		input, err := commands.CreateListInput(list_expiringWithin, list_expired)
+		if err != nil {
+			output.Report("list", nil, invalidInput(err))
+			return
+		}
+
+		result, err := commands.List(*input)
+		output.Report("list", result, err)
+	},
+}
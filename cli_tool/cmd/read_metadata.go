@@ -2,15 +2,23 @@ package cmd
 
 import (
 	"Forgetti/commands"
-	"fmt"
+	"Forgetti/output"
 
 	"github.com/spf13/cobra"
 )
 
 var readMetadata_inputPath string
+var readMetadata_listEntries bool
+var readMetadata_password string
+var readMetadata_serverAddress string
+var readMetadata_nonInteractive bool
 
 func init() {
 	readMetadataCmd.Flags().StringVarP(&readMetadata_inputPath, "input", "i", "", "The path to the encrypted file")
+	readMetadataCmd.Flags().BoolVarP(&readMetadata_listEntries, "list-entries", "l", false, "List the entries of an encrypted directory (decrypts it, the entries are not stored in the clear)")
+	readMetadataCmd.Flags().StringVarP(&readMetadata_password, "password", "p", "", "The password to decrypt the file with, for --list-entries")
+	readMetadataCmd.Flags().StringVarP(&readMetadata_serverAddress, "server-address", "s", "", "The address of the server to decrypt the file with, for --list-entries")
+	readMetadataCmd.Flags().BoolVarP(&readMetadata_nonInteractive, "non-interactive", "n", false, "Non-interactive mode - no prompts will be shown")
 
 	rootCmd.AddCommand(readMetadataCmd)
 }
@@ -18,18 +26,22 @@ func init() {
 var readMetadataCmd = &cobra.Command{
 	Use:   "metadata",
 	Short: "Read metadata from an encrypted file",
-	Long:  `Read metadata from an encrypted file.`,
+	Long:  `Read metadata from an encrypted file. The entries of an encrypted directory are only listed after decrypting it.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		input, err := commands.CreateReadMetadataInput(readMetadata_inputPath)
-		if err != nil {
-			fmt.Println(err)
-			return
+		if readMetadata_listEntries {
+			if err := promptForDecryptPasswordIfEmpty(&readMetadata_password, readMetadata_nonInteractive); err != nil {
+				output.Report("metadata", nil, invalidInput(err))
+				return
+			}
 		}
 
-		err = commands.ReadMetadata(*input)
+		input, err := commands.CreateReadMetadataInput(readMetadata_inputPath, readMetadata_listEntries, readMetadata_password, readMetadata_serverAddress)
 		if err != nil {
-			fmt.Println(err)
+			output.Report("metadata", nil, invalidInput(err))
 			return
 		}
+
+		result, err := commands.ReadMetadata(*input)
+		output.Report("metadata", result, err)
 	},
-}
\ No newline at end of file
+}
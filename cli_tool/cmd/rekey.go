@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"Forgetti/commands"
+	"Forgetti/output"
+
+	"github.com/spf13/cobra"
+)
+
+var rekey_inputPath string
+var rekey_password string
+var rekey_newPassword string
+var rekey_changePassword bool
+var rekey_expiresIn string
+var rekey_serverAddress string
+var rekey_upgradeAlgVersion bool
+var rekey_destroyOldKey bool
+var rekey_verbose bool
+var rekey_quiet bool
+var rekey_nonInteractive bool
+
+func init() {
+	rekeyCmd.Flags().StringVarP(&rekey_inputPath, "input", "i", "", "The path to the encrypted file, which is replaced")
+	rekeyCmd.Flags().StringVarP(&rekey_password, "password", "p", "", "The current password of the file")
+	rekeyCmd.Flags().StringVar(&rekey_newPassword, "new-password", "", "A new password for the file")
+	rekeyCmd.Flags().BoolVar(&rekey_changePassword, "change-password", false, "Ask for a new password for the file, or generate one in non-interactive mode")
+	rekeyCmd.Flags().StringVarP(&rekey_expiresIn, "expires-in", "e", "", "The time after which the new key will expire (format: 1y/2/mo/3w/4d/5h/6min, default: the expiration of the old key)")
+	rekeyCmd.Flags().StringVarP(&rekey_serverAddress, "server-address", "s", "", "The address of the server of the new key (default: the server of the file)")
+	rekeyCmd.Flags().BoolVar(&rekey_upgradeAlgVersion, "upgrade-alg", false, "Use the current algorithm version instead of the version of the file")
+	rekeyCmd.Flags().BoolVar(&rekey_destroyOldKey, "destroy-old-key", false, "Destroy the old key on its server after the file was replaced (requires the API token that created it)")
+	rekeyCmd.Flags().BoolVarP(&rekey_verbose, "verbose", "v", false, "Verbose output")
+	rekeyCmd.Flags().BoolVarP(&rekey_quiet, "quiet", "q", false, "Quiet output")
+	rekeyCmd.Flags().BoolVarP(&rekey_nonInteractive, "non-interactive", "n", false, "Non-interactive mode - no prompts will be shown")
+	rekeyCmd.MarkFlagsMutuallyExclusive("new-password", "change-password")
+
+	rootCmd.AddCommand(rekeyCmd)
+}
+
+var rekeyCmd = &cobra.Command{
+	Use:   "rekey",
+	Short: "Encrypt a file with a new server key",
+	Long: `Encrypt a file with a new server key, for example to change its expiration or move it to another server.
+The file is decrypted in memory and replaced only once the new version is complete. The password and the algorithm
+version can be changed in the same step.`,
+	Args: cobra.ExactArgs(0),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := promptForDecryptPasswordIfEmpty(&rekey_password, rekey_nonInteractive); err != nil {
+			output.Report("rekey", nil, invalidInput(err))
+			return
+		}
+
+		var generatedPassword string
+		if rekey_changePassword {
+			var err error
+			generatedPassword, err = promptForEncryptPasswordIfEmpty(&rekey_newPassword, rekey_nonInteractive)
+			if err != nil {
+				output.Report("rekey", nil, invalidInput(err))
+				return
+			}
+		}
+
+		input, err := commands.CreateRekeyInput(
+			rekey_inputPath,
+			rekey_password,
+			rekey_newPassword,
+			rekey_expiresIn,
+			rekey_serverAddress,
+			rekey_upgradeAlgVersion,
+			rekey_destroyOldKey,
+			rekey_verbose,
+			rekey_quiet,
+		)
+		if err != nil {
+			output.Report("rekey", nil, invalidInput(err))
+			return
+		}
+
+		result, err := commands.Rekey(*input)
+		if result != nil {
+			result.GeneratedPassword = generatedPassword
+		}
+		output.Report("rekey", result, err)
+	},
+}
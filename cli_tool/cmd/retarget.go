@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"Forgetti/commands"
+	"Forgetti/output"
+
+	"github.com/spf13/cobra"
+)
+
+var retarget_fileList string
+var retarget_from string
+var retarget_to string
+var retarget_dryRun bool
+var retarget_verbose bool
+var retarget_quiet bool
+
+func init() {
+	retargetCmd.Flags().StringVar(&retarget_fileList, "file-list", "", "A file listing the files to retarget, one path per line")
+	retargetCmd.Flags().StringVar(&retarget_from, "from", "", "Only retarget files of this server")
+	retargetCmd.Flags().StringVar(&retarget_to, "to", "", "The new server address (default: the address from the server aliases of the config)")
+	retargetCmd.Flags().BoolVar(&retarget_dryRun, "dry-run", false, "Only show which files would change")
+	retargetCmd.Flags().BoolVarP(&retarget_verbose, "verbose", "v", false, "Verbose output")
+	retargetCmd.Flags().BoolVarP(&retarget_quiet, "quiet", "q", false, "Quiet output - only errors will be shown")
+
+	retargetCmd.MarkFlagsMutuallyExclusive("verbose", "quiet")
+
+	rootCmd.AddCommand(retargetCmd)
+}
+
+var retargetCmd = &cobra.Command{
+	Use:   "retarget [files...]",
+	Short: "Change the server address stored in encrypted files",
+	Long: `Change the server address stored in encrypted files, after their server moved. Arguments may be glob patterns.
+Without --to, files get the address their server moved to according to 'config alias'. The key and content of the files
+are not changed, so no password is needed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		input, err := commands.CreateRetargetInput(args, retarget_fileList, retarget_from, retarget_to, retarget_dryRun, retarget_verbose, retarget_quiet)
+		if err != nil {
+			output.Report("retarget", nil, invalidInput(err))
+			return
+		}
+
+		result, err := commands.Retarget(*input)
+		output.Report("retarget", result, err)
+	},
+}
@@ -1,16 +1,34 @@
 package cmd
 
 import (
+	"Forgetti/config"
+	"Forgetti/models"
+	"Forgetti/output"
 	"fmt"
 	"os"
 
 	"github.com/spf13/cobra"
 )
 
+var root_output string
+var root_profile string
+
+// legacyOutputPathCommands had an --output flag for the output file before it was renamed to --output-file
+var legacyOutputPathCommands = map[*cobra.Command]bool{}
+
 var rootCmd = &cobra.Command{
 	Use:   "forgetti",
 	Short: "Forgetti CLI tool",
 	Long:  `CLI tool that encrypts and data and sometimes decrypts it too.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		format, err := parseOutputFlag(cmd)
+		if err != nil {
+			return err
+		}
+		output.SetFormat(format)
+		config.SetProfileOverride(root_profile)
+		return nil
+	},
 	Run: func(cmd *cobra.Command, args []string) {
 		fmt.Println("Run `forgetti --help` for a list of available commands.")
 	},
@@ -18,10 +36,47 @@ var rootCmd = &cobra.Command{
 
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
+		// Errors of flags are found before the output format is set
+		if format, formatErr := output.ParseFormat(root_output); formatErr == nil {
+			output.SetFormat(format)
+		}
+		if output.IsJson() {
+			output.Report("", nil, invalidInput(err))
+		} else {
+			fmt.Println(err)
+		}
 		os.Exit(1)
 	}
 }
 
 func init() {
+	rootCmd.PersistentFlags().StringVar(&root_profile, "profile", "", "The config profile to use, instead of the current profile (see 'config use')")
+	rootCmd.PersistentFlags().StringVar(&root_output, "output", string(output.FormatText), "Output format: 'text', or 'json' for one JSON result object on stdout, with logs on stderr")
+}
+
+// acceptLegacyOutputPath keeps --output working as the output file of a command whose flag was renamed to
+// --output-file, for values that are not an output format
+func acceptLegacyOutputPath(cmd *cobra.Command) {
+	legacyOutputPathCommands[cmd] = true
+}
+
+func parseOutputFlag(cmd *cobra.Command) (output.Format, error) {
+	format, err := output.ParseFormat(root_output)
+	if err == nil || !legacyOutputPathCommands[cmd] {
+		return format, err
+	}
+
+	if cmd.Flags().Changed("output-file") || cmd.Flags().Changed("output-dir") {
+		return "", fmt.Errorf("%w; the output file is set with --output-file", err)
+	}
+	if err := cmd.Flags().Set("output-file", root_output); err != nil {
+		return "", err
+	}
+	fmt.Fprintf(os.Stderr, "Warning: --output for the output file is deprecated and will be removed, use --output-file '%s' instead\n", root_output)
+	return output.FormatText, nil
+}
+
+// invalidInput marks errors of the flags and arguments of a command
+func invalidInput(err error) error {
+	return models.WithCode(models.ErrorCodeInvalidInput, err)
 }
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"Forgetti/output"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+// newOutputCommand returns a command with the output file flags of encrypt and decrypt
+func newOutputCommand(t *testing.T, legacy bool) *cobra.Command {
+	t.Helper()
+
+	cmd := &cobra.Command{Use: "test"}
+	cmd.Flags().StringP("output-file", "o", "", "")
+	cmd.Flags().String("output-dir", "", "")
+	if legacy {
+		acceptLegacyOutputPath(cmd)
+		t.Cleanup(func() { delete(legacyOutputPathCommands, cmd) })
+	}
+	return cmd
+}
+
+func useOutputFlag(t *testing.T, value string) {
+	t.Helper()
+
+	previous := root_output
+	root_output = value
+	t.Cleanup(func() { root_output = previous })
+}
+
+func TestParseOutputFlagFormats(t *testing.T) {
+	for _, legacy := range []bool{false, true} {
+		cmd := newOutputCommand(t, legacy)
+		useOutputFlag(t, "json")
+
+		format, err := parseOutputFlag(cmd)
+		if err != nil || format != output.FormatJson {
+			t.Errorf("expected json format, got %s, %v", format, err)
+		}
+		if outputFile, _ := cmd.Flags().GetString("output-file"); outputFile != "" {
+			t.Errorf("expected no output file, got '%s'", outputFile)
+		}
+	}
+}
+
+func TestParseOutputFlagLegacyOutputPath(t *testing.T) {
+	cmd := newOutputCommand(t, true)
+	useOutputFlag(t, "out.enc")
+
+	format, err := parseOutputFlag(cmd)
+	if err != nil || format != output.FormatText {
+		t.Fatalf("expected text format, got %s, %v", format, err)
+	}
+	if outputFile, _ := cmd.Flags().GetString("output-file"); outputFile != "out.enc" {
+		t.Errorf("expected the output file out.enc, got '%s'", outputFile)
+	}
+}
+
+func TestParseOutputFlagRejectsOutputPath(t *testing.T) {
+	useOutputFlag(t, "out.enc")
+
+	// Commands that never had an --output flag for the output file
+	if _, err := parseOutputFlag(newOutputCommand(t, false)); err == nil || !strings.Contains(err.Error(), "invalid output format") {
+		t.Errorf("expected an invalid output format error, got %v", err)
+	}
+
+	// The output file is set twice
+	for _, flag := range []string{"output-file", "output-dir"} {
+		cmd := newOutputCommand(t, true)
+		cmd.Flags().Set(flag, "other")
+		if _, err := parseOutputFlag(cmd); err == nil || !strings.Contains(err.Error(), "--output-file") {
+			t.Errorf("%s: expected an error naming --output-file, got %v", flag, err)
+		}
+	}
+}
+
+func TestLegacyOutputPathCommands(t *testing.T) {
+	for _, cmd := range []*cobra.Command{encryptCmd, decryptCmd} {
+		if !legacyOutputPathCommands[cmd] {
+			t.Errorf("expected %s to accept an output file for --output", cmd.Name())
+		}
+	}
+}
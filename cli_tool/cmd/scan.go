@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"Forgetti/commands"
+	"Forgetti/output"
+
+	"github.com/spf13/cobra"
+)
+
+var scan_verbose bool
+var scan_quiet bool
+
+func init() {
+	scanCmd.Flags().BoolVarP(&scan_verbose, "verbose", "v", false, "Verbose output")
+	scanCmd.Flags().BoolVarP(&scan_quiet, "quiet", "q", false, "Quiet output - only errors will be shown")
+
+	scanCmd.MarkFlagsMutuallyExclusive("verbose", "quiet")
+
+	rootCmd.AddCommand(scanCmd)
+}
+
+var scanCmd = &cobra.Command{
+	Use:   "scan <directories...>",
+	Short: "Rebuild the inventory of encrypted files from the files in directories",
+	Long: `Search the directories for ".forgetti" files and add them to the inventory shown by 'list', reading their key and
+expiration from their headers. Files below the directories that are in the inventory but no longer exist are removed
+from it. No password or server is needed.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		input, err := commands.CreateScanInput(args, scan_verbose, scan_quiet)
+		if err != nil {
+			output.Report("scan", nil, invalidInput(err))
+			return
+		}
+
+		result, err := commands.Scan(*input)
+		output.Report("scan", result, err)
+	},
+}
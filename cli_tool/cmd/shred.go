@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"Forgetti/commands"
+	"Forgetti/output"
+	"Forgetti/shred"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var shred_recursive bool
+var shred_passes int
+var shred_yes bool
+var shred_verbose bool
+var shred_quiet bool
+
+func init() {
+	shredCmd.Flags().BoolVarP(&shred_recursive, "recursive", "r", false, "Shred directories with all of their files")
+	shredCmd.Flags().IntVar(&shred_passes, "passes", shred.DefaultPasses, "Number of times each file is overwritten with random data")
+	shredCmd.Flags().BoolVarP(&shred_yes, "yes", "y", false, "Don't ask for confirmation")
+	shredCmd.Flags().BoolVarP(&shred_verbose, "verbose", "v", false, "Verbose output")
+	shredCmd.Flags().BoolVarP(&shred_quiet, "quiet", "q", false, "Quiet output")
+
+	rootCmd.AddCommand(shredCmd)
+}
+
+var shredCmd = &cobra.Command{
+	Use:   "shred <files...>",
+	Short: "Overwrite files with random data and remove them",
+	Long: `Overwrite files with random data several times, syncing each pass to the disk, then truncate and remove them.
+
+` + shred.Warning,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		input, err := commands.CreateShredInput(args, shred_recursive, shred_passes, shred_verbose, shred_quiet)
+		if err != nil {
+			output.Report("shred", nil, invalidInput(err))
+			return
+		}
+
+		if !shred_yes {
+			if err := confirmShred(input.Paths); err != nil {
+				output.Report("shred", nil, invalidInput(err))
+				return
+			}
+		}
+
+		result, err := commands.Shred(*input)
+		output.Report("shred", result, err)
+	},
+}
+
+func confirmShred(paths []string) error {
+	fmt.Fprintf(output.Console(), "Shred %s? This can't be undone. [y/N]: ", strings.Join(paths, ", "))
+
+	var answer string
+	if _, err := fmt.Scanln(&answer); err != nil {
+		return fmt.Errorf("not confirmed, use --yes to shred without confirmation")
+	}
+
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	if answer != "y" && answer != "yes" {
+		return fmt.Errorf("not confirmed")
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"Forgetti/output"
 	"crypto/rand"
 	"fmt"
 	"math/big"
@@ -14,9 +15,9 @@ const passwordEnv = "FORGETTI_PASSWORD"
 const generatedPasswordLength = 16
 
 func promptForPassword(prompt string) (string, error) {
-	fmt.Print(prompt)
+	fmt.Fprint(output.Console(), prompt)
 	password, err := term.ReadPassword(int(os.Stdin.Fd()))
-	fmt.Println()
+	fmt.Fprintln(output.Console())
 	if err != nil {
 		return "", fmt.Errorf("failed to read password: %v", err)
 	}
@@ -39,7 +40,7 @@ func generateRandomPassword(length int) (string, error) {
 }
 
 func promptForChoice() (bool, error) {
-	fmt.Print("Do you want to (p)rovide a password or (g)enerate a random one? [p/g]: ")
+	fmt.Fprint(output.Console(), "Do you want to (p)rovide a password or (g)enerate a random one? [p/g]: ")
 
 	var choice string
 	_, err := fmt.Scanln(&choice)
@@ -60,18 +61,19 @@ func promptForChoice() (bool, error) {
 
 func getFomEnv(password *string) {
 	if envPassword := os.Getenv(passwordEnv); envPassword != "" {
-		fmt.Printf("Using password from environment variable %s\n", passwordEnv)
+		fmt.Fprintf(output.Console(), "Using password from environment variable %s\n", passwordEnv)
 		*password = envPassword
 	}
 }
 
-func promptForEncryptPasswordIfEmpty(password *string, nonInteractive bool) error {
+// promptForEncryptPasswordIfEmpty returns the password if it was generated
+func promptForEncryptPasswordIfEmpty(password *string, nonInteractive bool) (string, error) {
 	if *password != "" {
-		return nil
+		return "", nil
 	}
 
 	if getFomEnv(password); *password != "" {
-		return nil
+		return "", nil
 	}
 
 	// Ask user what they want to do - assume generation if non-interactive
@@ -82,34 +84,35 @@ func promptForEncryptPasswordIfEmpty(password *string, nonInteractive bool) erro
 	} else {	
 		generateRandom, err = promptForChoice()
 		if err != nil {
-			return err
+			return "", err
 		}
 	}
 
 	if generateRandom {
 		randomPassword, err := generateRandomPassword(generatedPasswordLength)
 		if err != nil {
-			return err
+			return "", err
 		}
 		*password = randomPassword
-		fmt.Printf("Generated random password: %s\n", randomPassword)
+		fmt.Fprintf(output.Console(), "Generated random password: %s\n", randomPassword)
+		return randomPassword, nil
 	} else {
 		*password, err = promptForPassword("Enter password: ")
 		if err != nil {
-			return err
+			return "", err
 		}
 
 		confirmPassword, err := promptForPassword("Confirm password: ")
 		if err != nil {
-			return err
+			return "", err
 		}
 
 		if *password != confirmPassword {
-			return fmt.Errorf("passwords do not match")
+			return "", fmt.Errorf("passwords do not match")
 		}
 	}
 
-	return nil
+	return "", nil
 }
 
 func promptForDecryptPasswordIfEmpty(password *string, nonInteractive bool) error {
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"Forgetti/commands"
+	"Forgetti/output"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var verify_inputPath string
+var verify_recursive bool
+var verify_password string
+var verify_serverAddress string
+var verify_jobs int
+var verify_verbose bool
+var verify_quiet bool
+var verify_nonInteractive bool
+
+func init() {
+	verifyCmd.Flags().StringVarP(&verify_inputPath, "input", "i", "", "The path to the encrypted file, or to a directory with --recursive")
+	verifyCmd.Flags().BoolVarP(&verify_recursive, "recursive", "r", false, "Verify all .forgetti files below the input directory")
+	verifyCmd.Flags().StringVarP(&verify_password, "password", "p", "", "The password of the files")
+	verifyCmd.Flags().StringVarP(&verify_serverAddress, "server-address", "s", "", "The address of the server to verify the files with (default: the server of each file)")
+	verifyCmd.Flags().IntVarP(&verify_jobs, "jobs", "j", 4, "Number of files verified at the same time")
+	verifyCmd.Flags().BoolVarP(&verify_verbose, "verbose", "v", false, "Verbose output")
+	verifyCmd.Flags().BoolVarP(&verify_quiet, "quiet", "q", false, "Quiet output")
+	verifyCmd.Flags().BoolVarP(&verify_nonInteractive, "non-interactive", "n", false, "Non-interactive mode - no prompts will be shown")
+
+	rootCmd.AddCommand(verifyCmd)
+}
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check that encrypted files can still be decrypted",
+	Long: `Check that encrypted files can still be decrypted, without writing their content anywhere.
+The key of each file is requested from its server and the content is decrypted and authenticated in memory.
+
+Exit codes (the highest of all files):
+  0  all files can be decrypted
+  1  a file could not be checked, for example because the server was unreachable
+  2  wrong password, or the content was modified (authenticated encryption can't tell these apart)
+  3  the key expired or was destroyed
+  4  the file is corrupt`,
+	Args: cobra.ExactArgs(0),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := promptForDecryptPasswordIfEmpty(&verify_password, verify_nonInteractive); err != nil {
+			output.Report("verify", nil, invalidInput(err))
+			os.Exit(commands.VerifyExitError)
+		}
+
+		input, err := commands.CreateVerifyInput(
+			verify_inputPath,
+			verify_recursive,
+			verify_password,
+			verify_serverAddress,
+			verify_jobs,
+			verify_verbose,
+			verify_quiet,
+		)
+		if err != nil {
+			output.Report("verify", nil, invalidInput(err))
+			os.Exit(commands.VerifyExitError)
+		}
+
+		summary, err := commands.Verify(*input)
+		output.Report("verify", summary, err)
+		os.Exit(commands.VerifyExitCode(summary, err))
+	},
+}
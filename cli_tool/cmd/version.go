@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"Forgetti/output"
 	"fmt"
 
 	"github.com/spf13/cobra"
@@ -22,6 +23,17 @@ var versionCmd = &cobra.Command{
 	Short: "Print the version number",
 	Long:  `All software has versions. This is Forgetti's.`,
 	Run: func(cmd *cobra.Command, args []string) {
+		if output.IsJson() {
+			output.Report("version", versionResult{Version: Version, Commit: Commit, BuildDate: BuildDate}, nil)
+			return
+		}
+
 		fmt.Printf("Forgetti version %s (commit: %s, built: %s)\n", Version, Commit, BuildDate)
 	},
+}
+
+type versionResult struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
 } 
\ No newline at end of file
@@ -0,0 +1,399 @@
+package commands
+
+import (
+	"Forgetti/interaction"
+	"Forgetti/io"
+	"Forgetti/models"
+	"Forgetti/output"
+	"Forgetti/shred"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"forgetti-common/logging"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const maxBatchJobs = 64
+
+// BatchInput lists the files of a batch encryption or decryption
+type BatchInput struct {
+	Files []string
+	// OutputDir receives all outputs if set, otherwise each output is written next to its input
+	OutputDir string
+	Jobs      int
+	// SummaryPath is where the JSON summary is written, "-" for stdout and "" for no summary
+	SummaryPath string
+}
+
+type BatchFileResult struct {
+	Input      string     `json:"input"`
+	Output     string     `json:"output,omitempty"`
+	KeyId      string     `json:"key_id,omitempty"`
+	Expiration *time.Time `json:"expiration,omitempty"`
+	// InputShredded is set when encrypting with --shred-input
+	InputShredded bool   `json:"input_shredded,omitempty"`
+	Error         string `json:"error,omitempty"`
+	ErrorCode     string `json:"error_code,omitempty"`
+}
+
+func (r *BatchFileResult) fail(err error) BatchFileResult {
+	r.Error = err.Error()
+	r.ErrorCode = models.ErrorCode(err)
+	return *r
+}
+
+type BatchSummary struct {
+	Operation  string            `json:"operation"`
+	StartedAt  time.Time         `json:"started_at"`
+	FinishedAt time.Time         `json:"finished_at"`
+	Succeeded  int               `json:"succeeded"`
+	Failed     int               `json:"failed"`
+	Files      []BatchFileResult `json:"files"`
+	// GeneratedPassword is set if the password was generated for this encryption. It is never written to the summary
+	// file.
+	GeneratedPassword string `json:"generated_password,omitempty"`
+}
+
+// CreateBatchInput checks the batch settings, with the files collected by collectFiles
+func CreateBatchInput(patterns []string, fileList string, outputDir string, jobs int, summaryPath string) (*BatchInput, error) {
+	files, err := collectFiles(patterns, fileList)
+	if err != nil {
+		return nil, err
+	}
+
+	if jobs < 1 || jobs > maxBatchJobs {
+		return nil, fmt.Errorf("number of jobs must be between 1 and %d", maxBatchJobs)
+	}
+
+	if summaryPath == "-" && output.IsJson() {
+		return nil, fmt.Errorf("the summary is the result of the command with JSON output, '--summary -' can't be used")
+	}
+
+	if outputDir != "" {
+		info, err := os.Stat(outputDir)
+		if err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("output directory does not exist: '%s'", outputDir)
+		}
+	}
+
+	return &BatchInput{
+		Files:       files,
+		OutputDir:   outputDir,
+		Jobs:        jobs,
+		SummaryPath: summaryPath,
+	}, nil
+}
+
+// collectFiles expands the glob patterns and reads the file list (one path per line, "#" starts a comment). Files given
+// more than once are returned once.
+func collectFiles(patterns []string, fileList string) ([]string, error) {
+	var paths []string
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match '%s'", pattern)
+		}
+		paths = append(paths, matches...)
+	}
+
+	if fileList != "" {
+		listed, err := readFileList(fileList)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, listed...)
+	}
+
+	files := make([]string, 0, len(paths))
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		path = filepath.Clean(path)
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		files = append(files, path)
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no files to process")
+	}
+
+	return files, nil
+}
+
+func readFileList(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file list '%s': %w", path, err)
+	}
+	defer file.Close()
+
+	var paths []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		paths = append(paths, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read file list '%s': %w", path, err)
+	}
+
+	return paths, nil
+}
+
+// outputPaths returns the output path of every file, failing if two files would be written to the same path
+func (batch BatchInput) outputPaths(defaultOutputPath func(inputPath string) string) ([]string, error) {
+	outputs := make([]string, len(batch.Files))
+	inputsByOutput := make(map[string]string)
+	for i, file := range batch.Files {
+		output := defaultOutputPath(file)
+		if batch.OutputDir != "" {
+			output = filepath.Join(batch.OutputDir, filepath.Base(output))
+		}
+
+		if other, ok := inputsByOutput[output]; ok {
+			return nil, fmt.Errorf("'%s' and '%s' would both be written to '%s'", other, file, output)
+		}
+		inputsByOutput[output] = file
+		outputs[i] = output
+	}
+
+	return outputs, nil
+}
+
+// EncryptBatch encrypts every file of the batch. With sharedKey, or a key group or key id, all files are encrypted
+// with one server key, otherwise a new key is created for each file.
+func EncryptBatch(input EncryptInput, batch BatchInput, sharedKey bool) (*BatchSummary, error) {
+	logger := setUpBatchLogging(input.LogLevel, "encrypt.batch")
+	summary := BatchSummary{Operation: "encrypt", StartedAt: time.Now()}
+
+	outputs, err := batch.outputPaths(func(inputPath string) string { return inputPath + ".forgetti" })
+	if err != nil {
+		return nil, err
+	}
+
+	if input.ShredInput {
+		logger.Warning(shred.Warning)
+	}
+
+	var remoteKey *interaction.KeyGenerationResult
+	if sharedKey || input.KeyId != "" || input.Group != "" {
+		remoteKey, err = getRemoteKey(input)
+		if err != nil {
+			return nil, err
+		}
+		logger.Info("Encrypting %d files with key '%s', expiring at %s", len(batch.Files), remoteKey.Metadata.KeyId, remoteKey.Metadata.Expiration.String())
+	} else {
+		logger.Info("Encrypting %d files with a new key for each file", len(batch.Files))
+	}
+
+	// Each worker sets only the metadata of its own file, the inventory is saved once after the batch
+	written := make([]*models.Metadata, len(batch.Files))
+	summary.Files = runBatch(batch, func(i int, file string) BatchFileResult {
+		result := BatchFileResult{Input: file}
+
+		fileInput := input
+		if err := fileInput.setPaths(file, outputs[i], false); err != nil {
+			return result.fail(err)
+		}
+
+		content, err := readEncryptInput(fileInput)
+		if err != nil {
+			return result.fail(err)
+		}
+
+		fileKey := remoteKey
+		if fileKey == nil {
+			fileKey, err = getRemoteKey(fileInput)
+			if err != nil {
+				return result.fail(err)
+			}
+		}
+
+		encrypted, err := encryptFile(fileInput, content, fileKey)
+		if encrypted != nil {
+			written[i] = &fileKey.Metadata
+			result.Output = encrypted.Output
+			result.KeyId = encrypted.KeyId
+			result.Expiration = &encrypted.Expiration
+			result.InputShredded = encrypted.InputShredded
+		}
+		if err != nil {
+			return result.fail(err)
+		}
+		return result
+	}, logger)
+
+	files := make(map[string]models.Metadata)
+	for i, metadata := range written {
+		if metadata != nil {
+			files[summary.Files[i].Output] = *metadata
+		}
+	}
+	recordInInventory(files)
+
+	return &summary, finishBatch(&summary, batch, logger)
+}
+
+// DecryptBatch decrypts every file of the batch with the same password
+func DecryptBatch(input DecryptInput, batch BatchInput) (*BatchSummary, error) {
+	logger := setUpBatchLogging(input.LogLevel, "decrypt.batch")
+	summary := BatchSummary{Operation: "decrypt", StartedAt: time.Now()}
+
+	outputs, err := batch.outputPaths(defaultDecryptOutputPath)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Decrypting %d files", len(batch.Files))
+	keyHashes := newKeyHashCache()
+
+	summary.Files = runBatch(batch, func(i int, file string) BatchFileResult {
+		result := BatchFileResult{Input: file}
+
+		fileInput := input
+		if err := fileInput.setPaths(file, outputs[i]); err != nil {
+			return result.fail(err)
+		}
+
+		contentWithMetadata, err := io.ReadContentWithMetadataFromFile(file)
+		if err != nil {
+			return result.fail(err)
+		}
+		result.KeyId = contentWithMetadata.Metadata.KeyId
+		result.Expiration = &contentWithMetadata.Metadata.Expiration
+
+		if _, err := decryptFile(fileInput, contentWithMetadata, keyHashes.get); err != nil {
+			return result.fail(err)
+		}
+
+		result.Output = fileInput.OutputPath
+		return result
+	}, logger)
+
+	return &summary, finishBatch(&summary, batch, logger)
+}
+
+// keyHashCache asks the server for the encrypted key hash of each key only once. The hash depends only on the key and
+// the password, and files sharing a key would otherwise run into the rate limit of the key.
+type keyHashCache struct {
+	mutex   sync.Mutex
+	entries map[string]*keyHashEntry
+}
+
+type keyHashEntry struct {
+	once sync.Once
+	hash string
+	err  error
+}
+
+func newKeyHashCache() *keyHashCache {
+	return &keyHashCache{entries: make(map[string]*keyHashEntry)}
+}
+
+func (c *keyHashCache) get(serverAddress string, password string, metadata *models.Metadata) (string, error) {
+	cacheKey := serverAddress + " " + metadata.KeyId
+
+	c.mutex.Lock()
+	entry, ok := c.entries[cacheKey]
+	if !ok {
+		entry = &keyHashEntry{}
+		c.entries[cacheKey] = entry
+	}
+	c.mutex.Unlock()
+
+	entry.once.Do(func() {
+		entry.hash, entry.err = interaction.EncryptWithExistingKey(serverAddress, password, metadata)
+	})
+	return entry.hash, entry.err
+}
+
+// setUpBatchLogging keeps the messages about single steps of each file quiet, unless verbose output was requested.
+// Returns the logger of the batch progress, which is silenced only by quiet output.
+func setUpBatchLogging(logLevel logging.LogLevel, context string) logging.Logger {
+	globalLevel := logging.LogLevelError
+	if logLevel == logging.LogLevelVerbose {
+		globalLevel = logging.LogLevelVerbose
+	}
+	configureLogging(globalLevel)
+
+	batchLevel := logging.LogLevelInfo
+	if logLevel == logging.LogLevelError {
+		batchLevel = logging.LogLevelError
+	}
+	return logging.MakeLoggerWithLevel(context, batchLevel)
+}
+
+// runBatch processes the files with a pool of batch.Jobs workers, returning the results in the order of the files
+func runBatch(batch BatchInput, process func(i int, file string) BatchFileResult, logger logging.Logger) []BatchFileResult {
+	results := make([]BatchFileResult, len(batch.Files))
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+	for range min(batch.Jobs, len(batch.Files)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = process(i, batch.Files[i])
+				if results[i].Error != "" {
+					logger.Error("Failed '%s': %s", results[i].Input, results[i].Error)
+				} else if results[i].Output == "" {
+					logger.Info("Done '%s'", results[i].Input)
+				} else {
+					logger.Info("Done '%s' -> '%s'", results[i].Input, results[i].Output)
+				}
+			}
+		}()
+	}
+
+	for i := range batch.Files {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return results
+}
+
+func finishBatch(summary *BatchSummary, batch BatchInput, logger logging.Logger) error {
+	summary.FinishedAt = time.Now()
+	for _, result := range summary.Files {
+		if result.Error != "" {
+			summary.Failed++
+		} else {
+			summary.Succeeded++
+		}
+	}
+
+	if batch.SummaryPath != "" {
+		content, err := json.MarshalIndent(summary, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to serialize summary: %w", err)
+		}
+
+		if batch.SummaryPath == "-" {
+			fmt.Println(string(content))
+		} else if err := os.WriteFile(batch.SummaryPath, append(content, '\n'), 0644); err != nil {
+			return fmt.Errorf("failed to write summary to '%s': %w", batch.SummaryPath, err)
+		}
+	}
+
+	logger.Info("%d succeeded, %d failed (%s)", summary.Succeeded, summary.Failed, summary.FinishedAt.Sub(summary.StartedAt).Round(time.Millisecond).String())
+	if summary.Failed > 0 {
+		return models.NewCodedError(models.ErrorCodeBatchFailed, "failed to %s %d of %d files", summary.Operation, summary.Failed, len(summary.Files))
+	}
+
+	return nil
+}
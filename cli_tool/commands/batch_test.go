@@ -0,0 +1,251 @@
+package commands
+
+import (
+	"Forgetti/models"
+	"fmt"
+	"forgetti-common/logging"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeBatchInputs writes the files in the order of their names, returning their paths
+func writeBatchInputs(t *testing.T, dir string, names ...string) []string {
+	t.Helper()
+
+	var paths []string
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		writeInputFile(t, path, "content of "+name)
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+func encryptTestBatch(t *testing.T, stub *stubServer, files []string, sharedKey bool) *BatchSummary {
+	t.Helper()
+
+	input := EncryptInput{
+		Password:      testPassword,
+		Expiration:    time.Now().Add(time.Hour),
+		ServerAddress: stub.URL(),
+		AlgVersion:    models.CurrentAlgVersion(),
+		LogLevel:      logging.LogLevelError,
+	}
+	summary, err := EncryptBatch(input, BatchInput{Files: files, Jobs: 4}, sharedKey)
+	if err != nil {
+		t.Fatalf("EncryptBatch failed: %v", err)
+	}
+	return summary
+}
+
+func expectInputOrder(t *testing.T, summary *BatchSummary, files []string) {
+	t.Helper()
+
+	if len(summary.Files) != len(files) {
+		t.Fatalf("expected %d results, got %d", len(files), len(summary.Files))
+	}
+	for i, file := range files {
+		if summary.Files[i].Input != file {
+			t.Errorf("result %d: expected input '%s', got '%s'", i, file, summary.Files[i].Input)
+		}
+	}
+}
+
+func TestBatchWithSharedKey(t *testing.T) {
+	useTestConfig(t, "")
+	stub := newStubServer(t)
+	dir := t.TempDir()
+	var names []string
+	for i := range 12 {
+		names = append(names, fmt.Sprintf("%02d.txt", i))
+	}
+	files := writeBatchInputs(t, dir, names...)
+
+	summary := encryptTestBatch(t, stub, files, true)
+	expectInputOrder(t, summary, files)
+	if stub.keyCount() != 1 {
+		t.Errorf("expected a single key, got %d", stub.keyCount())
+	}
+	keyId := summary.Files[0].KeyId
+	var encrypted []string
+	for _, result := range summary.Files {
+		if result.KeyId != keyId || result.Output != result.Input+".forgetti" {
+			t.Errorf("unexpected result %+v", result)
+		}
+		encrypted = append(encrypted, result.Output)
+	}
+	if files := loadTestInventory(t).Files; len(files) != len(encrypted) {
+		t.Errorf("expected %d files in the inventory, got %d", len(encrypted), len(files))
+	}
+
+	outputDir := t.TempDir()
+	decryptSummary, err := DecryptBatch(
+		DecryptInput{Password: testPassword, LogLevel: logging.LogLevelError},
+		BatchInput{Files: encrypted, OutputDir: outputDir, Jobs: 4},
+	)
+	if err != nil {
+		t.Fatalf("DecryptBatch failed: %v", err)
+	}
+	expectInputOrder(t, decryptSummary, encrypted)
+
+	// The encrypted key hash of the shared key is requested once for all files
+	if count := stub.encryptRequestCount(keyId); count != 1 {
+		t.Errorf("expected 1 request for the key, got %d", count)
+	}
+	for i, result := range decryptSummary.Files {
+		content, err := os.ReadFile(filepath.Join(outputDir, names[i]))
+		if err != nil || result.Output != filepath.Join(outputDir, names[i]) {
+			t.Fatalf("expected the output '%s', got %+v (error: %v)", names[i], result, err)
+		}
+		if string(content) != "content of "+names[i] {
+			t.Errorf("'%s': unexpected content %q", names[i], content)
+		}
+	}
+}
+
+func TestBatchReportsOutputIfShreddingFails(t *testing.T) {
+	useTestConfig(t, "")
+	stub := newStubServer(t)
+	dir := t.TempDir()
+	files := writeBatchInputs(t, dir, "plain.txt")
+	linked := filepath.Join(dir, "linked.txt")
+	linkInputFile(t, linked, "content of linked.txt")
+	files = append(files, linked)
+
+	input := EncryptInput{
+		Password:      testPassword,
+		Expiration:    time.Now().Add(time.Hour),
+		ServerAddress: stub.URL(),
+		AlgVersion:    models.CurrentAlgVersion(),
+		ShredInput:    true,
+		LogLevel:      logging.LogLevelError,
+	}
+	summary, err := EncryptBatch(input, BatchInput{Files: files, Jobs: 2}, false)
+	if err == nil {
+		t.Fatal("expected shredding the linked input to fail")
+	}
+
+	failed := summary.Files[1]
+	if failed.Error == "" || failed.Output != linked+".forgetti" || failed.InputShredded {
+		t.Errorf("expected the written output without a shredded input, got %+v", failed)
+	}
+	if files := loadTestInventory(t).Files; len(files) != 2 {
+		t.Errorf("expected both outputs in the inventory, got %d files", len(files))
+	}
+}
+
+func TestBatchWithKeyPerFile(t *testing.T) {
+	useTestConfig(t, "")
+	stub := newStubServer(t)
+	files := writeBatchInputs(t, t.TempDir(), "a.txt", "b.txt", "c.txt")
+
+	summary := encryptTestBatch(t, stub, files, false)
+	expectInputOrder(t, summary, files)
+	if stub.keyCount() != len(files) {
+		t.Errorf("expected a key for each file, got %d keys", stub.keyCount())
+	}
+
+	var encrypted []string
+	for _, result := range summary.Files {
+		encrypted = append(encrypted, result.Output)
+		os.Remove(result.Input)
+	}
+	if _, err := DecryptBatch(DecryptInput{Password: testPassword, LogLevel: logging.LogLevelError}, BatchInput{Files: encrypted, Jobs: 2}); err != nil {
+		t.Fatalf("DecryptBatch failed: %v", err)
+	}
+	for _, result := range summary.Files {
+		if count := stub.encryptRequestCount(result.KeyId); count != 1 {
+			t.Errorf("key %s: expected 1 request, got %d", result.KeyId, count)
+		}
+	}
+}
+
+func TestDecryptBatchWithWrongPassword(t *testing.T) {
+	useTestConfig(t, "")
+	stub := newStubServer(t)
+	files := writeBatchInputs(t, t.TempDir(), "a.txt", "b.txt", "c.txt")
+	summary := encryptTestBatch(t, stub, files, true)
+
+	var encrypted []string
+	for _, result := range summary.Files {
+		encrypted = append(encrypted, result.Output)
+	}
+	decryptSummary, err := DecryptBatch(
+		DecryptInput{Password: "wrong password", LogLevel: logging.LogLevelError},
+		BatchInput{Files: encrypted, OutputDir: t.TempDir(), Jobs: 3},
+	)
+	if models.ErrorCode(err) != models.ErrorCodeBatchFailed {
+		t.Errorf("expected error code %s, got %v", models.ErrorCodeBatchFailed, err)
+	}
+	if decryptSummary.Failed != len(encrypted) {
+		t.Errorf("expected all files to fail, got %+v", decryptSummary)
+	}
+	expectInputOrder(t, decryptSummary, encrypted)
+	if count := stub.encryptRequestCount(summary.Files[0].KeyId); count != 1 {
+		t.Errorf("expected 1 request for the key, got %d", count)
+	}
+}
+
+func TestBatchRejectsCollidingOutputs(t *testing.T) {
+	useTestConfig(t, "")
+	stub := newStubServer(t)
+	root := t.TempDir()
+	files := []string{
+		writeBatchInputs(t, filepath.Join(root, "one"), "report.txt")[0],
+		writeBatchInputs(t, filepath.Join(root, "two"), "report.txt")[0],
+	}
+	outputDir := t.TempDir()
+
+	input := EncryptInput{Password: testPassword, Expiration: time.Now().Add(time.Hour), ServerAddress: stub.URL(), LogLevel: logging.LogLevelError}
+	_, err := EncryptBatch(input, BatchInput{Files: files, OutputDir: outputDir, Jobs: 2}, true)
+	if err == nil || !strings.Contains(err.Error(), "would both be written to") {
+		t.Fatalf("expected colliding outputs to be rejected, got %v", err)
+	}
+	if stub.keyCount() != 0 {
+		t.Error("expected no key to be created for a rejected batch")
+	}
+	if entries, _ := os.ReadDir(outputDir); len(entries) != 0 {
+		t.Errorf("expected no output to be written, got %d files", len(entries))
+	}
+
+	// Without an output directory, each output is written next to its input
+	summary := encryptTestBatch(t, stub, files, true)
+	var encrypted []string
+	for _, result := range summary.Files {
+		encrypted = append(encrypted, result.Output)
+	}
+
+	_, err = DecryptBatch(DecryptInput{Password: testPassword, LogLevel: logging.LogLevelError}, BatchInput{Files: encrypted, OutputDir: outputDir, Jobs: 2})
+	if err == nil || !strings.Contains(err.Error(), "would both be written to") {
+		t.Fatalf("expected colliding outputs to be rejected, got %v", err)
+	}
+	if count := stub.encryptRequestCount(summary.Files[0].KeyId); count != 0 {
+		t.Errorf("expected no request for a rejected batch, got %d", count)
+	}
+}
+
+func TestOutputPaths(t *testing.T) {
+	batch := BatchInput{Files: []string{"one/a.txt", "two/b.txt", "a.txt"}}
+	outputs, err := batch.outputPaths(func(inputPath string) string { return inputPath + ".forgetti" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"one/a.txt.forgetti", "two/b.txt.forgetti", "a.txt.forgetti"}
+	if fmt.Sprint(outputs) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, outputs)
+	}
+
+	batch.OutputDir = "out"
+	if _, err := batch.outputPaths(func(inputPath string) string { return inputPath + ".forgetti" }); err == nil {
+		t.Error("expected 'one/a.txt' and 'a.txt' to collide in the output directory")
+	}
+
+	// A file without the suffix is decrypted to its name with ".decrypted", which another file can already use
+	batch = BatchInput{Files: []string{"a.txt", "a.txt.decrypted.forgetti"}}
+	if _, err := batch.outputPaths(defaultDecryptOutputPath); err == nil {
+		t.Error("expected 'a.txt' and 'a.txt.decrypted.forgetti' to collide")
+	}
+}
@@ -0,0 +1,368 @@
+package commands
+
+import (
+	"Forgetti/config"
+	"Forgetti/interaction"
+	"Forgetti/models"
+	"fmt"
+	"forgetti-common/logging"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// defaultExpiresIn applies when neither --expires-in nor the profile set an expiration
+const defaultExpiresIn = "1d"
+
+type ConfigListResult struct {
+	ConfigPath     string          `json:"config_path"`
+	CurrentProfile string          `json:"current_profile"`
+	Profiles       []ProfileResult `json:"profiles"`
+}
+
+type ProfileResult struct {
+	Name              string `json:"name"`
+	ServerAddress     string `json:"server_address,omitempty"`
+	TokenSet          bool   `json:"token_set"`
+	TlsPin            string `json:"tls_pin,omitempty"`
+	DefaultExpiration string `json:"default_expiration,omitempty"`
+	DefaultAlgVersion string `json:"default_alg_version,omitempty"`
+}
+
+type ConfigFieldResult struct {
+	ConfigPath string `json:"config_path"`
+	Profile    string `json:"profile"`
+	Field      string `json:"field"`
+	// Value is left out when a token is set
+	Value string `json:"value,omitempty"`
+}
+
+type ConfigUseResult struct {
+	ConfigPath     string `json:"config_path"`
+	CurrentProfile string `json:"current_profile"`
+}
+
+type ServerAliasListResult struct {
+	ConfigPath string        `json:"config_path"`
+	Aliases    []ServerAlias `json:"aliases"`
+}
+
+type ServerAlias struct {
+	From string `json:"from"`
+	To   string `json:"to,omitempty"`
+}
+
+type ServerAliasResult struct {
+	ConfigPath string `json:"config_path"`
+	ServerAlias
+	// Removed is set by 'config alias remove', false if the server had no alias
+	Removed *bool `json:"removed,omitempty"`
+}
+
+// loadProfile returns the selected profile. The servers of all profiles are pinned, so that a file naming the server of
+// another profile is still checked against its pin. The server aliases apply to all requests.
+func loadProfile() (*config.Profile, error) {
+	cfg, err := config.LoadConfigOrEmpty()
+	if err != nil {
+		return nil, err
+	}
+
+	interaction.SetServerAliases(cfg.ServerAliases)
+
+	for _, name := range cfg.ProfileNames() {
+		profile, _ := cfg.GetProfile(name)
+		if profile.TlsPin == "" {
+			continue
+		}
+		if err := interaction.PinCertificate(profile.ServerAddress, profile.TlsPin); err != nil {
+			return nil, fmt.Errorf("invalid TLS pin of profile '%s': %w", name, err)
+		}
+	}
+
+	return cfg.SelectedProfile()
+}
+
+func ListConfig() (*ConfigListResult, error) {
+	configureLogging(logging.LogLevelInfo)
+	logger := logging.MakeLogger("config.list")
+
+	configPath, err := config.GetConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := config.LoadConfigOrEmpty()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ConfigListResult{ConfigPath: configPath, CurrentProfile: cfg.SelectedProfileName()}
+	logger.Info("Config file: '%s'", configPath)
+	for _, name := range cfg.ProfileNames() {
+		profile, _ := cfg.GetProfile(name)
+		result.Profiles = append(result.Profiles, ProfileResult{
+			Name:              name,
+			ServerAddress:     profile.ServerAddress,
+			TokenSet:          profile.Token != "",
+			TlsPin:            profile.TlsPin,
+			DefaultExpiration: profile.DefaultExpiration,
+			DefaultAlgVersion: profile.DefaultAlgVersion,
+		})
+
+		marker := " "
+		if name == result.CurrentProfile {
+			marker = "*"
+		}
+		logger.Info("%s %-15s server: %s  token: %s  TLS pin: %s  expiration: %s  alg version: %s",
+			marker, name, orDash(profile.ServerAddress), setOrNot(profile.Token), orDash(profile.TlsPin), orDash(profile.DefaultExpiration), orDash(profile.DefaultAlgVersion))
+	}
+
+	return result, nil
+}
+
+// GetConfig returns a field of the selected profile
+func GetConfig(field string) (*ConfigFieldResult, error) {
+	configureLogging(logging.LogLevelInfo)
+	logger := logging.MakeLogger("config.get")
+
+	configPath, err := config.GetConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := config.LoadConfigOrEmpty()
+	if err != nil {
+		return nil, err
+	}
+
+	name := cfg.SelectedProfileName()
+	profile, ok := cfg.GetProfile(name)
+	if !ok {
+		return nil, models.NewCodedError(models.ErrorCodeInvalidInput, "profile '%s' does not exist", name)
+	}
+
+	value, err := profile.GetField(field)
+	if err != nil {
+		return nil, models.WithCode(models.ErrorCodeInvalidInput, err)
+	}
+
+	logger.Info("%s", value)
+	return &ConfigFieldResult{ConfigPath: configPath, Profile: name, Field: field, Value: value}, nil
+}
+
+// SetConfig sets a field of the selected profile, creating the profile if it does not exist. An empty value removes
+// the field.
+func SetConfig(field string, value string) (*ConfigFieldResult, error) {
+	configureLogging(logging.LogLevelInfo)
+	logger := logging.MakeLogger("config.set")
+
+	configPath, err := config.GetConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	// A config file that can't be parsed is never replaced, as its content would be lost
+	cfg, err := config.LoadConfigOrEmpty()
+	if err != nil {
+		return nil, err
+	}
+
+	name := cfg.SelectedProfileName()
+	profile, _ := cfg.GetProfile(name)
+	if err := profile.SetField(field, value); err != nil {
+		return nil, models.WithCode(models.ErrorCodeInvalidInput, err)
+	}
+	if err := validateProfile(profile); err != nil {
+		return nil, models.WithCode(models.ErrorCodeInvalidInput, err)
+	}
+
+	cfg.SetProfile(name, profile)
+	if err := cfg.Save(); err != nil {
+		return nil, err
+	}
+
+	result := &ConfigFieldResult{ConfigPath: configPath, Profile: name, Field: field}
+	if field != "token" {
+		result.Value = value
+	}
+
+	if value == "" {
+		logger.Info("Removed %s of profile '%s'", field, name)
+	} else {
+		logger.Info("Set %s of profile '%s'", field, name)
+	}
+	return result, nil
+}
+
+// UseConfig makes the profile the current profile, which is used when no profile is given with --profile
+func UseConfig(name string) (*ConfigUseResult, error) {
+	configureLogging(logging.LogLevelInfo)
+	logger := logging.MakeLogger("config.use")
+
+	configPath, err := config.GetConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := config.LoadConfigOrEmpty()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := cfg.GetProfile(name); !ok {
+		return nil, models.NewCodedError(models.ErrorCodeInvalidInput, "profile '%s' does not exist (profiles: %v)", name, cfg.ProfileNames())
+	}
+
+	cfg.CurrentProfile = name
+	if name == config.DefaultProfile {
+		cfg.CurrentProfile = ""
+	}
+	if err := cfg.Save(); err != nil {
+		return nil, err
+	}
+
+	logger.Info("Using profile '%s'", name)
+	return &ConfigUseResult{ConfigPath: configPath, CurrentProfile: name}, nil
+}
+
+// ListServerAliases returns the servers that moved, sorted by their old address
+func ListServerAliases() (*ServerAliasListResult, error) {
+	configureLogging(logging.LogLevelInfo)
+	logger := logging.MakeLogger("config.alias.list")
+
+	configPath, err := config.GetConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := config.LoadConfigOrEmpty()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ServerAliasListResult{ConfigPath: configPath, Aliases: []ServerAlias{}}
+	for _, from := range slices.Sorted(maps.Keys(cfg.ServerAliases)) {
+		result.Aliases = append(result.Aliases, ServerAlias{From: from, To: cfg.ServerAliases[from]})
+		logger.Info("%s -> %s", from, cfg.ServerAliases[from])
+	}
+	if len(result.Aliases) == 0 {
+		logger.Info("No server aliases")
+	}
+
+	return result, nil
+}
+
+// AddServerAlias makes requests to the server at from go to the server at to, for files naming the old server
+func AddServerAlias(from string, to string) (*ServerAliasResult, error) {
+	configureLogging(logging.LogLevelInfo)
+	logger := logging.MakeLogger("config.alias.add")
+
+	for _, address := range []string{from, to} {
+		if err := validateServerAddress(address); err != nil {
+			return nil, models.WithCode(models.ErrorCodeInvalidInput, err)
+		}
+	}
+
+	configPath, err := config.GetConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := config.LoadConfigOrEmpty()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cfg.AddServerAlias(from, to); err != nil {
+		return nil, models.WithCode(models.ErrorCodeInvalidInput, err)
+	}
+	if err := cfg.Save(); err != nil {
+		return nil, err
+	}
+
+	logger.Info("Requests to %s go to %s", from, to)
+	return &ServerAliasResult{ConfigPath: configPath, ServerAlias: ServerAlias{From: from, To: to}}, nil
+}
+
+func RemoveServerAlias(from string) (*ServerAliasResult, error) {
+	configureLogging(logging.LogLevelInfo)
+	logger := logging.MakeLogger("config.alias.remove")
+
+	configPath, err := config.GetConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := config.LoadConfigOrEmpty()
+	if err != nil {
+		return nil, err
+	}
+
+	to, removed := cfg.RemoveServerAlias(from)
+	if removed {
+		if err := cfg.Save(); err != nil {
+			return nil, err
+		}
+		logger.Info("Removed the alias of %s", from)
+	} else {
+		logger.Info("%s has no alias", from)
+	}
+
+	return &ServerAliasResult{ConfigPath: configPath, ServerAlias: ServerAlias{From: from, To: to}, Removed: &removed}, nil
+}
+
+// tokenForServer returns the API token of a profile for requests to the server, which only get it if they go to the
+// server of the profile. Other servers, such as one named by the unauthenticated header of a file, never see it.
+func tokenForServer(token string, tokenServerAddress string, serverAddress string) string {
+	if token == "" || tokenServerAddress == "" || !interaction.SameServer(serverAddress, tokenServerAddress) {
+		return ""
+	}
+	return token
+}
+
+func validateServerAddress(serverAddress string) error {
+	parsed, err := url.Parse(serverAddress)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("invalid server address '%s': expected http(s)://host[:port]", serverAddress)
+	}
+	return nil
+}
+
+func validateProfile(profile config.Profile) error {
+	if profile.ServerAddress != "" {
+		if err := validateServerAddress(profile.ServerAddress); err != nil {
+			return err
+		}
+	}
+
+	if profile.TlsPin != "" {
+		if _, err := interaction.ParseTlsPin(profile.TlsPin); err != nil {
+			return err
+		}
+		if !strings.HasPrefix(profile.ServerAddress, "https://") {
+			return fmt.Errorf("a TLS pin requires an https server address, got '%s'", profile.ServerAddress)
+		}
+	}
+
+	if profile.DefaultExpiration != "" {
+		if _, err := parseExpiration(profile.DefaultExpiration); err != nil {
+			return err
+		}
+	}
+
+	if profile.DefaultAlgVersion != "" {
+		if _, err := models.ParseSupportedAlgVersion(profile.DefaultAlgVersion); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+func setOrNot(value string) string {
+	if value == "" {
+		return "not set"
+	}
+	return "set"
+}
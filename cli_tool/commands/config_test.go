@@ -0,0 +1,230 @@
+package commands
+
+import (
+	"Forgetti/config"
+	"Forgetti/models"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"os"
+	"testing"
+)
+
+const testConfig = `{
+  "server_address": "http://localhost:8080",
+  "token": "default-token",
+  "profiles": {
+    "staging": {
+      "server_address": "https://staging.example.com"
+    }
+  },
+  "server_aliases": {
+    "http://old.example.com": "http://localhost:8080"
+  }
+}`
+
+func loadTestConfig(t *testing.T) *config.Config {
+	t.Helper()
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func selectTestProfile(t *testing.T, name string) {
+	t.Helper()
+
+	config.SetProfileOverride(name)
+	t.Cleanup(func() { config.SetProfileOverride("") })
+}
+
+func TestSetConfig(t *testing.T) {
+	configPath := useTestConfig(t, testConfig)
+
+	result, err := SetConfig("default_expiration", "7d")
+	if err != nil {
+		t.Fatalf("SetConfig failed: %v", err)
+	}
+	if result.ConfigPath != configPath || result.Profile != config.DefaultProfile || result.Value != "7d" {
+		t.Errorf("unexpected result %+v", result)
+	}
+
+	info, err := os.Stat(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected mode 600, got %o", info.Mode().Perm())
+	}
+
+	// The other fields, profiles and aliases are kept
+	cfg := loadTestConfig(t)
+	if cfg.DefaultExpiration != "7d" || cfg.ServerAddress != "http://localhost:8080" || cfg.Token != "default-token" {
+		t.Errorf("expected the default profile with the new field, got %+v", cfg.Profile)
+	}
+	if staging, ok := cfg.GetProfile("staging"); !ok || staging.ServerAddress != "https://staging.example.com" || staging.DefaultExpiration != "" {
+		t.Errorf("expected the staging profile to be unchanged, got %+v", staging)
+	}
+	if cfg.ServerAliases["http://old.example.com"] != "http://localhost:8080" {
+		t.Errorf("expected the server aliases to be kept, got %v", cfg.ServerAliases)
+	}
+
+	field, err := GetConfig("default_expiration")
+	if err != nil || field.Value != "7d" {
+		t.Errorf("expected GetConfig to return the new value, got %+v (error: %v)", field, err)
+	}
+
+	// An empty value removes the field
+	if _, err := SetConfig("default_expiration", ""); err != nil {
+		t.Fatal(err)
+	}
+	if cfg := loadTestConfig(t); cfg.DefaultExpiration != "" {
+		t.Errorf("expected the field to be removed, got '%s'", cfg.DefaultExpiration)
+	}
+}
+
+func TestSetConfigOfSelectedProfile(t *testing.T) {
+	useTestConfig(t, testConfig)
+	selectTestProfile(t, "staging")
+
+	result, err := SetConfig("token", "staging-token")
+	if err != nil {
+		t.Fatalf("SetConfig failed: %v", err)
+	}
+	if result.Profile != "staging" || result.Value != "" {
+		t.Errorf("expected the token of staging to be set without returning it, got %+v", result)
+	}
+
+	cfg := loadTestConfig(t)
+	if staging, _ := cfg.GetProfile("staging"); staging.Token != "staging-token" {
+		t.Errorf("expected the token of staging, got '%s'", staging.Token)
+	}
+	if cfg.Token != "default-token" {
+		t.Errorf("expected the default profile to be unchanged, got token '%s'", cfg.Token)
+	}
+
+	// A profile that does not exist yet is created
+	selectTestProfile(t, "new")
+	if _, err := SetConfig("server_address", "https://new.example.com"); err != nil {
+		t.Fatalf("SetConfig of a new profile failed: %v", err)
+	}
+	if profile, ok := loadTestConfig(t).GetProfile("new"); !ok || profile.ServerAddress != "https://new.example.com" {
+		t.Errorf("expected the new profile, got %+v", profile)
+	}
+}
+
+func TestSetConfigRejectsInvalidValues(t *testing.T) {
+	hash := sha256.Sum256([]byte("key"))
+	pin := "sha256/" + base64.StdEncoding.EncodeToString(hash[:])
+
+	tests := []struct {
+		name  string
+		field string
+		value string
+	}{
+		{"unknown field", "password", "secret"},
+		{"server address without scheme", "server_address", "localhost:8080"},
+		{"server address with other scheme", "server_address", "ftp://localhost"},
+		{"invalid expiration", "default_expiration", "tomorrow"},
+		{"unsupported algorithm version", "default_alg_version", "99"},
+		{"invalid TLS pin", "tls_pin", "sha256/not base64!"},
+		// The default profile uses an http server
+		{"TLS pin of an http server", "tls_pin", pin},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			configPath := useTestConfig(t, testConfig)
+
+			_, err := SetConfig(test.field, test.value)
+			if models.ErrorCode(err) != models.ErrorCodeInvalidInput {
+				t.Errorf("expected error code %s, got %v", models.ErrorCodeInvalidInput, err)
+			}
+
+			content, err := os.ReadFile(configPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(content, []byte(testConfig)) {
+				t.Errorf("expected the config file to be unchanged, got %s", content)
+			}
+		})
+	}
+}
+
+func TestSetConfigKeepsUnparsableConfig(t *testing.T) {
+	configPath := useTestConfig(t, "{not json")
+
+	if _, err := SetConfig("token", "secret"); err == nil {
+		t.Fatal("expected SetConfig to fail")
+	}
+	content, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "{not json" {
+		t.Errorf("expected the config file to be unchanged, got %s", content)
+	}
+}
+
+func TestSetConfigCreatesConfig(t *testing.T) {
+	configPath := useTestConfig(t, "")
+
+	if _, err := SetConfig("server_address", "http://localhost:8080"); err != nil {
+		t.Fatalf("SetConfig failed: %v", err)
+	}
+	if _, err := os.Stat(configPath); err != nil {
+		t.Fatalf("expected the config file to be created: %v", err)
+	}
+	if cfg := loadTestConfig(t); cfg.ServerAddress != "http://localhost:8080" {
+		t.Errorf("expected the server address, got %+v", cfg.Profile)
+	}
+}
+
+func TestUseConfig(t *testing.T) {
+	useTestConfig(t, testConfig)
+
+	if _, err := UseConfig("staging"); err != nil {
+		t.Fatalf("UseConfig failed: %v", err)
+	}
+	if cfg := loadTestConfig(t); cfg.CurrentProfile != "staging" || cfg.SelectedProfileName() != "staging" {
+		t.Errorf("expected staging to be the current profile, got '%s'", cfg.CurrentProfile)
+	}
+
+	profile, err := loadProfile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.ServerAddress != "https://staging.example.com" {
+		t.Errorf("expected the server of staging, got %s", profile.ServerAddress)
+	}
+
+	// --profile beats the current profile
+	selectTestProfile(t, config.DefaultProfile)
+	if profile, err := loadProfile(); err != nil || profile.ServerAddress != "http://localhost:8080" {
+		t.Errorf("expected the server of the default profile, got %+v (error: %v)", profile, err)
+	}
+	config.SetProfileOverride("")
+
+	if _, err := UseConfig(config.DefaultProfile); err != nil {
+		t.Fatal(err)
+	}
+	if cfg := loadTestConfig(t); cfg.CurrentProfile != "" {
+		t.Errorf("expected no current profile for the default profile, got '%s'", cfg.CurrentProfile)
+	}
+
+	if _, err := UseConfig("missing"); models.ErrorCode(err) != models.ErrorCodeInvalidInput {
+		t.Errorf("expected an unknown profile to be rejected with %s, got %v", models.ErrorCodeInvalidInput, err)
+	}
+}
+
+func TestLoadProfileRejectsUnknownProfile(t *testing.T) {
+	useTestConfig(t, testConfig)
+	t.Setenv("FORGETTI_PROFILE", "missing")
+
+	if _, err := loadProfile(); err == nil {
+		t.Error("expected an unknown profile to be rejected")
+	}
+}
@@ -1,12 +1,14 @@
 package commands
 
 import (
+	"Forgetti/archive"
 	"Forgetti/encryption"
 	"Forgetti/interaction"
 	"Forgetti/io"
 	"Forgetti/models"
 	"fmt"
 	"forgetti-common/logging"
+	"os"
 	"strings"
 	"time"
 )
@@ -17,7 +19,19 @@ type DecryptInput struct {
 	Password      string
 	ServerAddress string
 	Overwrite     bool
-	LogLevel      logging.LogLevel
+	// PreserveMode restores the mode the file had at encryption, instead of making the output readable only by its owner
+	PreserveMode bool
+	LogLevel     logging.LogLevel
+}
+
+type DecryptResult struct {
+	Input          string `json:"input"`
+	Output         string `json:"output"`
+	EncryptedBytes int    `json:"encrypted_bytes"`
+	PlaintextBytes int    `json:"plaintext_bytes"`
+	// Entries is the number of extracted entries of an archive
+	Entries *int `json:"entries,omitempty"`
+	FileKey
 }
 
 func CreateDecryptInput(
@@ -26,6 +40,7 @@ func CreateDecryptInput(
 	password string,
 	serverAddress string,
 	overwrite bool,
+	preserveMode bool,
 	verbose bool,
 	quiet bool,
 ) (*DecryptInput, error) {
@@ -33,26 +48,36 @@ func CreateDecryptInput(
 		return nil, fmt.Errorf("input path is required")
 	}
 
-	if !io.FileExists(inputPath) {
-		return nil, fmt.Errorf("input file does not exist: '%s'", inputPath)
+	input, err := CreateDecryptOptions(password, serverAddress, overwrite, preserveMode, verbose, quiet)
+	if err != nil {
+		return nil, err
 	}
 
-	if outputPath == "" {
-		if strings.HasSuffix(inputPath, ".forgetti") {
-			outputPath = strings.TrimSuffix(inputPath, ".forgetti")
-		} else {
-			outputPath = inputPath + ".decrypted"
-		}
+	if err := input.setPaths(inputPath, outputPath); err != nil {
+		return nil, err
 	}
 
-	if io.FileExists(outputPath) && !overwrite {
-		return nil, fmt.Errorf("output file already exists: '%s'", outputPath)
-	}
+	return input, nil
+}
 
+// CreateDecryptOptions checks the settings that apply to every file of a decryption, leaving the paths empty
+func CreateDecryptOptions(
+	password string,
+	serverAddress string,
+	overwrite bool,
+	preserveMode bool,
+	verbose bool,
+	quiet bool,
+) (*DecryptInput, error) {
 	if password == "" {
 		return nil, fmt.Errorf("password is required")
 	}
 
+	// The server address of the file is used unless one is given, the profile only adds its TLS pins
+	if _, err := loadProfile(); err != nil {
+		return nil, err
+	}
+
 	logLevel := logging.LogLevelInfo
 	if verbose {
 		logLevel = logging.LogLevelVerbose
@@ -62,69 +87,158 @@ func CreateDecryptInput(
 	}
 
 	return &DecryptInput{
-		InputPath:     inputPath,
-		OutputPath:    outputPath,
 		Password:      password,
 		ServerAddress: serverAddress,
 		Overwrite:     overwrite,
+		PreserveMode:  preserveMode,
 		LogLevel:      logLevel,
 	}, nil
 }
 
-func Decrypt(input DecryptInput) error {
-	logging.SetGlobalConfig(logging.Config{
-		LogLevel: input.LogLevel,
-		LogFile:  "", // CLI tool logs only to console
-	})
+// setPaths checks the input path and sets the output path, which defaults to the input path without ".forgetti"
+func (input *DecryptInput) setPaths(inputPath string, outputPath string) error {
+	if !io.FileExists(inputPath) {
+		return models.NewCodedError(models.ErrorCodeInputNotFound, "input file does not exist: '%s'", inputPath)
+	}
+
+	if outputPath == "" {
+		outputPath = defaultDecryptOutputPath(inputPath)
+	}
+
+	if io.FileExists(outputPath) && !input.Overwrite {
+		return models.NewCodedError(models.ErrorCodeOutputExists, "output file already exists: '%s'", outputPath)
+	}
+
+	input.InputPath = inputPath
+	input.OutputPath = outputPath
+	return nil
+}
+
+func defaultDecryptOutputPath(inputPath string) string {
+	if strings.HasSuffix(inputPath, ".forgetti") {
+		return strings.TrimSuffix(inputPath, ".forgetti")
+	}
+	return inputPath + ".decrypted"
+}
+
+func Decrypt(input DecryptInput) (*DecryptResult, error) {
+	configureLogging(input.LogLevel)
 	logger := logging.MakeLogger("decrypt")
 
 	logger.Verbose("Reading file '%s'", input.InputPath)
 	contentWithMetadata, err := io.ReadContentWithMetadataFromFile(input.InputPath)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	logger.Verbose("Read encrypted content from file")
 	logger.Info("\n%s", contentWithMetadata.String())
 
+	result, err := decryptFile(input, contentWithMetadata, interaction.EncryptWithExistingKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Entries != nil {
+		logger.Info("Output: '%s' (%d entries)", result.Output, *result.Entries)
+	} else {
+		logger.Info("Output: '%s' (%d bytes)", result.Output, result.PlaintextBytes)
+	}
+
+	return result, nil
+}
+
+// decryptFile decrypts the content and writes it to the output file, or extracts it into the output directory if it is
+// an archive
+func decryptFile(input DecryptInput, contentWithMetadata *models.FileContentWithMetadata, getKeyHash getKeyHashFunc) (*DecryptResult, error) {
+	logger := logging.MakeLogger("decrypt.decryptFile")
+
+	decryptedContent, err := decryptContent(contentWithMetadata, input.Password, input.ServerAddress, getKeyHash)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &DecryptResult{
+		Input:          input.InputPath,
+		Output:         input.OutputPath,
+		EncryptedBytes: len(contentWithMetadata.FileContent),
+		PlaintextBytes: len(decryptedContent),
+		FileKey:        fileKeyOf(contentWithMetadata.Metadata),
+	}
+
+	if contentWithMetadata.Metadata.IsArchive() {
+		logger.Verbose("Extracting archive to directory '%s' (%d bytes, overwrite: %t)", input.OutputPath, len(decryptedContent), input.Overwrite)
+		entries, err := archive.Extract(decryptedContent, input.OutputPath, input.Overwrite)
+		if err != nil {
+			return nil, err
+		}
+
+		count := len(entries)
+		result.Entries = &count
+		return result, nil
+	}
+
+	mode := os.FileMode(io.DecryptedFileMode)
+	if input.PreserveMode {
+		if storedMode, ok := contentWithMetadata.Metadata.FileMode(); ok {
+			mode = storedMode
+		} else {
+			logger.Info("'%s' has no stored file mode, writing '%s' readable only by its owner", input.InputPath, input.OutputPath)
+		}
+	}
+
+	logger.Verbose("Writing content to file '%s' (%d bytes, mode %04o, overwrite: %t)", input.OutputPath, len(decryptedContent), mode, input.Overwrite)
+	if err := io.WriteFile(input.OutputPath, input.Overwrite, decryptedContent, mode); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// getKeyHashFunc asks the server for the encrypted key hash of a file, like interaction.EncryptWithExistingKey
+type getKeyHashFunc func(serverAddress string, password string, metadata *models.Metadata) (string, error)
+
+// decryptContent asks the server for the key of the file and decrypts its content. The server address of the metadata
+// is used if serverAddress is empty.
+func decryptContent(
+	contentWithMetadata *models.FileContentWithMetadata,
+	password string,
+	serverAddress string,
+	getKeyHash getKeyHashFunc,
+) ([]byte, error) {
+	logger := logging.MakeLogger("decrypt.decryptContent")
+
 	versions := models.ParseAlgVersion(contentWithMetadata.Metadata.AlgVersion)
 
 	if contentWithMetadata.Metadata.Expiration.Before(time.Now()) {
-		return fmt.Errorf("key has expired at %s (%s ago)", contentWithMetadata.Metadata.Expiration.String(), time.Since(contentWithMetadata.Metadata.Expiration).String())
+		return nil, models.NewCodedError(models.ErrorCodeKeyExpired, "key has expired at %s (%s ago)", contentWithMetadata.Metadata.Expiration.String(), time.Since(contentWithMetadata.Metadata.Expiration).String())
 	}
 
-	serverAddress := input.ServerAddress
 	if serverAddress == "" {
 		logger.Verbose("Server address not provided, using server address from metadata: '%s'", contentWithMetadata.Metadata.ServerAddress)
 		serverAddress = contentWithMetadata.Metadata.ServerAddress
 	}
 
 	logger.Verbose("Getting remote key '%s', using server '%s'", contentWithMetadata.Metadata.KeyId, serverAddress)
-	encryptedKeyHash, err := interaction.EncryptWithExistingKey(serverAddress, input.Password, &contentWithMetadata.Metadata)
+	encryptedKeyHash, err := getKeyHash(serverAddress, password, &contentWithMetadata.Metadata)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	logger.Verbose("Got remote key '%s'", contentWithMetadata.Metadata.KeyId)
 
 	logger.Verbose("Creating symmetric key")
-	key, err := encryption.CreateKey(input.Password, encryptedKeyHash, versions)
+	key, err := encryption.CreateKey(password, encryptedKeyHash, versions)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	logger.Verbose("Created symmetric key")
 
 	logger.Verbose("Decrypting content")
 	decryptedContent, err := encryption.Decrypt(contentWithMetadata.FileContent, key)
 	if err != nil {
-		return err
+		// Authenticated encryption can't tell a wrong password from a modified file
+		return nil, &models.CodedError{Code: models.ErrorCodeDecryptionFailed, Err: fmt.Errorf("wrong password, or the file was modified: %w", err)}
 	}
 	logger.Verbose("Decrypted content")
 
-	logger.Verbose("Writing content to file '%s' (%d bytes, overwrite: %t)", input.OutputPath, len(decryptedContent), input.Overwrite)
-	if err := io.WriteFile(input.OutputPath, input.Overwrite, decryptedContent); err != nil {
-		return err
-	}
-
-	logger.Info("Output: '%s' (%d bytes)", input.OutputPath, len(decryptedContent))
-
-	return nil
+	return decryptedContent, nil
 }
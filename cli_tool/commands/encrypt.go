@@ -1,13 +1,19 @@
 package commands
 
 import (
+	"Forgetti/archive"
 	"Forgetti/config"
 	"Forgetti/encryption"
 	"Forgetti/interaction"
 	"Forgetti/io"
 	"Forgetti/models"
+	"Forgetti/shred"
+	"bytes"
 	"fmt"
+	"forgetti-common/dto"
 	"forgetti-common/logging"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -19,8 +25,30 @@ type EncryptInput struct {
 	Password      string
 	Expiration    time.Time
 	ServerAddress string
+	Token         string
 	Overwrite     bool
 	LogLevel      logging.LogLevel
+	// KeyId and Group reuse a key of a local key group instead of creating a new key. A group without a key yet gets
+	// a new one.
+	KeyId string
+	Group string
+	// Recursive packs the input directory into an archive
+	Recursive bool
+	// AlgVersion is used for new keys, reused keys keep their version
+	AlgVersion models.AlgVersion
+	// ShredInput shreds the input once a test decryption of the output succeeded
+	ShredInput bool
+}
+
+type EncryptResult struct {
+	Input          string `json:"input"`
+	Output         string `json:"output"`
+	PlaintextBytes int    `json:"plaintext_bytes"`
+	EncryptedBytes int    `json:"encrypted_bytes"`
+	FileKey
+	InputShredded bool `json:"input_shredded,omitempty"`
+	// GeneratedPassword is set if the password was generated for this encryption
+	GeneratedPassword string `json:"generated_password,omitempty"`
 }
 
 func CreateEncryptInput(
@@ -30,34 +58,63 @@ func CreateEncryptInput(
 	expiresIn string,
 	serverAddress string,
 	overwrite bool,
+	shredInput bool,
 	verbose bool,
 	quiet bool,
+	keyId string,
+	group string,
+	recursive bool,
 ) (*EncryptInput, error) {
-	if config.DoesConfigExist() {
-		config, err := config.LoadConfig()
-		if err != nil {
-			return nil, err
-		}
+	if inputPath == "" {
+		return nil, fmt.Errorf("input path is required")
+	}
 
-		if serverAddress == "" {
-			serverAddress = config.ServerAddress
-		}
+	input, err := CreateEncryptOptions(password, expiresIn, serverAddress, overwrite, shredInput, verbose, quiet, keyId, group)
+	if err != nil {
+		return nil, err
 	}
 
-	if inputPath == "" {
-		return nil, fmt.Errorf("input path is required")
+	if err := input.setPaths(inputPath, outputPath, recursive); err != nil {
+		return nil, err
 	}
 
-	if !io.FileExists(inputPath) {
-		return nil, fmt.Errorf("input file does not exist: '%s'", inputPath)
+	return input, nil
+}
+
+// CreateEncryptOptions checks the settings that apply to every file of an encryption, leaving the paths empty
+func CreateEncryptOptions(
+	password string,
+	expiresIn string,
+	serverAddress string,
+	overwrite bool,
+	shredInput bool,
+	verbose bool,
+	quiet bool,
+	keyId string,
+	group string,
+) (*EncryptInput, error) {
+	profile, err := loadProfile()
+	if err != nil {
+		return nil, err
 	}
 
-	if outputPath == "" {
-		outputPath = inputPath + ".forgetti"
+	if serverAddress == "" {
+		serverAddress = profile.ServerAddress
 	}
 
-	if io.FileExists(outputPath) && !overwrite {
-		return nil, fmt.Errorf("output file already exists: '%s'", outputPath)
+	if expiresIn == "" {
+		expiresIn = profile.DefaultExpiration
+	}
+	if expiresIn == "" {
+		expiresIn = defaultExpiresIn
+	}
+
+	algVersion := models.CurrentAlgVersion()
+	if profile.DefaultAlgVersion != "" {
+		algVersion, err = models.ParseSupportedAlgVersion(profile.DefaultAlgVersion)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	expiration, err := parseExpiration(expiresIn)
@@ -73,6 +130,16 @@ func CreateEncryptInput(
 		return nil, fmt.Errorf("server address is required")
 	}
 
+	if keyId != "" && group != "" {
+		return nil, fmt.Errorf("only one of key id and group can be given")
+	}
+
+	if group != "" {
+		if err := dto.ValidateGroupName(group); err != nil {
+			return nil, err
+		}
+	}
+
 	logLevel := logging.LogLevelInfo
 	if verbose {
 		logLevel = logging.LogLevelVerbose
@@ -82,16 +149,65 @@ func CreateEncryptInput(
 	}
 
 	return &EncryptInput{
-		InputPath:     inputPath,
-		OutputPath:    outputPath,
 		Password:      password,
 		Expiration:    expiration,
 		ServerAddress: serverAddress,
+		Token:         tokenForServer(profile.Token, profile.ServerAddress, serverAddress),
 		Overwrite:     overwrite,
 		LogLevel:      logLevel,
+		KeyId:         keyId,
+		Group:         group,
+		AlgVersion:    algVersion,
+		ShredInput:    shredInput,
 	}, nil
 }
 
+// setPaths checks the input path and sets the output path, which defaults to the input path with ".forgetti" appended
+func (input *EncryptInput) setPaths(inputPath string, outputPath string, recursive bool) error {
+	inputInfo, err := os.Stat(inputPath)
+	if err != nil {
+		return models.NewCodedError(models.ErrorCodeInputNotFound, "input file does not exist: '%s'", inputPath)
+	}
+	if inputInfo.IsDir() && !recursive {
+		return models.NewCodedError(models.ErrorCodeInvalidInput, "input is a directory, use --recursive to encrypt it as an archive: '%s'", inputPath)
+	}
+	if !inputInfo.IsDir() && recursive {
+		return models.NewCodedError(models.ErrorCodeInvalidInput, "input is not a directory: '%s'", inputPath)
+	}
+
+	if outputPath == "" {
+		outputPath = filepath.Clean(inputPath) + ".forgetti"
+	}
+
+	if io.FileExists(outputPath) && !input.Overwrite {
+		return models.NewCodedError(models.ErrorCodeOutputExists, "output file already exists: '%s'", outputPath)
+	}
+
+	if input.ShredInput && isSameOrBelow(outputPath, inputPath) {
+		return models.NewCodedError(models.ErrorCodeInvalidInput, "the output '%s' would be shredded with the input '%s'", outputPath, inputPath)
+	}
+
+	input.InputPath = inputPath
+	input.OutputPath = outputPath
+	input.Recursive = recursive
+	return nil
+}
+
+// isSameOrBelow reports whether path is root, or inside root if it is a directory
+func isSameOrBelow(path string, root string) bool {
+	absolutePath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	absoluteRoot, err := filepath.Abs(root)
+	if err != nil {
+		return false
+	}
+
+	relative, err := filepath.Rel(absoluteRoot, absolutePath)
+	return err == nil && relative != ".." && !strings.HasPrefix(relative, ".."+string(filepath.Separator))
+}
+
 func parseExpiration(expiresIn string) (time.Time, error) {
 	if expiresIn == "" {
 		return time.Time{}, fmt.Errorf("expiration is required")
@@ -128,57 +244,258 @@ func parseExpiration(expiresIn string) (time.Time, error) {
 	return time.Time{}, fmt.Errorf("invalid duration format: '%s' (expected format: <number><unit> where unit is y/mo/w/d/h/min/s)", expiresIn)
 }
 
-func Encrypt(input EncryptInput) error {
-	logging.SetGlobalConfig(logging.Config{
-		LogLevel: input.LogLevel,
-		LogFile:  "", // CLI tool logs only to console
-	})
+func Encrypt(input EncryptInput) (*EncryptResult, error) {
+	configureLogging(input.LogLevel)
 	logger := logging.MakeLogger("encrypt")
 
+	if input.ShredInput {
+		logger.Warning(shred.Warning)
+	}
+
+	content, err := readEncryptInput(input)
+	if err != nil {
+		return nil, err
+	}
+
+	remoteKey, err := getRemoteKey(input)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := encryptFile(input, content, remoteKey)
+	if result != nil {
+		recordInInventory(map[string]models.Metadata{result.Output: remoteKey.Metadata})
+	}
+	if err != nil {
+		return result, err
+	}
+
+	logger.Info("\n")
+	logger.Info("Output:         %s (%d bytes)", result.Output, result.EncryptedBytes)
+	logger.Info("Key ID:         %s", result.KeyId)
+	logger.Info("Expires at:     %s (in %s)", result.Expiration.String(), time.Until(result.Expiration).String())
+	logger.Info("Server Address: %s", result.ServerAddress)
+	logger.Info("Alg Version:    %s", result.AlgVersion)
+	if result.Group != "" {
+		logger.Info("Key group:      %s", result.Group)
+	}
+	if result.InputShredded {
+		logger.Info("Shredded input: %s", result.Input)
+	}
+
+	return result, nil
+}
+
+// readEncryptInput reads the input file, or packs the input directory
+func readEncryptInput(input EncryptInput) ([]byte, error) {
+	logger := logging.MakeLogger("encrypt.readEncryptInput")
+
+	if input.Recursive {
+		logger.Verbose("Packing input directory '%s'", input.InputPath)
+		content, err := archive.Pack(input.InputPath)
+		if err != nil {
+			return nil, err
+		}
+		logger.Verbose("Packed %d bytes from input directory", len(content))
+		return content, nil
+	}
+
 	logger.Verbose("Reading input file '%s'", input.InputPath)
 	content, err := io.ReadFile(input.InputPath)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	logger.Verbose("Read %d bytes from input file", len(content))
+	return content, nil
+}
+
+// encryptFile encrypts the content with the given remote key and writes the output file. If the output was written, but
+// the input could not be shredded, the result is returned with the error.
+func encryptFile(input EncryptInput, content []byte, remoteKey *interaction.KeyGenerationResult) (*EncryptResult, error) {
+	logger := logging.MakeLogger("encrypt.encryptFile")
 
-	logger.Verbose("Creating remote key, using server '%s' and expiration '%s'", input.ServerAddress, input.Expiration.String())
-	interactionResult, err := interaction.GenerateKeyAndEncrypt(input.ServerAddress, input.Password, input.Expiration)
+	encryptedContent, err := encryptContent(content, input.Password, remoteKey)
 	if err != nil {
+		return nil, err
+	}
+
+	contentWithMetadata := models.FileContentWithMetadata{
+		FileContent: encryptedContent,
+		Metadata:    remoteKey.Metadata,
+	}
+	if input.Recursive {
+		contentWithMetadata.Metadata.Format = models.FormatTar
+	} else if info, err := os.Stat(input.InputPath); err == nil {
+		// Archives keep the modes of their entries instead
+		contentWithMetadata.Metadata.SetFileMode(info.Mode())
+	}
+
+	logger.Verbose("Writing encnrypted content to file '%s' (%d bytes, overwrite: %t)", input.OutputPath, len(encryptedContent), input.Overwrite)
+	if err := io.WriteContentWithMetadataToFile(input.OutputPath, input.Overwrite, &contentWithMetadata); err != nil {
+		return nil, err
+	}
+
+	result := &EncryptResult{
+		Input:          input.InputPath,
+		Output:         input.OutputPath,
+		PlaintextBytes: len(content),
+		EncryptedBytes: len(encryptedContent),
+		FileKey:        fileKeyOf(contentWithMetadata.Metadata),
+	}
+
+	if input.ShredInput {
+		if err := verifyAndShredInput(input, content, remoteKey); err != nil {
+			return result, err
+		}
+		result.InputShredded = true
+	}
+
+	return result, nil
+}
+
+// verifyEncryptedFile reads the written file back and decrypts it with the fresh key, without asking the server again
+func verifyEncryptedFile(path string, content []byte, password string, remoteKey *interaction.KeyGenerationResult) error {
+	logger := logging.MakeLogger("encrypt.verifyEncryptedFile")
+
+	logger.Verbose("Test decryption of '%s'", path)
+	written, err := io.ReadContentWithMetadataFromFile(path)
+	if err != nil {
+		return err
+	}
+	if err := verifyEncryptedContent(written, content, password, remoteKey); err != nil {
 		return err
 	}
-	logger.Verbose("Created remote key '%s' with expiration '%s'", interactionResult.Metadata.KeyId, interactionResult.Metadata.Expiration.String())
 
-	logger.Verbose("Creating symmetric key")
-	key, err := encryption.CreateKey(input.Password, interactionResult.EncryptedKeyHash, models.CurrentAlgVersion())
+	logger.Verbose("Test decryption of '%s' succeeded", path)
+	return nil
+}
+
+// verifyEncryptedContent decrypts the encrypted content with the fresh key and compares it to the plaintext
+func verifyEncryptedContent(encrypted *models.FileContentWithMetadata, content []byte, password string, remoteKey *interaction.KeyGenerationResult) error {
+	key, err := encryption.CreateKey(password, remoteKey.EncryptedKeyHash, models.ParseAlgVersion(encrypted.Metadata.AlgVersion))
+	if err != nil {
+		return err
+	}
+	decrypted, err := encryption.Decrypt(encrypted.FileContent, key)
 	if err != nil {
 		return err
 	}
+	if !bytes.Equal(decrypted, content) {
+		return fmt.Errorf("decrypted content differs from the input")
+	}
+	return nil
+}
+
+// verifyAndShredInput shreds the input only if the written output decrypts back to its content
+func verifyAndShredInput(input EncryptInput, content []byte, remoteKey *interaction.KeyGenerationResult) error {
+	if err := verifyEncryptedFile(input.OutputPath, content, input.Password, remoteKey); err != nil {
+		return fmt.Errorf("encrypted to '%s', but the input was not shredded, as the test decryption failed: %w", input.OutputPath, err)
+	}
+	if err := shredInput(input); err != nil {
+		return fmt.Errorf("encrypted to '%s', but failed to shred the input: %w", input.OutputPath, err)
+	}
+	return nil
+}
+
+func shredInput(input EncryptInput) error {
+	logger := logging.MakeLogger("encrypt.shredInput")
+
+	if input.Recursive {
+		count, err := shred.Directory(input.InputPath, shred.DefaultPasses)
+		if err != nil {
+			return err
+		}
+		logger.Verbose("Shredded %d files of '%s'", count, input.InputPath)
+		return nil
+	}
+
+	if err := shred.File(input.InputPath, shred.DefaultPasses); err != nil {
+		return err
+	}
+	logger.Verbose("Shredded '%s'", input.InputPath)
+	return nil
+}
+
+// encryptContent encrypts the content with the key made of the password and the remote key
+func encryptContent(content []byte, password string, remoteKey *interaction.KeyGenerationResult) ([]byte, error) {
+	logger := logging.MakeLogger("encrypt.encryptContent")
+
+	logger.Verbose("Creating symmetric key")
+	key, err := encryption.CreateKey(password, remoteKey.EncryptedKeyHash, models.ParseAlgVersion(remoteKey.Metadata.AlgVersion))
+	if err != nil {
+		return nil, err
+	}
 	logger.Verbose("Created symmetric key")
 
 	logger.Verbose("Encrypting content")
 	encryptedContent, err := encryption.Encrypt(content, key)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	logger.Verbose("Encrypted content")
 
-	contentWithMetadata := models.FileContentWithMetadata{
-		FileContent: encryptedContent,
-		Metadata:    interactionResult.Metadata,
+	return encryptedContent, nil
+}
+
+// getRemoteKey reuses the key of the local key group, if it did not expire, and creates a new key otherwise
+func getRemoteKey(input EncryptInput) (*interaction.KeyGenerationResult, error) {
+	logger := logging.MakeLogger("encrypt.getRemoteKey")
+
+	if input.KeyId == "" && input.Group == "" {
+		logger.Verbose("Creating remote key, using server '%s' and expiration '%s'", input.ServerAddress, input.Expiration.String())
+		result, err := interaction.GenerateKeyAndEncrypt(input.ServerAddress, input.Token, input.Password, input.Expiration, "", input.AlgVersion)
+		if err != nil {
+			return nil, err
+		}
+		logger.Verbose("Created remote key '%s' with expiration '%s'", result.Metadata.KeyId, result.Metadata.Expiration.String())
+		return result, nil
 	}
 
-	logger.Verbose("Writing encnrypted content to file '%s' (%d bytes, overwrite: %t)", input.OutputPath, len(encryptedContent), input.Overwrite)
-	if err := io.WriteContentWithMetadataToFile(input.OutputPath, input.Overwrite, &contentWithMetadata); err != nil {
-		return err
+	groups, err := config.LoadKeyGroups()
+	if err != nil {
+		return nil, err
 	}
 
-	logger.Info("\n")
-	logger.Info("Output:         %s (%d bytes)", input.OutputPath, len(encryptedContent))
-	logger.Info("Key ID:         %s", interactionResult.Metadata.KeyId)
-	logger.Info("Expires at:     %s (in %s)", interactionResult.Metadata.Expiration.String(), time.Until(interactionResult.Metadata.Expiration).String())
-	logger.Info("Server Address: %s", interactionResult.Metadata.ServerAddress)
-	logger.Info("Alg Version:    %s", interactionResult.Metadata.AlgVersion)
+	var group *config.KeyGroup
+	if input.KeyId != "" {
+		group = groups.FindByKeyId(input.KeyId)
+		if group == nil {
+			return nil, fmt.Errorf("key %s is not in a key group of this machine - only keys created with --group can be reused", input.KeyId)
+		}
+		if group.Expired() {
+			return nil, fmt.Errorf("key %s of group '%s' expired at %s", input.KeyId, group.Name, group.Metadata.Expiration.String())
+		}
+	} else {
+		group = groups.Find(input.ServerAddress, input.Group)
+		if group != nil && group.Expired() {
+			logger.Info("Key '%s' of group '%s' expired at %s, creating a new key for the group", group.Metadata.KeyId, group.Name, group.Metadata.Expiration.String())
+			group = nil
+		}
+	}
 
-	return nil
+	if group != nil {
+		// The group's own expiration applies, the requested one only applies to new keys
+		logger.Info("Reusing key '%s' of group '%s', expiring at %s", group.Metadata.KeyId, group.Name, group.Metadata.Expiration.String())
+		metadata := group.Metadata
+		encryptedKeyHash, err := interaction.EncryptWithExistingKey(metadata.ServerAddress, input.Password, &metadata)
+		if err != nil {
+			return nil, err
+		}
+		return &interaction.KeyGenerationResult{EncryptedKeyHash: encryptedKeyHash, Metadata: metadata}, nil
+	}
+
+	logger.Verbose("Creating remote key of group '%s', using server '%s' and expiration '%s'", input.Group, input.ServerAddress, input.Expiration.String())
+	result, err := interaction.GenerateKeyAndEncrypt(input.ServerAddress, input.Token, input.Password, input.Expiration, input.Group, input.AlgVersion)
+	if err != nil {
+		return nil, err
+	}
+	result.Metadata.Group = input.Group
+
+	groups.Put(config.KeyGroup{Name: input.Group, Metadata: result.Metadata})
+	if err := groups.Save(); err != nil {
+		return nil, fmt.Errorf("created key %s of group '%s', but failed to save the group: %w", result.Metadata.KeyId, input.Group, err)
+	}
+	logger.Info("Created key '%s' of group '%s'", result.Metadata.KeyId, input.Group)
+
+	return result, nil
 }
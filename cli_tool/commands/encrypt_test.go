@@ -0,0 +1,200 @@
+package commands
+
+import (
+	"Forgetti/interaction"
+	"Forgetti/models"
+	"forgetti-common/logging"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// localKey is a server key that needs no server, for tests that only encrypt
+func localKey(encryptedKeyHash string) *interaction.KeyGenerationResult {
+	return &interaction.KeyGenerationResult{
+		EncryptedKeyHash: encryptedKeyHash,
+		Metadata: models.Metadata{
+			KeyId:           "00000000-0000-0000-0000-000000000001",
+			Expiration:      time.Now().Add(time.Hour),
+			VerificationKey: "verification-key",
+			ServerAddress:   "http://localhost:1",
+			AlgVersion:      models.CurrentAlgVersion().String(),
+		},
+	}
+}
+
+func writeInputFile(t *testing.T, path string, content string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEncryptShredsInputAfterTestDecryption(t *testing.T) {
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "secret.txt")
+	writeInputFile(t, inputPath, "secret content")
+
+	input := EncryptInput{Password: "password", ShredInput: true}
+	if err := input.setPaths(inputPath, "", false); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := encryptFile(input, []byte("secret content"), localKey("encrypted-key-hash"))
+	if err != nil {
+		t.Fatalf("encryptFile failed: %v", err)
+	}
+	if !result.InputShredded {
+		t.Error("expected the input to be reported as shredded")
+	}
+	if _, err := os.Lstat(inputPath); !os.IsNotExist(err) {
+		t.Errorf("expected the input to be removed, got %v", err)
+	}
+	if _, err := os.Stat(inputPath + ".forgetti"); err != nil {
+		t.Errorf("expected the output to exist: %v", err)
+	}
+}
+
+func TestEncryptKeepsInputIfTestDecryptionFails(t *testing.T) {
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "secret.txt")
+	writeInputFile(t, inputPath, "secret content")
+
+	input := EncryptInput{Password: "password"}
+	if err := input.setPaths(inputPath, "", false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := encryptFile(input, []byte("secret content"), localKey("encrypted-key-hash")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The output was written with another remote key than the one the test decryption uses
+	input.ShredInput = true
+	if err := verifyAndShredInput(input, []byte("secret content"), localKey("other-key-hash")); err == nil {
+		t.Fatal("expected the test decryption to fail")
+	}
+
+	content, err := os.ReadFile(inputPath)
+	if err != nil {
+		t.Fatalf("the input was removed: %v", err)
+	}
+	if string(content) != "secret content" {
+		t.Errorf("the input was changed to %q", content)
+	}
+}
+
+func TestEncryptRefusesOutputInsideShreddedInput(t *testing.T) {
+	dir := t.TempDir()
+	inputDir := filepath.Join(dir, "tree")
+	writeInputFile(t, filepath.Join(inputDir, "a.txt"), "a")
+	inputFile := filepath.Join(dir, "secret.txt")
+	writeInputFile(t, inputFile, "secret")
+
+	tests := []struct {
+		name      string
+		input     string
+		output    string
+		recursive bool
+	}{
+		{"output inside the input directory", inputDir, filepath.Join(inputDir, "tree.forgetti"), true},
+		{"output in a subdirectory of the input directory", inputDir, filepath.Join(inputDir, "sub", "..", "tree.forgetti"), true},
+		{"output is the input file", inputFile, inputFile, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			input := EncryptInput{Password: "password", Overwrite: true, ShredInput: true}
+			err := input.setPaths(test.input, test.output, test.recursive)
+			if err == nil {
+				t.Fatal("expected the output to be refused")
+			}
+			if models.ErrorCode(err) != models.ErrorCodeInvalidInput {
+				t.Errorf("expected error code %s, got %s", models.ErrorCodeInvalidInput, models.ErrorCode(err))
+			}
+		})
+	}
+
+	// Without shredding, the same output is fine
+	input := EncryptInput{Password: "password", Overwrite: true}
+	if err := input.setPaths(inputDir, filepath.Join(inputDir, "tree.forgetti"), true); err != nil {
+		t.Errorf("expected the output to be accepted without --shred-input: %v", err)
+	}
+
+	for _, path := range []string{filepath.Join(inputDir, "a.txt"), inputFile} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("'%s' was removed: %v", path, err)
+		}
+	}
+}
+
+func TestEncryptSendsTokenOnlyToProfileServer(t *testing.T) {
+	useTestConfig(t, `{"current_profile": "work", "profiles": {"work": {"server_address": "http://forgetti.example.com", "token": "secret"}}}`)
+
+	tests := []struct {
+		serverAddress string
+		token         string
+	}{
+		{"", "secret"},
+		{"http://forgetti.example.com/", "secret"},
+		{"http://other.example.com", ""},
+	}
+
+	for _, test := range tests {
+		input, err := CreateEncryptOptions(testPassword, "1h", test.serverAddress, false, false, false, true, "", "")
+		if err != nil {
+			t.Fatalf("%s: CreateEncryptOptions failed: %v", test.serverAddress, err)
+		}
+		if input.Token != test.token {
+			t.Errorf("%s: expected token '%s', got '%s'", test.serverAddress, test.token, input.Token)
+		}
+	}
+}
+
+// linkInputFile makes the input a symbolic link to a real file, which encrypts fine but cannot be shredded
+func linkInputFile(t *testing.T, path string, content string) {
+	t.Helper()
+
+	target := filepath.Join(t.TempDir(), "target.txt")
+	writeInputFile(t, target, content)
+	if err := os.Symlink(target, path); err != nil {
+		t.Skipf("symbolic links are not supported: %v", err)
+	}
+}
+
+func TestEncryptReportsOutputIfShreddingFails(t *testing.T) {
+	useTestConfig(t, "")
+	stub := newStubServer(t)
+	inputPath := filepath.Join(t.TempDir(), "secret.txt")
+	linkInputFile(t, inputPath, "secret content")
+
+	input := EncryptInput{
+		Password:      testPassword,
+		Expiration:    time.Now().Add(time.Hour),
+		ServerAddress: stub.URL(),
+		AlgVersion:    models.CurrentAlgVersion(),
+		ShredInput:    true,
+		LogLevel:      logging.LogLevelError,
+	}
+	if err := input.setPaths(inputPath, "", false); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Encrypt(input)
+	if err == nil {
+		t.Fatal("expected shredding the input to fail")
+	}
+	if result == nil || result.Output != input.OutputPath || result.InputShredded {
+		t.Fatalf("expected the written output without a shredded input, got %+v", result)
+	}
+	if _, err := os.Stat(result.Output); err != nil {
+		t.Errorf("expected the output to exist: %v", err)
+	}
+	if files := loadTestInventory(t).Files; len(files) != 1 {
+		t.Errorf("expected the output in the inventory, got %d files", len(files))
+	}
+}
@@ -0,0 +1,139 @@
+package commands
+
+import (
+	"Forgetti/config"
+	"Forgetti/interaction"
+	"fmt"
+	"forgetti-common/logging"
+	"time"
+)
+
+type DestroyGroupInput struct {
+	Name          string
+	ServerAddress string
+	Token         string
+	LogLevel      logging.LogLevel
+}
+
+func CreateDestroyGroupInput(name string, serverAddress string, verbose bool) (*DestroyGroupInput, error) {
+	profile, err := loadProfile()
+	if err != nil {
+		return nil, err
+	}
+
+	if serverAddress == "" {
+		serverAddress = profile.ServerAddress
+	}
+
+	if name == "" {
+		return nil, fmt.Errorf("group name is required")
+	}
+
+	if serverAddress == "" {
+		return nil, fmt.Errorf("server address is required")
+	}
+
+	logLevel := logging.LogLevelInfo
+	if verbose {
+		logLevel = logging.LogLevelVerbose
+	}
+
+	return &DestroyGroupInput{
+		Name:          name,
+		ServerAddress: serverAddress,
+		Token:         tokenForServer(profile.Token, profile.ServerAddress, serverAddress),
+		LogLevel:      logLevel,
+	}, nil
+}
+
+type GroupListResult struct {
+	Groups []GroupResult `json:"groups"`
+}
+
+type GroupResult struct {
+	Name    string `json:"name"`
+	Expired bool   `json:"expired"`
+	FileKey
+}
+
+type DestroyGroupResult struct {
+	Group string `json:"group"`
+	KeyId string `json:"key_id"`
+	// Destroyed is false if the key had already expired, so the server was not asked to destroy it
+	Destroyed bool `json:"destroyed"`
+}
+
+func ListGroups() (*GroupListResult, error) {
+	configureLogging(logging.LogLevelInfo)
+	logger := logging.MakeLogger("group.list")
+
+	groups, err := config.LoadKeyGroups()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &GroupListResult{Groups: make([]GroupResult, 0, len(groups.Groups))}
+	if len(groups.Groups) == 0 {
+		logger.Info("No key groups")
+		return result, nil
+	}
+
+	for _, group := range groups.Groups {
+		expiresIn := time.Until(group.Metadata.Expiration).Round(time.Second)
+		state := fmt.Sprintf("expires in %s", expiresIn.String())
+		if group.Expired() {
+			state = "expired"
+		}
+
+		logger.Info("%-20s %s  %s (%s)  %s", group.Name, group.Metadata.KeyId, group.Metadata.Expiration.Format(time.RFC3339), state, group.Metadata.ServerAddress)
+		result.Groups = append(result.Groups, GroupResult{Name: group.Name, Expired: group.Expired(), FileKey: fileKeyOf(group.Metadata)})
+	}
+
+	return result, nil
+}
+
+// DestroyGroup destroys the key of the group on the server, so that no file encrypted with it can be decrypted anymore
+func DestroyGroup(input DestroyGroupInput) (*DestroyGroupResult, error) {
+	configureLogging(input.LogLevel)
+	logger := logging.MakeLogger("group.destroy")
+
+	groups, err := config.LoadKeyGroups()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &DestroyGroupResult{Group: input.Name}
+	group := groups.Find(input.ServerAddress, input.Name)
+	if group != nil && group.Expired() {
+		logger.Info("Key '%s' of group '%s' already expired at %s", group.Metadata.KeyId, group.Name, group.Metadata.Expiration.String())
+		result.KeyId = group.Metadata.KeyId
+	} else {
+		// Groups unknown to this machine are destroyed by name, the server knows the groups of the API token
+		keyId := ""
+		groupName := input.Name
+		if group != nil {
+			keyId = group.Metadata.KeyId
+			groupName = ""
+		}
+
+		logger.Verbose("Destroying key of group '%s' on server '%s'", input.Name, input.ServerAddress)
+		destroyedKeyId, err := interaction.DestroyKey(input.ServerAddress, input.Token, keyId, groupName)
+		if err != nil {
+			return nil, err
+		}
+		logger.Info("Destroyed key '%s' of group '%s' - files encrypted with it can no longer be decrypted", destroyedKeyId, input.Name)
+		result.KeyId = destroyedKeyId
+		result.Destroyed = true
+	}
+
+	if group == nil {
+		return result, nil
+	}
+
+	groups.Remove(input.ServerAddress, input.Name)
+	if err := groups.Save(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
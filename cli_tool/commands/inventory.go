@@ -0,0 +1,325 @@
+package commands
+
+import (
+	"Forgetti/config"
+	"Forgetti/io"
+	"Forgetti/models"
+	"fmt"
+	"forgetti-common/logging"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+type ListInput struct {
+	// Deadline limits the list to files that are not expired yet and expire before it, unless it is the zero time
+	Deadline    time.Time
+	ExpiredOnly bool
+}
+
+type InventoryListResult struct {
+	Files []InventoryFileResult `json:"files"`
+}
+
+type InventoryFileResult struct {
+	Path          string    `json:"path"`
+	KeyId         string    `json:"key_id"`
+	ServerAddress string    `json:"server_address"`
+	Expiration    time.Time `json:"expiration"`
+	Group         string    `json:"group,omitempty"`
+	RecordedAt    time.Time `json:"recorded_at"`
+	Expired       bool      `json:"expired"`
+	// Missing is set if the file no longer exists at its path
+	Missing bool `json:"missing"`
+}
+
+type ScanInput struct {
+	Directories []string
+	LogLevel    logging.LogLevel
+}
+
+// Status of a file found by scan
+const (
+	ScanStatusAdded     = "added"
+	ScanStatusUpdated   = "updated"
+	ScanStatusUnchanged = "unchanged"
+	ScanStatusFailed    = "failed"
+)
+
+type ScanFileResult struct {
+	Path      string `json:"path"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+	ErrorCode string `json:"error_code,omitempty"`
+}
+
+func (r *ScanFileResult) fail(err error) ScanFileResult {
+	r.Status = ScanStatusFailed
+	r.Error = err.Error()
+	r.ErrorCode = models.ErrorCode(err)
+	return *r
+}
+
+type ScanResult struct {
+	Added     int `json:"added"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+	// Removed counts the entries of files below the scanned directories that no longer exist
+	Removed int              `json:"removed"`
+	Failed  int              `json:"failed"`
+	Files   []ScanFileResult `json:"files"`
+}
+
+// CreateListInput parses the duration of expiringWithin, in the format of --expires-in
+func CreateListInput(expiringWithin string, expiredOnly bool) (*ListInput, error) {
+	if expiringWithin != "" && expiredOnly {
+		return nil, fmt.Errorf("--expiring-within and --expired can't be used together")
+	}
+
+	var deadline time.Time
+	if expiringWithin != "" {
+		var err error
+		deadline, err = parseExpiration(expiringWithin)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &ListInput{Deadline: deadline, ExpiredOnly: expiredOnly}, nil
+}
+
+// List returns the files of the inventory, the first to expire first
+func List(input ListInput) (*InventoryListResult, error) {
+	configureLogging(logging.LogLevelInfo)
+	logger := logging.MakeLogger("list")
+
+	inventory, err := config.LoadInventory()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]config.InventoryEntry, 0, len(inventory.Files))
+	for _, entry := range inventory.Files {
+		switch {
+		case input.ExpiredOnly && !entry.Expired():
+			continue
+		case !input.Deadline.IsZero() && (entry.Expired() || entry.Expiration.After(input.Deadline)):
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].Expiration.Equal(entries[j].Expiration) {
+			return entries[i].Expiration.Before(entries[j].Expiration)
+		}
+		return entries[i].Path < entries[j].Path
+	})
+
+	result := &InventoryListResult{Files: make([]InventoryFileResult, 0, len(entries))}
+	if len(entries) == 0 {
+		logger.Info("No encrypted files")
+		return result, nil
+	}
+
+	for _, entry := range entries {
+		fileResult := InventoryFileResult{
+			Path:          entry.Path,
+			KeyId:         entry.KeyId,
+			ServerAddress: entry.ServerAddress,
+			Expiration:    entry.Expiration,
+			Group:         entry.Group,
+			RecordedAt:    entry.RecordedAt,
+			Expired:       entry.Expired(),
+			Missing:       !io.FileExists(entry.Path),
+		}
+		result.Files = append(result.Files, fileResult)
+
+		state := fmt.Sprintf("expires in %s", time.Until(entry.Expiration).Round(time.Second).String())
+		if fileResult.Expired {
+			state = "expired"
+		}
+		if fileResult.Missing {
+			state += ", missing"
+		}
+		logger.Info("%s  %s (%s)  %s", entry.Expiration.Format(time.RFC3339), entry.Path, state, entry.ServerAddress)
+	}
+
+	return result, nil
+}
+
+func CreateScanInput(directories []string, verbose bool, quiet bool) (*ScanInput, error) {
+	if len(directories) == 0 {
+		return nil, fmt.Errorf("at least one directory is required")
+	}
+
+	for _, directory := range directories {
+		info, err := os.Stat(directory)
+		if err != nil {
+			return nil, models.NewCodedError(models.ErrorCodeInputNotFound, "directory does not exist: '%s'", directory)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("not a directory: '%s'", directory)
+		}
+	}
+
+	logLevel := logging.LogLevelInfo
+	if verbose {
+		logLevel = logging.LogLevelVerbose
+	}
+	if quiet {
+		logLevel = logging.LogLevelError
+	}
+
+	return &ScanInput{Directories: directories, LogLevel: logLevel}, nil
+}
+
+// Scan rebuilds the inventory of the directories from the headers of their ".forgetti" files. Entries of files below
+// the directories that were not found again are removed, entries of other files are kept.
+func Scan(input ScanInput) (*ScanResult, error) {
+	configureLogging(input.LogLevel)
+	logger := logging.MakeLogger("scan")
+
+	// The headers are read before the inventory is locked, which keeps other runs waiting only for the update
+	roots := make([]string, len(input.Directories))
+	scanned := make([][]scannedFile, len(input.Directories))
+	for i, directory := range input.Directories {
+		root, err := filepath.Abs(directory)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve path '%s': %w", directory, err)
+		}
+
+		files, err := findEncryptedFiles(root)
+		if err != nil {
+			return nil, err
+		}
+		logger.Verbose("Found %d encrypted files in '%s'", len(files), directory)
+
+		roots[i] = root
+		for _, file := range files {
+			scanned[i] = append(scanned[i], readScannedFile(file))
+		}
+	}
+
+	result := &ScanResult{}
+	err := config.UpdateInventory(func(inventory *config.Inventory) error {
+		for i, root := range roots {
+			found := make(map[string]bool, len(scanned[i]))
+			for _, file := range scanned[i] {
+				found[file.result.Path] = true
+				fileResult := file.update(inventory)
+				result.Files = append(result.Files, fileResult)
+
+				switch fileResult.Status {
+				case ScanStatusFailed:
+					result.Failed++
+					logger.Error("Failed '%s': %s", fileResult.Path, fileResult.Error)
+				case ScanStatusAdded:
+					result.Added++
+					logger.Info("Added '%s'", fileResult.Path)
+				case ScanStatusUpdated:
+					result.Updated++
+					logger.Info("Updated '%s'", fileResult.Path)
+				default:
+					result.Unchanged++
+					logger.Verbose("'%s': unchanged", fileResult.Path)
+				}
+			}
+
+			result.Removed += inventory.RemoveBelow(root, func(entry config.InventoryEntry) bool {
+				if !found[entry.Path] {
+					logger.Info("Removed '%s'", entry.Path)
+					return false
+				}
+				return true
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Added %d files, updated %d, %d unchanged, removed %d, %d failed", result.Added, result.Updated, result.Unchanged, result.Removed, result.Failed)
+
+	if result.Failed > 0 {
+		return result, models.NewCodedError(models.ErrorCodeBatchFailed, "failed to read %d of %d files", result.Failed, len(result.Files))
+	}
+	return result, nil
+}
+
+// scannedFile is the inventory entry read from the header of a file, or the failure to read it
+type scannedFile struct {
+	entry  config.InventoryEntry
+	result ScanFileResult
+}
+
+func readScannedFile(file string) scannedFile {
+	scanned := scannedFile{result: ScanFileResult{Path: file}}
+
+	contentWithMetadata, err := io.ReadContentWithMetadataFromFile(file)
+	if err != nil {
+		scanned.result.fail(err)
+		return scanned
+	}
+	if err := checkEncryptedFile(contentWithMetadata); err != nil {
+		scanned.result.fail(err)
+		return scanned
+	}
+
+	scanned.entry, err = config.NewInventoryEntry(file, contentWithMetadata.Metadata)
+	if err != nil {
+		scanned.result.fail(err)
+	}
+	return scanned
+}
+
+// update adds the entry of the file to the inventory, unless reading it failed
+func (f scannedFile) update(inventory *config.Inventory) ScanFileResult {
+	result := f.result
+	if result.Status == ScanStatusFailed {
+		return result
+	}
+
+	existing := inventory.Find(f.entry.Path)
+	switch {
+	case existing == nil:
+		result.Status = ScanStatusAdded
+	case existing.KeyId == f.entry.KeyId && existing.ServerAddress == f.entry.ServerAddress &&
+		existing.Expiration.Equal(f.entry.Expiration) && existing.Group == f.entry.Group:
+		result.Status = ScanStatusUnchanged
+		return result
+	default:
+		result.Status = ScanStatusUpdated
+	}
+
+	inventory.Put(f.entry)
+	return result
+}
+
+// recordInInventory adds the encrypted files to the inventory. The files were written already, so a failure is only a
+// warning.
+func recordInInventory(files map[string]models.Metadata) {
+	logger := logging.MakeLogger("inventory.record")
+
+	if len(files) == 0 {
+		return
+	}
+
+	err := config.UpdateInventory(func(inventory *config.Inventory) error {
+		for path, metadata := range files {
+			entry, err := config.NewInventoryEntry(path, metadata)
+			if err != nil {
+				logger.Warning("Failed to add '%s' to the inventory of encrypted files: %s", path, err.Error())
+				continue
+			}
+			inventory.Put(entry)
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Warning("Failed to update the inventory of encrypted files: %s", err.Error())
+		return
+	}
+	logger.Verbose("Recorded %d files in the inventory", len(files))
+}
@@ -0,0 +1,232 @@
+package commands
+
+import (
+	"Forgetti/config"
+	"Forgetti/models"
+	"fmt"
+	"forgetti-common/logging"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func saveTestInventory(t *testing.T, entries ...config.InventoryEntry) {
+	t.Helper()
+
+	err := config.UpdateInventory(func(inventory *config.Inventory) error {
+		inventory.Files = entries
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func loadTestInventory(t *testing.T) *config.Inventory {
+	t.Helper()
+
+	inventory, err := config.LoadInventory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return inventory
+}
+
+func listedPaths(result *InventoryListResult) []string {
+	paths := make([]string, 0, len(result.Files))
+	for _, file := range result.Files {
+		paths = append(paths, filepath.Base(file.Path))
+	}
+	return paths
+}
+
+func TestCreateListInput(t *testing.T) {
+	input, err := CreateListInput("2d", false)
+	if err != nil {
+		t.Fatalf("CreateListInput failed: %v", err)
+	}
+	expected := time.Now().Add(48 * time.Hour)
+	if input.Deadline.Before(expected.Add(-time.Minute)) || input.Deadline.After(expected.Add(time.Minute)) {
+		t.Errorf("expected the deadline to be in 2 days, got %s", input.Deadline)
+	}
+
+	input, err = CreateListInput("", false)
+	if err != nil || !input.Deadline.IsZero() || input.ExpiredOnly {
+		t.Errorf("expected no filter, got %+v (error: %v)", input, err)
+	}
+
+	for _, expiringWithin := range []string{"2", "two days", "2x", "-1d"} {
+		if _, err := CreateListInput(expiringWithin, false); err == nil {
+			t.Errorf("expected '%s' to be rejected", expiringWithin)
+		}
+	}
+	if _, err := CreateListInput("2d", true); err == nil {
+		t.Error("expected --expiring-within and --expired together to be rejected")
+	}
+}
+
+func TestList(t *testing.T) {
+	useTestConfig(t, "")
+	dir := t.TempDir()
+	now := time.Now()
+	for _, name := range []string{"hour.forgetti", "day.forgetti", "week.forgetti", "expired.forgetti", "also-hour.forgetti"} {
+		writeInputFile(t, filepath.Join(dir, name), "encrypted")
+	}
+	saveTestInventory(t,
+		config.InventoryEntry{Path: filepath.Join(dir, "week.forgetti"), Expiration: now.Add(7 * 24 * time.Hour)},
+		config.InventoryEntry{Path: filepath.Join(dir, "hour.forgetti"), Expiration: now.Add(time.Hour)},
+		config.InventoryEntry{Path: filepath.Join(dir, "expired.forgetti"), Expiration: now.Add(-time.Hour)},
+		config.InventoryEntry{Path: filepath.Join(dir, "missing.forgetti"), Expiration: now.Add(2 * time.Hour)},
+		config.InventoryEntry{Path: filepath.Join(dir, "day.forgetti"), Expiration: now.Add(24 * time.Hour)},
+		config.InventoryEntry{Path: filepath.Join(dir, "also-hour.forgetti"), Expiration: now.Add(time.Hour)},
+	)
+
+	tests := []struct {
+		name           string
+		expiringWithin string
+		expired        bool
+		expected       []string
+	}{
+		{"all", "", false, []string{"expired.forgetti", "also-hour.forgetti", "hour.forgetti", "missing.forgetti", "day.forgetti", "week.forgetti"}},
+		{"expiring within 2 days", "2d", false, []string{"also-hour.forgetti", "hour.forgetti", "missing.forgetti", "day.forgetti"}},
+		{"expiring within 90 minutes", "90min", false, []string{"also-hour.forgetti", "hour.forgetti"}},
+		{"expired", "", true, []string{"expired.forgetti"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			input, err := CreateListInput(test.expiringWithin, test.expired)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := List(*input)
+			if err != nil {
+				t.Fatalf("List failed: %v", err)
+			}
+			if paths := listedPaths(result); fmt.Sprint(paths) != fmt.Sprint(test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, paths)
+			}
+		})
+	}
+
+	result, err := List(ListInput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range result.Files {
+		name := filepath.Base(file.Path)
+		if file.Missing != (name == "missing.forgetti") {
+			t.Errorf("'%s': expected missing to be %t", name, name == "missing.forgetti")
+		}
+		if file.Expired != (name == "expired.forgetti") {
+			t.Errorf("'%s': expected expired to be %t", name, name == "expired.forgetti")
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	useTestConfig(t, "")
+	root := t.TempDir()
+	other := t.TempDir()
+
+	a := filepath.Join(root, "a.txt.forgetti")
+	b := filepath.Join(root, "sub", "b.txt.forgetti")
+	writeEncryptedTestFile(t, a, "a", testPassword, localKey("hash-a"))
+	bKey := localKey("hash-b")
+	bKey.Metadata.KeyId = "00000000-0000-0000-0000-00000000000b"
+	writeEncryptedTestFile(t, b, "b", testPassword, bKey)
+	writeInputFile(t, filepath.Join(root, "corrupt.forgetti"), "not an encrypted file")
+	writeInputFile(t, filepath.Join(root, "plain.txt"), "not scanned")
+
+	otherEntry := config.InventoryEntry{Path: filepath.Join(other, "elsewhere.forgetti"), KeyId: "other"}
+	saveTestInventory(t,
+		config.InventoryEntry{Path: b, KeyId: "outdated"},
+		config.InventoryEntry{Path: filepath.Join(root, "moved-away.forgetti"), KeyId: "moved"},
+		otherEntry,
+	)
+
+	result, err := Scan(ScanInput{Directories: []string{root}, LogLevel: logging.LogLevelError})
+	if models.ErrorCode(err) != models.ErrorCodeBatchFailed {
+		t.Errorf("expected error code %s for the corrupt file, got %v", models.ErrorCodeBatchFailed, err)
+	}
+	if result.Added != 1 || result.Updated != 1 || result.Unchanged != 0 || result.Removed != 1 || result.Failed != 1 {
+		t.Errorf("expected 1 added, 1 updated, 1 removed and 1 failed, got %+v", result)
+	}
+
+	inventory := loadTestInventory(t)
+	if len(inventory.Files) != 3 {
+		t.Errorf("expected 3 entries, got %+v", inventory.Files)
+	}
+	if entry := inventory.Find(a); entry == nil || entry.KeyId != localKey("").Metadata.KeyId {
+		t.Errorf("expected the entry of a.txt.forgetti from its header, got %+v", entry)
+	}
+	if entry := inventory.Find(b); entry == nil || entry.KeyId != bKey.Metadata.KeyId {
+		t.Errorf("expected the entry of b.txt.forgetti to be updated, got %+v", entry)
+	}
+	if entry := inventory.Find(otherEntry.Path); entry == nil {
+		t.Error("expected the entry outside of the scanned directory to be kept")
+	}
+
+	// A second scan finds nothing new
+	if err := os.Remove(filepath.Join(root, "corrupt.forgetti")); err != nil {
+		t.Fatal(err)
+	}
+	result, err = Scan(ScanInput{Directories: []string{root}, LogLevel: logging.LogLevelError})
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if result.Unchanged != 2 || result.Added+result.Updated+result.Removed+result.Failed != 0 {
+		t.Errorf("expected 2 unchanged files, got %+v", result)
+	}
+}
+
+func TestScanRebuildsInventory(t *testing.T) {
+	// No inventory file yet, as on a new machine
+	useTestConfig(t, "")
+	root := t.TempDir()
+	writeEncryptedTestFile(t, filepath.Join(root, "a.forgetti"), "a", testPassword, localKey("hash-a"))
+
+	// Relative paths are recorded as absolute paths
+	workingDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(root); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(workingDir) })
+
+	result, err := Scan(ScanInput{Directories: []string{"."}, LogLevel: logging.LogLevelError})
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if result.Added != 1 {
+		t.Errorf("expected 1 added file, got %+v", result)
+	}
+	if entry := loadTestInventory(t).Find(filepath.Join(root, "a.forgetti")); entry == nil {
+		t.Error("expected an entry with the absolute path")
+	}
+}
+
+func TestRecordInInventoryConcurrently(t *testing.T) {
+	useTestConfig(t, "")
+	dir := t.TempDir()
+
+	const runs = 10
+	var wg sync.WaitGroup
+	for i := 0; i < runs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			path := filepath.Join(dir, fmt.Sprintf("%d.forgetti", i))
+			recordInInventory(map[string]models.Metadata{path: localKey("").Metadata})
+		}()
+	}
+	wg.Wait()
+
+	if files := loadTestInventory(t).Files; len(files) != runs {
+		t.Errorf("expected %d entries, got %d", runs, len(files))
+	}
+}
@@ -0,0 +1,39 @@
+package commands
+
+import (
+	"Forgetti/models"
+	"Forgetti/output"
+	"forgetti-common/logging"
+	"time"
+)
+
+// FileKey describes the key of an encrypted file in the results of commands. The verification key is left out, as
+// only its owner needs it.
+type FileKey struct {
+	KeyId         string    `json:"key_id"`
+	Expiration    time.Time `json:"expiration"`
+	ServerAddress string    `json:"server_address"`
+	AlgVersion    string    `json:"alg_version"`
+	Group         string    `json:"group,omitempty"`
+	Format        string    `json:"format,omitempty"`
+}
+
+func fileKeyOf(metadata models.Metadata) FileKey {
+	return FileKey{
+		KeyId:         metadata.KeyId,
+		Expiration:    metadata.Expiration,
+		ServerAddress: metadata.ServerAddress,
+		AlgVersion:    metadata.AlgVersion,
+		Group:         metadata.Group,
+		Format:        metadata.Format,
+	}
+}
+
+// configureLogging sets the log level of the command, logging to the console of the output format
+func configureLogging(logLevel logging.LogLevel) {
+	logging.SetGlobalConfig(logging.Config{
+		LogLevel: logLevel,
+		LogFile:  "", // CLI tool logs only to console
+		Console:  output.Console(),
+	})
+}
@@ -1,39 +1,127 @@
 package commands
 
 import (
+	"Forgetti/archive"
+	"Forgetti/interaction"
 	"Forgetti/io"
+	"Forgetti/models"
 	"fmt"
 	"forgetti-common/logging"
+	"time"
 )
 
 type ReadMetadataInput struct {
 	InputPath string
+	// ListEntries decrypts an archive to list its entries, which are never stored in the clear
+	ListEntries   bool
+	Password      string
+	ServerAddress string
 }
 
-func CreateReadMetadataInput(path string) (*ReadMetadataInput, error) {
+func CreateReadMetadataInput(path string, listEntries bool, password string, serverAddress string) (*ReadMetadataInput, error) {
 	if path == "" {
 		return nil, fmt.Errorf("input path is required")
 	}
 
+	if listEntries && password == "" {
+		return nil, fmt.Errorf("password is required to list the entries of an archive")
+	}
+
+	if listEntries {
+		if _, err := loadProfile(); err != nil {
+			return nil, err
+		}
+	}
+
 	return &ReadMetadataInput{
-		InputPath: path,
+		InputPath:     path,
+		ListEntries:   listEntries,
+		Password:      password,
+		ServerAddress: serverAddress,
 	}, nil
 }
 
-func ReadMetadata(input ReadMetadataInput) error {
-	logging.SetGlobalConfig(logging.Config{
-		LogLevel: logging.LogLevelInfo,
-		LogFile:  "", // CLI tool logs only to console
-	})
+type MetadataResult struct {
+	Input          string `json:"input"`
+	EncryptedBytes int    `json:"encrypted_bytes"`
+	Expired        bool   `json:"expired"`
+	// Mode is the octal permissions of a single file at encryption, if they were stored
+	Mode string `json:"mode,omitempty"`
+	FileKey
+	// Entries are only listed on request, as listing them needs decryption
+	Entries []EntryResult `json:"entries,omitempty"`
+}
+
+type EntryResult struct {
+	Path    string    `json:"path"`
+	IsDir   bool      `json:"is_dir"`
+	Mode    string    `json:"mode"` // octal permissions, for example "0644"
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+func ReadMetadata(input ReadMetadataInput) (*MetadataResult, error) {
+	configureLogging(logging.LogLevelInfo)
 	logger := logging.MakeLogger("read_metadata")
 
 	logger.Info("File: '%s'", input.InputPath)
 	contentWithMetadata, err := io.ReadContentWithMetadataFromFile(input.InputPath)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	logger.Info("%s", contentWithMetadata.String())
 
-	return nil
+	result := &MetadataResult{
+		Input:          input.InputPath,
+		EncryptedBytes: len(contentWithMetadata.FileContent),
+		Expired:        contentWithMetadata.Metadata.Expiration.Before(time.Now()),
+		Mode:           contentWithMetadata.Metadata.Mode,
+		FileKey:        fileKeyOf(contentWithMetadata.Metadata),
+	}
+
+	if !input.ListEntries {
+		return result, nil
+	}
+
+	if !contentWithMetadata.Metadata.IsArchive() {
+		return nil, models.NewCodedError(models.ErrorCodeInvalidInput, "file does not contain a directory archive, it has no entries")
+	}
+
+	// Decryption logs its progress at info level, which would interrupt the listing
+	configureLogging(logging.LogLevelError)
+	decryptedContent, err := decryptContent(contentWithMetadata, input.Password, input.ServerAddress, interaction.EncryptWithExistingKey)
+	configureLogging(logging.LogLevelInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := archive.List(decryptedContent)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Entries (%d):", len(entries))
+	result.Entries = make([]EntryResult, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Path
+		size := fmt.Sprintf("%d", entry.Size)
+		mode := entry.Mode.String()
+		if entry.IsDir {
+			name += "/"
+			size = "-"
+			mode = "d" + mode[1:]
+		}
+		logger.Info("%s %12s %s %s", mode, size, entry.ModTime.Local().Format(time.DateTime), name)
+
+		result.Entries = append(result.Entries, EntryResult{
+			Path:    entry.Path,
+			IsDir:   entry.IsDir,
+			Mode:    fmt.Sprintf("%04o", entry.Mode.Perm()),
+			Size:    entry.Size,
+			ModTime: entry.ModTime,
+		})
+	}
+
+	return result, nil
 }
@@ -0,0 +1,213 @@
+package commands
+
+import (
+	"Forgetti/interaction"
+	"Forgetti/io"
+	"Forgetti/models"
+	"fmt"
+	"forgetti-common/logging"
+	"time"
+)
+
+type RekeyInput struct {
+	InputPath string
+	Password  string
+	// NewPassword replaces the password, if set
+	NewPassword string
+	// Expiration of the new key, the zero time keeps the expiration of the old key
+	Expiration time.Time
+	// ServerAddress of the new key, empty to keep the server of the file
+	ServerAddress string
+	// Token is only sent to TokenServerAddress, the server of the profile
+	Token              string
+	TokenServerAddress string
+	// UpgradeAlgVersion creates the new key with the current algorithm version, otherwise the new key keeps the version
+	// of the file
+	UpgradeAlgVersion bool
+	DestroyOldKey     bool
+	LogLevel          logging.LogLevel
+}
+
+type RekeyResult struct {
+	Input          string  `json:"input"`
+	EncryptedBytes int     `json:"encrypted_bytes"`
+	OldKey         FileKey `json:"old_key"`
+	// The key fields describe the new key
+	FileKey
+	PasswordChanged bool `json:"password_changed"`
+	OldKeyDestroyed bool `json:"old_key_destroyed"`
+	// GeneratedPassword is set if the new password was generated
+	GeneratedPassword string `json:"generated_password,omitempty"`
+}
+
+func CreateRekeyInput(
+	inputPath string,
+	password string,
+	newPassword string,
+	expiresIn string,
+	serverAddress string,
+	upgradeAlgVersion bool,
+	destroyOldKey bool,
+	verbose bool,
+	quiet bool,
+) (*RekeyInput, error) {
+	if inputPath == "" {
+		return nil, fmt.Errorf("input path is required")
+	}
+	if !io.FileExists(inputPath) {
+		return nil, models.NewCodedError(models.ErrorCodeInputNotFound, "input file does not exist: '%s'", inputPath)
+	}
+
+	if password == "" {
+		return nil, fmt.Errorf("password is required")
+	}
+
+	if newPassword != "" && newPassword == password {
+		return nil, fmt.Errorf("new password is the same as the current password")
+	}
+
+	profile, err := loadProfile()
+	if err != nil {
+		return nil, err
+	}
+
+	var expiration time.Time
+	if expiresIn != "" {
+		expiration, err = parseExpiration(expiresIn)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if serverAddress != "" {
+		if err := validateServerAddress(serverAddress); err != nil {
+			return nil, err
+		}
+	}
+
+	if destroyOldKey && profile.Token == "" {
+		return nil, fmt.Errorf("destroying the old key requires the API token that created it")
+	}
+
+	logLevel := logging.LogLevelInfo
+	if verbose {
+		logLevel = logging.LogLevelVerbose
+	}
+	if quiet {
+		logLevel = logging.LogLevelError
+	}
+
+	return &RekeyInput{
+		InputPath:          inputPath,
+		Password:           password,
+		NewPassword:        newPassword,
+		Expiration:         expiration,
+		ServerAddress:      serverAddress,
+		Token:              profile.Token,
+		TokenServerAddress: profile.ServerAddress,
+		UpgradeAlgVersion:  upgradeAlgVersion,
+		DestroyOldKey:      destroyOldKey,
+		LogLevel:           logLevel,
+	}, nil
+}
+
+// Rekey encrypts the file with a new server key, replacing the file in place. The content is decrypted in memory only,
+// and the file keeps its old content if anything fails before it is replaced.
+func Rekey(input RekeyInput) (*RekeyResult, error) {
+	configureLogging(input.LogLevel)
+	logger := logging.MakeLogger("rekey")
+
+	logger.Verbose("Reading file '%s'", input.InputPath)
+	contentWithMetadata, err := io.ReadContentWithMetadataFromFile(input.InputPath)
+	if err != nil {
+		return nil, err
+	}
+	oldMetadata := contentWithMetadata.Metadata
+
+	// Destroying a shared key would make the other files of its group unreadable
+	if input.DestroyOldKey && oldMetadata.Group != "" {
+		return nil, models.NewCodedError(models.ErrorCodeInvalidInput, "the old key is shared by key group '%s', destroy it with 'group destroy' once all of its files are rekeyed", oldMetadata.Group)
+	}
+
+	oldKeyToken := tokenForServer(input.Token, input.TokenServerAddress, oldMetadata.ServerAddress)
+	if input.DestroyOldKey && oldKeyToken == "" {
+		return nil, models.NewCodedError(models.ErrorCodeInvalidInput, "the old key is on server '%s', the API token is only sent to the server of the profile '%s'; select the profile of that server to destroy it", oldMetadata.ServerAddress, input.TokenServerAddress)
+	}
+
+	content, err := decryptContent(contentWithMetadata, input.Password, "", interaction.EncryptWithExistingKey)
+	if err != nil {
+		return nil, err
+	}
+	logger.Verbose("Decrypted %d bytes in memory", len(content))
+
+	serverAddress := input.ServerAddress
+	if serverAddress == "" {
+		serverAddress = interaction.ResolveServerAddress(oldMetadata.ServerAddress)
+	}
+	expiration := input.Expiration
+	if expiration.IsZero() {
+		expiration = oldMetadata.Expiration
+	}
+	algVersion := models.ParseAlgVersion(oldMetadata.AlgVersion)
+	if input.UpgradeAlgVersion {
+		algVersion = models.CurrentAlgVersion()
+	}
+	password := input.Password
+	if input.NewPassword != "" {
+		password = input.NewPassword
+	}
+
+	logger.Verbose("Creating remote key, using server '%s' and expiration '%s'", serverAddress, expiration.String())
+	token := tokenForServer(input.Token, input.TokenServerAddress, serverAddress)
+	remoteKey, err := interaction.GenerateKeyAndEncrypt(serverAddress, token, password, expiration, "", algVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	encryptedContent, err := encryptContent(content, password, remoteKey)
+	if err != nil {
+		return nil, err
+	}
+
+	newContentWithMetadata := models.FileContentWithMetadata{
+		FileContent: encryptedContent,
+		Metadata:    remoteKey.Metadata,
+	}
+	newContentWithMetadata.Metadata.Format = oldMetadata.Format
+	newContentWithMetadata.Metadata.Mode = oldMetadata.Mode
+
+	// The file is the only copy of the content, and with --destroy-old-key the old key is gone too
+	if err := verifyEncryptedContent(&newContentWithMetadata, content, password, remoteKey); err != nil {
+		return nil, fmt.Errorf("the file was not replaced, as the test decryption with the new key failed: %w", err)
+	}
+
+	logger.Verbose("Replacing file '%s' (%d bytes)", input.InputPath, len(encryptedContent))
+	if err := io.ReplaceContentWithMetadataInFile(input.InputPath, &newContentWithMetadata); err != nil {
+		return nil, err
+	}
+	recordInInventory(map[string]models.Metadata{input.InputPath: newContentWithMetadata.Metadata})
+
+	result := &RekeyResult{
+		Input:           input.InputPath,
+		EncryptedBytes:  len(encryptedContent),
+		OldKey:          fileKeyOf(oldMetadata),
+		FileKey:         fileKeyOf(newContentWithMetadata.Metadata),
+		PasswordChanged: password != input.Password,
+	}
+
+	logger.Info("Rekeyed '%s'", input.InputPath)
+	logger.Info("Key ID:         %s -> %s", result.OldKey.KeyId, result.KeyId)
+	logger.Info("Expires at:     %s (in %s)", result.Expiration.String(), time.Until(result.Expiration).Round(time.Second).String())
+	logger.Info("Server Address: %s", result.ServerAddress)
+	logger.Info("Alg Version:    %s", result.AlgVersion)
+
+	if input.DestroyOldKey {
+		if _, err := interaction.DestroyKey(oldMetadata.ServerAddress, oldKeyToken, oldMetadata.KeyId, ""); err != nil {
+			return result, fmt.Errorf("rekeyed '%s', but failed to destroy the old key %s: %w", input.InputPath, oldMetadata.KeyId, err)
+		}
+		result.OldKeyDestroyed = true
+		logger.Info("Destroyed old key %s", oldMetadata.KeyId)
+	}
+
+	return result, nil
+}
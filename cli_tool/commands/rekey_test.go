@@ -0,0 +1,290 @@
+package commands
+
+import (
+	"Forgetti/interaction"
+	"Forgetti/io"
+	"Forgetti/models"
+	"bytes"
+	"forgetti-common/logging"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// decryptTestFile decrypts the file in memory, asking the server of its header for the key
+func decryptTestFile(t *testing.T, path string, password string) (string, error) {
+	t.Helper()
+
+	contentWithMetadata, err := io.ReadContentWithMetadataFromFile(path)
+	if err != nil {
+		t.Fatalf("failed to read '%s': %v", path, err)
+	}
+	content, err := decryptContent(contentWithMetadata, password, "", interaction.EncryptWithExistingKey)
+	return string(content), err
+}
+
+func readMetadata(t *testing.T, path string) models.Metadata {
+	t.Helper()
+
+	contentWithMetadata, err := io.ReadContentWithMetadataFromFile(path)
+	if err != nil {
+		t.Fatalf("failed to read '%s': %v", path, err)
+	}
+	return contentWithMetadata.Metadata
+}
+
+func TestRekey(t *testing.T) {
+	useTestConfig(t, "")
+	stub := newStubServer(t)
+	path := filepath.Join(t.TempDir(), "report.txt.forgetti")
+	old := stub.encryptTestFile(path, "quarterly report", testPassword)
+	expiration := time.Now().Add(48 * time.Hour).Round(time.Second)
+
+	result, err := Rekey(RekeyInput{
+		InputPath:         path,
+		Password:          testPassword,
+		Expiration:        expiration,
+		UpgradeAlgVersion: true,
+		LogLevel:          logging.LogLevelError,
+	})
+	if err != nil {
+		t.Fatalf("Rekey failed: %v", err)
+	}
+
+	metadata := readMetadata(t, path)
+	if metadata.KeyId == old.Metadata.KeyId || result.KeyId != metadata.KeyId || result.OldKey.KeyId != old.Metadata.KeyId {
+		t.Errorf("expected a new key, got %s (result: %s, old key: %s)", metadata.KeyId, result.KeyId, result.OldKey.KeyId)
+	}
+	if !metadata.Expiration.Equal(expiration) {
+		t.Errorf("expected expiration %s, got %s", expiration, metadata.Expiration)
+	}
+	if metadata.ServerAddress != stub.URL() {
+		t.Errorf("expected the file to stay on server %s, got %s", stub.URL(), metadata.ServerAddress)
+	}
+	if metadata.AlgVersion != models.CurrentAlgVersion().String() {
+		t.Errorf("expected algorithm version %s, got %s", models.CurrentAlgVersion().String(), metadata.AlgVersion)
+	}
+	if result.PasswordChanged || result.OldKeyDestroyed {
+		t.Errorf("expected neither a password change nor a destroyed key: %+v", result)
+	}
+	if !stub.hasKey(old.Metadata.KeyId) {
+		t.Error("the old key was destroyed without --destroy-old-key")
+	}
+
+	content, err := decryptTestFile(t, path, testPassword)
+	if err != nil {
+		t.Fatalf("failed to decrypt the rekeyed file: %v", err)
+	}
+	if content != "quarterly report" {
+		t.Errorf("expected the content to stay the same, got %q", content)
+	}
+}
+
+func TestRekeyKeepsExpirationByDefault(t *testing.T) {
+	useTestConfig(t, "")
+	stub := newStubServer(t)
+	path := filepath.Join(t.TempDir(), "report.txt.forgetti")
+	old := stub.encryptTestFile(path, "quarterly report", testPassword)
+
+	if _, err := Rekey(RekeyInput{InputPath: path, Password: testPassword, LogLevel: logging.LogLevelError}); err != nil {
+		t.Fatalf("Rekey failed: %v", err)
+	}
+
+	metadata := readMetadata(t, path)
+	if !metadata.Expiration.Equal(old.Metadata.Expiration) {
+		t.Errorf("expected the expiration %s of the old key, got %s", old.Metadata.Expiration, metadata.Expiration)
+	}
+}
+
+func TestRekeyChangesPassword(t *testing.T) {
+	useTestConfig(t, "")
+	stub := newStubServer(t)
+	path := filepath.Join(t.TempDir(), "report.txt.forgetti")
+	stub.encryptTestFile(path, "quarterly report", testPassword)
+
+	result, err := Rekey(RekeyInput{
+		InputPath:   path,
+		Password:    testPassword,
+		NewPassword: "new password",
+		LogLevel:    logging.LogLevelError,
+	})
+	if err != nil {
+		t.Fatalf("Rekey failed: %v", err)
+	}
+	if !result.PasswordChanged {
+		t.Error("expected the password change to be reported")
+	}
+
+	content, err := decryptTestFile(t, path, "new password")
+	if err != nil {
+		t.Fatalf("failed to decrypt with the new password: %v", err)
+	}
+	if content != "quarterly report" {
+		t.Errorf("expected the content to stay the same, got %q", content)
+	}
+
+	if _, err := decryptTestFile(t, path, testPassword); models.ErrorCode(err) != models.ErrorCodeDecryptionFailed {
+		t.Errorf("expected the old password to fail with %s, got %v", models.ErrorCodeDecryptionFailed, err)
+	}
+}
+
+func TestRekeyDestroysOldKey(t *testing.T) {
+	useTestConfig(t, "")
+	stub := newStubServer(t)
+	path := filepath.Join(t.TempDir(), "report.txt.forgetti")
+	old := stub.encryptTestFile(path, "quarterly report", testPassword)
+
+	// A copy of the file with the old key can no longer be decrypted afterwards
+	copyPath := filepath.Join(t.TempDir(), "copy.forgetti")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(copyPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Rekey(RekeyInput{
+		InputPath:          path,
+		Password:           testPassword,
+		Token:              "token",
+		TokenServerAddress: stub.URL(),
+		DestroyOldKey:      true,
+		LogLevel:           logging.LogLevelError,
+	})
+	if err != nil {
+		t.Fatalf("Rekey failed: %v", err)
+	}
+	if !result.OldKeyDestroyed {
+		t.Error("expected the old key to be reported as destroyed")
+	}
+	if stub.hasKey(old.Metadata.KeyId) {
+		t.Error("the old key still exists on the server")
+	}
+
+	if _, err := decryptTestFile(t, path, testPassword); err != nil {
+		t.Errorf("failed to decrypt the rekeyed file: %v", err)
+	}
+	if _, err := decryptTestFile(t, copyPath, testPassword); models.ErrorCode(err) != models.ErrorCodeKeyNotFound {
+		t.Errorf("expected the copy with the old key to fail with %s, got %v", models.ErrorCodeKeyNotFound, err)
+	}
+}
+
+func TestRekeyLeavesFileUnchangedOnFailure(t *testing.T) {
+	useTestConfig(t, "")
+	stub := newStubServer(t)
+
+	tests := []struct {
+		name    string
+		prepare func(path string, metadata models.Metadata) RekeyInput
+	}{
+		{"wrong password", func(path string, _ models.Metadata) RekeyInput {
+			return RekeyInput{InputPath: path, Password: "wrong password"}
+		}},
+		{"old key destroyed", func(path string, metadata models.Metadata) RekeyInput {
+			stub.forget(metadata.KeyId)
+			return RekeyInput{InputPath: path, Password: testPassword}
+		}},
+		{"new server unreachable", func(path string, _ models.Metadata) RekeyInput {
+			return RekeyInput{InputPath: path, Password: testPassword, ServerAddress: "http://127.0.0.1:1"}
+		}},
+		{"key of a group", func(path string, metadata models.Metadata) RekeyInput {
+			written, err := io.ReadContentWithMetadataFromFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			written.Metadata.Group = "backups"
+			if err := io.WriteContentWithMetadataToFile(path, true, written); err != nil {
+				t.Fatal(err)
+			}
+			return RekeyInput{InputPath: path, Password: testPassword, Token: "token", DestroyOldKey: true}
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "report.txt.forgetti")
+			written := stub.encryptTestFile(path, "quarterly report", testPassword)
+
+			input := test.prepare(path, written.Metadata)
+			input.LogLevel = logging.LogLevelError
+			before, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := Rekey(input); err == nil {
+				t.Fatal("expected Rekey to fail")
+			}
+
+			after, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(before, after) {
+				t.Error("the file was changed")
+			}
+		})
+	}
+}
+
+func TestVerifyEncryptedContentWithOtherKey(t *testing.T) {
+	remoteKey := localKey("encrypted-key-hash")
+	encrypted, err := encryptContent([]byte("content"), testPassword, remoteKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contentWithMetadata := &models.FileContentWithMetadata{FileContent: encrypted, Metadata: remoteKey.Metadata}
+
+	if err := verifyEncryptedContent(contentWithMetadata, []byte("content"), testPassword, remoteKey); err != nil {
+		t.Errorf("expected the test decryption to succeed: %v", err)
+	}
+	if err := verifyEncryptedContent(contentWithMetadata, []byte("content"), testPassword, localKey("other-key-hash")); err == nil {
+		t.Error("expected the test decryption with another key to fail")
+	}
+	if err := verifyEncryptedContent(contentWithMetadata, []byte("other content"), testPassword, remoteKey); err == nil {
+		t.Error("expected the test decryption of other content to fail")
+	}
+}
+
+func TestRekeySendsTokenOnlyToProfileServer(t *testing.T) {
+	useTestConfig(t, "")
+	stub := newStubServer(t)
+	profileServer := newStubServer(t)
+	path := filepath.Join(t.TempDir(), "report.txt.forgetti")
+	old := stub.encryptTestFile(path, "quarterly report", testPassword)
+
+	// The server in the header of the file is not the server of the profile
+	input := RekeyInput{
+		InputPath:          path,
+		Password:           testPassword,
+		Token:              "token",
+		TokenServerAddress: profileServer.URL(),
+		DestroyOldKey:      true,
+		LogLevel:           logging.LogLevelError,
+	}
+	if _, err := Rekey(input); models.ErrorCode(err) != models.ErrorCodeInvalidInput {
+		t.Fatalf("expected destroying the old key to fail with %s, got %v", models.ErrorCodeInvalidInput, err)
+	}
+	if !stub.hasKey(old.Metadata.KeyId) || readMetadata(t, path).KeyId != old.Metadata.KeyId {
+		t.Error("expected the file and its old key to stay unchanged")
+	}
+
+	input.DestroyOldKey = false
+	if _, err := Rekey(input); err != nil {
+		t.Fatalf("Rekey failed: %v", err)
+	}
+	if stub.receivedToken() {
+		t.Error("the API token was sent to the server in the header of the file")
+	}
+
+	// The token is sent once the server of the file is the server of the profile
+	input.TokenServerAddress = stub.URL() + "/"
+	if _, err := Rekey(input); err != nil {
+		t.Fatalf("Rekey failed: %v", err)
+	}
+	if !stub.receivedToken() {
+		t.Error("expected the API token to be sent to the server of the profile")
+	}
+}
@@ -0,0 +1,179 @@
+package commands
+
+import (
+	"Forgetti/interaction"
+	"Forgetti/io"
+	"Forgetti/models"
+	"fmt"
+	"forgetti-common/logging"
+	"strings"
+)
+
+type RetargetInput struct {
+	Files []string
+	// From limits the rewrite to files of this server, if set
+	From string
+	// To is the new server address. If empty, each file gets the address its server moved to according to the server
+	// aliases of the config.
+	To       string
+	DryRun   bool
+	LogLevel logging.LogLevel
+}
+
+type RetargetFileResult struct {
+	Input     string `json:"input"`
+	From      string `json:"from,omitempty"`
+	To        string `json:"to,omitempty"`
+	Changed   bool   `json:"changed"`
+	Error     string `json:"error,omitempty"`
+	ErrorCode string `json:"error_code,omitempty"`
+}
+
+func (r *RetargetFileResult) fail(err error) RetargetFileResult {
+	r.Error = err.Error()
+	r.ErrorCode = models.ErrorCode(err)
+	return *r
+}
+
+type RetargetResult struct {
+	DryRun    bool                 `json:"dry_run"`
+	Changed   int                  `json:"changed"`
+	Unchanged int                  `json:"unchanged"`
+	Failed    int                  `json:"failed"`
+	Files     []RetargetFileResult `json:"files"`
+}
+
+func CreateRetargetInput(
+	patterns []string,
+	fileList string,
+	from string,
+	to string,
+	dryRun bool,
+	verbose bool,
+	quiet bool,
+) (*RetargetInput, error) {
+	files, err := collectFiles(patterns, fileList)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, address := range []string{from, to} {
+		if address == "" {
+			continue
+		}
+		if err := validateServerAddress(address); err != nil {
+			return nil, err
+		}
+	}
+
+	// Loads the server aliases
+	if _, err := loadProfile(); err != nil {
+		return nil, err
+	}
+	if to == "" && !interaction.HasServerAliases() {
+		return nil, fmt.Errorf("new server address is required, as no server aliases are configured (see 'config alias add')")
+	}
+
+	logLevel := logging.LogLevelInfo
+	if verbose {
+		logLevel = logging.LogLevelVerbose
+	}
+	if quiet {
+		logLevel = logging.LogLevelError
+	}
+
+	return &RetargetInput{
+		Files:    files,
+		From:     strings.TrimSuffix(from, "/"),
+		To:       to,
+		DryRun:   dryRun,
+		LogLevel: logLevel,
+	}, nil
+}
+
+// Retarget rewrites the server address in the headers of the files. Files of other servers than input.From, or
+// without a server alias, are left unchanged.
+func Retarget(input RetargetInput) (*RetargetResult, error) {
+	configureLogging(input.LogLevel)
+	logger := logging.MakeLogger("retarget")
+
+	result := &RetargetResult{DryRun: input.DryRun}
+	retargeted := make(map[string]models.Metadata)
+	for _, file := range input.Files {
+		fileResult := retargetFile(input, file, retargeted)
+		result.Files = append(result.Files, fileResult)
+
+		switch {
+		case fileResult.Error != "":
+			result.Failed++
+			logger.Error("Failed '%s': %s", file, fileResult.Error)
+		case fileResult.Changed:
+			result.Changed++
+			logger.Info("'%s': %s -> %s", file, fileResult.From, fileResult.To)
+		default:
+			result.Unchanged++
+			logger.Verbose("'%s': unchanged (%s)", file, fileResult.From)
+		}
+	}
+	recordInInventory(retargeted)
+
+	verb := "Changed"
+	if input.DryRun {
+		verb = "Would change"
+	}
+	logger.Info("%s %d files, %d unchanged, %d failed", verb, result.Changed, result.Unchanged, result.Failed)
+
+	if result.Failed > 0 {
+		return result, models.NewCodedError(models.ErrorCodeBatchFailed, "failed to retarget %d of %d files", result.Failed, len(result.Files))
+	}
+	return result, nil
+}
+
+// retargetFile adds the new header of a rewritten file to retargeted
+func retargetFile(input RetargetInput, file string, retargeted map[string]models.Metadata) RetargetFileResult {
+	result := RetargetFileResult{Input: file}
+
+	if !io.FileExists(file) {
+		return result.fail(models.NewCodedError(models.ErrorCodeInputNotFound, "input file does not exist: '%s'", file))
+	}
+
+	contentWithMetadata, err := io.ReadContentWithMetadataFromFile(file)
+	if err != nil {
+		return result.fail(err)
+	}
+
+	current := contentWithMetadata.Metadata.ServerAddress
+	result.From = current
+	if input.From != "" && strings.TrimSuffix(current, "/") != input.From {
+		return result
+	}
+
+	target := input.To
+	if target == "" {
+		target = interaction.ResolveServerAddress(current)
+	}
+	if strings.TrimSuffix(target, "/") == strings.TrimSuffix(current, "/") {
+		return result
+	}
+
+	result.To = target
+	if !input.DryRun {
+		if err := rewriteServerAddress(file, contentWithMetadata, target); err != nil {
+			return result.fail(err)
+		}
+		retargeted[file] = contentWithMetadata.Metadata
+	}
+
+	result.Changed = true
+	return result
+}
+
+// rewriteServerAddress is the only place where the header of an existing file is changed. The header is not
+// authenticated, so it is rewritten without the password; once it is, the header must be sealed again here.
+func rewriteServerAddress(path string, contentWithMetadata *models.FileContentWithMetadata, serverAddress string) error {
+	contentWithMetadata.Metadata.ServerAddress = serverAddress
+	if err := io.ReplaceContentWithMetadataInFile(path, contentWithMetadata); err != nil {
+		return fmt.Errorf("failed to rewrite '%s': %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package commands
+
+import (
+	"Forgetti/interaction"
+	"Forgetti/models"
+	"bytes"
+	"forgetti-common/logging"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeFileOfServer writes an encrypted file whose header names the server
+func writeFileOfServer(t *testing.T, path string, serverAddress string) {
+	t.Helper()
+
+	remoteKey := localKey("encrypted-key-hash")
+	remoteKey.Metadata.ServerAddress = serverAddress
+	writeEncryptedTestFile(t, path, "content", testPassword, remoteKey)
+}
+
+func retargetFiles(t *testing.T, input RetargetInput) *RetargetResult {
+	t.Helper()
+
+	input.LogLevel = logging.LogLevelError
+	result, err := Retarget(input)
+	if err != nil {
+		t.Fatalf("Retarget failed: %v", err)
+	}
+	return result
+}
+
+func TestRetargetFrom(t *testing.T) {
+	useTestConfig(t, "")
+	dir := t.TempDir()
+	old := filepath.Join(dir, "old.forgetti")
+	oldWithSlash := filepath.Join(dir, "old-with-slash.forgetti")
+	other := filepath.Join(dir, "other.forgetti")
+	writeFileOfServer(t, old, "http://old.example.com")
+	writeFileOfServer(t, oldWithSlash, "http://old.example.com/")
+	writeFileOfServer(t, other, "http://other.example.com")
+
+	input, err := CreateRetargetInput([]string{old, oldWithSlash, other}, "", "http://old.example.com/", "http://new.example.com", false, false, true)
+	if err != nil {
+		t.Fatalf("CreateRetargetInput failed: %v", err)
+	}
+	result := retargetFiles(t, *input)
+	if result.Changed != 2 || result.Unchanged != 1 {
+		t.Errorf("expected 2 changed files and 1 unchanged file, got %+v", result)
+	}
+
+	for path, expected := range map[string]string{
+		old:          "http://new.example.com",
+		oldWithSlash: "http://new.example.com",
+		other:        "http://other.example.com",
+	} {
+		if serverAddress := readMetadata(t, path).ServerAddress; serverAddress != expected {
+			t.Errorf("'%s': expected server %s, got %s", filepath.Base(path), expected, serverAddress)
+		}
+	}
+}
+
+func TestRetargetWithServerAliases(t *testing.T) {
+	useTestConfig(t, `{"server_aliases": {"http://old.example.com/": "http://new.example.com"}}`)
+	dir := t.TempDir()
+	old := filepath.Join(dir, "old.forgetti")
+	oldWithSlash := filepath.Join(dir, "old-with-slash.forgetti")
+	moved := filepath.Join(dir, "moved.forgetti")
+	other := filepath.Join(dir, "other.forgetti")
+	writeFileOfServer(t, old, "http://old.example.com")
+	writeFileOfServer(t, oldWithSlash, "http://old.example.com/")
+	writeFileOfServer(t, moved, "http://new.example.com/")
+	writeFileOfServer(t, other, "http://other.example.com")
+
+	input, err := CreateRetargetInput([]string{old, oldWithSlash, moved, other}, "", "", "", false, false, true)
+	if err != nil {
+		t.Fatalf("CreateRetargetInput failed: %v", err)
+	}
+	result := retargetFiles(t, *input)
+	if result.Changed != 2 || result.Unchanged != 2 {
+		t.Errorf("expected 2 changed files and 2 unchanged files, got %+v", result)
+	}
+
+	for _, path := range []string{old, oldWithSlash} {
+		if serverAddress := readMetadata(t, path).ServerAddress; serverAddress != "http://new.example.com" {
+			t.Errorf("'%s': expected the server of the alias, got %s", filepath.Base(path), serverAddress)
+		}
+	}
+	// A file that already names the new server, with or without a slash, is not rewritten
+	if serverAddress := readMetadata(t, moved).ServerAddress; serverAddress != "http://new.example.com/" {
+		t.Errorf("expected the file of the new server to be unchanged, got %s", serverAddress)
+	}
+}
+
+func TestCreateRetargetInputRequiresTarget(t *testing.T) {
+	useTestConfig(t, "")
+	path := filepath.Join(t.TempDir(), "old.forgetti")
+	writeFileOfServer(t, path, "http://old.example.com")
+
+	if _, err := CreateRetargetInput([]string{path}, "", "", "", false, false, true); err == nil {
+		t.Error("expected a missing server address to be rejected without server aliases")
+	}
+	if _, err := CreateRetargetInput([]string{path}, "", "", "old.example.com", false, false, true); err == nil {
+		t.Error("expected an invalid server address to be rejected")
+	}
+}
+
+func TestRetargetDryRun(t *testing.T) {
+	useTestConfig(t, "")
+	path := filepath.Join(t.TempDir(), "old.forgetti")
+	writeFileOfServer(t, path, "http://old.example.com")
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := retargetFiles(t, RetargetInput{Files: []string{path}, To: "http://new.example.com", DryRun: true})
+	if result.Changed != 1 || !result.DryRun || result.Files[0].To != "http://new.example.com" {
+		t.Errorf("expected the change to be reported, got %+v", result)
+	}
+
+	after, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Error("the file was changed by a dry run")
+	}
+	if files := loadTestInventory(t).Files; len(files) != 0 {
+		t.Errorf("expected a dry run not to record files, got %+v", files)
+	}
+}
+
+func TestRetargetUpdatesInventory(t *testing.T) {
+	useTestConfig(t, "")
+	dir := t.TempDir()
+	old := filepath.Join(dir, "old.forgetti")
+	other := filepath.Join(dir, "other.forgetti")
+	writeFileOfServer(t, old, "http://old.example.com")
+	writeFileOfServer(t, other, "http://other.example.com")
+	recordInInventory(map[string]models.Metadata{
+		old:   readMetadata(t, old),
+		other: readMetadata(t, other),
+	})
+
+	retargetFiles(t, RetargetInput{Files: []string{old, other}, From: "http://old.example.com", To: "http://new.example.com"})
+
+	inventory := loadTestInventory(t)
+	if entry := inventory.Find(old); entry == nil || entry.ServerAddress != "http://new.example.com" {
+		t.Errorf("expected the entry of the retargeted file to name the new server, got %+v", entry)
+	}
+	if entry := inventory.Find(other); entry == nil || entry.ServerAddress != "http://other.example.com" {
+		t.Errorf("expected the entry of the other file to be unchanged, got %+v", entry)
+	}
+}
+
+func TestRetargetKeepsContent(t *testing.T) {
+	useTestConfig(t, "")
+	stub := newStubServer(t)
+	path := filepath.Join(t.TempDir(), "report.txt.forgetti")
+	stub.encryptTestFile(path, "quarterly report", testPassword)
+
+	// The file names a server that moved to the stub server, which the alias resolves when decrypting
+	retargetFiles(t, RetargetInput{Files: []string{path}, To: "http://old.example.com"})
+	interaction.SetServerAliases(map[string]string{"http://old.example.com/": stub.URL()})
+
+	content, err := decryptTestFile(t, path, testPassword)
+	if err != nil {
+		t.Fatalf("failed to decrypt the retargeted file: %v", err)
+	}
+	if content != "quarterly report" {
+		t.Errorf("expected the content to stay the same, got %q", content)
+	}
+}
+
+func TestRetargetKeepsFileMode(t *testing.T) {
+	useTestConfig(t, "")
+	path := filepath.Join(t.TempDir(), "shared.forgetti")
+	writeFileOfServer(t, path, "http://old.example.com")
+	if err := os.Chmod(path, 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	result := retargetFiles(t, RetargetInput{Files: []string{path}, To: "http://new.example.com"})
+	if result.Changed != 1 {
+		t.Fatalf("expected 1 changed file, got %+v", result)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("expected mode 640, got %o", info.Mode().Perm())
+	}
+}
+
+func TestRetargetReportsFailures(t *testing.T) {
+	useTestConfig(t, "")
+	dir := t.TempDir()
+	ok := filepath.Join(dir, "ok.forgetti")
+	corrupt := filepath.Join(dir, "corrupt.forgetti")
+	writeFileOfServer(t, ok, "http://old.example.com")
+	writeInputFile(t, corrupt, "not an encrypted file")
+
+	result, err := Retarget(RetargetInput{
+		Files:    []string{ok, corrupt, filepath.Join(dir, "missing.forgetti")},
+		To:       "http://new.example.com",
+		LogLevel: logging.LogLevelError,
+	})
+	if models.ErrorCode(err) != models.ErrorCodeBatchFailed {
+		t.Errorf("expected error code %s, got %v", models.ErrorCodeBatchFailed, err)
+	}
+	if result.Changed != 1 || result.Failed != 2 {
+		t.Errorf("expected 1 changed and 2 failed files, got %+v", result)
+	}
+	if result.Files[2].ErrorCode != models.ErrorCodeInputNotFound {
+		t.Errorf("expected error code %s for the missing file, got %s", models.ErrorCodeInputNotFound, result.Files[2].ErrorCode)
+	}
+}
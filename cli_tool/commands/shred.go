@@ -0,0 +1,100 @@
+package commands
+
+import (
+	"Forgetti/models"
+	"Forgetti/shred"
+	"fmt"
+	"forgetti-common/logging"
+	"os"
+)
+
+const maxShredPasses = 35
+
+type ShredInput struct {
+	Paths []string
+	// Recursive allows directories, which are removed with all of their files
+	Recursive bool
+	Passes    int
+	LogLevel  logging.LogLevel
+}
+
+type ShredResult struct {
+	Passes int `json:"passes"`
+	// Shredded lists the given paths that were removed
+	Shredded []string `json:"shredded"`
+	// Files is the number of shredded files, including those of directories
+	Files int `json:"files"`
+}
+
+func CreateShredInput(patterns []string, recursive bool, passes int, verbose bool, quiet bool) (*ShredInput, error) {
+	paths, err := collectFiles(patterns, "")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range paths {
+		info, err := os.Lstat(path)
+		if err != nil {
+			return nil, models.NewCodedError(models.ErrorCodeInputNotFound, "input file does not exist: '%s'", path)
+		}
+		if info.IsDir() && !recursive {
+			return nil, fmt.Errorf("'%s' is a directory, use --recursive to shred it with all of its files", path)
+		}
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil, fmt.Errorf("only regular files can be shredded: '%s'", path)
+		}
+	}
+
+	if passes < 1 || passes > maxShredPasses {
+		return nil, fmt.Errorf("number of passes must be between 1 and %d", maxShredPasses)
+	}
+
+	logLevel := logging.LogLevelInfo
+	if verbose {
+		logLevel = logging.LogLevelVerbose
+	}
+	if quiet {
+		logLevel = logging.LogLevelError
+	}
+
+	return &ShredInput{
+		Paths:     paths,
+		Recursive: recursive,
+		Passes:    passes,
+		LogLevel:  logLevel,
+	}, nil
+}
+
+// Shred overwrites and removes the files, and the directories with all of their files. Stops at the first failure.
+func Shred(input ShredInput) (*ShredResult, error) {
+	configureLogging(input.LogLevel)
+	logger := logging.MakeLogger("shred")
+	logger.Warning(shred.Warning)
+
+	result := &ShredResult{Passes: input.Passes, Shredded: []string{}}
+	for _, path := range input.Paths {
+		info, err := os.Lstat(path)
+		if err != nil {
+			return result, fmt.Errorf("failed to read '%s': %w", path, err)
+		}
+
+		if info.IsDir() {
+			count, err := shred.Directory(path, input.Passes)
+			result.Files += count
+			if err != nil {
+				return result, err
+			}
+			logger.Info("Shredded '%s' (%d files)", path, count)
+		} else {
+			if err := shred.File(path, input.Passes); err != nil {
+				return result, err
+			}
+			result.Files++
+			logger.Info("Shredded '%s'", path)
+		}
+
+		result.Shredded = append(result.Shredded, path)
+	}
+
+	return result, nil
+}
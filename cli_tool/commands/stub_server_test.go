@@ -0,0 +1,266 @@
+package commands
+
+import (
+	"Forgetti/interaction"
+	"Forgetti/io"
+	"Forgetti/models"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"forgetti-common/constants"
+	"forgetti-common/crypto"
+	"forgetti-common/dto"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubServer implements the key routes of the server in memory. It does not advertise a key policy, so the client
+// skips its checks.
+type stubServer struct {
+	t      *testing.T
+	server *httptest.Server
+	mutex  sync.Mutex
+	keys   map[string]*stubKey
+	// encryptRequests counts the requests for the encrypted key hash of each key
+	encryptRequests map[string]int
+	destroyed       []string
+	// authorizations holds the Authorization headers of the requests for new keys and to destroy keys
+	authorizations []string
+}
+
+type stubKey struct {
+	pair    *crypto.KeyPair
+	expired bool
+}
+
+func newStubServer(t *testing.T) *stubServer {
+	stub := &stubServer{t: t, keys: make(map[string]*stubKey), encryptRequests: make(map[string]int)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+constants.NewKeyRoute, stub.newKey)
+	mux.HandleFunc("POST "+constants.EncryptRoute, stub.encrypt)
+	mux.HandleFunc("POST "+constants.DestroyKeyRoute, stub.destroy)
+	stub.server = httptest.NewServer(mux)
+	t.Cleanup(stub.server.Close)
+	return stub
+}
+
+func (s *stubServer) URL() string {
+	return s.server.URL
+}
+
+func (s *stubServer) newKey(w http.ResponseWriter, r *http.Request) {
+	s.recordAuthorization(r)
+	var request dto.NewKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeStubError(w, http.StatusBadRequest, "bad-request", nil)
+		return
+	}
+
+	pair, err := crypto.GenerateKeyPair()
+	if err != nil {
+		s.t.Errorf("failed to generate key pair: %v", err)
+		writeStubError(w, http.StatusInternalServerError, "internal-server-error", nil)
+		return
+	}
+	encrypted, err := crypto.EncryptRsa(request.Content, pair.BroadcastKey)
+	if err != nil {
+		s.t.Errorf("failed to encrypt: %v", err)
+		writeStubError(w, http.StatusInternalServerError, "internal-server-error", nil)
+		return
+	}
+	verificationKey, err := crypto.SerializePrivateKey(pair.VerificationKey)
+	if err != nil {
+		s.t.Errorf("failed to serialize verification key: %v", err)
+		writeStubError(w, http.StatusInternalServerError, "internal-server-error", nil)
+		return
+	}
+
+	keyId := randomKeyId()
+	s.mutex.Lock()
+	s.keys[keyId] = &stubKey{pair: pair}
+	s.mutex.Unlock()
+
+	writeStubJson(w, dto.NewKeyResponse{
+		EncryptedContent: encrypted,
+		Metadata: dto.Metadata{
+			KeyId:           keyId,
+			Expiration:      request.Expiration,
+			VerificationKey: verificationKey,
+			Group:           request.Group,
+		},
+	})
+}
+
+func (s *stubServer) encrypt(w http.ResponseWriter, r *http.Request) {
+	var request dto.EncryptRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeStubError(w, http.StatusBadRequest, "bad-request", nil)
+		return
+	}
+
+	s.mutex.Lock()
+	s.encryptRequests[request.KeyId]++
+	key, ok := s.keys[request.KeyId]
+	s.mutex.Unlock()
+
+	switch {
+	case !ok:
+		writeStubError(w, http.StatusNotFound, models.ErrorCodeKeyNotFound, map[string]string{"key_id": request.KeyId})
+		return
+	case key.expired:
+		writeStubError(w, http.StatusGone, models.ErrorCodeKeyExpired, map[string]string{"key_id": request.KeyId})
+		return
+	}
+
+	encrypted, err := crypto.EncryptRsa(request.Content, key.pair.BroadcastKey)
+	if err != nil {
+		s.t.Errorf("failed to encrypt: %v", err)
+		writeStubError(w, http.StatusInternalServerError, "internal-server-error", nil)
+		return
+	}
+	writeStubJson(w, dto.EncryptResponse{EncryptedContent: encrypted})
+}
+
+func (s *stubServer) destroy(w http.ResponseWriter, r *http.Request) {
+	s.recordAuthorization(r)
+	var request dto.DestroyKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeStubError(w, http.StatusBadRequest, "bad-request", nil)
+		return
+	}
+
+	s.mutex.Lock()
+	_, ok := s.keys[request.KeyId]
+	delete(s.keys, request.KeyId)
+	if ok {
+		s.destroyed = append(s.destroyed, request.KeyId)
+	}
+	s.mutex.Unlock()
+
+	if !ok {
+		writeStubError(w, http.StatusNotFound, models.ErrorCodeKeyNotFound, map[string]string{"key_id": request.KeyId})
+		return
+	}
+	writeStubJson(w, dto.DestroyKeyResponse{KeyId: request.KeyId})
+}
+
+func (s *stubServer) recordAuthorization(r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.authorizations = append(s.authorizations, r.Header.Get("Authorization"))
+}
+
+// receivedToken reports whether any request for a new key or to destroy a key sent an API token
+func (s *stubServer) receivedToken() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, authorization := range s.authorizations {
+		if authorization != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// expire makes the server answer that the key expired, while the header of its files still says otherwise
+func (s *stubServer) expire(keyId string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.keys[keyId].expired = true
+}
+
+func (s *stubServer) forget(keyId string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.keys, keyId)
+}
+
+func (s *stubServer) hasKey(keyId string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, ok := s.keys[keyId]
+	return ok
+}
+
+func (s *stubServer) keyCount() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.keys)
+}
+
+func (s *stubServer) encryptRequestCount(keyId string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.encryptRequests[keyId]
+}
+
+// encryptTestFile encrypts the content into a new file at path, with a new key of the stub server
+func (s *stubServer) encryptTestFile(path string, content string, password string) *models.FileContentWithMetadata {
+	s.t.Helper()
+
+	remoteKey, err := interaction.GenerateKeyAndEncrypt(s.URL(), "", password, time.Now().Add(time.Hour), "", models.CurrentAlgVersion())
+	if err != nil {
+		s.t.Fatalf("failed to create key: %v", err)
+	}
+	return writeEncryptedTestFile(s.t, path, content, password, remoteKey)
+}
+
+func writeEncryptedTestFile(t *testing.T, path string, content string, password string, remoteKey *interaction.KeyGenerationResult) *models.FileContentWithMetadata {
+	t.Helper()
+
+	encrypted, err := encryptContent([]byte(content), password, remoteKey)
+	if err != nil {
+		t.Fatalf("failed to encrypt: %v", err)
+	}
+	contentWithMetadata := &models.FileContentWithMetadata{FileContent: encrypted, Metadata: remoteKey.Metadata}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := io.WriteContentWithMetadataToFile(path, false, contentWithMetadata); err != nil {
+		t.Fatalf("failed to write '%s': %v", path, err)
+	}
+	return contentWithMetadata
+}
+
+// useTestConfig points the CLI at a config file in a temporary directory, which also holds the key groups and the
+// inventory
+func useTestConfig(t *testing.T, content string) string {
+	t.Helper()
+
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	if content != "" {
+		if err := os.WriteFile(configPath, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("FORGETTI_CONFIG_PATH", configPath)
+	t.Setenv("FORGETTI_TOKEN", "")
+	t.Setenv("FORGETTI_PROFILE", "")
+	t.Cleanup(func() { interaction.SetServerAliases(nil) })
+	return configPath
+}
+
+func randomKeyId() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+func writeStubJson(w http.ResponseWriter, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeStubError(w http.ResponseWriter, status int, code string, data map[string]string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(dto.ErrorResponse{Message: code, ErrorCode: code, Data: data})
+}
@@ -0,0 +1,212 @@
+package commands
+
+import (
+	"Forgetti/archive"
+	"Forgetti/io"
+	"Forgetti/models"
+	"errors"
+	"fmt"
+	"forgetti-common/logging"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Exit codes of verify. With several files, the highest code of the failed files is used.
+const (
+	VerifyExitOk = 0
+	// VerifyExitError means the file could not be checked, for example because the server was unreachable
+	VerifyExitError = 1
+	// VerifyExitWrongPassword is also used for modified content, which authenticated encryption can't tell apart
+	VerifyExitWrongPassword = 2
+	// VerifyExitKeyExpired is used for expired and destroyed keys
+	VerifyExitKeyExpired = 3
+	VerifyExitCorrupt    = 4
+)
+
+// minEncryptedSize is the size of the AES-GCM nonce and authentication tag of empty content
+const minEncryptedSize = 12 + 16
+
+type VerifyInput struct {
+	Password      string
+	ServerAddress string
+	LogLevel      logging.LogLevel
+	BatchInput
+}
+
+// CreateVerifyInput checks the input path. A directory requires recursive, and all ".forgetti" files below it are
+// verified.
+func CreateVerifyInput(
+	inputPath string,
+	recursive bool,
+	password string,
+	serverAddress string,
+	jobs int,
+	verbose bool,
+	quiet bool,
+) (*VerifyInput, error) {
+	if inputPath == "" {
+		return nil, fmt.Errorf("input path is required")
+	}
+
+	info, err := os.Stat(inputPath)
+	if err != nil {
+		return nil, models.NewCodedError(models.ErrorCodeInputNotFound, "input file does not exist: '%s'", inputPath)
+	}
+	if info.IsDir() && !recursive {
+		return nil, fmt.Errorf("input is a directory, use --recursive to verify its encrypted files: '%s'", inputPath)
+	}
+
+	files := []string{inputPath}
+	if info.IsDir() {
+		files, err = findEncryptedFiles(inputPath)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			return nil, models.NewCodedError(models.ErrorCodeInputNotFound, "no .forgetti files found in '%s'", inputPath)
+		}
+	}
+
+	if password == "" {
+		return nil, fmt.Errorf("password is required")
+	}
+
+	if jobs < 1 || jobs > maxBatchJobs {
+		return nil, fmt.Errorf("number of jobs must be between 1 and %d", maxBatchJobs)
+	}
+
+	// The server address of each file is used unless one is given, the profile only adds its TLS pins and aliases
+	if _, err := loadProfile(); err != nil {
+		return nil, err
+	}
+
+	logLevel := logging.LogLevelInfo
+	if verbose {
+		logLevel = logging.LogLevelVerbose
+	}
+	if quiet {
+		logLevel = logging.LogLevelError
+	}
+
+	return &VerifyInput{
+		Password:      password,
+		ServerAddress: serverAddress,
+		LogLevel:      logLevel,
+		BatchInput:    BatchInput{Files: files, Jobs: jobs},
+	}, nil
+}
+
+func findEncryptedFiles(root string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.Type().IsRegular() && strings.HasSuffix(entry.Name(), ".forgetti") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search '%s': %w", root, err)
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// Verify asks the server for the key of each file and decrypts it in memory, checking its authentication tag. The
+// plaintext is discarded. Each key is requested only once.
+func Verify(input VerifyInput) (*BatchSummary, error) {
+	logger := setUpBatchLogging(input.LogLevel, "verify")
+	summary := BatchSummary{Operation: "verify", StartedAt: time.Now()}
+
+	logger.Info("Verifying %d files", len(input.Files))
+	keyHashes := newKeyHashCache()
+
+	summary.Files = runBatch(input.BatchInput, func(i int, file string) BatchFileResult {
+		result := BatchFileResult{Input: file}
+
+		contentWithMetadata, err := io.ReadContentWithMetadataFromFile(file)
+		if err != nil {
+			return result.fail(err)
+		}
+		result.KeyId = contentWithMetadata.Metadata.KeyId
+		result.Expiration = &contentWithMetadata.Metadata.Expiration
+
+		if err := checkEncryptedFile(contentWithMetadata); err != nil {
+			return result.fail(err)
+		}
+
+		content, err := decryptContent(contentWithMetadata, input.Password, input.ServerAddress, keyHashes.get)
+		if err != nil {
+			return result.fail(err)
+		}
+
+		if contentWithMetadata.Metadata.IsArchive() {
+			if _, err := archive.List(content); err != nil {
+				return result.fail(models.WithCode(models.ErrorCodeCorruptFile, fmt.Errorf("invalid directory archive: %w", err)))
+			}
+		}
+
+		return result
+	}, logger)
+
+	err := finishBatch(&summary, input.BatchInput, logger)
+	// A single file reports its own error code
+	if err != nil && len(summary.Files) == 1 {
+		file := summary.Files[0]
+		err = &models.CodedError{Code: file.ErrorCode, Err: errors.New(file.Error)}
+	}
+	return &summary, err
+}
+
+// checkEncryptedFile finds damage to the header and content that can be told apart from a wrong password
+func checkEncryptedFile(contentWithMetadata *models.FileContentWithMetadata) error {
+	metadata := contentWithMetadata.Metadata
+	if metadata.KeyId == "" || metadata.VerificationKey == "" || metadata.ServerAddress == "" {
+		return models.NewCodedError(models.ErrorCodeCorruptFile, "the header is missing the key id, verification key or server address")
+	}
+	if models.ParseAlgVersion(metadata.AlgVersion).String() != metadata.AlgVersion {
+		return models.NewCodedError(models.ErrorCodeCorruptFile, "invalid algorithm version '%s'", metadata.AlgVersion)
+	}
+	if len(contentWithMetadata.FileContent) < minEncryptedSize {
+		return models.NewCodedError(models.ErrorCodeCorruptFile, "the encrypted content is truncated (%d bytes)", len(contentWithMetadata.FileContent))
+	}
+	return nil
+}
+
+// VerifyExitCode returns the exit code of the result of Verify
+func VerifyExitCode(summary *BatchSummary, err error) int {
+	if err == nil {
+		return VerifyExitOk
+	}
+	if summary == nil {
+		return verifyExitCodeOf(models.ErrorCode(err))
+	}
+
+	code := VerifyExitOk
+	for _, file := range summary.Files {
+		if file.Error != "" {
+			code = max(code, verifyExitCodeOf(file.ErrorCode))
+		}
+	}
+	return code
+}
+
+func verifyExitCodeOf(errorCode string) int {
+	switch errorCode {
+	case models.ErrorCodeDecryptionFailed:
+		return VerifyExitWrongPassword
+	case models.ErrorCodeKeyExpired, models.ErrorCodeKeyNotFound:
+		return VerifyExitKeyExpired
+	case models.ErrorCodeCorruptFile:
+		return VerifyExitCorrupt
+	default:
+		return VerifyExitError
+	}
+}
@@ -0,0 +1,179 @@
+package commands
+
+import (
+	"Forgetti/io"
+	"Forgetti/models"
+	"errors"
+	"forgetti-common/logging"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testPassword = "correct horse battery staple"
+
+// verifyFixture creates encrypted files with one kind of damage each, named after it
+type verifyFixture struct {
+	stub *stubServer
+}
+
+func newVerifyFixture(t *testing.T) *verifyFixture {
+	useTestConfig(t, "")
+	return &verifyFixture{stub: newStubServer(t)}
+}
+
+func (f *verifyFixture) file(t *testing.T, kind string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), kind+".forgetti")
+	if kind == "corrupt-header" {
+		if err := os.WriteFile(path, []byte("not an encrypted file"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	written := f.stub.encryptTestFile(path, "content of "+kind, testPassword)
+	rewrite := func() {
+		if err := io.WriteContentWithMetadataToFile(path, true, written); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	switch kind {
+	case "ok", "wrong-password":
+	case "truncated":
+		written.FileContent = written.FileContent[:minEncryptedSize-1]
+		rewrite()
+	case "modified":
+		written.FileContent[len(written.FileContent)-1] ^= 0xff
+		rewrite()
+	case "missing-key-id":
+		written.Metadata.KeyId = ""
+		rewrite()
+	case "expired-header":
+		written.Metadata.Expiration = time.Now().Add(-time.Minute)
+		rewrite()
+	case "expired-on-server":
+		f.stub.expire(written.Metadata.KeyId)
+	case "destroyed":
+		f.stub.forget(written.Metadata.KeyId)
+	case "unreachable":
+		written.Metadata.ServerAddress = "http://127.0.0.1:1"
+		rewrite()
+	default:
+		t.Fatalf("unknown kind of file '%s'", kind)
+	}
+	return path
+}
+
+func verifyFiles(password string, files ...string) (*BatchSummary, error) {
+	return Verify(VerifyInput{
+		Password: password,
+		LogLevel: logging.LogLevelError,
+		BatchInput: BatchInput{
+			Files: files,
+			Jobs:  2,
+		},
+	})
+}
+
+func TestVerifyExitCodes(t *testing.T) {
+	fixture := newVerifyFixture(t)
+
+	tests := []struct {
+		kind      string
+		exitCode  int
+		errorCode string
+	}{
+		{"ok", VerifyExitOk, ""},
+		{"corrupt-header", VerifyExitCorrupt, models.ErrorCodeCorruptFile},
+		{"truncated", VerifyExitCorrupt, models.ErrorCodeCorruptFile},
+		{"missing-key-id", VerifyExitCorrupt, models.ErrorCodeCorruptFile},
+		{"wrong-password", VerifyExitWrongPassword, models.ErrorCodeDecryptionFailed},
+		{"modified", VerifyExitWrongPassword, models.ErrorCodeDecryptionFailed},
+		{"expired-header", VerifyExitKeyExpired, models.ErrorCodeKeyExpired},
+		{"expired-on-server", VerifyExitKeyExpired, models.ErrorCodeKeyExpired},
+		{"destroyed", VerifyExitKeyExpired, models.ErrorCodeKeyNotFound},
+		{"unreachable", VerifyExitError, models.ErrorCodeServerUnreachable},
+	}
+
+	for _, test := range tests {
+		t.Run(test.kind, func(t *testing.T) {
+			password := testPassword
+			if test.kind == "wrong-password" {
+				password = "wrong password"
+			}
+
+			summary, err := verifyFiles(password, fixture.file(t, test.kind))
+			if code := VerifyExitCode(summary, err); code != test.exitCode {
+				t.Errorf("expected exit code %d, got %d (error: %v)", test.exitCode, code, err)
+			}
+			if test.errorCode == "" {
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+				return
+			}
+			// A single file reports its own error code
+			if code := models.ErrorCode(err); code != test.errorCode {
+				t.Errorf("expected error code %s, got %s (error: %v)", test.errorCode, code, err)
+			}
+		})
+	}
+}
+
+func TestVerifyExitCodeOfSeveralFiles(t *testing.T) {
+	fixture := newVerifyFixture(t)
+
+	tests := []struct {
+		name     string
+		kinds    []string
+		exitCode int
+	}{
+		{"all ok", []string{"ok", "ok"}, VerifyExitOk},
+		{"one modified", []string{"ok", "modified"}, VerifyExitWrongPassword},
+		{"expired beats modified", []string{"modified", "expired-header", "ok"}, VerifyExitKeyExpired},
+		{"corrupt beats all", []string{"unreachable", "corrupt-header", "destroyed", "modified"}, VerifyExitCorrupt},
+		{"unreachable only", []string{"ok", "unreachable"}, VerifyExitError},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var files []string
+			for _, kind := range test.kinds {
+				files = append(files, fixture.file(t, kind))
+			}
+
+			summary, err := verifyFiles(testPassword, files...)
+			if code := VerifyExitCode(summary, err); code != test.exitCode {
+				t.Errorf("expected exit code %d, got %d (error: %v)", test.exitCode, code, err)
+			}
+			if test.exitCode != VerifyExitOk && models.ErrorCode(err) != models.ErrorCodeBatchFailed {
+				t.Errorf("expected error code %s, got %s", models.ErrorCodeBatchFailed, models.ErrorCode(err))
+			}
+			if len(summary.Files) != len(files) {
+				t.Errorf("expected %d results, got %d", len(files), len(summary.Files))
+			}
+		})
+	}
+}
+
+func TestVerifyExitCodeWithoutSummary(t *testing.T) {
+	tests := []struct {
+		err      error
+		exitCode int
+	}{
+		{nil, VerifyExitOk},
+		{models.NewCodedError(models.ErrorCodeInputNotFound, "input file does not exist"), VerifyExitError},
+		{models.NewCodedError(models.ErrorCodeCorruptFile, "corrupt"), VerifyExitCorrupt},
+		{errors.New("no code"), VerifyExitError},
+	}
+
+	for _, test := range tests {
+		if code := VerifyExitCode(nil, test.err); code != test.exitCode {
+			t.Errorf("%v: expected exit code %d, got %d", test.err, test.exitCode, code)
+		}
+	}
+}
@@ -5,22 +5,75 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
 )
 
 const defaultConfigPath = ".config.json"
 const configPathEnvVar = "FORGETTI_CONFIG_PATH"
+const tokenEnvVar = "FORGETTI_TOKEN"
+const profileEnvVar = "FORGETTI_PROFILE"
+
+// xdgConfigPath is relative to the user's config directory ($XDG_CONFIG_HOME, ~/.config by default)
+const xdgConfigPath = "forgetti/config.json"
+
+// DefaultProfile is the name of the profile stored in the top level fields of the config file, which is all that
+// config files written before profiles existed contain
+const DefaultProfile = "default"
+
+// ProfileFields are the names of the settings of a profile, as used in the config file
+var ProfileFields = []string{"server_address", "token", "tls_pin", "default_expiration", "default_alg_version"}
+
+type Profile struct {
+	ServerAddress string `json:"server_address,omitempty"`
+	Token         string `json:"token,omitempty"`
+	// TlsPin is "sha256/" followed by the base64 SHA-256 hash of the public key of the server's certificate
+	TlsPin            string `json:"tls_pin,omitempty"`
+	DefaultExpiration string `json:"default_expiration,omitempty"`
+	DefaultAlgVersion string `json:"default_alg_version,omitempty"`
+}
 
 type Config struct {
-	ServerAddress string `json:"server_address"`
+	Profile
+	CurrentProfile string             `json:"current_profile,omitempty"`
+	Profiles       map[string]Profile `json:"profiles,omitempty"`
+	// ServerAliases maps the addresses of servers that moved to their new addresses, for all profiles
+	ServerAliases map[string]string `json:"server_aliases,omitempty"`
 }
 
+// profileOverride is the profile selected with --profile
+var profileOverride string
+
+func SetProfileOverride(name string) {
+	profileOverride = name
+}
+
+// GetConfigPath returns the path given in FORGETTI_CONFIG_PATH, or else the first existing config file in the user's
+// config directory or next to the binary. If there is none, new config files are created in the config directory.
 func GetConfigPath() (string, error) {
-	envConfigPath := os.Getenv(configPathEnvVar)
-	if envConfigPath != "" {
-		return io.GetRelativePathFromBin(defaultConfigPath)
+	if envConfigPath := os.Getenv(configPathEnvVar); envConfigPath != "" {
+		return envConfigPath, nil
+	}
+
+	var xdgPath string
+	if configDir, err := os.UserConfigDir(); err == nil {
+		xdgPath = filepath.Join(configDir, xdgConfigPath)
+		if io.FileExists(xdgPath) {
+			return xdgPath, nil
+		}
 	}
 
-	return io.GetRelativePathFromBin(defaultConfigPath)
+	binPath, err := io.GetRelativePathFromBin(defaultConfigPath)
+	if err != nil {
+		return "", err
+	}
+	if io.FileExists(binPath) || xdgPath == "" {
+		return binPath, nil
+	}
+
+	return xdgPath, nil
 }
 
 func DoesConfigExist() bool {
@@ -46,11 +99,182 @@ func LoadConfig() (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
-	
+
 	var config Config
 	if err := json.Unmarshal(content, &config); err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to parse config file '%s': %w", configPath, err)
 	}
 
 	return &config, nil
 }
+
+// LoadConfigOrEmpty returns an empty config if there is no config file
+func LoadConfigOrEmpty() (*Config, error) {
+	if !DoesConfigExist() {
+		return &Config{}, nil
+	}
+	return LoadConfig()
+}
+
+// Save replaces the config file, which is written atomically so that a failed write can't leave a broken config behind.
+// The file can contain API tokens, so only the owner may read it.
+func (c *Config) Save() error {
+	configPath, err := GetConfigPath()
+	if err != nil {
+		return err
+	}
+
+	content, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize config: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(configPath), 0700); err != nil {
+		return fmt.Errorf("failed to create directories: '%s'", configPath)
+	}
+
+	if err := io.WriteFile(configPath, true, append(content, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+
+	return nil
+}
+
+// SelectedProfileName returns the profile given with --profile, or in FORGETTI_PROFILE, or else the current profile
+func (c *Config) SelectedProfileName() string {
+	if profileOverride != "" {
+		return profileOverride
+	}
+	if envProfile := os.Getenv(profileEnvVar); envProfile != "" {
+		return envProfile
+	}
+	if c.CurrentProfile != "" {
+		return c.CurrentProfile
+	}
+	return DefaultProfile
+}
+
+// GetProfile returns the profile with the given name, or false if it does not exist. The default profile always
+// exists.
+func (c *Config) GetProfile(name string) (Profile, bool) {
+	if name == DefaultProfile {
+		return c.Profile, true
+	}
+	profile, ok := c.Profiles[name]
+	return profile, ok
+}
+
+// SetProfile adds or replaces the profile with the given name
+func (c *Config) SetProfile(name string, profile Profile) {
+	if name == DefaultProfile {
+		c.Profile = profile
+		return
+	}
+	if c.Profiles == nil {
+		c.Profiles = make(map[string]Profile)
+	}
+	c.Profiles[name] = profile
+}
+
+// ProfileNames returns the default profile first, followed by the other profiles in alphabetical order
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles)+1)
+	for name := range c.Profiles {
+		if name != DefaultProfile {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return slices.Insert(names, 0, DefaultProfile)
+}
+
+// SelectedProfile returns the selected profile, with the API token from the environment if it is set
+func (c *Config) SelectedProfile() (*Profile, error) {
+	name := c.SelectedProfileName()
+	profile, ok := c.GetProfile(name)
+	if !ok {
+		return nil, fmt.Errorf("profile '%s' does not exist (profiles: %v)", name, c.ProfileNames())
+	}
+
+	if envToken := os.Getenv(tokenEnvVar); envToken != "" {
+		profile.Token = envToken
+	}
+
+	return &profile, nil
+}
+
+// AddServerAlias sends requests to the server at from to the server at to. Fails if the alias would form a cycle.
+func (c *Config) AddServerAlias(from string, to string) error {
+	from = strings.TrimSuffix(from, "/")
+	to = strings.TrimSuffix(to, "/")
+	if from == to {
+		return fmt.Errorf("a server can't be an alias of itself: '%s'", from)
+	}
+
+	seen := make(map[string]bool)
+	for next := to; !seen[next]; {
+		if next == from {
+			return fmt.Errorf("'%s' already moved to '%s', the alias would form a cycle", to, from)
+		}
+		seen[next] = true
+
+		target, ok := c.ServerAliases[next]
+		if !ok {
+			break
+		}
+		next = strings.TrimSuffix(target, "/")
+	}
+
+	if c.ServerAliases == nil {
+		c.ServerAliases = make(map[string]string)
+	}
+	c.ServerAliases[from] = to
+	return nil
+}
+
+// RemoveServerAlias returns the address the server moved to, or false if the server has no alias
+func (c *Config) RemoveServerAlias(from string) (string, bool) {
+	from = strings.TrimSuffix(from, "/")
+	to, ok := c.ServerAliases[from]
+	if !ok {
+		return "", false
+	}
+	delete(c.ServerAliases, from)
+	return to, true
+}
+
+// GetField returns the value of one of the ProfileFields
+func (p *Profile) GetField(field string) (string, error) {
+	value, err := p.field(field)
+	if err != nil {
+		return "", err
+	}
+	return *value, nil
+}
+
+// SetField sets the value of one of the ProfileFields, an empty value removes it
+func (p *Profile) SetField(field string, value string) error {
+	target, err := p.field(field)
+	if err != nil {
+		return err
+	}
+	*target = value
+	return nil
+}
+
+func (p *Profile) field(field string) (*string, error) {
+	switch field {
+	case "server_address":
+		return &p.ServerAddress, nil
+	case "token":
+		return &p.Token, nil
+	case "tls_pin":
+		return &p.TlsPin, nil
+	case "default_expiration":
+		return &p.DefaultExpiration, nil
+	case "default_alg_version":
+		return &p.DefaultAlgVersion, nil
+	default:
+		return nil, fmt.Errorf("unknown profile field '%s' (fields: %v)", field, ProfileFields)
+	}
+}
@@ -0,0 +1,243 @@
+package config
+
+import (
+	"Forgetti/io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// useConfigDirs points the user's config directory to a temporary directory and clears the config environment
+// variables. Returns the path of the config file in the config directory.
+func useConfigDirs(t *testing.T) string {
+	t.Helper()
+
+	configHome := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configHome)
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv(configPathEnvVar, "")
+	t.Setenv(tokenEnvVar, "")
+	t.Setenv(profileEnvVar, "")
+	return filepath.Join(configHome, xdgConfigPath)
+}
+
+// createBinConfig creates the config file next to the test binary, which GetConfigPath falls back to
+func createBinConfig(t *testing.T) string {
+	t.Helper()
+
+	binPath, err := io.GetRelativePathFromBin(defaultConfigPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, binPath, "{}")
+	t.Cleanup(func() { os.Remove(binPath) })
+	return binPath
+}
+
+func writeTestFile(t *testing.T, path string, content string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func expectConfigPath(t *testing.T, expected string) {
+	t.Helper()
+
+	configPath, err := GetConfigPath()
+	if err != nil {
+		t.Fatalf("GetConfigPath failed: %v", err)
+	}
+	if configPath != expected {
+		t.Errorf("expected config path '%s', got '%s'", expected, configPath)
+	}
+}
+
+func TestGetConfigPathFromEnvironment(t *testing.T) {
+	xdgPath := useConfigDirs(t)
+	writeTestFile(t, xdgPath, "{}")
+	createBinConfig(t)
+
+	// The environment variable wins even if its file does not exist yet
+	envPath := filepath.Join(t.TempDir(), "elsewhere.json")
+	t.Setenv(configPathEnvVar, envPath)
+	expectConfigPath(t, envPath)
+}
+
+func TestGetConfigPathPrefersConfigDirectory(t *testing.T) {
+	xdgPath := useConfigDirs(t)
+	writeTestFile(t, xdgPath, "{}")
+	createBinConfig(t)
+
+	expectConfigPath(t, xdgPath)
+}
+
+func TestGetConfigPathFallsBackToBinary(t *testing.T) {
+	useConfigDirs(t)
+	binPath := createBinConfig(t)
+
+	expectConfigPath(t, binPath)
+}
+
+func TestGetConfigPathWithoutConfigFile(t *testing.T) {
+	// New config files are created in the config directory
+	xdgPath := useConfigDirs(t)
+
+	expectConfigPath(t, xdgPath)
+	if DoesConfigExist() {
+		t.Error("expected no config file to exist")
+	}
+	cfg, err := LoadConfigOrEmpty()
+	if err != nil || cfg.ServerAddress != "" {
+		t.Errorf("expected an empty config, got %+v (error: %v)", cfg, err)
+	}
+}
+
+func TestSaveCreatesConfigFile(t *testing.T) {
+	xdgPath := useConfigDirs(t)
+
+	cfg := &Config{Profile: Profile{ServerAddress: "http://localhost:8080", Token: "secret"}}
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	info, err := os.Stat(xdgPath)
+	if err != nil {
+		t.Fatalf("expected the config file in the config directory: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected mode 600, got %o", info.Mode().Perm())
+	}
+
+	loaded, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.ServerAddress != cfg.ServerAddress || loaded.Token != cfg.Token {
+		t.Errorf("expected the saved profile, got %+v", loaded.Profile)
+	}
+}
+
+func TestLoadConfigRejectsInvalidFile(t *testing.T) {
+	xdgPath := useConfigDirs(t)
+	writeTestFile(t, xdgPath, "{not json")
+
+	if _, err := LoadConfigOrEmpty(); err == nil {
+		t.Error("expected an invalid config file to be rejected")
+	}
+}
+
+func TestSelectedProfile(t *testing.T) {
+	cfg := &Config{
+		Profile:        Profile{ServerAddress: "https://default.example.com"},
+		CurrentProfile: "current",
+		Profiles: map[string]Profile{
+			"current":  {ServerAddress: "https://current.example.com"},
+			"env":      {ServerAddress: "https://env.example.com"},
+			"override": {ServerAddress: "https://override.example.com", Token: "profile-token"},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		override  string
+		env       string
+		current   string
+		expected  string
+		expectErr bool
+	}{
+		{"default", "", "", "", DefaultProfile, false},
+		{"current profile", "", "", "current", "current", false},
+		{"environment beats current profile", "", "env", "current", "env", false},
+		{"--profile beats environment", "override", "env", "current", "override", false},
+		{"--profile default", DefaultProfile, "env", "current", DefaultProfile, false},
+		{"unknown profile", "missing", "", "", "missing", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			SetProfileOverride(test.override)
+			t.Cleanup(func() { SetProfileOverride("") })
+			t.Setenv(profileEnvVar, test.env)
+			t.Setenv(tokenEnvVar, "")
+			cfg.CurrentProfile = test.current
+
+			if name := cfg.SelectedProfileName(); name != test.expected {
+				t.Errorf("expected profile '%s', got '%s'", test.expected, name)
+			}
+
+			profile, err := cfg.SelectedProfile()
+			if test.expectErr {
+				if err == nil {
+					t.Error("expected an unknown profile to be rejected")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SelectedProfile failed: %v", err)
+			}
+			expected, _ := cfg.GetProfile(test.expected)
+			if profile.ServerAddress != expected.ServerAddress {
+				t.Errorf("expected server %s, got %s", expected.ServerAddress, profile.ServerAddress)
+			}
+		})
+	}
+}
+
+func TestSelectedProfileTokenFromEnvironment(t *testing.T) {
+	cfg := &Config{Profile: Profile{ServerAddress: "https://default.example.com", Token: "file-token"}}
+	t.Setenv(profileEnvVar, "")
+	t.Setenv(tokenEnvVar, "env-token")
+
+	profile, err := cfg.SelectedProfile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.Token != "env-token" {
+		t.Errorf("expected the token of the environment, got '%s'", profile.Token)
+	}
+	if cfg.Token != "file-token" {
+		t.Error("the token of the environment was written into the config")
+	}
+}
+
+func TestLegacyConfigIsDefaultProfile(t *testing.T) {
+	// Config files written before profiles existed only contain the top level fields
+	xdgPath := useConfigDirs(t)
+	writeTestFile(t, xdgPath, `{"server_address": "http://localhost:8080", "token": "secret"}`)
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile, err := cfg.SelectedProfile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.ServerAddress != "http://localhost:8080" || profile.Token != "secret" {
+		t.Errorf("expected the top level fields as the default profile, got %+v", profile)
+	}
+	if names := cfg.ProfileNames(); len(names) != 1 || names[0] != DefaultProfile {
+		t.Errorf("expected only the default profile, got %v", names)
+	}
+}
+
+func TestProfileFields(t *testing.T) {
+	var profile Profile
+	for _, field := range ProfileFields {
+		if err := profile.SetField(field, "value of "+field); err != nil {
+			t.Errorf("SetField(%s) failed: %v", field, err)
+		}
+		if value, err := profile.GetField(field); err != nil || value != "value of "+field {
+			t.Errorf("GetField(%s): expected the value that was set, got '%s' (error: %v)", field, value, err)
+		}
+	}
+
+	if err := profile.SetField("password", "secret"); err == nil {
+		t.Error("expected an unknown field to be rejected")
+	}
+}
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"Forgetti/io"
+	"Forgetti/models"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// The key groups are stored next to the config file. They contain the verification keys, which only the client that
+// created a key knows.
+const groupsFileName = ".groups.json"
+
+type KeyGroup struct {
+	Name     string          `json:"name"`
+	Metadata models.Metadata `json:"metadata"`
+}
+
+func (g *KeyGroup) Expired() bool {
+	return g.Metadata.Expiration.Before(time.Now())
+}
+
+type KeyGroups struct {
+	Groups []KeyGroup `json:"groups"`
+}
+
+func GetGroupsPath() (string, error) {
+	configPath, err := GetConfigPath()
+	if err != nil {
+		return "", err
+	}
+
+	groupsPath := filepath.Join(filepath.Dir(configPath), groupsFileName)
+	if io.FileExists(groupsPath) {
+		return groupsPath, nil
+	}
+
+	// Groups saved before the config directory was used are next to the binary
+	legacyPath, err := io.GetRelativePathFromBin(groupsFileName)
+	if err == nil && io.FileExists(legacyPath) {
+		return legacyPath, nil
+	}
+
+	return groupsPath, nil
+}
+
+// LoadKeyGroups returns no groups if none were saved yet
+func LoadKeyGroups() (*KeyGroups, error) {
+	groupsPath, err := GetGroupsPath()
+	if err != nil {
+		return nil, err
+	}
+
+	if !io.FileExists(groupsPath) {
+		return &KeyGroups{}, nil
+	}
+
+	content, err := io.ReadFile(groupsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups KeyGroups
+	if err := json.Unmarshal(content, &groups); err != nil {
+		return nil, fmt.Errorf("failed to parse key groups file '%s': %w", groupsPath, err)
+	}
+
+	return &groups, nil
+}
+
+func (g *KeyGroups) Save() error {
+	groupsPath, err := GetGroupsPath()
+	if err != nil {
+		return err
+	}
+
+	content, err := json.MarshalIndent(g, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize key groups: %w", err)
+	}
+
+	// Only the owner may read the verification keys
+	return io.WriteFile(groupsPath, true, content, 0600)
+}
+
+// Find returns the group of the server with the given name, or nil
+func (g *KeyGroups) Find(serverAddress string, name string) *KeyGroup {
+	for i := range g.Groups {
+		if g.Groups[i].Name == name && g.Groups[i].Metadata.ServerAddress == serverAddress {
+			return &g.Groups[i]
+		}
+	}
+	return nil
+}
+
+// FindByKeyId returns the group using the key, or nil
+func (g *KeyGroups) FindByKeyId(keyId string) *KeyGroup {
+	for i := range g.Groups {
+		if g.Groups[i].Metadata.KeyId == keyId {
+			return &g.Groups[i]
+		}
+	}
+	return nil
+}
+
+// Put adds the group, replacing the group of the same server with the same name
+func (g *KeyGroups) Put(group KeyGroup) {
+	g.Remove(group.Metadata.ServerAddress, group.Name)
+	g.Groups = append(g.Groups, group)
+}
+
+func (g *KeyGroups) Remove(serverAddress string, name string) {
+	kept := g.Groups[:0]
+	for _, group := range g.Groups {
+		if group.Name != name || group.Metadata.ServerAddress != serverAddress {
+			kept = append(kept, group)
+		}
+	}
+	g.Groups = kept
+}
@@ -0,0 +1,197 @@
+package config
+
+import (
+	"Forgetti/io"
+	"Forgetti/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The inventory of encrypted files is stored next to the config file, readable only by its owner
+const inventoryFileName = ".inventory.json"
+
+// Changes of the inventory hold a lock file, so that concurrent runs of the CLI don't drop each other's entries
+const (
+	inventoryLockTimeout = 10 * time.Second
+	inventoryLockRetry   = 20 * time.Millisecond
+	// A lock older than this was left behind by a run that crashed
+	staleInventoryLockAge = time.Minute
+)
+
+// InventoryEntry describes an encrypted file as it was last written or scanned
+type InventoryEntry struct {
+	// Path is absolute
+	Path          string    `json:"path"`
+	KeyId         string    `json:"key_id"`
+	ServerAddress string    `json:"server_address"`
+	Expiration    time.Time `json:"expiration"`
+	Group         string    `json:"group,omitempty"`
+	RecordedAt    time.Time `json:"recorded_at"`
+}
+
+func (e *InventoryEntry) Expired() bool {
+	return e.Expiration.Before(time.Now())
+}
+
+type Inventory struct {
+	Files []InventoryEntry `json:"files"`
+}
+
+// NewInventoryEntry describes the encrypted file at path with the given header
+func NewInventoryEntry(path string, metadata models.Metadata) (InventoryEntry, error) {
+	absolutePath, err := filepath.Abs(path)
+	if err != nil {
+		return InventoryEntry{}, fmt.Errorf("failed to resolve path '%s': %w", path, err)
+	}
+
+	return InventoryEntry{
+		Path:          absolutePath,
+		KeyId:         metadata.KeyId,
+		ServerAddress: metadata.ServerAddress,
+		Expiration:    metadata.Expiration,
+		Group:         metadata.Group,
+		RecordedAt:    time.Now(),
+	}, nil
+}
+
+func GetInventoryPath() (string, error) {
+	configPath, err := GetConfigPath()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(filepath.Dir(configPath), inventoryFileName), nil
+}
+
+// LoadInventory returns an empty inventory if no file was recorded yet
+func LoadInventory() (*Inventory, error) {
+	inventoryPath, err := GetInventoryPath()
+	if err != nil {
+		return nil, err
+	}
+
+	if !io.FileExists(inventoryPath) {
+		return &Inventory{}, nil
+	}
+
+	content, err := io.ReadFile(inventoryPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var inventory Inventory
+	if err := json.Unmarshal(content, &inventory); err != nil {
+		return nil, fmt.Errorf("failed to parse inventory file '%s': %w", inventoryPath, err)
+	}
+
+	return &inventory, nil
+}
+
+func (i *Inventory) Save() error {
+	inventoryPath, err := GetInventoryPath()
+	if err != nil {
+		return err
+	}
+
+	content, err := json.MarshalIndent(i, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize inventory: %w", err)
+	}
+
+	return io.WriteFile(inventoryPath, true, content, 0600)
+}
+
+// UpdateInventory loads the inventory, changes it with update and saves it, all while holding the lock of the inventory
+func UpdateInventory(update func(inventory *Inventory) error) error {
+	unlock, err := lockInventory()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	inventory, err := LoadInventory()
+	if err != nil {
+		return err
+	}
+	if err := update(inventory); err != nil {
+		return err
+	}
+	return inventory.Save()
+}
+
+// lockInventory creates the lock file of the inventory, waiting for other runs to release it. Returns the function that
+// releases the lock.
+func lockInventory() (func(), error) {
+	inventoryPath, err := GetInventoryPath()
+	if err != nil {
+		return nil, err
+	}
+	lockPath := inventoryPath + ".lock"
+
+	if err := os.MkdirAll(filepath.Dir(lockPath), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create directories: '%s'", lockPath)
+	}
+
+	deadline := time.Now().Add(inventoryLockTimeout)
+	for {
+		file, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			file.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("failed to lock the inventory: %w", err)
+		}
+
+		if info, err := os.Stat(lockPath); err == nil && time.Since(info.ModTime()) > staleInventoryLockAge {
+			os.Remove(lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("the inventory is locked by another run of forgetti - remove '%s' if there is none", lockPath)
+		}
+		time.Sleep(inventoryLockRetry)
+	}
+}
+
+// Find returns the entry of the file at the absolute path, or nil
+func (i *Inventory) Find(path string) *InventoryEntry {
+	for j := range i.Files {
+		if i.Files[j].Path == path {
+			return &i.Files[j]
+		}
+	}
+	return nil
+}
+
+// Put adds the entry, replacing the entry of the same path
+func (i *Inventory) Put(entry InventoryEntry) {
+	if existing := i.Find(entry.Path); existing != nil {
+		*existing = entry
+		return
+	}
+	i.Files = append(i.Files, entry)
+}
+
+// RemoveBelow removes the entries of files at or below the absolute path for which keep returns false, returning the
+// number of removed entries
+func (i *Inventory) RemoveBelow(root string, keep func(entry InventoryEntry) bool) int {
+	kept := i.Files[:0]
+	removed := 0
+	for _, entry := range i.Files {
+		below := entry.Path == root || strings.HasPrefix(entry.Path, strings.TrimSuffix(root, string(filepath.Separator))+string(filepath.Separator))
+		if below && !keep(entry) {
+			removed++
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	i.Files = kept
+	return removed
+}
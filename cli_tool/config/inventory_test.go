@@ -0,0 +1,180 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func useTestInventory(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	t.Setenv(configPathEnvVar, filepath.Join(dir, "config.json"))
+	return filepath.Join(dir, inventoryFileName)
+}
+
+func TestInventoryPut(t *testing.T) {
+	inventory := &Inventory{}
+	inventory.Put(InventoryEntry{Path: "/files/a.forgetti", KeyId: "1"})
+	inventory.Put(InventoryEntry{Path: "/files/b.forgetti", KeyId: "2"})
+	inventory.Put(InventoryEntry{Path: "/files/a.forgetti", KeyId: "3"})
+
+	if len(inventory.Files) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(inventory.Files))
+	}
+	if entry := inventory.Find("/files/a.forgetti"); entry == nil || entry.KeyId != "3" {
+		t.Errorf("expected the entry of a.forgetti to be replaced, got %+v", entry)
+	}
+	if entry := inventory.Find("/files/c.forgetti"); entry != nil {
+		t.Errorf("expected no entry of c.forgetti, got %+v", entry)
+	}
+}
+
+func TestInventoryRemoveBelow(t *testing.T) {
+	inventory := &Inventory{Files: []InventoryEntry{
+		{Path: "/files/a.forgetti"},
+		{Path: "/files/sub/b.forgetti"},
+		{Path: "/files/keep.forgetti"},
+		// Shares the prefix of the root, but is not below it
+		{Path: "/files-other/c.forgetti"},
+		{Path: "/elsewhere/d.forgetti"},
+	}}
+
+	removed := inventory.RemoveBelow("/files/", func(entry InventoryEntry) bool {
+		return entry.Path == "/files/keep.forgetti"
+	})
+
+	if removed != 2 {
+		t.Errorf("expected 2 removed entries, got %d", removed)
+	}
+	var paths []string
+	for _, entry := range inventory.Files {
+		paths = append(paths, entry.Path)
+	}
+	expected := []string{"/files/keep.forgetti", "/files-other/c.forgetti", "/elsewhere/d.forgetti"}
+	if fmt.Sprint(paths) != fmt.Sprint(expected) {
+		t.Errorf("expected entries %v, got %v", expected, paths)
+	}
+}
+
+func TestInventorySaveAndLoad(t *testing.T) {
+	inventoryPath := useTestInventory(t)
+
+	inventory, err := LoadInventory()
+	if err != nil {
+		t.Fatalf("LoadInventory failed without an inventory file: %v", err)
+	}
+	if len(inventory.Files) != 0 {
+		t.Errorf("expected an empty inventory, got %+v", inventory.Files)
+	}
+
+	expiration := time.Now().Add(time.Hour).Round(time.Second)
+	inventory.Put(InventoryEntry{Path: "/files/a.forgetti", KeyId: "1", Expiration: expiration})
+	if err := inventory.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	info, err := os.Stat(inventoryPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected mode 600, got %o", info.Mode().Perm())
+	}
+
+	loaded, err := LoadInventory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry := loaded.Find("/files/a.forgetti"); entry == nil || entry.KeyId != "1" || !entry.Expiration.Equal(expiration) {
+		t.Errorf("expected the saved entry, got %+v", entry)
+	}
+}
+
+func TestUpdateInventoryConcurrently(t *testing.T) {
+	inventoryPath := useTestInventory(t)
+
+	const runs = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, runs)
+	for i := 0; i < runs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- UpdateInventory(func(inventory *Inventory) error {
+				inventory.Put(InventoryEntry{Path: fmt.Sprintf("/files/%d.forgetti", i)})
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("UpdateInventory failed: %v", err)
+		}
+	}
+
+	inventory, err := LoadInventory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inventory.Files) != runs {
+		t.Errorf("expected %d entries, got %d", runs, len(inventory.Files))
+	}
+	if _, err := os.Stat(inventoryPath + ".lock"); !os.IsNotExist(err) {
+		t.Errorf("expected the lock to be released, got %v", err)
+	}
+}
+
+func TestUpdateInventoryRemovesStaleLock(t *testing.T) {
+	inventoryPath := useTestInventory(t)
+
+	lockPath := inventoryPath + ".lock"
+	if err := os.WriteFile(lockPath, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	stale := time.Now().Add(-2 * staleInventoryLockAge)
+	if err := os.Chtimes(lockPath, stale, stale); err != nil {
+		t.Fatal(err)
+	}
+
+	err := UpdateInventory(func(inventory *Inventory) error {
+		inventory.Put(InventoryEntry{Path: "/files/a.forgetti"})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("UpdateInventory failed with a stale lock: %v", err)
+	}
+}
+
+func TestUpdateInventoryKeepsInventoryOnError(t *testing.T) {
+	useTestInventory(t)
+
+	if err := UpdateInventory(func(inventory *Inventory) error {
+		inventory.Put(InventoryEntry{Path: "/files/a.forgetti"})
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := UpdateInventory(func(inventory *Inventory) error {
+		inventory.Files = nil
+		return fmt.Errorf("failed")
+	})
+	if err == nil {
+		t.Fatal("expected the error of the update")
+	}
+
+	inventory, err := LoadInventory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inventory.Files) != 1 {
+		t.Errorf("expected the failed update not to be saved, got %+v", inventory.Files)
+	}
+}
@@ -1,37 +1,51 @@
 package interaction
 
 import (
+	"Forgetti/models"
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"forgetti-common/constants"
 	"forgetti-common/dto"
 	"forgetti-common/logging"
+	"io"
 	"net/http"
 	"time"
 )
 
+var ErrInfoNotSupported = errors.New("server does not advertise its key policy")
+
 type RemoteClient struct {
 	baseURL    string
+	token      string
 	httpClient *http.Client
 }
 
-func NewRemoteClient(baseURL string) *RemoteClient {
+func NewRemoteClient(baseURL string, token string) *RemoteClient {
 	logger := logging.MakeLogger("RemoteClient.NewRemoteClient")
-	logger.Verbose("Creating new remote client for server: %s", baseURL)
+	if resolved := ResolveServerAddress(baseURL); resolved != baseURL {
+		logger.Verbose("Server %s moved to %s", baseURL, resolved)
+		baseURL = resolved
+	}
+	logger.Verbose("Creating new remote client for server: %s (API token set: %t)", baseURL, token != "")
 	return &RemoteClient{
 		baseURL: baseURL,
+		token:   token,
 		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout:   30 * time.Second,
+			Transport: newHttpTransport(baseURL),
 		},
 	}
 }
 
-func (r *RemoteClient) NewKey(content string, expiration time.Time) (*dto.NewKeyResponse, error) {
+// NewKey creates a key on the server, in the given group unless the group is empty
+func (r *RemoteClient) NewKey(content string, expiration time.Time, group string) (*dto.NewKeyResponse, error) {
 	logger := logging.MakeLogger("RemoteClient.NewKey")
 	request := dto.NewKeyRequest{
 		Content:    content,
 		Expiration: expiration,
+		Group:      group,
 	}
 
 	logger.Verbose("Validating new key request")
@@ -49,14 +63,15 @@ func (r *RemoteClient) NewKey(content string, expiration time.Time) (*dto.NewKey
 
 	url := r.baseURL + constants.NewKeyRoute
 	logger.Verbose("Making HTTP POST request to: %s", url)
-	resp, err := r.httpClient.Post(
-		url,
-		"application/json",
-		bytes.NewBuffer(jsonData),
-	)
+	httpRequest, err := r.newAuthenticatedRequest(http.MethodPost, url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.httpClient.Do(httpRequest)
 	if err != nil {
 		logger.Error("HTTP POST request failed: %v", err)
-		return nil, fmt.Errorf("failed to make request: %w", err)
+		return nil, requestFailed(err)
 	}
 	defer resp.Body.Close()
 	logger.Verbose("HTTP response received with status code: %d", resp.StatusCode)
@@ -100,7 +115,7 @@ func (r *RemoteClient) Encrypt(content string, keyId string) (*dto.EncryptRespon
 	)
 	if err != nil {
 		logger.Error("HTTP POST request failed for encrypt: %v", err)
-		return nil, fmt.Errorf("failed to make request: %w", err)
+		return nil, requestFailed(err)
 	}
 	defer resp.Body.Close()
 	logger.Verbose("HTTP response received with status code: %d", resp.StatusCode)
@@ -121,27 +136,160 @@ func (r *RemoteClient) Encrypt(content string, keyId string) (*dto.EncryptRespon
 	return &response, nil
 }
 
+// DestroyKey destroys a key of the API token, named either by its id or by its group
+func (r *RemoteClient) DestroyKey(keyId string, group string) (*dto.DestroyKeyResponse, error) {
+	logger := logging.MakeLogger("RemoteClient.DestroyKey")
+	request := dto.DestroyKeyRequest{
+		KeyId: keyId,
+		Group: group,
+	}
+
+	if err := request.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid request: %w", err)
+	}
+
+	jsonData, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	url := r.baseURL + constants.DestroyKeyRoute
+	logger.Verbose("Making HTTP POST request to: %s", url)
+	httpRequest, err := r.newAuthenticatedRequest(http.MethodPost, url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.httpClient.Do(httpRequest)
+	if err != nil {
+		logger.Error("HTTP POST request failed for destroy: %v", err)
+		return nil, requestFailed(err)
+	}
+	defer resp.Body.Close()
+	logger.Verbose("HTTP response received with status code: %d", resp.StatusCode)
+
+	if resp.StatusCode != http.StatusOK {
+		logger.Error("HTTP destroy request failed with status code: %d", resp.StatusCode)
+		return nil, handleApiError(resp)
+	}
+
+	var response dto.DestroyKeyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		logger.Error("Failed to decode destroy response: %v", err)
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	logger.Info("Successfully destroyed key. KeyId: %s", response.KeyId)
+	return &response, nil
+}
+
+// Info returns the key policy of the server, or ErrInfoNotSupported for servers that do not advertise it
+func (r *RemoteClient) Info() (*dto.InfoResponse, error) {
+	logger := logging.MakeLogger("RemoteClient.Info")
+
+	url := r.baseURL + constants.InfoRoute
+	logger.Verbose("Making HTTP GET request to: %s", url)
+	httpRequest, err := r.newAuthenticatedRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.httpClient.Do(httpRequest)
+	if err != nil {
+		logger.Error("HTTP GET request failed for info: %v", err)
+		return nil, requestFailed(err)
+	}
+	defer resp.Body.Close()
+	logger.Verbose("HTTP response received with status code: %d", resp.StatusCode)
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrInfoNotSupported
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		logger.Error("HTTP info request failed with status code: %d", resp.StatusCode)
+		return nil, handleApiError(resp)
+	}
+
+	var response dto.InfoResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		logger.Error("Failed to decode info response: %v", err)
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &response, nil
+}
+
+func (r *RemoteClient) newAuthenticatedRequest(method string, url string, body io.Reader) (*http.Request, error) {
+	httpRequest, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if body != nil {
+		httpRequest.Header.Set("Content-Type", "application/json")
+	}
+	if r.token != "" {
+		httpRequest.Header.Set("Authorization", "Bearer "+r.token)
+	}
+
+	return httpRequest, nil
+}
+
+// ApiError is an error response of the server, keeping its error code
+type ApiError struct {
+	StatusCode int
+	Code       string
+	message    string
+}
+
+func (e *ApiError) Error() string {
+	return e.message
+}
+
+func (e *ApiError) ErrorCode() string {
+	return e.Code
+}
+
 func handleApiError(resp *http.Response) error {
 	var response dto.ErrorResponse
 	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
 		return fmt.Errorf("failed to decode response: %w", err)
 	}
 
+	message := fmt.Sprintf("[%d] %s: %s", resp.StatusCode, response.ErrorCode, response.Message)
 	if err := makePrettyError(response); err != nil {
-		return err
+		message = err.Error()
 	}
 
-	return fmt.Errorf("[%d] %s: %s", resp.StatusCode, response.ErrorCode, response.Message)
+	return &ApiError{StatusCode: resp.StatusCode, Code: response.ErrorCode, message: message}
+}
+
+func requestFailed(err error) error {
+	return models.WithCode(models.ErrorCodeServerUnreachable, fmt.Errorf("failed to make request: %w", err))
 }
 
 func makePrettyError(response dto.ErrorResponse) error {
 	switch response.ErrorCode {
-	case "key-not-found":
+	case models.ErrorCodeKeyNotFound:
 		return fmt.Errorf("key %s does not exist on server - it could have expired, or another server was used to generate it", response.Data["key_id"])
-	case "key-expired":
+	case models.ErrorCodeKeyExpired:
 		return fmt.Errorf("key %s expired at %s", response.Data["key_id"], response.Data["expiration"])
+	case "key-group-exists":
+		return fmt.Errorf("key group %s already has the live key %s on the server, but its verification key is not stored on this machine - use another group name, or destroy the key of the group first", response.Data["group"], response.Data["key_id"])
+	case "key-group-not-found":
+		return fmt.Errorf("key group %s has no key on the server", response.Data["group"])
 	case "bad-request":
 		return fmt.Errorf("request failed: %s", response.Data["error"])
+	case "unauthorized":
+		return fmt.Errorf("server requires a valid API token (%s) - set it in the config file ('token') or in the FORGETTI_TOKEN environment variable", response.Data["reason"])
+	case "quota-exceeded":
+		return fmt.Errorf("API token quota exceeded: %s (limit: %s)", response.Data["quota"], response.Data["limit"])
+	case "rate-limited":
+		if response.Data["scope"] == "key" {
+			return fmt.Errorf("too many requests for this key - server temporarily refuses to use it, try again in %s seconds", response.Data["retry_after"])
+		}
+		return fmt.Errorf("too many requests - server is rate limiting this client, try again in %s seconds", response.Data["retry_after"])
 	case "internal-server-error":
 		return fmt.Errorf("server error: %s", response.Message)
 	default:
@@ -0,0 +1,61 @@
+package interaction
+
+import (
+	"maps"
+	"strings"
+	"sync"
+)
+
+var (
+	serverAliases      = make(map[string]string)
+	serverAliasesMutex sync.RWMutex
+)
+
+// SetServerAliases replaces the table of servers that moved, mapping old server addresses to new ones. Requests to an
+// old address are sent to the new address instead.
+func SetServerAliases(aliases map[string]string) {
+	normalized := make(map[string]string, len(aliases))
+	for from, to := range aliases {
+		normalized[normalizeServerAddress(from)] = to
+	}
+
+	serverAliasesMutex.Lock()
+	defer serverAliasesMutex.Unlock()
+	serverAliases = normalized
+}
+
+// HasServerAliases reports whether any server aliases are set
+func HasServerAliases() bool {
+	serverAliasesMutex.RLock()
+	defer serverAliasesMutex.RUnlock()
+	return len(serverAliases) > 0
+}
+
+// ResolveServerAddress returns the address the server moved to, following servers that moved more than once.
+// Addresses without an alias are returned unchanged.
+func ResolveServerAddress(serverAddress string) string {
+	serverAliasesMutex.RLock()
+	aliases := maps.Clone(serverAliases)
+	serverAliasesMutex.RUnlock()
+
+	seen := make(map[string]bool)
+	for {
+		key := normalizeServerAddress(serverAddress)
+		next, ok := aliases[key]
+		// A hand-edited config may contain a cycle, which stops at the last new address
+		if !ok || seen[key] {
+			return serverAddress
+		}
+		seen[key] = true
+		serverAddress = next
+	}
+}
+
+// SameServer reports whether both addresses lead to the same server, after following their aliases
+func SameServer(serverAddress string, otherServerAddress string) bool {
+	return normalizeServerAddress(ResolveServerAddress(serverAddress)) == normalizeServerAddress(ResolveServerAddress(otherServerAddress))
+}
+
+func normalizeServerAddress(serverAddress string) string {
+	return strings.TrimSuffix(serverAddress, "/")
+}
@@ -0,0 +1,73 @@
+package interaction
+
+import "testing"
+
+func useServerAliases(t *testing.T, aliases map[string]string) {
+	t.Helper()
+
+	SetServerAliases(aliases)
+	t.Cleanup(func() { SetServerAliases(nil) })
+}
+
+func TestResolveServerAddress(t *testing.T) {
+	useServerAliases(t, map[string]string{
+		"http://old.example.com":     "http://new.example.com",
+		"http://slash.example.com/":  "http://new.example.com/",
+		"http://first.example.com":   "http://second.example.com",
+		"http://second.example.com/": "http://third.example.com",
+	})
+
+	tests := []struct {
+		serverAddress string
+		expected      string
+	}{
+		{"http://old.example.com", "http://new.example.com"},
+		{"http://old.example.com/", "http://new.example.com"},
+		{"http://slash.example.com", "http://new.example.com/"},
+		{"http://slash.example.com/", "http://new.example.com/"},
+		// Servers that moved more than once
+		{"http://first.example.com/", "http://third.example.com"},
+		// Addresses without an alias are returned unchanged, keeping their slash
+		{"http://new.example.com", "http://new.example.com"},
+		{"http://other.example.com/", "http://other.example.com/"},
+		{"http://old.example.com/api", "http://old.example.com/api"},
+	}
+
+	for _, test := range tests {
+		if resolved := ResolveServerAddress(test.serverAddress); resolved != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.serverAddress, test.expected, resolved)
+		}
+	}
+}
+
+func TestResolveServerAddressStopsAtCycle(t *testing.T) {
+	// A hand-edited config can contain a cycle
+	useServerAliases(t, map[string]string{
+		"http://a.example.com": "http://b.example.com",
+		"http://b.example.com": "http://a.example.com/",
+	})
+
+	if resolved := ResolveServerAddress("http://a.example.com"); resolved != "http://a.example.com/" {
+		t.Errorf("expected the cycle to stop at the last new address, got %s", resolved)
+	}
+}
+
+func TestHasServerAliases(t *testing.T) {
+	useServerAliases(t, nil)
+	if HasServerAliases() {
+		t.Error("expected no server aliases")
+	}
+
+	SetServerAliases(map[string]string{"http://old.example.com": "http://new.example.com"})
+	if !HasServerAliases() {
+		t.Error("expected server aliases")
+	}
+}
+
+func TestRemoteClientUsesServerAlias(t *testing.T) {
+	useServerAliases(t, map[string]string{"http://old.example.com/": "http://new.example.com"})
+
+	if client := NewRemoteClient("http://old.example.com", ""); client.baseURL != "http://new.example.com" {
+		t.Errorf("expected requests to go to the new server, got %s", client.baseURL)
+	}
+}
@@ -0,0 +1,109 @@
+package interaction
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const pinPrefix = "sha256/"
+
+var (
+	pins      = make(map[string][]byte)
+	pinsMutex sync.RWMutex
+)
+
+// ParseTlsPin checks that the pin has the form "sha256/<base64 SHA-256 hash of the certificate's public key>"
+func ParseTlsPin(pin string) ([]byte, error) {
+	if !strings.HasPrefix(pin, pinPrefix) {
+		return nil, fmt.Errorf("invalid TLS pin '%s': expected '%s' followed by a base64 SHA-256 hash", pin, pinPrefix)
+	}
+
+	hash, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(pin, pinPrefix))
+	if err != nil || len(hash) != sha256.Size {
+		return nil, fmt.Errorf("invalid TLS pin '%s': expected '%s' followed by a base64 SHA-256 hash", pin, pinPrefix)
+	}
+
+	return hash, nil
+}
+
+// PinCertificate makes clients of the server accept only certificates with the pinned public key, in addition to the
+// usual certificate verification
+func PinCertificate(serverAddress string, pin string) error {
+	hash, err := ParseTlsPin(pin)
+	if err != nil {
+		return err
+	}
+
+	host, err := pinnedHost(serverAddress)
+	if err != nil {
+		return err
+	}
+
+	pinsMutex.Lock()
+	defer pinsMutex.Unlock()
+	pins[host] = hash
+	return nil
+}
+
+// pinnedHost returns the host and port of an https server address, as pins apply to all paths of a server
+func pinnedHost(serverAddress string) (string, error) {
+	parsed, err := url.Parse(serverAddress)
+	if err != nil {
+		return "", fmt.Errorf("invalid server address '%s': %w", serverAddress, err)
+	}
+	if parsed.Scheme != "https" {
+		return "", fmt.Errorf("a TLS pin requires an https server address, got '%s'", serverAddress)
+	}
+
+	port := parsed.Port()
+	if port == "" {
+		port = "443"
+	}
+	return parsed.Hostname() + ":" + port, nil
+}
+
+// newHttpTransport returns a transport checking the pin of the server, or nil to use the default transport
+func newHttpTransport(serverAddress string) http.RoundTripper {
+	host, err := pinnedHost(serverAddress)
+	if err != nil {
+		return nil
+	}
+
+	pinsMutex.RLock()
+	hash, ok := pins[host]
+	pinsMutex.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	// The pin is checked in addition to the TLS settings of the default transport, such as its root certificates
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	transport.TLSClientConfig.VerifyConnection = func(state tls.ConnectionState) error {
+		return checkPin(state.PeerCertificates, hash)
+	}
+	return transport
+}
+
+func checkPin(certificates []*x509.Certificate, hash []byte) error {
+	if len(certificates) == 0 {
+		return fmt.Errorf("server did not present a certificate")
+	}
+
+	actual := sha256.Sum256(certificates[0].RawSubjectPublicKeyInfo)
+	if !bytes.Equal(actual[:], hash) {
+		return fmt.Errorf("server certificate does not match the TLS pin of the profile (server key: %s%s)", pinPrefix, base64.StdEncoding.EncodeToString(actual[:]))
+	}
+
+	return nil
+}
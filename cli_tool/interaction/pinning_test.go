@@ -0,0 +1,138 @@
+package interaction
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTlsServer starts a TLS server without an info route, whose certificate the default transport trusts during the test
+func newTlsServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	t.Cleanup(server.Close)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	transport := http.DefaultTransport.(*http.Transport)
+	previous := transport.TLSClientConfig
+	transport.TLSClientConfig = &tls.Config{RootCAs: roots}
+	t.Cleanup(func() { transport.TLSClientConfig = previous })
+
+	host, err := pinnedHost(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		pinsMutex.Lock()
+		defer pinsMutex.Unlock()
+		delete(pins, host)
+	})
+
+	return server
+}
+
+func pinOf(certificate *x509.Certificate) string {
+	hash := sha256.Sum256(certificate.RawSubjectPublicKeyInfo)
+	return pinPrefix + base64.StdEncoding.EncodeToString(hash[:])
+}
+
+func TestParseTlsPin(t *testing.T) {
+	valid := pinPrefix + base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+	if _, err := ParseTlsPin(valid); err != nil {
+		t.Errorf("expected '%s' to be accepted, got %v", valid, err)
+	}
+
+	for _, pin := range []string{
+		"",
+		base64.StdEncoding.EncodeToString(make([]byte, sha256.Size)),
+		"sha1/" + base64.StdEncoding.EncodeToString(make([]byte, sha256.Size)),
+		pinPrefix + "not base64!",
+		pinPrefix + base64.StdEncoding.EncodeToString(make([]byte, sha256.Size-1)),
+	} {
+		if _, err := ParseTlsPin(pin); err == nil {
+			t.Errorf("expected '%s' to be rejected", pin)
+		}
+	}
+}
+
+func TestPinCertificateRequiresHttps(t *testing.T) {
+	pin := pinPrefix + base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+	if err := PinCertificate("http://localhost:8080", pin); err == nil {
+		t.Error("expected a pin of an http server to be rejected")
+	}
+}
+
+func TestPinnedHost(t *testing.T) {
+	tests := []struct {
+		serverAddress string
+		host          string
+	}{
+		{"https://forgetti.example.com", "forgetti.example.com:443"},
+		{"https://forgetti.example.com/", "forgetti.example.com:443"},
+		{"https://forgetti.example.com:8443/api", "forgetti.example.com:8443"},
+	}
+
+	for _, test := range tests {
+		host, err := pinnedHost(test.serverAddress)
+		if err != nil || host != test.host {
+			t.Errorf("%s: expected %s, got %s (error: %v)", test.serverAddress, test.host, host, err)
+		}
+	}
+}
+
+func TestCertificatePinMatches(t *testing.T) {
+	server := newTlsServer(t)
+	if err := PinCertificate(server.URL, pinOf(server.Certificate())); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewRemoteClient(server.URL, "").Info(); err != ErrInfoNotSupported {
+		t.Errorf("expected the request to reach the server, got %v", err)
+	}
+}
+
+func TestCertificatePinMismatch(t *testing.T) {
+	server := newTlsServer(t)
+	other := pinPrefix + base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+	if err := PinCertificate(server.URL, other); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := NewRemoteClient(server.URL, "").Info()
+	if err == nil || err == ErrInfoNotSupported {
+		t.Fatalf("expected the connection to be refused, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "TLS pin") || !strings.Contains(err.Error(), pinOf(server.Certificate())) {
+		t.Errorf("expected the error to name the TLS pin and the key of the server, got %v", err)
+	}
+}
+
+func TestCertificatePinKeepsCertificateVerification(t *testing.T) {
+	// The pin does not replace the verification of the certificate: a server whose certificate is not trusted is
+	// refused even if its key is pinned
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+	host, err := pinnedHost(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		pinsMutex.Lock()
+		defer pinsMutex.Unlock()
+		delete(pins, host)
+	})
+	if err := PinCertificate(server.URL, pinOf(server.Certificate())); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewRemoteClient(server.URL, "").Info(); err == nil || err == ErrInfoNotSupported {
+		t.Errorf("expected the untrusted certificate to be refused, got %v", err)
+	}
+}
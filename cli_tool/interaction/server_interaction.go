@@ -3,9 +3,13 @@ package interaction
 import (
 	"Forgetti/encryption"
 	"Forgetti/models"
+	"errors"
 	"fmt"
 	"forgetti-common/crypto"
+	"forgetti-common/dto"
 	"forgetti-common/logging"
+	"slices"
+	"strings"
 	"time"
 )
 
@@ -14,20 +18,34 @@ type KeyGenerationResult struct {
 	Metadata         models.Metadata
 }
 
-func GenerateKeyAndEncrypt(serverAddress string, key string, expiration time.Time) (*KeyGenerationResult, error) {
+// GenerateKeyAndEncrypt creates a new key on the server, in the given group unless the group is empty
+func GenerateKeyAndEncrypt(
+	serverAddress string,
+	token string,
+	key string,
+	expiration time.Time,
+	group string,
+	algVersion models.AlgVersion,
+) (*KeyGenerationResult, error) {
 	logger := logging.MakeLogger("server_interaction.GenerateKeyAndEncrypt")
-	remoteClient := NewRemoteClient(serverAddress)
+	remoteClient := NewRemoteClient(serverAddress, token)
 
 	logger.Verbose("Hashing key for server interaction with pre-remote hash algorithm")
-	keyHash, err := encryption.HashRemotePartForEncryption(key, models.CurrentAlgVersion().PreRemoteHash)
+	keyHash, err := encryption.HashRemotePartForEncryption(key, algVersion.PreRemoteHash)
 	if err != nil {
 		logger.Error("Failed to hash key: %v", err)
 		return nil, err
 	}
 	logger.Verbose("Key hashed successfully")
 
+	logger.Verbose("Checking key policy of server %s", serverAddress)
+	if err := checkKeyPolicy(remoteClient, expiration, algVersion); err != nil {
+		logger.Error("Key policy check failed: %v", err)
+		return nil, err
+	}
+
 	logger.Verbose("Making new key request to server %s with expiration %s", serverAddress, expiration.Format("2006-01-02 15:04:05"))
-	response, err := remoteClient.NewKey(keyHash, expiration)
+	response, err := remoteClient.NewKey(keyHash, expiration, group)
 	if err != nil {
 		logger.Error("Failed to create new key on server: %v", err)
 		return nil, err
@@ -43,7 +61,7 @@ func GenerateKeyAndEncrypt(serverAddress string, key string, expiration time.Tim
 
 	result := &KeyGenerationResult{
 		EncryptedKeyHash: response.EncryptedContent,
-		Metadata:         models.ToFileMetadata(response.Metadata, serverAddress),
+		Metadata:         models.ToFileMetadata(response.Metadata, serverAddress, algVersion),
 	}
 	logger.Info("Successfully generated and encrypted key. KeyId: %s, Expiration: %s", result.Metadata.KeyId, result.Metadata.Expiration.Format("2006-01-02 15:04:05"))
 	return result, nil
@@ -51,7 +69,7 @@ func GenerateKeyAndEncrypt(serverAddress string, key string, expiration time.Tim
 
 func EncryptWithExistingKey(serverAddress string, key string, metadata *models.Metadata) (string, error) {
 	logger := logging.MakeLogger("server_interaction.EncryptWithExistingKey")
-	remoteClient := NewRemoteClient(serverAddress)
+	remoteClient := NewRemoteClient(serverAddress, "") // Encryption with existing keys does not require a token
 	versions := models.ParseAlgVersion(metadata.AlgVersion)
 
 	logger.Verbose("Hashing key for existing key encryption with KeyId: %s", metadata.KeyId)
@@ -73,7 +91,8 @@ func EncryptWithExistingKey(serverAddress string, key string, metadata *models.M
 	logger.Verbose("Validating encrypted key hash for existing key")
 	if err := validateEncryptedKeyHash(keyHash, response.EncryptedContent, metadata.VerificationKey); err != nil {
 		logger.Error("Key hash validation failed for existing key: %v", err)
-		return "", err
+		// The verification key comes from the header of the file
+		return "", models.NewCodedError(models.ErrorCodeCorruptFile, "the verification key of the file does not match key %s: %w", metadata.KeyId, err)
 	}
 	logger.Verbose("Key hash validation successful for existing key")
 	logger.Info("Successfully encrypted with existing key. KeyId: %s", metadata.KeyId)
@@ -81,6 +100,49 @@ func EncryptWithExistingKey(serverAddress string, key string, metadata *models.M
 	return response.EncryptedContent, nil
 }
 
+// DestroyKey destroys a key of the API token on the server, named either by its id or by its group
+func DestroyKey(serverAddress string, token string, keyId string, group string) (string, error) {
+	logger := logging.MakeLogger("server_interaction.DestroyKey")
+	remoteClient := NewRemoteClient(serverAddress, token)
+
+	logger.Verbose("Making destroy request to server %s", serverAddress)
+	response, err := remoteClient.DestroyKey(keyId, group)
+	if err != nil {
+		logger.Error("Failed to destroy key on server: %v", err)
+		return "", err
+	}
+
+	return response.KeyId, nil
+}
+
+// checkKeyPolicy validates the key parameters against the policy advertised by the server
+func checkKeyPolicy(remoteClient *RemoteClient, expiration time.Time, algVersion models.AlgVersion) error {
+	logger := logging.MakeLogger("server_interaction.checkKeyPolicy")
+
+	info, err := remoteClient.Info()
+	if errors.Is(err, ErrInfoNotSupported) {
+		logger.Verbose("Server does not advertise its key policy, skipping local validation")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	request := dto.NewKeyRequest{Expiration: expiration}
+	minExpiration := time.Duration(info.MinExpirationSeconds) * time.Second
+	maxExpiration := time.Duration(info.MaxExpirationSeconds) * time.Second
+	if err := request.ValidateExpirationLimits(minExpiration, maxExpiration); err != nil {
+		return fmt.Errorf("expiration not allowed by server policy: %w", err)
+	}
+
+	if !slices.Contains(info.SupportedAlgVersions, algVersion.String()) {
+		return fmt.Errorf("server does not support algorithm version %s (supported: %s)", algVersion.String(), strings.Join(info.SupportedAlgVersions, ", "))
+	}
+
+	logger.Verbose("Key parameters match server policy")
+	return nil
+}
+
 func validateEncryptedKeyHash(keyHash string, encrypted string, serializedKey string) error {
 	logger := logging.MakeLogger("server_interaction.validateEncryptedKeyHash")
 
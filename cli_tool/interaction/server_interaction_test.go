@@ -0,0 +1,92 @@
+package interaction
+
+import (
+	"Forgetti/models"
+	"encoding/json"
+	"errors"
+	"forgetti-common/constants"
+	"forgetti-common/dto"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newInfoServer starts a server advertising the given key policy
+func newInfoServer(t *testing.T, info dto.InfoResponse) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(constants.InfoRoute, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(info)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestInfoReturnsAdvertisedPolicy(t *testing.T) {
+	advertised := dto.InfoResponse{
+		MinExpirationSeconds:   3600,
+		MaxExpirationSeconds:   86400,
+		SupportedAlgVersions:   []string{models.CurrentAlgVersion().String()},
+		TokenRequiredForNewKey: true,
+	}
+	server := newInfoServer(t, advertised)
+
+	info, err := NewRemoteClient(server.URL, "").Info()
+	if err != nil {
+		t.Fatalf("expected the info to be returned, got %v", err)
+	}
+	if info.MinExpirationSeconds != 3600 || info.MaxExpirationSeconds != 86400 || !info.TokenRequiredForNewKey {
+		t.Errorf("expected %+v, got %+v", advertised, info)
+	}
+}
+
+func TestInfoNotSupported(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(server.Close)
+
+	if _, err := NewRemoteClient(server.URL, "").Info(); !errors.Is(err, ErrInfoNotSupported) {
+		t.Errorf("expected ErrInfoNotSupported, got %v", err)
+	}
+
+	// Servers without the info route are not checked locally
+	if err := checkKeyPolicy(NewRemoteClient(server.URL, ""), time.Now().Add(time.Hour), models.CurrentAlgVersion()); err != nil {
+		t.Errorf("expected the policy check to be skipped, got %v", err)
+	}
+}
+
+func TestCheckKeyPolicy(t *testing.T) {
+	server := newInfoServer(t, dto.InfoResponse{
+		MinExpirationSeconds: 3600,
+		MaxExpirationSeconds: 86400,
+		SupportedAlgVersions: []string{models.CurrentAlgVersion().String()},
+	})
+	client := NewRemoteClient(server.URL, "")
+
+	tests := []struct {
+		name       string
+		expiration time.Duration
+		algVersion models.AlgVersion
+		errorPart  string
+	}{
+		{"allowed", 2 * time.Hour, models.CurrentAlgVersion(), ""},
+		{"too short", 10 * time.Minute, models.CurrentAlgVersion(), "expiration not allowed"},
+		{"too long", 48 * time.Hour, models.CurrentAlgVersion(), "expiration not allowed"},
+		{"unsupported version", 2 * time.Hour, models.ParseAlgVersion("2:1:1:1"), "does not support algorithm version"},
+	}
+
+	for _, test := range tests {
+		err := checkKeyPolicy(client, time.Now().Add(test.expiration), test.algVersion)
+		if test.errorPart == "" && err != nil {
+			t.Errorf("%s: expected no error, got %v", test.name, err)
+		}
+		if test.errorPart != "" && (err == nil || !strings.Contains(err.Error(), test.errorPart)) {
+			t.Errorf("%s: expected an error containing '%s', got %v", test.name, test.errorPart, err)
+		}
+	}
+}
@@ -5,10 +5,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"forgetti-common/io"
+	"os"
 )
 
 const delimiterByte = 0x00 // Must be invalid in JSON
 
+// EncryptedFileMode is the mode of encrypted files, whose content can't be read without the password and the server
+const EncryptedFileMode = 0644
+
+// DecryptedFileMode is the mode of decrypted files, unless the mode stored at encryption is restored
+const DecryptedFileMode = 0600
+
 func FileExists(path string) bool {
 	return io.FileExists(path)
 }
@@ -17,8 +24,8 @@ func ReadFile(path string) ([]byte, error) {
 	return io.ReadFile(path)
 }
 
-func WriteFile(path string, overwrite bool, data []byte) error {
-	return io.WriteFile(path, overwrite, data)
+func WriteFile(path string, overwrite bool, data []byte, perm os.FileMode) error {
+	return io.WriteFile(path, overwrite, data, perm)
 }
 
 func GetRelativePathFromBin(path string) (string, error) {
@@ -26,10 +33,29 @@ func GetRelativePathFromBin(path string) (string, error) {
 }
 
 func WriteContentWithMetadataToFile(path string, overwrite bool, data *models.FileContentWithMetadata) error {
+	fileContent, err := serializeContentWithMetadata(data)
+	if err != nil {
+		return err
+	}
+
+	return io.WriteFile(path, overwrite, fileContent, EncryptedFileMode)
+}
+
+// ReplaceContentWithMetadataInFile replaces an existing encrypted file, which keeps its old content if writing fails
+func ReplaceContentWithMetadataInFile(path string, data *models.FileContentWithMetadata) error {
+	fileContent, err := serializeContentWithMetadata(data)
+	if err != nil {
+		return err
+	}
+
+	return io.ReplaceFile(path, fileContent)
+}
+
+func serializeContentWithMetadata(data *models.FileContentWithMetadata) ([]byte, error) {
 	// Marshal only the metadata to JSON
 	metadataJson, err := json.Marshal(data.Metadata)
 	if err != nil {
-		return fmt.Errorf("failed to marshal metadata: %w", err)
+		return nil, fmt.Errorf("failed to marshal metadata: %w", err)
 	}
 
 	// Create the final file content: metadata JSON + null byte delimiter + raw encrypted bytes
@@ -37,7 +63,7 @@ func WriteContentWithMetadataToFile(path string, overwrite bool, data *models.Fi
 	fileContent := append(metadataJson, delimiterByte)
 	fileContent = append(fileContent, data.FileContent...)
 
-	return io.WriteFile(path, overwrite, fileContent)
+	return fileContent, nil
 }
 
 func ReadContentWithMetadataFromFile(path string) (*models.FileContentWithMetadata, error) {
@@ -56,14 +82,14 @@ func ReadContentWithMetadataFromFile(path string) (*models.FileContentWithMetada
 	}
 
 	if delimiterIndex == -1 {
-		return nil, fmt.Errorf("invalid file format: no delimiter found between metadata and encrypted content")
+		return nil, models.NewCodedError(models.ErrorCodeCorruptFile, "invalid file format: no delimiter found between metadata and encrypted content")
 	}
 
 	// Parse metadata JSON from the beginning up to the delimiter
 	metadataJson := fileData[:delimiterIndex]
 	var metadata models.Metadata
 	if err := json.Unmarshal(metadataJson, &metadata); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal metadata: %w", err)
+		return nil, models.NewCodedError(models.ErrorCodeCorruptFile, "failed to unmarshal metadata: %w", err)
 	}
 
 	// Use the remaining bytes after the delimiter as encrypted content
@@ -18,6 +18,21 @@ func CurrentAlgVersion() AlgVersion {
 	return AlgVersion{Symmetric: "1", LocalHash: "1", PreRemoteHash: "1", PostRemoteHash: "1"}
 }
 
+// SupportedAlgVersions returns the versions this client can create keys with
+func SupportedAlgVersions() []AlgVersion {
+	return []AlgVersion{CurrentAlgVersion()}
+}
+
+// ParseSupportedAlgVersion parses a version given by the user, which must be supported for new keys
+func ParseSupportedAlgVersion(s string) (AlgVersion, error) {
+	for _, version := range SupportedAlgVersions() {
+		if version.String() == s {
+			return version, nil
+		}
+	}
+	return AlgVersion{}, fmt.Errorf("unsupported algorithm version '%s' (supported: %s)", s, CurrentAlgVersion().String())
+}
+
 func (v AlgVersion) String() string {
 	return fmt.Sprintf("%s%s%s%s%s%s%s", v.Symmetric, separator, v.LocalHash, separator, v.PreRemoteHash, separator, v.PostRemoteHash)
 }
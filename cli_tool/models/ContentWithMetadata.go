@@ -4,6 +4,8 @@ import (
 	"forgetti-common/dto"
 	"time"
 	"fmt"
+	"io/fs"
+	"strconv"
 )
 
 type Metadata struct {
@@ -12,6 +14,32 @@ type Metadata struct {
 	VerificationKey string 	  `json:"verification_key"`
 	ServerAddress   string 	  `json:"server_address"`
 	AlgVersion      string 	  `json:"alg_version"`
+	Group           string 	  `json:"group,omitempty"` // the key group, if the key is shared with other files
+	Format          string 	  `json:"format,omitempty"` // empty for a single file
+	Mode            string 	  `json:"mode,omitempty"` // octal permissions of a single file at encryption, for example "0640"
+}
+
+// FormatTar is the format of a directory packed by the archive package. Its entries are only known after decryption.
+const FormatTar = "tar"
+
+func (m *Metadata) IsArchive() bool {
+	return m.Format == FormatTar
+}
+
+func (m *Metadata) SetFileMode(mode fs.FileMode) {
+	m.Mode = fmt.Sprintf("%04o", mode.Perm())
+}
+
+// FileMode returns the permissions of the file at encryption, or false if they were not stored
+func (m *Metadata) FileMode() (fs.FileMode, bool) {
+	if m.Mode == "" {
+		return 0, false
+	}
+	mode, err := strconv.ParseUint(m.Mode, 8, 32)
+	if err != nil {
+		return 0, false
+	}
+	return fs.FileMode(mode).Perm(), true
 }
 
 type FileContentWithMetadata struct {
@@ -19,21 +47,37 @@ type FileContentWithMetadata struct {
 	Metadata  Metadata `json:"metadata"`
 }
 
-func ToFileMetadata(metadata dto.Metadata, serverAddress string) Metadata {
+func ToFileMetadata(metadata dto.Metadata, serverAddress string, algVersion AlgVersion) Metadata {
 	return Metadata{
 		KeyId: metadata.KeyId,
 		Expiration: metadata.Expiration,
 		VerificationKey: metadata.VerificationKey,
 		ServerAddress: serverAddress,
-		AlgVersion: CurrentAlgVersion().String(),
+		AlgVersion: algVersion.String(),
+		Group: metadata.Group,
 	}
 }
 
 func (f *FileContentWithMetadata) String() string {
 	roundedDuration := time.Until(f.Metadata.Expiration).Round(time.Second)
+	group := ""
+	if f.Metadata.Group != "" {
+		group = fmt.Sprintf("Key group:                %s\n", f.Metadata.Group)
+	}
+	format := ""
+	if f.Metadata.IsArchive() {
+		format = "Content:                  directory archive\n"
+	}
+	mode := ""
+	if f.Metadata.Mode != "" {
+		mode = fmt.Sprintf("File mode:                %s\n", f.Metadata.Mode)
+	}
 	return fmt.Sprintf("Encrypted content length: %d bytes\n", len(f.FileContent)) +
 		   fmt.Sprintf("Key ID:                   %s\n", f.Metadata.KeyId) +
 		   fmt.Sprintf("Expires at:               %s (in %s)\n", f.Metadata.Expiration.String(), roundedDuration.String()) +
 		   fmt.Sprintf("Server Address:           %s\n", f.Metadata.ServerAddress) +
-		   fmt.Sprintf("Algorithm Version:        %s\n", f.Metadata.AlgVersion)
+		   fmt.Sprintf("Algorithm Version:        %s\n", f.Metadata.AlgVersion) +
+		   group +
+		   format +
+		   mode
 }
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Error codes of failures detected by the CLI itself. Errors returned by the server keep the error code of the server,
+// for example "key-not-found" or "rate-limited".
+const (
+	ErrorCodeInvalidInput      = "invalid-input"
+	ErrorCodeInputNotFound     = "input-not-found"
+	ErrorCodeOutputExists      = "output-exists"
+	ErrorCodeKeyExpired        = "key-expired"
+	ErrorCodeDecryptionFailed  = "decryption-failed"
+	ErrorCodeCorruptFile       = "corrupt-file"
+	ErrorCodeServerUnreachable = "server-unreachable"
+	ErrorCodeBatchFailed       = "batch-failed"
+	ErrorCodeUnknown           = "error"
+)
+
+// Error codes of the server that the CLI handles
+const (
+	// ErrorCodeKeyNotFound is returned for keys that were destroyed, or that expired and were removed
+	ErrorCodeKeyNotFound = "key-not-found"
+)
+
+// CodedError attaches an error code to an error, so that scripts don't have to parse messages
+type CodedError struct {
+	Code string
+	Err  error
+}
+
+func (e *CodedError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *CodedError) Unwrap() error {
+	return e.Err
+}
+
+func (e *CodedError) ErrorCode() string {
+	return e.Code
+}
+
+func NewCodedError(code string, format string, args ...any) error {
+	return &CodedError{Code: code, Err: fmt.Errorf(format, args...)}
+}
+
+// WithCode attaches the code to the error, unless it already has one
+func WithCode(code string, err error) error {
+	if err == nil || ErrorCode(err) != ErrorCodeUnknown {
+		return err
+	}
+	return &CodedError{Code: code, Err: err}
+}
+
+// ErrorCode returns the code of the first error in the chain that has one, or ErrorCodeUnknown
+func ErrorCode(err error) string {
+	var coded interface{ ErrorCode() string }
+	if errors.As(err, &coded) {
+		return coded.ErrorCode()
+	}
+	return ErrorCodeUnknown
+}
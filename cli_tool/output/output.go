@@ -0,0 +1,98 @@
+// Package output selects between human-readable output and one JSON result object per command, for scripts.
+package output
+
+import (
+	"Forgetti/models"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+)
+
+type Format string
+
+const (
+	FormatText Format = "text"
+	FormatJson Format = "json"
+)
+
+// SchemaVersion is increased only by changes that could break readers of the JSON results, such as removing or
+// renaming fields. New fields can be added without changing it.
+const SchemaVersion = 1
+
+var format = FormatText
+
+// stdout receives the JSON result objects
+var stdout io.Writer = os.Stdout
+
+func ParseFormat(value string) (Format, error) {
+	switch Format(value) {
+	case FormatText, FormatJson:
+		return Format(value), nil
+	default:
+		return "", fmt.Errorf("invalid output format '%s' (expected 'text' or 'json')", value)
+	}
+}
+
+func SetFormat(value Format) {
+	format = value
+}
+
+func IsJson() bool {
+	return format == FormatJson
+}
+
+// Console is where logs, prompts and other human-readable messages go. With JSON output they go to stderr, so that
+// stdout holds only the result object.
+func Console() io.Writer {
+	if IsJson() {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+type Result struct {
+	SchemaVersion int    `json:"schema_version"`
+	Command       string `json:"command"`
+	Ok            bool   `json:"ok"`
+	Result        any    `json:"result,omitempty"`
+	Error         *Error `json:"error,omitempty"`
+}
+
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Report prints the result object of the command with JSON output. With text output, the command already logged its
+// result, so only the error is printed.
+func Report(command string, result any, err error) {
+	if !IsJson() {
+		if err != nil {
+			fmt.Println(err)
+		}
+		return
+	}
+
+	// Commands return nil results of their own type on errors
+	if value := reflect.ValueOf(result); value.Kind() == reflect.Pointer && value.IsNil() {
+		result = nil
+	}
+
+	object := Result{
+		SchemaVersion: SchemaVersion,
+		Command:       command,
+		Ok:            err == nil,
+		Result:        result,
+	}
+	if err != nil {
+		object.Error = &Error{Code: models.ErrorCode(err), Message: err.Error()}
+	}
+
+	encoder := json.NewEncoder(stdout)
+	encoder.SetEscapeHTML(false)
+	if encodeErr := encoder.Encode(object); encodeErr != nil {
+		fmt.Fprintf(os.Stderr, "failed to serialize result: %v\n", encodeErr)
+	}
+}
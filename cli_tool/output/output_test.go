@@ -0,0 +1,91 @@
+package output
+
+import (
+	"Forgetti/models"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+// reportJson returns the JSON object that Report prints for the result
+func reportJson(t *testing.T, result any, err error) map[string]any {
+	t.Helper()
+
+	buffer := &bytes.Buffer{}
+	stdout = buffer
+	SetFormat(FormatJson)
+	t.Cleanup(func() {
+		stdout = os.Stdout
+		SetFormat(FormatText)
+	})
+
+	Report("encrypt", result, err)
+
+	var object map[string]any
+	if err := json.Unmarshal(buffer.Bytes(), &object); err != nil {
+		t.Fatalf("expected one JSON object, got %q: %v", buffer.String(), err)
+	}
+	return object
+}
+
+func TestReportSuccess(t *testing.T) {
+	type encryptResult struct {
+		OutputPath string `json:"output_path"`
+	}
+	object := reportJson(t, &encryptResult{OutputPath: "file.enc"}, nil)
+
+	if object["schema_version"] != float64(SchemaVersion) || object["command"] != "encrypt" || object["ok"] != true {
+		t.Errorf("expected the schema version, command and ok, got %v", object)
+	}
+	if result, ok := object["result"].(map[string]any); !ok || result["output_path"] != "file.enc" {
+		t.Errorf("expected the result object, got %v", object["result"])
+	}
+	if _, ok := object["error"]; ok {
+		t.Errorf("expected no error, got %v", object["error"])
+	}
+}
+
+func TestReportErrorCodes(t *testing.T) {
+	type encryptResult struct{}
+
+	tests := []struct {
+		err  error
+		code string
+	}{
+		{models.NewCodedError(models.ErrorCodeKeyExpired, "key %s expired", "id"), models.ErrorCodeKeyExpired},
+		{fmt.Errorf("failed to decrypt: %w", models.NewCodedError(models.ErrorCodeCorruptFile, "bad header")), models.ErrorCodeCorruptFile},
+		{models.WithCode(models.ErrorCodeInvalidInput, errors.New("missing argument")), models.ErrorCodeInvalidInput},
+		{errors.New("something else"), models.ErrorCodeUnknown},
+	}
+
+	for _, test := range tests {
+		var result *encryptResult
+		object := reportJson(t, result, test.err)
+
+		if object["ok"] != false {
+			t.Errorf("%v: expected ok to be false, got %v", test.err, object["ok"])
+		}
+		if _, ok := object["result"]; ok {
+			t.Errorf("%v: expected the nil result to be omitted, got %v", test.err, object["result"])
+		}
+		reported, ok := object["error"].(map[string]any)
+		if !ok || reported["code"] != test.code || reported["message"] != test.err.Error() {
+			t.Errorf("%v: expected code %s and the message, got %v", test.err, test.code, object["error"])
+		}
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, value := range []string{"text", "json"} {
+		if format, err := ParseFormat(value); err != nil || string(format) != value {
+			t.Errorf("expected '%s' to be accepted, got %s, %v", value, format, err)
+		}
+	}
+
+	if _, err := ParseFormat("out.enc"); err == nil {
+		t.Error("expected 'out.enc' to be rejected")
+	}
+}
@@ -0,0 +1,131 @@
+// Package shred overwrites files before removing them, so that their content can't be read back from the disk.
+//
+// Overwriting in place only works if the filesystem writes the new data over the old blocks. Copy-on-write and
+// journaling filesystems (btrfs, ZFS, APFS, ext4 with data journaling), snapshots, backups and the wear leveling of SSDs
+// and flash storage can keep old copies that no overwrite reaches. Full disk encryption is the reliable protection there.
+package shred
+
+import (
+	"crypto/rand"
+	"fmt"
+	"forgetti-common/logging"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// DefaultPasses is the number of random overwrites of each file
+const DefaultPasses = 3
+
+// Warning is shown whenever files are shredded
+const Warning = "Shredding can't reach old copies of the data kept by copy-on-write or journaling filesystems, snapshots, backups or the wear leveling of SSDs. Use full disk encryption to protect against those."
+
+const chunkSize = 64 * 1024
+
+// File overwrites the regular file with random data in the given number of passes, syncing each pass to the disk, then
+// truncates and removes it. Symbolic links and other special files are refused.
+func File(path string, passes int) error {
+	logger := logging.MakeLogger("shred.File")
+
+	if passes < 1 {
+		return fmt.Errorf("number of passes must be at least 1")
+	}
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		return fmt.Errorf("failed to read '%s': %w", path, err)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("only regular files can be shredded: '%s'", path)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open '%s': %w", path, err)
+	}
+
+	for pass := 1; pass <= passes; pass++ {
+		if err := overwrite(file, info.Size()); err != nil {
+			file.Close()
+			return fmt.Errorf("failed to overwrite '%s' (pass %d of %d): %w", path, pass, passes, err)
+		}
+		logger.Verbose("Overwrote '%s' (pass %d of %d)", path, pass, passes)
+	}
+
+	if err := file.Truncate(0); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to truncate '%s': %w", path, err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to truncate '%s': %w", path, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close '%s': %w", path, err)
+	}
+
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove '%s': %w", path, err)
+	}
+	return nil
+}
+
+// Directory shreds every regular file below root and removes its directories. Fails without changing anything if the
+// tree contains symbolic links or special files, as those can't be shredded. Returns the number of shredded files.
+func Directory(root string, passes int) (int, error) {
+	var files []string
+	var directories []string
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		switch {
+		case entry.IsDir():
+			directories = append(directories, path)
+		case entry.Type().IsRegular():
+			files = append(files, path)
+		default:
+			return fmt.Errorf("only regular files and directories can be shredded: '%s'", path)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for i, file := range files {
+		if err := File(file, passes); err != nil {
+			return i, err
+		}
+	}
+
+	// Directories are removed deepest first, after their contents
+	for i := len(directories) - 1; i >= 0; i-- {
+		if err := os.Remove(directories[i]); err != nil {
+			return len(files), fmt.Errorf("failed to remove directory '%s': %w", directories[i], err)
+		}
+	}
+
+	return len(files), nil
+}
+
+func overwrite(file *os.File, size int64) error {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	buffer := make([]byte, chunkSize)
+	for remaining := size; remaining > 0; {
+		chunk := buffer[:min(remaining, chunkSize)]
+		if _, err := rand.Read(chunk); err != nil {
+			return err
+		}
+		if _, err := file.Write(chunk); err != nil {
+			return err
+		}
+		remaining -= int64(len(chunk))
+	}
+
+	return file.Sync()
+}
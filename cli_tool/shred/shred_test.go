@@ -0,0 +1,153 @@
+package shred
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, path string, content []byte) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOverwrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret.txt")
+	// Larger than one chunk, to overwrite more than one
+	original := bytes.Repeat([]byte("secret "), chunkSize/3)
+	writeTestFile(t, path, original)
+
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if err := overwrite(file, int64(len(original))); err != nil {
+		t.Fatalf("overwrite failed: %v", err)
+	}
+
+	overwritten, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(overwritten) != len(original) {
+		t.Errorf("expected the size to stay %d bytes, got %d", len(original), len(overwritten))
+	}
+	if bytes.Contains(overwritten, []byte("secret")) {
+		t.Error("the original content is still in the file")
+	}
+}
+
+func TestFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "secret.txt")
+	writeTestFile(t, path, []byte("secret content"))
+
+	// The hard link keeps the data of the file reachable after it is removed
+	link := filepath.Join(dir, "link")
+	if err := os.Link(path, link); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := File(path, DefaultPasses); err != nil {
+		t.Fatalf("File failed: %v", err)
+	}
+
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Errorf("expected the file to be removed, got %v", err)
+	}
+	remaining, err := os.ReadFile(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(remaining) != 0 {
+		t.Errorf("expected the data to be truncated, %d bytes remain: %q", len(remaining), remaining)
+	}
+}
+
+func TestFileRefusesSpecialFiles(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target.txt")
+	writeTestFile(t, target, []byte("keep"))
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := File(link, DefaultPasses); err == nil {
+		t.Error("expected a symbolic link to be refused")
+	}
+	if err := File(dir, DefaultPasses); err == nil {
+		t.Error("expected a directory to be refused")
+	}
+	if err := File(target, 0); err == nil {
+		t.Error("expected 0 passes to be refused")
+	}
+
+	content, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "keep" {
+		t.Errorf("the target of the link was changed to %q", content)
+	}
+	if _, err := os.Lstat(link); err != nil {
+		t.Errorf("the link was removed: %v", err)
+	}
+}
+
+func TestDirectory(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "tree")
+	writeTestFile(t, filepath.Join(root, "a.txt"), []byte("a"))
+	writeTestFile(t, filepath.Join(root, "sub", "b.txt"), []byte("b"))
+	writeTestFile(t, filepath.Join(root, "sub", "deeper", "c.txt"), []byte("c"))
+	if err := os.MkdirAll(filepath.Join(root, "empty"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	count, err := Directory(root, 1)
+	if err != nil {
+		t.Fatalf("Directory failed: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("expected 3 shredded files, got %d", count)
+	}
+	if _, err := os.Lstat(root); !os.IsNotExist(err) {
+		t.Errorf("expected the directory to be removed, got %v", err)
+	}
+}
+
+func TestDirectoryRefusesLinks(t *testing.T) {
+	outside := filepath.Join(t.TempDir(), "outside.txt")
+	writeTestFile(t, outside, []byte("outside"))
+
+	root := t.TempDir()
+	file := filepath.Join(root, "a.txt")
+	writeTestFile(t, file, []byte("a"))
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Directory(root, 1); err == nil {
+		t.Fatal("expected a tree with a symbolic link to be refused")
+	}
+
+	// Nothing is changed, neither the files of the tree nor the target of the link
+	for path, expected := range map[string]string{file: "a", outside: "outside"} {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("'%s' was removed: %v", path, err)
+		}
+		if string(content) != expected {
+			t.Errorf("'%s' was changed to %q", path, content)
+		}
+	}
+}
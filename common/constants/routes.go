@@ -1,4 +1,7 @@
 package constants
 
 const NewKeyRoute string = "/enc/new-key"
-const EncryptRoute string = "/enc/encrypt"
\ No newline at end of file
+const EncryptRoute string = "/enc/encrypt"
+const UsageRoute string = "/enc/usage"
+const InfoRoute string = "/enc/info"
+const DestroyKeyRoute string = "/enc/destroy"
@@ -13,3 +13,8 @@ type PrivateKey struct {
 	N *big.Int
 	D *big.Int
 }
+
+// Redacted keeps private keys out of logs
+func (k *PrivateKey) Redacted() string {
+	return "[private key]"
+}
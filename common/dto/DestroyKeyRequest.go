@@ -0,0 +1,21 @@
+package dto
+
+import "errors"
+
+// DestroyKeyRequest names the key to destroy, either by its id or by its group
+type DestroyKeyRequest struct {
+	KeyId string `json:"key_id,omitempty" binding:"omitempty,uuid"`
+	Group string `json:"group,omitempty" binding:"omitempty,max=64"`
+}
+
+func (r DestroyKeyRequest) Validate() error {
+	if (r.KeyId == "") == (r.Group == "") {
+		return errors.New("exactly one of key_id and group is required")
+	}
+
+	if r.Group != "" {
+		return ValidateGroupName(r.Group)
+	}
+
+	return nil
+}
@@ -0,0 +1,6 @@
+package dto
+
+type DestroyKeyResponse struct {
+	KeyId string `json:"key_id"`
+	Group string `json:"group,omitempty"`
+}
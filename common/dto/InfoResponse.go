@@ -0,0 +1,9 @@
+package dto
+
+type InfoResponse struct {
+	MinExpirationSeconds   int64    `json:"min_expiration_seconds"`
+	MaxExpirationSeconds   int64    `json:"max_expiration_seconds"` // includes the override of the API token, if one was sent
+	SupportedAlgVersions   []string `json:"supported_alg_versions"`
+	TokenRequiredForNewKey bool     `json:"token_required_for_new_key"`
+	WebhooksEnabled        bool     `json:"webhooks_enabled"`
+}
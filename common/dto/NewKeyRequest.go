@@ -3,14 +3,24 @@ package dto
 import (
 	"errors"
 	"fmt"
+	"net/url"
+	"regexp"
 	"time"
 )
 
-const maxExpiration time.Duration = 30 * 24 * time.Hour
+// validGroupName keeps key group names readable and safe to use in file names
+var validGroupName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
 
 type NewKeyRequest struct {
 	Content    string    `json:"content" binding:"required,min=1,max=1000"`
 	Expiration time.Time `json:"expiration" binding:"required"`
+	// WebhookUrl is notified when the key is about to expire, expires and is destroyed. The notifications are signed
+	// with WebhookSecret.
+	WebhookUrl    string `json:"webhook_url,omitempty" binding:"omitempty,max=2048"`
+	WebhookSecret string `json:"webhook_secret,omitempty" binding:"required_with=WebhookUrl,omitempty,min=16,max=256"`
+	// Group names the key, so that it can be shared by many files. Group names are unique among the live keys of an
+	// API token.
+	Group string `json:"group,omitempty" binding:"omitempty,max=64"`
 }
 
 func (r NewKeyRequest) Validate() error {
@@ -18,9 +28,38 @@ func (r NewKeyRequest) Validate() error {
 		return errors.New("expiration must be in the future")
 	}
 
+	if r.WebhookUrl != "" {
+		parsed, err := url.Parse(r.WebhookUrl)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return errors.New("webhook_url must be an absolute http or https URL")
+		}
+	}
+
+	if r.Group != "" {
+		if err := ValidateGroupName(r.Group); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r NewKeyRequest) ValidateExpirationLimits(minExpiration time.Duration, maxExpiration time.Duration) error {
+	if r.Expiration.Before(time.Now().Add(minExpiration)) {
+		return fmt.Errorf("expiration must be at least %s in the future", minExpiration.String())
+	}
+
 	if r.Expiration.After(time.Now().Add(maxExpiration)) {
 		return fmt.Errorf("expiration must be less than %s in the future", maxExpiration.String())
 	}
 
 	return nil
 }
+
+func ValidateGroupName(group string) error {
+	if len(group) > 64 || !validGroupName.MatchString(group) {
+		return errors.New("group must be at most 64 letters, digits, '.', '_' or '-', starting with a letter or digit")
+	}
+
+	return nil
+}
@@ -6,6 +6,7 @@ type Metadata struct {
 	KeyId           string    `json:"key_id"`
 	Expiration      time.Time `json:"expiration"`
 	VerificationKey string    `json:"verification_key"`
+	Group           string    `json:"group,omitempty"`
 }
 
 type NewKeyResponse struct {
@@ -0,0 +1,10 @@
+package dto
+
+type UsageResponse struct {
+	TokenName            string `json:"token_name"`
+	LiveKeys             int64  `json:"live_keys"`
+	MaxLiveKeys          int    `json:"max_live_keys"` // 0 means unlimited
+	KeysCreatedToday     int64  `json:"keys_created_today"`
+	DailyKeyCap          int    `json:"daily_key_cap"` // 0 means unlimited
+	MaxExpirationSeconds int64  `json:"max_expiration_seconds"`
+}
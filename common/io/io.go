@@ -1,7 +1,11 @@
 package io
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 )
@@ -16,7 +20,15 @@ func ReadFile(path string) ([]byte, error) {
 	return os.ReadFile(path)
 }
 
-func WriteFile(path string, overwrite bool, data []byte) error {
+// WriteFile writes the file with the given permissions, see WriteFileFrom
+func WriteFile(path string, overwrite bool, data []byte, perm os.FileMode) error {
+	return WriteFileFrom(path, overwrite, perm, bytes.NewReader(data))
+}
+
+// WriteFileFrom writes the content to a temporary file in the same directory, syncs it and renames it into place, so
+// that a crash never leaves a partly written file behind. The file gets the given permissions, also when it replaces
+// an existing file.
+func WriteFileFrom(path string, overwrite bool, perm os.FileMode, content io.Reader) error {
 	if FileExists(path) && !overwrite {
 		return fmt.Errorf("file already exists: '%s'", path)
 	}
@@ -25,7 +37,60 @@ func WriteFile(path string, overwrite bool, data []byte) error {
 		return fmt.Errorf("failed to create directories: '%s'", path)
 	}
 
-	return os.WriteFile(path, data, 0644)
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := io.Copy(file, content); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write '%s': %w", path, err)
+	}
+	if err := file.Chmod(perm); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to set mode of '%s': %w", path, err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write '%s': %w", path, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write '%s': %w", path, err)
+	}
+
+	if overwrite {
+		if err := os.Rename(file.Name(), path); err != nil {
+			return fmt.Errorf("failed to replace '%s': %w", path, err)
+		}
+		return nil
+	}
+
+	// A link fails if the file was created in the meantime, where a rename would replace it
+	err = os.Link(file.Name(), path)
+	if errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("file already exists: '%s'", path)
+	} else if err != nil {
+		// Some filesystems don't support links
+		if FileExists(path) {
+			return fmt.Errorf("file already exists: '%s'", path)
+		}
+		if err := os.Rename(file.Name(), path); err != nil {
+			return fmt.Errorf("failed to create '%s': %w", path, err)
+		}
+	}
+	return nil
+}
+
+// ReplaceFile replaces an existing file like WriteFile, keeping its permissions. If writing fails, the file keeps its
+// old content.
+func ReplaceFile(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to read file mode: %w", err)
+	}
+
+	return WriteFile(path, true, data, info.Mode().Perm())
 }
 
 func GetRelativePathFromBin(path string) (string, error) {
@@ -0,0 +1,84 @@
+package io
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "sub", "secret.txt")
+
+	if err := WriteFile(path, false, []byte("first"), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	assertFile(t, path, "first", 0600)
+
+	if err := WriteFile(path, false, []byte("second"), 0600); err == nil {
+		t.Fatal("expected an error for an existing file without overwrite")
+	}
+	assertFile(t, path, "first", 0600)
+
+	// The permissions of the replaced file don't carry over
+	if err := os.Chmod(path, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(path, true, []byte("second"), 0600); err != nil {
+		t.Fatalf("WriteFile with overwrite failed: %v", err)
+	}
+	assertFile(t, path, "second", 0600)
+
+	assertNoTemporaryFiles(t, filepath.Dir(path))
+}
+
+func TestReplaceFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file.forgetti")
+
+	if err := WriteFile(path, false, []byte("old"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReplaceFile(path, []byte("new")); err != nil {
+		t.Fatalf("ReplaceFile failed: %v", err)
+	}
+	assertFile(t, path, "new", 0640)
+
+	if err := ReplaceFile(filepath.Join(dir, "missing"), []byte("new")); err == nil {
+		t.Fatal("expected an error for a missing file")
+	}
+
+	assertNoTemporaryFiles(t, dir)
+}
+
+func assertFile(t *testing.T, path string, content string, perm os.FileMode) {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read '%s': %v", path, err)
+	}
+	if string(data) != content {
+		t.Errorf("expected content %q, got %q", content, data)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != perm {
+		t.Errorf("expected mode %o, got %o", perm, info.Mode().Perm())
+	}
+}
+
+func assertNoTemporaryFiles(t *testing.T, dir string) {
+	t.Helper()
+
+	matches, err := filepath.Glob(filepath.Join(dir, ".*.tmp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) > 0 {
+		t.Errorf("temporary files were left behind: %v", matches)
+	}
+}
@@ -1,11 +1,14 @@
 package logging
 
 import (
+	"bytes"
+	"encoding/json"
 	commonIo "forgetti-common/io"
 	"fmt"
 	"io"
 	"os"
-	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
@@ -15,40 +18,72 @@ type LogLevel int
 const (
 	LogLevelVerbose LogLevel = iota
 	LogLevelInfo
+	LogLevelWarning
 	LogLevelError
 )
 
+type LogFormat int
+
+const (
+	LogFormatText LogFormat = iota
+	LogFormatJson           // one JSON object per line
+)
+
+// Common field names, so that log processors see the same names everywhere
+const (
+	FieldComponent = "component"
+	FieldKeyId     = "key_id"
+	FieldClientIp  = "client_ip"
+	FieldRequestId = "request_id"
+	FieldLatency   = "latency"
+)
+
+// Fields are structured values attached to log entries
+type Fields map[string]any
+
 type Logger interface {
 	Verbose(message string, args ...any)
 	Info(message string, args ...any)
+	Warning(message string, args ...any)
 	Error(message string, args ...any)
+	// WithFields returns a logger that adds the fields to every entry, in addition to the fields of this logger
+	WithFields(fields Fields) Logger
 }
 
 type Config struct {
 	LogLevel LogLevel
-	LogFile  string // if empty, logs only to console
+	Format   LogFormat
+	LogFile  string    // if empty, logs only to console
+	Console  io.Writer // stdout if nil
+	Rotation RotationConfig
+	Privacy  Privacy
 }
 
 type MultiLogger struct {
 	LogLevel LogLevel
+	Format   LogFormat
 	Context  string // context information (filename/struct name)
+	Fields   Fields
+	Privacy  Privacy
 	writers  []io.Writer
-	mutex    sync.Mutex
+	mutex    *sync.Mutex
 }
 
 var (
 	globalConfig Config
 	configMutex  sync.RWMutex
-	logFile      *os.File
+	logFile      *rotatingFile
 )
 
 // SetGlobalConfig sets the global logging configuration
 func SetGlobalConfig(config Config) error {
-	pathFromBin, err := commonIo.GetRelativePathFromBin(config.LogFile)
-	if err != nil {
-		return fmt.Errorf("failed to get relative path from bin: %w", err)
+	if config.LogFile != "" {
+		pathFromBin, err := commonIo.GetRelativePathFromBin(config.LogFile)
+		if err != nil {
+			return fmt.Errorf("failed to get relative path from bin: %w", err)
+		}
+		config.LogFile = pathFromBin
 	}
-	config.LogFile = pathFromBin
 
 	configMutex.Lock()
 	defer configMutex.Unlock()
@@ -63,20 +98,39 @@ func SetGlobalConfig(config Config) error {
 
 	// Open new log file if specified
 	if config.LogFile != "" {
-		if err := os.MkdirAll(filepath.Dir(config.LogFile), 0755); err != nil {
-			return fmt.Errorf("failed to create directories: %w", err)
-		}
-
 		var err error
-		logFile, err = os.OpenFile(config.LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		logFile, err = openRotatingFile(config.LogFile, config.Rotation)
 		if err != nil {
-			return fmt.Errorf("failed to open log file %s: %w", config.LogFile, err)
+			return err
 		}
 	}
 
 	return nil
 }
 
+// Close flushes and closes the global log file, if any
+func Close() error {
+	configMutex.Lock()
+	defer configMutex.Unlock()
+
+	if logFile == nil {
+		return nil
+	}
+
+	syncErr := logFile.Sync()
+	closeErr := logFile.Close()
+	logFile = nil
+
+	if syncErr != nil {
+		return fmt.Errorf("failed to flush log file: %w", syncErr)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("failed to close log file: %w", closeErr)
+	}
+
+	return nil
+}
+
 // GetGlobalConfig returns a copy of the global logging configuration
 func GetGlobalConfig() Config {
 	configMutex.RLock()
@@ -89,16 +143,7 @@ func MakeLogger(context string) Logger {
 	configMutex.RLock()
 	defer configMutex.RUnlock()
 
-	writers := []io.Writer{os.Stdout}
-	if logFile != nil {
-		writers = append(writers, logFile)
-	}
-
-	return &MultiLogger{
-		LogLevel: globalConfig.LogLevel,
-		Context:  context,
-		writers:  writers,
-	}
+	return makeLogger(context, globalConfig.LogLevel)
 }
 
 // MakeLoggerWithLevel creates a new logger with the specified context and log level override
@@ -106,15 +151,47 @@ func MakeLoggerWithLevel(context string, level LogLevel) Logger {
 	configMutex.RLock()
 	defer configMutex.RUnlock()
 
-	writers := []io.Writer{os.Stdout}
+	return makeLogger(context, level)
+}
+
+func makeLogger(context string, level LogLevel) Logger {
+	console := globalConfig.Console
+	if console == nil {
+		console = os.Stdout
+	}
+
+	writers := []io.Writer{console}
 	if logFile != nil {
 		writers = append(writers, logFile)
 	}
 
 	return &MultiLogger{
 		LogLevel: level,
+		Format:   globalConfig.Format,
 		Context:  context,
+		Privacy:  globalConfig.Privacy,
 		writers:  writers,
+		mutex:    &sync.Mutex{},
+	}
+}
+
+func (l *MultiLogger) WithFields(fields Fields) Logger {
+	merged := make(Fields, len(l.Fields)+len(fields))
+	for name, value := range l.Fields {
+		merged[name] = value
+	}
+	for name, value := range fields {
+		merged[name] = value
+	}
+
+	return &MultiLogger{
+		LogLevel: l.LogLevel,
+		Format:   l.Format,
+		Context:  l.Context,
+		Fields:   merged,
+		Privacy:  l.Privacy,
+		writers:  l.writers,
+		mutex:    l.mutex,
 	}
 }
 
@@ -123,36 +200,102 @@ func (l *MultiLogger) log(level string, message string, args ...any) {
 		return
 	}
 
+	redactedArgs := make([]any, len(args))
+	for i, arg := range args {
+		redactedArgs[i] = l.Privacy.redact(arg)
+	}
+
+	fields := make(Fields, len(l.Fields))
+	for name, value := range l.Fields {
+		fields[name] = l.Privacy.redactField(name, value)
+	}
+
+	var logMessage []byte
+	if l.Format == LogFormatJson {
+		logMessage = formatJson(level, l.Context, fmt.Sprintf(message, redactedArgs...), fields)
+	} else {
+		logMessage = formatText(level, l.Context, fmt.Sprintf(message, redactedArgs...), fields)
+	}
+
 	l.mutex.Lock()
 	defer l.mutex.Unlock()
 
+	for _, writer := range l.writers {
+		writer.Write(logMessage)
+	}
+}
+
+func formatText(level string, context string, message string, fields Fields) []byte {
 	timestamp := time.Now().Format("2006-01-02 15:04:05")
 	contextStr := ""
-	if l.Context != "" {
-		contextStr = fmt.Sprintf("[%s] ", l.Context)
+	if context != "" {
+		contextStr = fmt.Sprintf("[%s] ", context)
 	}
 
-	logMessage := fmt.Sprintf("[%s] %s%s%s\n", timestamp, level, contextStr, fmt.Sprintf(message, args...))
+	fieldsStr := ""
+	for _, name := range sortedFieldNames(fields) {
+		fieldsStr += fmt.Sprintf(" %s=%v", name, fields[name])
+	}
 
-	for _, writer := range l.writers {
-		writer.Write([]byte(logMessage))
+	return []byte(fmt.Sprintf("[%s] %s %s%s%s\n", timestamp, level, contextStr, message, fieldsStr))
+}
+
+func formatJson(level string, context string, message string, fields Fields) []byte {
+	entry := make(map[string]any, len(fields)+4)
+	for name, value := range fields {
+		if duration, ok := value.(time.Duration); ok {
+			// Durations are logged in milliseconds, which log processors can aggregate
+			value = float64(duration.Microseconds()) / 1000
+		}
+		entry[name] = value
 	}
+	entry["time"] = time.Now().Format(time.RFC3339Nano)
+	entry["level"] = strings.ToLower(level)
+	entry["message"] = message
+	if context != "" {
+		entry[FieldComponent] = context
+	}
+
+	var line bytes.Buffer
+	encoder := json.NewEncoder(&line)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(entry); err != nil {
+		line.Reset()
+		encoder.Encode(map[string]any{"time": entry["time"], "level": entry["level"], "message": message, "error": err.Error()})
+	}
+
+	return line.Bytes()
+}
+
+func sortedFieldNames(fields Fields) []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
 func (l *MultiLogger) Verbose(message string, args ...any) {
 	if l.LogLevel <= LogLevelVerbose {
-		l.log("VERBOSE ", message, args...)
+		l.log("VERBOSE", message, args...)
 	}
 }
 
 func (l *MultiLogger) Info(message string, args ...any) {
 	if l.LogLevel <= LogLevelInfo {
-		l.log("INFO ", message, args...)
+		l.log("INFO", message, args...)
+	}
+}
+
+func (l *MultiLogger) Warning(message string, args ...any) {
+	if l.LogLevel <= LogLevelWarning {
+		l.log("WARNING", message, args...)
 	}
 }
 
 func (l *MultiLogger) Error(message string, args ...any) {
 	if l.LogLevel <= LogLevelError {
-		l.log("ERROR ", message, args...)
+		l.log("ERROR", message, args...)
 	}
 }
@@ -0,0 +1,200 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestLogger(format LogFormat, level LogLevel) (*MultiLogger, *bytes.Buffer) {
+	output := &bytes.Buffer{}
+	return &MultiLogger{
+		LogLevel: level,
+		Format:   format,
+		Context:  "test.Component",
+		writers:  []io.Writer{output},
+		mutex:    &sync.Mutex{},
+	}, output
+}
+
+func TestJsonFormat(t *testing.T) {
+	logger, output := newTestLogger(LogFormatJson, LogLevelVerbose)
+
+	logger.WithFields(Fields{FieldRequestId: "abc", FieldLatency: 1500 * time.Microsecond}).
+		WithFields(Fields{FieldKeyId: "key"}).
+		Warning("Something %s -> <%s>", "happened", "here")
+
+	var entry map[string]any
+	if err := json.Unmarshal(output.Bytes(), &entry); err != nil {
+		t.Fatalf("Output is not JSON: %v (%s)", err, output.String())
+	}
+	if !strings.Contains(output.String(), "-> <here>") {
+		t.Errorf("Output = %s, want message without HTML escaping", output.String())
+	}
+
+	expected := map[string]any{
+		"level":        "warning",
+		"message":      "Something happened -> <here>",
+		FieldComponent: "test.Component",
+		FieldRequestId: "abc",
+		FieldKeyId:     "key",
+		FieldLatency:   1.5,
+	}
+	for name, value := range expected {
+		if entry[name] != value {
+			t.Errorf("Field %s = %v, want %v", name, entry[name], value)
+		}
+	}
+	if _, err := time.Parse(time.RFC3339Nano, entry["time"].(string)); err != nil {
+		t.Errorf("Field time = %v, want RFC 3339 timestamp", entry["time"])
+	}
+}
+
+func TestTextFormat(t *testing.T) {
+	logger, output := newTestLogger(LogFormatText, LogLevelVerbose)
+
+	logger.WithFields(Fields{"b": 2, "a": 1}).Info("Message")
+
+	line := output.String()
+	if !strings.HasSuffix(line, " INFO [test.Component] Message a=1 b=2\n") {
+		t.Errorf("Output = %q", line)
+	}
+}
+
+func TestLogLevels(t *testing.T) {
+	logger, output := newTestLogger(LogFormatText, LogLevelWarning)
+
+	logger.Verbose("verbose")
+	logger.Info("info")
+	logger.Warning("warning")
+	logger.Error("error")
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], "WARNING") || !strings.Contains(lines[1], "ERROR") {
+		t.Errorf("Output = %q, want only the warning and the error", output.String())
+	}
+}
+
+func TestConsoleWriter(t *testing.T) {
+	output := &bytes.Buffer{}
+	SetGlobalConfig(Config{LogLevel: LogLevelInfo, Console: output})
+	defer SetGlobalConfig(Config{})
+
+	MakeLogger("test.Component").Info("to the console")
+
+	if !strings.HasSuffix(output.String(), " INFO [test.Component] to the console\n") {
+		t.Errorf("Console output = %q", output.String())
+	}
+}
+
+func TestRotatingFileRotatesBySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.log")
+	file, err := openRotatingFile(path, RotationConfig{MaxSizeBytes: 10, MaxBackups: 2})
+	if err != nil {
+		t.Fatalf("openRotatingFile() error = %v", err)
+	}
+	defer file.Close()
+
+	current := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	file.now = func() time.Time {
+		current = current.Add(time.Second)
+		return current
+	}
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := file.Write([]byte(line)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	backups, err := file.backups()
+	if err != nil {
+		t.Fatalf("backups() error = %v", err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("backups() = %v, want 2 backups", backups)
+	}
+
+	expectContent(t, backups[0], "second\n")
+	expectContent(t, backups[1], "third\n")
+	expectContent(t, path, "fourth\n")
+}
+
+func TestRotatingFileRotatesByAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.log")
+	file, err := openRotatingFile(path, RotationConfig{MaxAge: time.Hour})
+	if err != nil {
+		t.Fatalf("openRotatingFile() error = %v", err)
+	}
+	defer file.Close()
+
+	current := time.Now()
+	file.now = func() time.Time { return current }
+	file.startedAt = current
+
+	file.Write([]byte("old\n"))
+	current = current.Add(30 * time.Minute)
+	file.Write([]byte("still old\n"))
+	current = current.Add(time.Hour)
+	file.Write([]byte("new\n"))
+
+	backups, _ := file.backups()
+	if len(backups) != 1 {
+		t.Fatalf("backups() = %v, want 1 backup", backups)
+	}
+	expectContent(t, backups[0], "old\nstill old\n")
+	expectContent(t, path, "new\n")
+}
+
+func TestRotatingFileRecoversFromFailedReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.log")
+	file, err := openRotatingFile(path, RotationConfig{MaxSizeBytes: 10})
+	if err != nil {
+		t.Fatalf("openRotatingFile() error = %v", err)
+	}
+	defer file.Close()
+
+	fallback := &bytes.Buffer{}
+	file.fallback = fallback
+	file.Write([]byte("first\n"))
+
+	openFile := file.openFile
+	file.openFile = func(name string, flag int, perm os.FileMode) (*os.File, error) {
+		return nil, os.ErrPermission
+	}
+	if _, err := file.Write([]byte("lost file\n")); err != nil {
+		t.Fatalf("Write() error = %v, want the entry written to the fallback", err)
+	}
+	if fallback.String() != "lost file\n" {
+		t.Errorf("Fallback = %q, want the entry written while the file could not be reopened", fallback.String())
+	}
+
+	file.openFile = openFile
+	if _, err := file.Write([]byte("reopened\n")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	expectContent(t, path, "reopened\n")
+
+	file.Close()
+	if _, err := file.Write([]byte("closed\n")); err != os.ErrClosed {
+		t.Errorf("Write() after Close() error = %v, want %v", err, os.ErrClosed)
+	}
+}
+
+func expectContent(t *testing.T, path string, want string) {
+	t.Helper()
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", path, err)
+	}
+	if string(content) != want {
+		t.Errorf("Content of %s = %q, want %q", filepath.Base(path), content, want)
+	}
+}
@@ -0,0 +1,177 @@
+package logging
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+type KeyIdPolicy int
+
+const (
+	KeyIdsPlain  KeyIdPolicy = iota
+	KeyIdsHashed             // replaced by a keyed hash, so entries about one key can still be correlated
+	KeyIdsDropped
+)
+
+type ClientIpPolicy int
+
+const (
+	ClientIpsPlain     ClientIpPolicy = iota
+	ClientIpsTruncated                // IPv4 addresses are truncated to /24, IPv6 addresses to /48
+	ClientIpsDropped
+)
+
+const (
+	droppedValue  = "[dropped]"
+	redactedValue = "[REDACTED]"
+)
+
+// Privacy decides how personal data is logged. The zero value logs it unchanged.
+type Privacy struct {
+	KeyIds       KeyIdPolicy
+	ClientIps    ClientIpPolicy
+	keyIdHashKey []byte
+}
+
+// NewPrivacy creates a privacy policy. Key ids are hashed with hashSecret, or with a random secret if it is empty,
+// in which case hashes can only be correlated within one run.
+func NewPrivacy(keyIds KeyIdPolicy, clientIps ClientIpPolicy, hashSecret string) (Privacy, error) {
+	hashKey := []byte(hashSecret)
+	if hashSecret == "" {
+		hashKey = make([]byte, 32)
+		if _, err := rand.Read(hashKey); err != nil {
+			return Privacy{}, fmt.Errorf("failed to generate key id hash secret: %w", err)
+		}
+	}
+
+	return Privacy{KeyIds: keyIds, ClientIps: clientIps, keyIdHashKey: hashKey}, nil
+}
+
+// KeyId returns the key id as it may be logged
+func (p Privacy) KeyId(keyId string) string {
+	switch p.KeyIds {
+	case KeyIdsHashed:
+		mac := hmac.New(sha256.New, p.keyIdHashKey)
+		mac.Write([]byte(keyId))
+		return "h:" + hex.EncodeToString(mac.Sum(nil))[:16]
+	case KeyIdsDropped:
+		return droppedValue
+	default:
+		return keyId
+	}
+}
+
+// ClientIp returns the client address as it may be logged
+func (p Privacy) ClientIp(clientIp string) string {
+	switch p.ClientIps {
+	case ClientIpsTruncated:
+		ip := net.ParseIP(clientIp)
+		if ip == nil {
+			return droppedValue
+		}
+		if ipv4 := ip.To4(); ipv4 != nil {
+			return ipv4.Mask(net.CIDRMask(24, 32)).String()
+		}
+		return ip.Mask(net.CIDRMask(48, 128)).String()
+	case ClientIpsDropped:
+		return droppedValue
+	default:
+		return clientIp
+	}
+}
+
+// KeyId marks a log argument as a key id, which is logged according to the key id policy
+type KeyId string
+
+// ClientIp marks a log argument as a client address, which is logged according to the client address policy
+type ClientIp string
+
+// Redactor is implemented by values that must never be logged, and replaces them in log entries
+type Redactor interface {
+	Redacted() string
+}
+
+// KeyIdCarrier is implemented by errors that mention key ids in their message, so that the ids are logged according
+// to the key id policy
+type KeyIdCarrier interface {
+	LoggedKeyIds() []string
+}
+
+// Secret holds a value that must not be logged. It is redacted even when formatted outside of a logger.
+type Secret string
+
+func (s Secret) Redacted() string {
+	return redactedValue
+}
+
+func (s Secret) String() string {
+	return redactedValue
+}
+
+func (s Secret) Format(f fmt.State, verb rune) {
+	f.Write([]byte(redactedValue))
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + redactedValue + `"`), nil
+}
+
+// Reveal returns the secret value, for use outside of logging
+func (s Secret) Reveal() string {
+	return string(s)
+}
+
+// redact returns the value as it may be logged
+func (p Privacy) redact(value any) any {
+	switch v := value.(type) {
+	case KeyId:
+		return p.KeyId(string(v))
+	case ClientIp:
+		return p.ClientIp(string(v))
+	case Redactor:
+		return v.Redacted()
+	case error:
+		return p.redactError(v)
+	default:
+		return value
+	}
+}
+
+func (p Privacy) redactError(err error) string {
+	message := err.Error()
+	if p.KeyIds == KeyIdsPlain {
+		return message
+	}
+
+	for current := err; current != nil; current = errors.Unwrap(current) {
+		carrier, ok := current.(KeyIdCarrier)
+		if !ok {
+			continue
+		}
+		for _, keyId := range carrier.LoggedKeyIds() {
+			if keyId != "" {
+				message = strings.ReplaceAll(message, keyId, p.KeyId(keyId))
+			}
+		}
+	}
+
+	return message
+}
+
+// redactField returns the field value as it may be logged, applying the policies of well-known fields
+func (p Privacy) redactField(name string, value any) any {
+	switch name {
+	case FieldKeyId:
+		return p.KeyId(fmt.Sprint(value))
+	case FieldClientIp:
+		return p.ClientIp(fmt.Sprint(value))
+	default:
+		return p.redact(value)
+	}
+}
@@ -0,0 +1,134 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const testKeyId = "0d3c1f0e-8a51-4a6e-9d7a-3f6b2b1c9e42"
+
+type keyNotFoundError struct {
+	keyId string
+}
+
+func (e *keyNotFoundError) Error() string {
+	return "key not found: " + e.keyId
+}
+
+func (e *keyNotFoundError) LoggedKeyIds() []string {
+	return []string{e.keyId}
+}
+
+type privateKey struct {
+	secret string
+}
+
+func (k *privateKey) Redacted() string {
+	return "[private key]"
+}
+
+func logWithPrivacy(t *testing.T, privacy Privacy, format LogFormat, log func(logger Logger)) string {
+	t.Helper()
+
+	logger, output := newTestLogger(format, LogLevelVerbose)
+	logger.Privacy = privacy
+	log(logger)
+	return output.String()
+}
+
+func TestKeyIdPolicies(t *testing.T) {
+	hashed, err := NewPrivacy(KeyIdsHashed, ClientIpsPlain, "secret")
+	if err != nil {
+		t.Fatalf("NewPrivacy() error = %v", err)
+	}
+	otherSecret, _ := NewPrivacy(KeyIdsHashed, ClientIpsPlain, "other secret")
+	dropped, _ := NewPrivacy(KeyIdsDropped, ClientIpsPlain, "")
+
+	hash := hashed.KeyId(testKeyId)
+	if !strings.HasPrefix(hash, "h:") || hash != hashed.KeyId(testKeyId) {
+		t.Errorf("KeyId() = %s, want stable keyed hash", hash)
+	}
+	if hash == otherSecret.KeyId(testKeyId) {
+		t.Error("KeyId() hashes do not depend on the secret")
+	}
+
+	for name, privacy := range map[string]Privacy{"hashed": hashed, "dropped": dropped} {
+		for _, format := range []LogFormat{LogFormatText, LogFormatJson} {
+			output := logWithPrivacy(t, privacy, format, func(logger Logger) {
+				logger.WithFields(Fields{FieldKeyId: testKeyId}).Info("Created key %s", KeyId(testKeyId))
+				logger.Error("Failed: %v", fmt.Errorf("failed to get key: %w", &keyNotFoundError{keyId: testKeyId}))
+			})
+
+			if strings.Contains(output, testKeyId) {
+				t.Errorf("%s policy logged the key id: %s", name, output)
+			}
+			if !strings.Contains(output, privacy.KeyId(testKeyId)) {
+				t.Errorf("%s policy output = %s, want %s", name, output, privacy.KeyId(testKeyId))
+			}
+		}
+	}
+
+	output := logWithPrivacy(t, Privacy{}, LogFormatText, func(logger Logger) {
+		logger.Info("Created key %s", KeyId(testKeyId))
+	})
+	if !strings.Contains(output, testKeyId) {
+		t.Errorf("Plain policy output = %s, want the key id", output)
+	}
+}
+
+func TestClientIpPolicies(t *testing.T) {
+	tests := []struct {
+		policy ClientIpPolicy
+		ip     string
+		want   string
+	}{
+		{ClientIpsPlain, "192.168.10.77", "192.168.10.77"},
+		{ClientIpsTruncated, "192.168.10.77", "192.168.10.0"},
+		{ClientIpsTruncated, "2001:db8:1234:5678::1", "2001:db8:1234::"},
+		{ClientIpsTruncated, "not an ip", droppedValue},
+		{ClientIpsDropped, "192.168.10.77", droppedValue},
+	}
+	for _, tt := range tests {
+		privacy := Privacy{ClientIps: tt.policy}
+		if got := privacy.ClientIp(tt.ip); got != tt.want {
+			t.Errorf("ClientIp(%s) with policy %d = %s, want %s", tt.ip, tt.policy, got, tt.want)
+		}
+
+		output := logWithPrivacy(t, privacy, LogFormatJson, func(logger Logger) {
+			logger.WithFields(Fields{FieldClientIp: tt.ip}).Info("Request from %s", ClientIp(tt.ip))
+		})
+		if tt.ip != tt.want && strings.Contains(output, tt.ip) {
+			t.Errorf("Policy %d logged the address: %s", tt.policy, output)
+		}
+	}
+}
+
+func TestSecretsAreNeverLogged(t *testing.T) {
+	const secret = "hunter2"
+
+	for _, format := range []LogFormat{LogFormatText, LogFormatJson} {
+		output := logWithPrivacy(t, Privacy{}, format, func(logger Logger) {
+			logger.WithFields(Fields{"password": Secret(secret), "key": &privateKey{secret: secret}}).
+				Info("%s %v %+v %#v %q %x", Secret(secret), Secret(secret), Secret(secret), Secret(secret), Secret(secret), Secret(secret))
+			logger.Info("Key: %v", &privateKey{secret: secret})
+		})
+
+		if strings.Contains(output, secret) || strings.Contains(output, fmt.Sprintf("%x", secret)) {
+			t.Errorf("Secret was logged: %s", output)
+		}
+		if !strings.Contains(output, "[private key]") {
+			t.Errorf("Output = %s, want redactor replacement", output)
+		}
+	}
+
+	formatted := fmt.Sprintf("%v %s", Secret(secret), Secret(secret))
+	marshaled, _ := json.Marshal(struct{ Password Secret }{Secret(secret)})
+	if strings.Contains(formatted, secret) || strings.Contains(string(marshaled), secret) {
+		t.Errorf("Secret revealed outside of logger: %s %s", formatted, marshaled)
+	}
+	if Secret(secret).Reveal() != secret {
+		t.Error("Reveal() does not return the secret")
+	}
+}
@@ -0,0 +1,203 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// RotationConfig controls when the log file is rotated. Zero values disable the corresponding limit.
+type RotationConfig struct {
+	MaxSizeBytes int64         // rotate before the file grows beyond this size
+	MaxAge       time.Duration // rotate when the file was started longer ago than this
+	MaxBackups   int           // number of rotated files to keep, older ones are deleted
+}
+
+// rotatingFile is a log file that is renamed to <name>.<timestamp><ext> and replaced by a new one when it
+// reaches its size or age limit
+type rotatingFile struct {
+	path      string
+	config    RotationConfig
+	mutex     sync.Mutex
+	file      *os.File
+	size      int64
+	startedAt time.Time
+	closed    bool
+	now       func() time.Time
+	openFile  func(name string, flag int, perm os.FileMode) (*os.File, error)
+	fallback  io.Writer // receives the entries while the file cannot be reopened after a rotation
+}
+
+func openRotatingFile(path string, config RotationConfig) (*rotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directories: %w", err)
+	}
+
+	r := &rotatingFile{path: path, config: config, now: time.Now, openFile: os.OpenFile, fallback: os.Stderr}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.closed {
+		return 0, os.ErrClosed
+	}
+
+	if r.file != nil && r.shouldRotate(int64(len(p))) {
+		if err := r.rotate(); err != nil {
+			// Keep logging to the current file rather than losing entries
+			fmt.Fprintf(os.Stderr, "failed to rotate log file: %v\n", err)
+		}
+	}
+
+	if r.file == nil {
+		// The file could not be reopened after a rotation, so retry on every write until it can
+		if err := r.open(); err != nil {
+			return r.fallback.Write(p)
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotatingFile) Sync() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.file == nil {
+		return nil
+	}
+	return r.file.Sync()
+}
+
+func (r *rotatingFile) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.closed = true
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+func (r *rotatingFile) shouldRotate(writeSize int64) bool {
+	if r.size == 0 {
+		return false
+	}
+	if r.config.MaxSizeBytes > 0 && r.size+writeSize > r.config.MaxSizeBytes {
+		return true
+	}
+	return r.config.MaxAge > 0 && r.now().Sub(r.startedAt) >= r.config.MaxAge
+}
+
+func (r *rotatingFile) open() error {
+	file, err := r.openFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file %s: %w", r.path, err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat log file %s: %w", r.path, err)
+	}
+
+	r.file = file
+	r.size = info.Size()
+	// The age of an existing file is unknown, so it counts from when logging to it resumed
+	r.startedAt = r.now()
+	return nil
+}
+
+// rotate replaces the file by a new one. The file is nil afterwards if the new one could not be opened.
+func (r *rotatingFile) rotate() error {
+	err := r.file.Close()
+	r.file = nil
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(r.path, r.backupPath(r.now())); err != nil {
+		// Reopen the current file, so that logging continues
+		if openErr := r.open(); openErr != nil {
+			return openErr
+		}
+		return err
+	}
+
+	if err := r.open(); err != nil {
+		return err
+	}
+
+	return r.removeOldBackups()
+}
+
+func (r *rotatingFile) backupPath(t time.Time) string {
+	ext := filepath.Ext(r.path)
+	return fmt.Sprintf("%s.%s%s", strings.TrimSuffix(r.path, ext), t.Format(backupTimeFormat), ext)
+}
+
+// backups returns the rotated files, oldest first
+func (r *rotatingFile) backups() ([]string, error) {
+	ext := filepath.Ext(r.path)
+	prefix := filepath.Base(strings.TrimSuffix(r.path, ext)) + "."
+
+	entries, err := os.ReadDir(filepath.Dir(r.path))
+	if err != nil {
+		return nil, err
+	}
+
+	backups := []string{}
+	for _, entry := range entries {
+		name := entry.Name()
+		timestamp, ok := strings.CutPrefix(name, prefix)
+		if !ok || entry.IsDir() || !strings.HasSuffix(timestamp, ext) {
+			continue
+		}
+		if _, err := time.Parse(backupTimeFormat, strings.TrimSuffix(timestamp, ext)); err != nil {
+			continue
+		}
+		backups = append(backups, filepath.Join(filepath.Dir(r.path), name))
+	}
+
+	// The timestamp format sorts chronologically
+	sort.Strings(backups)
+	return backups, nil
+}
+
+func (r *rotatingFile) removeOldBackups() error {
+	if r.config.MaxBackups <= 0 {
+		return nil
+	}
+
+	backups, err := r.backups()
+	if err != nil {
+		return err
+	}
+
+	for len(backups) > r.config.MaxBackups {
+		if err := os.Remove(backups[0]); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+
+	return nil
+}
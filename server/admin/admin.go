@@ -0,0 +1,77 @@
+package admin
+
+import (
+	"ForgettiServer/config"
+	"ForgettiServer/services"
+	"fmt"
+	"forgetti-common/logging"
+	"strings"
+)
+
+type command struct {
+	name        string
+	usage       string
+	description string
+	run         func(args []string, container *services.ServiceContainer) error
+	// runWithConfig is used instead of run by commands that must not set up services, which migrates the database
+	runWithConfig func(args []string, cfg *config.Config) error
+}
+
+var commands = []command{
+	tokenCommand,
+	migrateCommand,
+	dataProtectionCommand,
+	auditCommand,
+}
+
+// IsAdminCommand reports whether the arguments select an admin command instead of running the server. Any leading
+// non-flag argument does, so that Run reports a mistyped command instead of the server starting. Flags, such as those
+// of a test binary, are left to the server.
+func IsAdminCommand(args []string) bool {
+	return len(args) > 0 && !strings.HasPrefix(args[0], "-")
+}
+
+func Run(args []string, cfg *config.Config) error {
+	logger := logging.MakeLogger("admin.Run")
+
+	cmd := findCommand(args[0])
+	if cmd == nil {
+		return fmt.Errorf("unknown command '%s'\n\n%s", args[0], Usage())
+	}
+
+	if cfg.KeyStore.Backend == "memory" {
+		return fmt.Errorf("the memory key store keeps no database, there is nothing for '%s' to manage", cmd.name)
+	}
+
+	if cmd.runWithConfig != nil {
+		return cmd.runWithConfig(args[1:], cfg)
+	}
+
+	logger.Verbose("Creating service container for admin command '%s'", cmd.name)
+	container, err := services.CreateServiceContainer(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create service container: %w", err)
+	}
+	defer container.DatabaseService.Close()
+
+	return cmd.run(args[1:], container)
+}
+
+func Usage() string {
+	lines := []string{"Usage: forgetti-server [command]", "", "Without a command, the server is started.", "", "Commands:"}
+	for _, cmd := range commands {
+		lines = append(lines, fmt.Sprintf("  %-50s %s", cmd.usage, cmd.description))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func findCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package admin
+
+import (
+	"ForgettiServer/db/dbtest"
+	"strings"
+	"testing"
+)
+
+func TestIsAdminCommand(t *testing.T) {
+	tests := []struct {
+		args []string
+		want bool
+	}{
+		{nil, false},
+		{[]string{"token", "list"}, true},
+		{[]string{"migrate", "status"}, true},
+		{[]string{"data-protection", "reprotect"}, true},
+		{[]string{"audit"}, true},
+		{[]string{"-test.run=TestServe"}, false},
+		{[]string{"--config", "config.json"}, false},
+		{[]string{"unknown"}, true},
+		{[]string{"tokn", "create"}, true},
+	}
+
+	for _, test := range tests {
+		if got := IsAdminCommand(test.args); got != test.want {
+			t.Errorf("IsAdminCommand(%v) = %v, want %v", test.args, got, test.want)
+		}
+	}
+}
+
+func TestRunRejectsUnknownCommand(t *testing.T) {
+	err := Run([]string{"tokn", "create"}, nil)
+	if err == nil || !strings.Contains(err.Error(), "unknown command 'tokn'") {
+		t.Errorf("Run() error = %v, want unknown command", err)
+	}
+}
+
+func TestRunRejectsMemoryKeyStore(t *testing.T) {
+	cfg := dbtest.NewConfig()
+	cfg.KeyStore.Backend = "memory"
+
+	for _, args := range [][]string{{"token", "list"}, {"migrate", "status"}, {"audit", "verify"}} {
+		if err := Run(args, cfg); err == nil || !strings.Contains(err.Error(), "memory key store") {
+			t.Errorf("Run(%v) error = %v, want the memory key store to be rejected", args, err)
+		}
+	}
+}
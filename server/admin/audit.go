@@ -0,0 +1,35 @@
+package admin
+
+import (
+	"ForgettiServer/services"
+	"fmt"
+)
+
+const auditUsage = "audit verify"
+
+var auditCommand = command{
+	name:        "audit",
+	usage:       auditUsage,
+	description: "Check that the audit log was not tampered with",
+	run:         runAudit,
+}
+
+func runAudit(args []string, container *services.ServiceContainer) error {
+	if len(args) != 1 || args[0] != "verify" {
+		return fmt.Errorf("expected one audit subcommand, usage: forgetti-server %s", auditUsage)
+	}
+
+	result, err := container.AuditLog.Verify()
+	if err != nil {
+		return err
+	}
+
+	if result.Entries == 0 {
+		fmt.Println("The audit log is empty")
+		return nil
+	}
+
+	fmt.Printf("The audit log is intact: %d entries, sequence %d to %d\n", result.Entries, result.FirstSequence, result.LastSequence)
+	fmt.Printf("Last entry hash: %s\n", result.LastHash)
+	return nil
+}
@@ -0,0 +1,64 @@
+package admin
+
+import (
+	"ForgettiServer/services"
+	"fmt"
+)
+
+const dataProtectionUsage = "data-protection status | reprotect"
+
+var dataProtectionCommand = command{
+	name:        "data-protection",
+	usage:       dataProtectionUsage,
+	description: "Re-protect stored keys with the active data protection key",
+	run:         runDataProtection,
+}
+
+func runDataProtection(args []string, container *services.ServiceContainer) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected one data-protection subcommand, usage: forgetti-server %s", dataProtectionUsage)
+	}
+
+	switch args[0] {
+	case "status":
+		return dataProtectionStatus(container)
+	case "reprotect":
+		return reprotect(container)
+	default:
+		return fmt.Errorf("unknown data-protection subcommand '%s', usage: forgetti-server %s", args[0], dataProtectionUsage)
+	}
+}
+
+func dataProtectionStatus(container *services.ServiceContainer) error {
+	status, err := container.Reprotector.Status()
+	if err != nil {
+		return err
+	}
+
+	if provider := container.Config.DataProtection.Envelope.Provider; provider != "" {
+		fmt.Printf("Active key: envelope encryption (%s provider)\n", provider)
+	} else {
+		_, activeKeyId := container.Config.DataProtectionKeys()
+		fmt.Printf("Active key: %s\n", activeKeyId)
+	}
+	fmt.Printf("Keys protected with other keys: %d\n", status.Outdated)
+	if status.Outdated == 0 {
+		fmt.Println("Retired keys can be removed from the keyring")
+	}
+	return nil
+}
+
+func reprotect(container *services.ServiceContainer) error {
+	result, err := container.Reprotector.ReprotectAll()
+	if result != nil {
+		fmt.Printf("Re-protected %d keys\n", result.Reprotected)
+	}
+	if err != nil {
+		return err
+	}
+
+	if result.Failed > 0 {
+		return fmt.Errorf("failed to re-protect %d keys - their key is probably missing from the keyring", result.Failed)
+	}
+	return nil
+}
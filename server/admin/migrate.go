@@ -0,0 +1,99 @@
+package admin
+
+import (
+	"ForgettiServer/config"
+	"ForgettiServer/db"
+	"ForgettiServer/db/migrations"
+	"fmt"
+	"time"
+)
+
+const migrateUsage = "migrate up | down | status"
+
+var migrateCommand = command{
+	name:          "migrate",
+	usage:         migrateUsage,
+	description:   "Apply, roll back or list database schema migrations",
+	runWithConfig: runMigrate,
+}
+
+func runMigrate(args []string, cfg *config.Config) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected one migrate subcommand, usage: forgetti-server %s", migrateUsage)
+	}
+
+	database, err := db.OpenDb(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.NewDatabaseService(database).Close()
+
+	migrator := migrations.NewMigrator(database)
+	switch args[0] {
+	case "up":
+		return migrateUp(migrator)
+	case "down":
+		return migrateDown(migrator)
+	case "status":
+		return migrationStatus(migrator)
+	default:
+		return fmt.Errorf("unknown migrate subcommand '%s', usage: forgetti-server %s", args[0], migrateUsage)
+	}
+}
+
+func migrateUp(migrator *migrations.Migrator) error {
+	applied, err := migrator.Up()
+	for _, migration := range applied {
+		fmt.Printf("Applied %s\n", migration.String())
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(applied) == 0 {
+		fmt.Printf("Schema is up to date (version %d)\n", migrator.LatestVersion())
+	}
+	return nil
+}
+
+func migrateDown(migrator *migrations.Migrator) error {
+	migration, err := migrator.Down()
+	if err != nil {
+		return err
+	}
+
+	if migration == nil {
+		fmt.Println("No migrations to roll back")
+	} else {
+		fmt.Printf("Rolled back %s\n", migration.String())
+	}
+	return nil
+}
+
+func migrationStatus(migrator *migrations.Migrator) error {
+	version, err := migrator.CurrentVersion()
+	if err != nil {
+		return err
+	}
+
+	statuses, err := migrator.Status()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Schema version: %d (latest known: %d)\n", version, migrator.LatestVersion())
+	if version > migrator.LatestVersion() {
+		fmt.Println("The database was migrated by a newer server - this server will refuse to start")
+	}
+
+	fmt.Printf("\n%-30s  %s\n", "MIGRATION", "APPLIED")
+	for _, status := range statuses {
+		applied := "pending"
+		if status.AppliedAt != nil {
+			applied = status.AppliedAt.Format(time.DateTime)
+		}
+		fmt.Printf("%-30s  %s\n", status.Migration.String(), applied)
+	}
+
+	return nil
+}
@@ -0,0 +1,169 @@
+package admin
+
+import (
+	"ForgettiServer/models"
+	"ForgettiServer/services"
+	"flag"
+	"fmt"
+	"time"
+)
+
+const tokenUsage = "token create --name <name> [quota flags] | list | set-quota <id> [quota flags] | revoke <id>"
+
+var tokenCommand = command{
+	name:        "token",
+	usage:       tokenUsage,
+	description: "Manage API tokens used to create keys",
+	run:         runToken,
+}
+
+func runToken(args []string, container *services.ServiceContainer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing token subcommand, usage: forgetti-server %s", tokenUsage)
+	}
+
+	switch args[0] {
+	case "create":
+		return createToken(args[1:], container)
+	case "list":
+		return listTokens(container)
+	case "set-quota":
+		return setTokenQuota(args[1:], container)
+	case "revoke":
+		return revokeToken(args[1:], container)
+	default:
+		return fmt.Errorf("unknown token subcommand '%s', usage: forgetti-server %s", args[0], tokenUsage)
+	}
+}
+
+type quotaFlags struct {
+	maxLiveKeys        *int
+	maxExpirationHours *int
+	dailyKeyCap        *int
+}
+
+func addQuotaFlags(flags *flag.FlagSet) quotaFlags {
+	return quotaFlags{
+		maxLiveKeys:        flags.Int("max-keys", 0, "Maximum number of live keys (0 = unlimited)"),
+		maxExpirationHours: flags.Int("max-expiration-hours", 0, "Maximum key expiration in hours (0 = server default)"),
+		dailyKeyCap:        flags.Int("daily-cap", 0, "Maximum number of keys created per day (0 = unlimited)"),
+	}
+}
+
+func (q quotaFlags) toQuota() (models.TokenQuota, error) {
+	if *q.maxLiveKeys < 0 || *q.maxExpirationHours < 0 || *q.dailyKeyCap < 0 {
+		return models.TokenQuota{}, fmt.Errorf("quota values cannot be negative")
+	}
+
+	return models.TokenQuota{
+		MaxLiveKeys:   *q.maxLiveKeys,
+		MaxExpiration: time.Duration(*q.maxExpirationHours) * time.Hour,
+		DailyKeyCap:   *q.dailyKeyCap,
+	}, nil
+}
+
+func createToken(args []string, container *services.ServiceContainer) error {
+	flags := flag.NewFlagSet("token create", flag.ContinueOnError)
+	name := flags.String("name", "", "A name identifying the token holder")
+	quotaFlags := addQuotaFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *name == "" {
+		return fmt.Errorf("token name is required (--name)")
+	}
+
+	quota, err := quotaFlags.toQuota()
+	if err != nil {
+		return err
+	}
+
+	token, apiToken, err := container.TokenService.CreateToken(*name, quota)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Created token '%s' (id: %s)\n", apiToken.Name, apiToken.Id)
+	fmt.Printf("Token: %s\n", token)
+	fmt.Println("Store it now - it cannot be shown again.")
+	return nil
+}
+
+func listTokens(container *services.ServiceContainer) error {
+	tokens, err := container.TokenService.ListTokens()
+	if err != nil {
+		return err
+	}
+
+	if len(tokens) == 0 {
+		fmt.Println("No tokens")
+		return nil
+	}
+
+	fmt.Printf("%-36s  %-20s  %-10s  %-14s  %-10s  %s\n", "ID", "CREATED", "MAX KEYS", "MAX EXPIRATION", "DAILY CAP", "NAME")
+	for _, token := range tokens {
+		fmt.Printf("%-36s  %-20s  %-10s  %-14s  %-10s  %s\n",
+			token.Id,
+			token.CreatedAt.Format(time.DateTime),
+			formatLimit(token.Quota.MaxLiveKeys, "unlimited"),
+			formatMaxExpiration(token.Quota.MaxExpiration),
+			formatLimit(token.Quota.DailyKeyCap, "unlimited"),
+			token.Name)
+	}
+
+	return nil
+}
+
+func setTokenQuota(args []string, container *services.ServiceContainer) error {
+	if len(args) < 1 {
+		return fmt.Errorf("expected a token id, usage: forgetti-server %s", tokenUsage)
+	}
+
+	flags := flag.NewFlagSet("token set-quota", flag.ContinueOnError)
+	quotaFlags := addQuotaFlags(flags)
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	quota, err := quotaFlags.toQuota()
+	if err != nil {
+		return err
+	}
+
+	if err := container.TokenService.SetQuota(args[0], quota); err != nil {
+		return err
+	}
+
+	fmt.Printf("Updated quota of token %s\n", args[0])
+	return nil
+}
+
+func revokeToken(args []string, container *services.ServiceContainer) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected exactly one token id to revoke")
+	}
+
+	if err := container.TokenService.RevokeToken(args[0]); err != nil {
+		return err
+	}
+
+	fmt.Printf("Revoked token %s\n", args[0])
+	return nil
+}
+
+func formatLimit(value int, unlimited string) string {
+	if value == 0 {
+		return unlimited
+	}
+
+	return fmt.Sprint(value)
+}
+
+func formatMaxExpiration(maxExpiration time.Duration) string {
+	if maxExpiration == 0 {
+		return "default"
+	}
+
+	return fmt.Sprintf("%dh", int(maxExpiration.Hours()))
+}
@@ -3,6 +3,8 @@ package config
 import (
 	"fmt"
 	"forgetti-common/io"
+	"strings"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/ilyakaznacheev/cleanenv"
@@ -13,39 +15,207 @@ type Config struct {
 		Host string `json:"host" env:"SERVER_HOST" env-default:"localhost" validate:"required"`
 		Port int    `json:"port" env:"SERVER_PORT" env-default:"8080" validate:"min=1,max=65535"`
 		Mode string `json:"mode" env:"GIN_MODE" env-default:"release" validate:"oneof=debug release test"`
+
+		ShutdownTimeoutSeconds int `json:"shutdown_timeout_seconds" env:"SERVER_SHUTDOWN_TIMEOUT" env-default:"30" validate:"min=1,max=300"`
 	} `json:"server"`
 
 	KeyStore struct {
-		RecentlyExpiredDurationHours int `json:"recently_expired_duration" env:"KEYSTORE_RECENTLY_EXPIRED_DURATION" env-default:"24" validate:"min=1,max=168"`
+		Backend                      string `json:"backend" env:"KEYSTORE_BACKEND" env-default:"database" validate:"oneof=database memory"`
+		RecentlyExpiredDurationHours int    `json:"recently_expired_duration" env:"KEYSTORE_RECENTLY_EXPIRED_DURATION" env-default:"24" validate:"min=1,max=168"`
+		CleanupIntervalMinutes       int    `json:"cleanup_interval_minutes" env:"KEYSTORE_CLEANUP_INTERVAL" env-default:"60" validate:"min=1,max=1440"`
 	} `json:"keystore"`
 
+	KeyPolicy struct {
+		MinExpirationMinutes int      `json:"min_expiration_minutes" env:"KEY_POLICY_MIN_EXPIRATION_MINUTES" env-default:"1" validate:"min=1"`
+		MaxExpirationHours   int      `json:"max_expiration_hours" env:"KEY_POLICY_MAX_EXPIRATION_HOURS" env-default:"720" validate:"min=1"`
+		SupportedAlgVersions []string `json:"supported_alg_versions" env:"KEY_POLICY_SUPPORTED_ALG_VERSIONS" env-default:"1:1:1:1" validate:"min=1"`
+	} `json:"key_policy"`
+
+	Auth struct {
+		RequireTokenForNewKey bool `json:"require_token_for_new_key" env:"AUTH_REQUIRE_TOKEN_FOR_NEW_KEY" env-default:"false"`
+	} `json:"auth"`
+
+	RateLimit struct {
+		Disabled                     bool `json:"disabled" env:"RATE_LIMIT_DISABLED" env-default:"false"`
+		PerIpRequestsPerMinute       int  `json:"per_ip_requests_per_minute" env:"RATE_LIMIT_PER_IP_RPM" env-default:"120" validate:"min=1"`
+		PerIpBurst                   int  `json:"per_ip_burst" env:"RATE_LIMIT_PER_IP_BURST" env-default:"30" validate:"min=1"`
+		NewKeyPerIpRequestsPerMinute int  `json:"new_key_per_ip_requests_per_minute" env:"RATE_LIMIT_NEW_KEY_PER_IP_RPM" env-default:"10" validate:"min=1"`
+		NewKeyPerIpBurst             int  `json:"new_key_per_ip_burst" env:"RATE_LIMIT_NEW_KEY_PER_IP_BURST" env-default:"5" validate:"min=1"`
+		PerKeyRequestsPerMinute      int  `json:"per_key_requests_per_minute" env:"RATE_LIMIT_PER_KEY_RPM" env-default:"10" validate:"min=1"`
+		PerKeyBurst                  int  `json:"per_key_burst" env:"RATE_LIMIT_PER_KEY_BURST" env-default:"5" validate:"min=1"`
+		KeyLockoutThreshold          int  `json:"key_lockout_threshold" env:"RATE_LIMIT_KEY_LOCKOUT_THRESHOLD" env-default:"20" validate:"min=0"` // 0 disables lockout
+		KeyLockoutMinutes            int  `json:"key_lockout_minutes" env:"RATE_LIMIT_KEY_LOCKOUT_MINUTES" env-default:"15" validate:"min=1,max=1440"`
+	} `json:"rate_limit"`
+
 	Database struct {
-		Path            string `json:"path" env:"DB_PATH" env-default:"./forgetti.db" validate:"required"`
+		Driver          string `json:"driver" env:"DB_DRIVER" env-default:"sqlite" validate:"oneof=sqlite postgres"`
+		Path            string `json:"path" env:"DB_PATH" env-default:"./forgetti.db" validate:"required"`     // sqlite only
+		Dsn             string `json:"dsn" env:"DB_DSN" env-default:"" validate:"required_if=Driver postgres"` // postgres only
 		MaxOpenConns    int    `json:"max_open_conns" env:"DB_MAX_OPEN_CONNS" env-default:"25" validate:"min=1,max=100"`
 		MaxIdleConns    int    `json:"max_idle_conns" env:"DB_MAX_IDLE_CONNS" env-default:"5" validate:"min=1,max=25"`
 		ConnMaxLifetime int    `json:"conn_max_lifetime_minutes" env:"DB_CONN_MAX_LIFETIME" env-default:"60" validate:"min=1,max=1440"`
+		// When set, startup only checks the schema version and `forgetti-server migrate up` must be run after upgrades
+		ManualMigrations bool `json:"manual_migrations" env:"DB_MANUAL_MIGRATIONS"`
 	} `json:"database"`
 
 	Logging struct {
 		Level        string `json:"level" env:"LOG_LEVEL" env-default:"info" validate:"oneof=debug info warn error"`
+		Format       string `json:"format" env:"LOG_FORMAT" env-default:"text" validate:"oneof=text json"`
 		LogFile      string `json:"log_file" env:"LOG_FILE" env-default:""`
 		LogDirectory string `json:"log_directory" env:"LOG_DIRECTORY" env-default:"./logs"`
+		// Log file rotation, 0 disables the limit
+		MaxSizeMB   int `json:"max_size_mb" env:"LOG_MAX_SIZE_MB" env-default:"100" validate:"min=0"`
+		MaxAgeHours int `json:"max_age_hours" env:"LOG_MAX_AGE_HOURS" env-default:"0" validate:"min=0"`
+		MaxBackups  int `json:"max_backups" env:"LOG_MAX_BACKUPS" env-default:"5" validate:"min=0"`
+
+		// How personal data is logged, so that logs do not link clients to keys
+		Privacy struct {
+			KeyIds          string `json:"key_ids" env:"LOG_KEY_IDS" env-default:"hash" validate:"oneof=plain hash drop"`
+			KeyIdHashSecret string `json:"key_id_hash_secret" env:"LOG_KEY_ID_HASH_SECRET" env-default:""` // random per run if empty
+			ClientIps       string `json:"client_ips" env:"LOG_CLIENT_IPS" env-default:"truncate" validate:"oneof=plain truncate drop"`
+		} `json:"privacy"`
 	} `json:"logging"`
 
+	Audit struct {
+		Disabled bool `json:"disabled" env:"AUDIT_DISABLED" env-default:"false"`
+		// Records older than this are removed by the cleanup job, 0 keeps them forever
+		RetentionDays int `json:"retention_days" env:"AUDIT_RETENTION_DAYS" env-default:"0" validate:"min=0"`
+	} `json:"audit"`
+
+	Webhooks struct {
+		Disabled            bool `json:"disabled" env:"WEBHOOKS_DISABLED" env-default:"false"`
+		ExpiringSoonHours   int  `json:"expiring_soon_hours" env:"WEBHOOKS_EXPIRING_SOON_HOURS" env-default:"24" validate:"min=1,max=720"`
+		PollIntervalSeconds int  `json:"poll_interval_seconds" env:"WEBHOOKS_POLL_INTERVAL" env-default:"10" validate:"min=1,max=3600"`
+		TimeoutSeconds      int  `json:"timeout_seconds" env:"WEBHOOKS_TIMEOUT" env-default:"10" validate:"min=1,max=120"`
+		// Failed deliveries are retried after retry_base_seconds, doubling the delay after every attempt
+		MaxAttempts      int `json:"max_attempts" env:"WEBHOOKS_MAX_ATTEMPTS" env-default:"8" validate:"min=1,max=50"`
+		RetryBaseSeconds int `json:"retry_base_seconds" env:"WEBHOOKS_RETRY_BASE" env-default:"30" validate:"min=1,max=3600"`
+		// Clients could otherwise use webhooks to reach services on the network of the server
+		AllowPrivateNetworks bool `json:"allow_private_networks" env:"WEBHOOKS_ALLOW_PRIVATE_NETWORKS" env-default:"false"`
+	} `json:"webhooks"`
+
 	DataProtection struct {
-		Key string `json:"key" env:"DATA_PROTECTION_KEY" env-default:"" validate:"required"`
+		// Key is the single key used before key rotation was supported, it is part of the keyring as LegacyDataProtectionKeyId
+		Key         string            `json:"key" env:"DATA_PROTECTION_KEY" env-default:""`
+		Keys        map[string]string `json:"keys" env:"DATA_PROTECTION_KEYS"` // key id -> secret, both active and retired keys
+		ActiveKeyId string            `json:"active_key_id" env:"DATA_PROTECTION_ACTIVE_KEY_ID" env-default:""`
+		// When set, the cleanup job also re-protects stored keys that are not protected with the active key
+		BackgroundReprotect bool `json:"background_reprotect" env:"DATA_PROTECTION_BACKGROUND_REPROTECT"`
+		ReprotectBatchSize  int  `json:"reprotect_batch_size" env:"DATA_PROTECTION_REPROTECT_BATCH_SIZE" env-default:"100" validate:"min=1,max=10000"`
+
+		// Envelope encryption protects every value with a data key wrapped by a provider, so the master secret is not
+		// stored next to the database. The keyring above is then only used to read values protected before.
+		Envelope struct {
+			Provider string `json:"provider" env:"DATA_PROTECTION_ENVELOPE_PROVIDER" env-default:"" validate:"omitempty,oneof=file vault"`
+			KeyFile  string `json:"key_file" env:"DATA_PROTECTION_ENVELOPE_KEY_FILE" env-default:"" validate:"required_if=Provider file"` // file only
+
+			// Vault transit secrets engine, or any service implementing its encrypt and decrypt API
+			Vault struct {
+				Address        string `json:"address" env:"VAULT_ADDR" env-default:""`
+				Token          string `json:"token" env:"VAULT_TOKEN" env-default:""`
+				Mount          string `json:"mount" env:"VAULT_TRANSIT_MOUNT" env-default:"transit"`
+				KeyName        string `json:"key_name" env:"VAULT_TRANSIT_KEY" env-default:""`
+				TimeoutSeconds int    `json:"timeout_seconds" env:"VAULT_TIMEOUT" env-default:"10" validate:"min=1,max=300"`
+			} `json:"vault"`
+		} `json:"envelope"`
 	} `json:"data_protection"`
 }
 
+// LegacyDataProtectionKeyId identifies data_protection.key in the keyring, and protects values stored without a key id
+const LegacyDataProtectionKeyId = "default"
+
+// EnvelopeDataProtectionKeyId marks values protected with envelope encryption, so it cannot be used in the keyring
+const EnvelopeDataProtectionKeyId = "env"
+
 func (c *Config) Validate() error {
 	validate := validator.New()
 	if err := validate.Struct(c); err != nil {
 		return fmt.Errorf("config validation failed: %w", err)
 	}
 
+	if c.MinExpiration() > c.MaxExpiration() {
+		return fmt.Errorf("config validation failed: key_policy.min_expiration_minutes exceeds key_policy.max_expiration_hours")
+	}
+
+	if err := c.validateDataProtectionKeys(); err != nil {
+		return fmt.Errorf("config validation failed: %w", err)
+	}
+
+	// API tokens are created by admin commands, which cannot reach the in-memory database of the memory key store
+	if c.KeyStore.Backend == "memory" && c.Auth.RequireTokenForNewKey {
+		return fmt.Errorf("config validation failed: auth.require_token_for_new_key cannot be used with the memory key store, which keeps no API tokens")
+	}
+
 	return nil
 }
 
+func (c *Config) validateDataProtectionKeys() error {
+	if _, ok := c.DataProtection.Keys[LegacyDataProtectionKeyId]; ok && c.DataProtection.Key != "" {
+		return fmt.Errorf("data_protection.keys cannot contain '%s' when data_protection.key is set", LegacyDataProtectionKeyId)
+	}
+
+	if c.DataProtection.Envelope.Provider == "vault" {
+		vault := c.DataProtection.Envelope.Vault
+		if vault.Address == "" || vault.Token == "" || vault.KeyName == "" {
+			return fmt.Errorf("data_protection.envelope.vault requires address, token and key_name")
+		}
+	}
+
+	keys, activeKeyId := c.DataProtectionKeys()
+	if len(keys) == 0 {
+		if c.DataProtection.Envelope.Provider != "" {
+			return nil
+		}
+		return fmt.Errorf("data_protection.key or data_protection.keys is required")
+	}
+
+	for keyId, secret := range keys {
+		if keyId == "" || strings.Contains(keyId, "$") || keyId == EnvelopeDataProtectionKeyId {
+			return fmt.Errorf("data protection key id '%s' must be non-empty, cannot contain '$' and cannot be '%s'", keyId, EnvelopeDataProtectionKeyId)
+		}
+		if secret == "" {
+			return fmt.Errorf("data protection key '%s' is empty", keyId)
+		}
+	}
+
+	if activeKeyId == "" {
+		return fmt.Errorf("data_protection.active_key_id is required when several keys are configured")
+	}
+	if _, ok := keys[activeKeyId]; !ok {
+		return fmt.Errorf("data_protection.active_key_id '%s' is not in the keyring", activeKeyId)
+	}
+
+	return nil
+}
+
+// DataProtectionKeys returns the keyring (key id -> secret) and the id of the key new values are protected with
+func (c *Config) DataProtectionKeys() (map[string]string, string) {
+	keys := make(map[string]string, len(c.DataProtection.Keys)+1)
+	for keyId, secret := range c.DataProtection.Keys {
+		keys[keyId] = secret
+	}
+	if c.DataProtection.Key != "" {
+		keys[LegacyDataProtectionKeyId] = c.DataProtection.Key
+	}
+
+	activeKeyId := c.DataProtection.ActiveKeyId
+	if activeKeyId == "" && len(keys) == 1 {
+		for keyId := range keys {
+			activeKeyId = keyId
+		}
+	}
+
+	return keys, activeKeyId
+}
+
+func (c *Config) MinExpiration() time.Duration {
+	return time.Duration(c.KeyPolicy.MinExpirationMinutes) * time.Minute
+}
+
+func (c *Config) MaxExpiration() time.Duration {
+	return time.Duration(c.KeyPolicy.MaxExpirationHours) * time.Hour
+}
+
 func Load() (*Config, error) {
 	var cfg Config
 	if err := cleanenv.ReadEnv(&cfg); err != nil {
@@ -2,32 +2,68 @@ package db
 
 import (
 	"ForgettiServer/config"
+	"ForgettiServer/db/migrations"
 	"ForgettiServer/db/models"
 	"fmt"
 	"forgetti-common/io"
+	"forgetti-common/logging"
 	"reflect"
 	"time"
 
+	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 	_ "modernc.org/sqlite"
 )
 
+// InMemorySqlitePath is the sqlite path of a database that lives only as long as the process
+const InMemorySqlitePath = ":memory:"
+
 type DatabaseService struct {
 	db *gorm.DB
 }
 
+// CreateDb opens the database and brings its schema to the latest version, unless migrations are manual
 func CreateDb(cfg *config.Config) (*gorm.DB, error) {
-	path, err := io.GetRelativePathFromBin(cfg.Database.Path)
+	logger := logging.MakeLogger("db.CreateDb")
+
+	db, err := OpenDb(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	migrator := migrations.NewMigrator(db)
+	if cfg.Database.ManualMigrations {
+		err = migrator.CheckUpToDate()
+	} else {
+		var applied []migrations.Migration
+		applied, err = migrator.Up()
+		if len(applied) > 0 {
+			logger.Info("Applied %d database migration(s), schema is at version %d", len(applied), applied[len(applied)-1].Version)
+		}
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to get relative path from bin: %w", err)
+		NewDatabaseService(db).Close()
+		return nil, err
 	}
 
-	db, err := gorm.Open(sqlite.Dialector{
-		DriverName: "sqlite",
-		DSN:        path,
-	}, &gorm.Config{
+	if err := checkTables(db); err != nil {
+		NewDatabaseService(db).Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// OpenDb connects to the configured database without touching its schema
+func OpenDb(cfg *config.Config) (*gorm.DB, error) {
+	dialector, err := createDialector(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := gorm.Open(dialector, &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Silent),
 	})
 	if err != nil {
@@ -39,17 +75,58 @@ func CreateDb(cfg *config.Config) (*gorm.DB, error) {
 		return nil, fmt.Errorf("failed to get underlying sql.DB: %w", err)
 	}
 
-	sqlDB.SetMaxOpenConns(cfg.Database.MaxOpenConns)
-	sqlDB.SetMaxIdleConns(cfg.Database.MaxIdleConns)
-	sqlDB.SetConnMaxLifetime(time.Duration(cfg.Database.ConnMaxLifetime) * time.Minute)
+	if isInMemorySqlite(cfg) {
+		// Every connection to an in-memory database sees its own empty database, so keep exactly one open forever
+		sqlDB.SetMaxOpenConns(1)
+		sqlDB.SetMaxIdleConns(1)
+		sqlDB.SetConnMaxLifetime(0)
+	} else {
+		sqlDB.SetMaxOpenConns(cfg.Database.MaxOpenConns)
+		sqlDB.SetMaxIdleConns(cfg.Database.MaxIdleConns)
+		sqlDB.SetConnMaxLifetime(time.Duration(cfg.Database.ConnMaxLifetime) * time.Minute)
+	}
 
-	for _, model := range models.ModelsToMigrate {
-		if err := db.AutoMigrate(model); err != nil {
-			return nil, fmt.Errorf("failed to run database migrations for model %T: %w", reflect.TypeOf(model), err)
+	return db, nil
+}
+
+// checkTables verifies that the migrations created a table for every model
+func checkTables(db *gorm.DB) error {
+	for _, model := range models.RegisteredModels {
+		if !db.Migrator().HasTable(model) {
+			return fmt.Errorf("table for model %s is missing - a migration is probably missing for it", reflect.TypeOf(model).Elem().Name())
 		}
 	}
 
-	return db, nil
+	return nil
+}
+
+func createDialector(cfg *config.Config) (gorm.Dialector, error) {
+	switch cfg.Database.Driver {
+	case "postgres":
+		return postgres.Open(cfg.Database.Dsn), nil
+	case "sqlite":
+		path := InMemorySqlitePath
+		if !isInMemorySqlite(cfg) {
+			var err error
+			path, err = io.GetRelativePathFromBin(cfg.Database.Path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get relative path from bin: %w", err)
+			}
+		}
+
+		// Wait for locks instead of failing, and take the write lock when a transaction starts,
+		// so that concurrent read-then-write transactions are serialized instead of deadlocking
+		return sqlite.Dialector{
+			DriverName: "sqlite",
+			DSN:        path + "?_pragma=busy_timeout(5000)&_txlock=immediate",
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported database driver: '%s'", cfg.Database.Driver)
+	}
+}
+
+func isInMemorySqlite(cfg *config.Config) bool {
+	return cfg.Database.Driver == "sqlite" && cfg.Database.Path == InMemorySqlitePath
 }
 
 func NewDatabaseService(db *gorm.DB) *DatabaseService {
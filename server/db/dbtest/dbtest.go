@@ -0,0 +1,211 @@
+// Package dbtest runs database tests against every supported driver.
+//
+// SQLite is always tested, using a temporary file. PostgreSQL is tested against
+// an embedded server, started on first use by packages whose TestMain calls Main.
+// FORGETTI_TEST_POSTGRES_DSN overrides it with a database the tests may create
+// schemas in.
+package dbtest
+
+import (
+	"ForgettiServer/config"
+	"ForgettiServer/db"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	embeddedpostgres "github.com/fergusstrange/embedded-postgres"
+	"github.com/ilyakaznacheev/cleanenv"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const PostgresDsnEnvVar = "FORGETTI_TEST_POSTGRES_DSN"
+
+var postgresServer struct {
+	once     sync.Once
+	enabled  bool // set by Main, which stops the embedded server
+	dsn      string
+	err      error
+	embedded *embeddedpostgres.EmbeddedPostgres
+	dir      string
+}
+
+// Main runs the tests of a package using ForEachDriver, stopping the embedded PostgreSQL server afterwards
+func Main(m *testing.M) {
+	postgresServer.enabled = true
+	code := m.Run()
+
+	if postgresServer.embedded != nil {
+		if err := postgresServer.embedded.Stop(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to stop embedded postgres: %v\n", err)
+		}
+		os.RemoveAll(postgresServer.dir)
+	}
+
+	os.Exit(code)
+}
+
+// ForEachDriver runs the test once per available driver, each time against a fresh, migrated database
+func ForEachDriver(t *testing.T, test func(t *testing.T, cfg *config.Config, database *gorm.DB)) {
+	forEachDriver(t, db.CreateDb, test)
+}
+
+// ForEachDriverUnmigrated runs the test once per available driver, each time against a fresh, empty database
+func ForEachDriverUnmigrated(t *testing.T, test func(t *testing.T, cfg *config.Config, database *gorm.DB)) {
+	forEachDriver(t, db.OpenDb, test)
+}
+
+func forEachDriver(
+	t *testing.T,
+	openDb func(cfg *config.Config) (*gorm.DB, error),
+	test func(t *testing.T, cfg *config.Config, database *gorm.DB),
+) {
+	t.Run("sqlite", func(t *testing.T) {
+		cfg := NewConfig()
+		cfg.Database.Driver = "sqlite"
+		cfg.Database.Path = filepath.Join(t.TempDir(), "forgetti.db")
+
+		test(t, cfg, open(t, cfg, openDb))
+	})
+
+	t.Run("postgres", func(t *testing.T) {
+		dsn := postgresDsn(t)
+
+		cfg := NewConfig()
+		cfg.Database.Driver = "postgres"
+		cfg.Database.Dsn = withSchema(dsn, createSchema(t, dsn))
+
+		test(t, cfg, open(t, cfg, openDb))
+	})
+}
+
+// NewConfig returns a valid configuration with the default values, suitable for tests
+func NewConfig() *config.Config {
+	cfg := &config.Config{}
+	if err := cleanenv.ReadEnv(cfg); err != nil {
+		panic(fmt.Sprintf("failed to apply config defaults: %v", err))
+	}
+
+	cfg.DataProtection.Key = "test-data-protection-key"
+	return cfg
+}
+
+func open(t *testing.T, cfg *config.Config, openDb func(cfg *config.Config) (*gorm.DB, error)) *gorm.DB {
+	database, err := openDb(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create %s database: %v", cfg.Database.Driver, err)
+	}
+
+	t.Cleanup(func() {
+		db.NewDatabaseService(database).Close()
+	})
+
+	return database
+}
+
+// postgresDsn returns the DSN of the server given by FORGETTI_TEST_POSTGRES_DSN, or else of the embedded server, which
+// is started on first use. Skips the test if the embedded server cannot run, e.g. without network access.
+func postgresDsn(t *testing.T) string {
+	if dsn := os.Getenv(PostgresDsnEnvVar); dsn != "" {
+		return dsn
+	}
+
+	if !postgresServer.enabled {
+		t.Fatal("The package must run its tests with dbtest.Main to test against embedded postgres")
+	}
+
+	postgresServer.once.Do(func() {
+		postgresServer.dsn, postgresServer.err = startEmbeddedPostgres()
+	})
+	if postgresServer.err != nil {
+		t.Skipf("Embedded postgres is not available, set %s to test against another server: %v", PostgresDsnEnvVar, postgresServer.err)
+	}
+
+	return postgresServer.dsn
+}
+
+func startEmbeddedPostgres() (string, error) {
+	port, err := freePort()
+	if err != nil {
+		return "", err
+	}
+
+	postgresServer.dir, err = os.MkdirTemp("", "forgetti-postgres-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create runtime directory: %w", err)
+	}
+
+	var log strings.Builder
+	embedded := embeddedpostgres.NewDatabase(embeddedpostgres.DefaultConfig().
+		Port(uint32(port)).
+		RuntimePath(postgresServer.dir).
+		Logger(&log))
+	if err := embedded.Start(); err != nil {
+		os.RemoveAll(postgresServer.dir)
+		if output := strings.TrimSpace(log.String()); output != "" {
+			return "", fmt.Errorf("%w: %s", err, output)
+		}
+		return "", err
+	}
+	postgresServer.embedded = embedded
+
+	return fmt.Sprintf("host=localhost port=%d user=postgres password=postgres dbname=postgres sslmode=disable", port), nil
+}
+
+func freePort() (int, error) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return 0, fmt.Errorf("failed to find a free port: %w", err)
+	}
+	defer listener.Close()
+
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+// createSchema creates a uniquely named schema, dropped when the test ends
+func createSchema(t *testing.T, dsn string) string {
+	admin, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("Failed to connect to postgres: %v", err)
+	}
+	t.Cleanup(func() {
+		db.NewDatabaseService(admin).Close()
+	})
+
+	suffix := make([]byte, 6)
+	if _, err := rand.Read(suffix); err != nil {
+		t.Fatalf("Failed to generate schema name: %v", err)
+	}
+	schema := "forgetti_test_" + hex.EncodeToString(suffix)
+
+	if err := admin.Exec(fmt.Sprintf("CREATE SCHEMA %s", schema)).Error; err != nil {
+		t.Fatalf("Failed to create schema %s: %v", schema, err)
+	}
+	t.Cleanup(func() {
+		if err := admin.Exec(fmt.Sprintf("DROP SCHEMA %s CASCADE", schema)).Error; err != nil {
+			t.Errorf("Failed to drop schema %s: %v", schema, err)
+		}
+	})
+
+	return schema
+}
+
+// withSchema makes all connections opened with the DSN use the given schema, for both URL and key=value DSNs
+func withSchema(dsn string, schema string) string {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		separator := "?"
+		if strings.Contains(dsn, "?") {
+			separator = "&"
+		}
+		return dsn + separator + "search_path=" + schema
+	}
+
+	return dsn + " search_path=" + schema
+}
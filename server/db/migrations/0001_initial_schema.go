@@ -0,0 +1,42 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type keyRecordV1 struct {
+	Id            string    `gorm:"primarykey;column:id"`
+	Expiration    time.Time `gorm:"column:expiration;not null"`
+	SerializedKey string    `gorm:"column:serialized_key;not null"`
+	CreatedAt     time.Time `gorm:"column:created_at;autoCreateTime"`
+}
+
+func (keyRecordV1) TableName() string {
+	return "keys"
+}
+
+type recentlyExpiredRecordV1 struct {
+	Id         string    `gorm:"primarykey;column:id"`
+	Expiration time.Time `gorm:"column:expiration;not null"`
+	CreatedAt  time.Time `gorm:"column:created_at;autoCreateTime"`
+}
+
+func (recentlyExpiredRecordV1) TableName() string {
+	return "recently_expired"
+}
+
+var initialSchema = Migration{
+	Version: 1,
+	Name:    "initial_schema",
+	Up: func(tx *gorm.DB) error {
+		if err := createTableIfMissing(tx, &keyRecordV1{}); err != nil {
+			return err
+		}
+		return createTableIfMissing(tx, &recentlyExpiredRecordV1{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&recentlyExpiredRecordV1{}, &keyRecordV1{})
+	},
+}
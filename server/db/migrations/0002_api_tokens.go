@@ -0,0 +1,49 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type apiTokenRecordV2 struct {
+	Id        string    `gorm:"primarykey;column:id"`
+	Name      string    `gorm:"column:name;not null"`
+	TokenHash string    `gorm:"column:token_hash;not null;uniqueIndex"`
+	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime"`
+}
+
+func (apiTokenRecordV2) TableName() string {
+	return "api_tokens"
+}
+
+type keyRecordV2 struct {
+	OwnerTokenId string `gorm:"column:owner_token_id;not null;default:'';index"`
+}
+
+func (keyRecordV2) TableName() string {
+	return "keys"
+}
+
+var apiTokens = Migration{
+	Version: 2,
+	Name:    "api_tokens",
+	Up: func(tx *gorm.DB) error {
+		if err := createTableIfMissing(tx, &apiTokenRecordV2{}); err != nil {
+			return err
+		}
+		if err := addColumnIfMissing(tx, &keyRecordV2{}, "OwnerTokenId"); err != nil {
+			return err
+		}
+		return createIndexIfMissing(tx, &keyRecordV2{}, "OwnerTokenId")
+	},
+	Down: func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropIndex(&keyRecordV2{}, "OwnerTokenId"); err != nil {
+			return err
+		}
+		if err := tx.Migrator().DropColumn(&keyRecordV2{}, "OwnerTokenId"); err != nil {
+			return err
+		}
+		return tx.Migrator().DropTable(&apiTokenRecordV2{})
+	},
+}
@@ -0,0 +1,49 @@
+package migrations
+
+import "gorm.io/gorm"
+
+type apiTokenRecordV3 struct {
+	MaxLiveKeys        int `gorm:"column:max_live_keys;not null;default:0"`
+	MaxExpirationHours int `gorm:"column:max_expiration_hours;not null;default:0"`
+	DailyKeyCap        int `gorm:"column:daily_key_cap;not null;default:0"`
+}
+
+func (apiTokenRecordV3) TableName() string {
+	return "api_tokens"
+}
+
+type tokenUsageRecordV3 struct {
+	TokenId     string `gorm:"primarykey;column:token_id"`
+	Day         string `gorm:"primarykey;column:day"`
+	KeysCreated int64  `gorm:"column:keys_created;not null;default:0"`
+}
+
+func (tokenUsageRecordV3) TableName() string {
+	return "token_usage"
+}
+
+var tokenQuotaFields = []string{"MaxLiveKeys", "MaxExpirationHours", "DailyKeyCap"}
+
+var tokenQuotas = Migration{
+	Version: 3,
+	Name:    "token_quotas",
+	Up: func(tx *gorm.DB) error {
+		for _, field := range tokenQuotaFields {
+			if err := addColumnIfMissing(tx, &apiTokenRecordV3{}, field); err != nil {
+				return err
+			}
+		}
+		return createTableIfMissing(tx, &tokenUsageRecordV3{})
+	},
+	Down: func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropTable(&tokenUsageRecordV3{}); err != nil {
+			return err
+		}
+		for _, field := range tokenQuotaFields {
+			if err := tx.Migrator().DropColumn(&apiTokenRecordV3{}, field); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
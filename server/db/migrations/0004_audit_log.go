@@ -0,0 +1,32 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type auditRecordV4 struct {
+	Sequence int64     `gorm:"primarykey;autoIncrement:false;column:sequence"`
+	Time     time.Time `gorm:"column:time;not null;index"`
+	Event    string    `gorm:"column:event;not null"`
+	KeyId    string    `gorm:"column:key_id;not null;default:'';index"`
+	Details  string    `gorm:"column:details;not null;default:''"`
+	PrevHash string    `gorm:"column:prev_hash;not null"`
+	Hash     string    `gorm:"column:hash;not null"`
+}
+
+func (auditRecordV4) TableName() string {
+	return "audit_log"
+}
+
+var auditLog = Migration{
+	Version: 4,
+	Name:    "audit_log",
+	Up: func(tx *gorm.DB) error {
+		return createTableIfMissing(tx, &auditRecordV4{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&auditRecordV4{})
+	},
+}
@@ -0,0 +1,53 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type webhookRecordV5 struct {
+	KeyId            string    `gorm:"primarykey;column:key_id"`
+	Expiration       time.Time `gorm:"column:expiration;not null;index"`
+	Target           string    `gorm:"column:target;not null"`
+	ExpiringSoonSent bool      `gorm:"column:expiring_soon_sent;not null;default:false"`
+	ExpiredSent      bool      `gorm:"column:expired_sent;not null;default:false"`
+	CreatedAt        time.Time `gorm:"column:created_at;autoCreateTime"`
+}
+
+func (webhookRecordV5) TableName() string {
+	return "webhooks"
+}
+
+type webhookDeliveryRecordV5 struct {
+	Id            int64     `gorm:"primarykey;column:id"`
+	KeyId         string    `gorm:"column:key_id;not null"`
+	Event         string    `gorm:"column:event;not null"`
+	Payload       string    `gorm:"column:payload;not null"`
+	Target        string    `gorm:"column:target;not null"`
+	Attempts      int       `gorm:"column:attempts;not null;default:0"`
+	NextAttemptAt time.Time `gorm:"column:next_attempt_at;not null;index"`
+	LastError     string    `gorm:"column:last_error;not null;default:''"`
+	CreatedAt     time.Time `gorm:"column:created_at;autoCreateTime"`
+}
+
+func (webhookDeliveryRecordV5) TableName() string {
+	return "webhook_deliveries"
+}
+
+var webhooks = Migration{
+	Version: 5,
+	Name:    "webhooks",
+	Up: func(tx *gorm.DB) error {
+		if err := createTableIfMissing(tx, &webhookRecordV5{}); err != nil {
+			return err
+		}
+		return createTableIfMissing(tx, &webhookDeliveryRecordV5{})
+	},
+	Down: func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropTable(&webhookDeliveryRecordV5{}); err != nil {
+			return err
+		}
+		return tx.Migrator().DropTable(&webhookRecordV5{})
+	},
+}
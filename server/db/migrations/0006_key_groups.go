@@ -0,0 +1,35 @@
+package migrations
+
+import "gorm.io/gorm"
+
+type keyRecordV6 struct {
+	OwnerTokenId string  `gorm:"column:owner_token_id;not null;default:'';index;uniqueIndex:idx_keys_owner_group,priority:1"`
+	GroupName    *string `gorm:"column:group_name;uniqueIndex:idx_keys_owner_group,priority:2"`
+}
+
+func (keyRecordV6) TableName() string {
+	return "keys"
+}
+
+const keyGroupIndex = "idx_keys_owner_group"
+
+var keyGroups = Migration{
+	Version: 6,
+	Name:    "key_groups",
+	Up: func(tx *gorm.DB) error {
+		if err := addColumnIfMissing(tx, &keyRecordV6{}, "GroupName"); err != nil {
+			return err
+		}
+		return createIndexIfMissing(tx, &keyRecordV6{}, keyGroupIndex)
+	},
+	Down: func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropIndex(&keyRecordV6{}, keyGroupIndex); err != nil {
+			return err
+		}
+		if err := tx.Migrator().DropColumn(&keyRecordV6{}, "GroupName"); err != nil {
+			return err
+		}
+		// SQLite drops columns by recreating the table, which loses its other indexes
+		return createIndexIfMissing(tx, &keyRecordV2{}, "OwnerTokenId")
+	},
+}
@@ -0,0 +1,226 @@
+package migrations
+
+import (
+	"errors"
+	"fmt"
+	"forgetti-common/logging"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrSchemaTooNew is returned when the database was migrated by a newer server version
+var ErrSchemaTooNew = errors.New("database schema is newer than this server")
+
+// ErrSchemaOutdated is returned when migrations are pending but may not be applied automatically
+var ErrSchemaOutdated = errors.New("database schema is outdated")
+
+// advisoryLockId identifies the PostgreSQL lock that keeps replicas from migrating concurrently
+const advisoryLockId = 7340211
+
+// SchemaMigrationRecord marks a migration as applied
+type SchemaMigrationRecord struct {
+	Version   int       `gorm:"primarykey;autoIncrement:false;column:version"`
+	Name      string    `gorm:"column:name;not null"`
+	AppliedAt time.Time `gorm:"column:applied_at;not null"`
+}
+
+func (SchemaMigrationRecord) TableName() string {
+	return "schema_migrations"
+}
+
+type MigrationStatus struct {
+	Migration Migration
+	AppliedAt *time.Time
+}
+
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+func NewMigrator(db *gorm.DB) *Migrator {
+	return &Migrator{db: db, migrations: migrations}
+}
+
+// LatestVersion returns the version of the newest migration known to this server
+func (m *Migrator) LatestVersion() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// CurrentVersion returns the version of the newest migration applied to the database, 0 if none
+func (m *Migrator) CurrentVersion() (int, error) {
+	if err := m.ensureTable(); err != nil {
+		return 0, err
+	}
+	return currentVersion(m.db)
+}
+
+// CheckUpToDate fails unless the database is at exactly the latest known version
+func (m *Migrator) CheckUpToDate() error {
+	version, err := m.CurrentVersion()
+	if err != nil {
+		return err
+	}
+
+	if version > m.LatestVersion() {
+		return fmt.Errorf("%w: database is at version %d, this server knows up to version %d", ErrSchemaTooNew, version, m.LatestVersion())
+	}
+	if version < m.LatestVersion() {
+		return fmt.Errorf("%w: database is at version %d, run 'forgetti-server migrate up' to migrate to version %d", ErrSchemaOutdated, version, m.LatestVersion())
+	}
+
+	return nil
+}
+
+// Up applies all pending migrations in order, each in its own transaction, and returns the applied ones
+func (m *Migrator) Up() ([]Migration, error) {
+	logger := logging.MakeLogger("migrations.Migrator.Up")
+
+	if err := m.ensureTable(); err != nil {
+		return nil, err
+	}
+
+	applied := []Migration{}
+	for _, migration := range m.migrations {
+		wasApplied := false
+		err := m.db.Transaction(func(tx *gorm.DB) error {
+			version, err := lockAndGetVersion(tx)
+			if err != nil {
+				return err
+			}
+			if version > m.LatestVersion() {
+				return fmt.Errorf("%w: database is at version %d, this server knows up to version %d", ErrSchemaTooNew, version, m.LatestVersion())
+			}
+			if version >= migration.Version {
+				return nil
+			}
+
+			logger.Info("Applying migration %s", migration.String())
+			if err := migration.Up(tx); err != nil {
+				return fmt.Errorf("failed to apply migration %s: %w", migration.String(), err)
+			}
+
+			record := SchemaMigrationRecord{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}
+			if err := tx.Create(&record).Error; err != nil {
+				return fmt.Errorf("failed to record migration %s: %w", migration.String(), err)
+			}
+
+			wasApplied = true
+			return nil
+		})
+		if err != nil {
+			return applied, err
+		}
+
+		if wasApplied {
+			applied = append(applied, migration)
+		}
+	}
+
+	return applied, nil
+}
+
+// Down rolls back the newest applied migration, returning nil if there was none
+func (m *Migrator) Down() (*Migration, error) {
+	logger := logging.MakeLogger("migrations.Migrator.Down")
+
+	if err := m.ensureTable(); err != nil {
+		return nil, err
+	}
+
+	var rolledBack *Migration
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		version, err := lockAndGetVersion(tx)
+		if err != nil || version == 0 {
+			return err
+		}
+
+		migration := m.find(version)
+		if migration == nil {
+			return fmt.Errorf("%w: cannot roll back unknown migration version %d", ErrSchemaTooNew, version)
+		}
+
+		logger.Info("Rolling back migration %s", migration.String())
+		if err := migration.Down(tx); err != nil {
+			return fmt.Errorf("failed to roll back migration %s: %w", migration.String(), err)
+		}
+
+		if err := tx.Delete(&SchemaMigrationRecord{}, version).Error; err != nil {
+			return fmt.Errorf("failed to remove migration record %s: %w", migration.String(), err)
+		}
+
+		rolledBack = migration
+		return nil
+	})
+
+	return rolledBack, err
+}
+
+// Status lists all known migrations, with the time they were applied if they were
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	if err := m.ensureTable(); err != nil {
+		return nil, err
+	}
+
+	var records []SchemaMigrationRecord
+	if err := m.db.Order("version").Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to list applied migrations: %w", err)
+	}
+
+	appliedAt := make(map[int]time.Time, len(records))
+	for _, record := range records {
+		appliedAt[record.Version] = record.AppliedAt
+	}
+
+	result := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Migration: migration}
+		if at, ok := appliedAt[migration.Version]; ok {
+			status.AppliedAt = &at
+		}
+		result = append(result, status)
+	}
+
+	return result, nil
+}
+
+func (m *Migrator) find(version int) *Migration {
+	for i := range m.migrations {
+		if m.migrations[i].Version == version {
+			return &m.migrations[i]
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) ensureTable() error {
+	if err := m.db.AutoMigrate(&SchemaMigrationRecord{}); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+	return nil
+}
+
+// lockAndGetVersion keeps other replicas from migrating until the transaction ends. SQLite needs
+// no extra lock, because it serializes write transactions (see db.OpenDb).
+func lockAndGetVersion(tx *gorm.DB) (int, error) {
+	if tx.Dialector.Name() == "postgres" {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", advisoryLockId).Error; err != nil {
+			return 0, fmt.Errorf("failed to lock schema migrations: %w", err)
+		}
+	}
+
+	return currentVersion(tx)
+}
+
+func currentVersion(db *gorm.DB) (int, error) {
+	var version int
+	err := db.Model(&SchemaMigrationRecord{}).Select("COALESCE(MAX(version), 0)").Scan(&version).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to get schema version: %w", err)
+	}
+	return version, nil
+}
@@ -0,0 +1,149 @@
+package migrations_test
+
+import (
+	"ForgettiServer/config"
+	"ForgettiServer/db/dbtest"
+	"ForgettiServer/db/migrations"
+	"ForgettiServer/db/models"
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestUpCreatesColumnsOfAllModels(t *testing.T) {
+	dbtest.ForEachDriverUnmigrated(t, func(t *testing.T, _ *config.Config, database *gorm.DB) {
+		migrator := migrations.NewMigrator(database)
+
+		applied, err := migrator.Up()
+		if err != nil {
+			t.Fatalf("Up() error = %v", err)
+		}
+		if len(applied) != migrator.LatestVersion() {
+			t.Errorf("Up() applied %d migrations, want %d", len(applied), migrator.LatestVersion())
+		}
+		expectVersion(t, migrator, migrator.LatestVersion())
+		expectModelColumns(t, database)
+
+		applied, err = migrator.Up()
+		if err != nil || len(applied) != 0 {
+			t.Errorf("Second Up() = %d migrations, %v, want none", len(applied), err)
+		}
+		if err := migrator.CheckUpToDate(); err != nil {
+			t.Errorf("CheckUpToDate() error = %v", err)
+		}
+	})
+}
+
+func TestDownRollsBackAllMigrations(t *testing.T) {
+	dbtest.ForEachDriverUnmigrated(t, func(t *testing.T, _ *config.Config, database *gorm.DB) {
+		migrator := migrations.NewMigrator(database)
+		if _, err := migrator.Up(); err != nil {
+			t.Fatalf("Up() error = %v", err)
+		}
+
+		for version := migrator.LatestVersion(); version > 0; version-- {
+			migration, err := migrator.Down()
+			if err != nil {
+				t.Fatalf("Down() error = %v", err)
+			}
+			if migration == nil || migration.Version != version {
+				t.Fatalf("Down() rolled back %v, want version %d", migration, version)
+			}
+		}
+
+		if migration, err := migrator.Down(); migration != nil || err != nil {
+			t.Errorf("Down() on empty schema = %v, %v, want nil, nil", migration, err)
+		}
+		expectVersion(t, migrator, 0)
+		for _, model := range models.RegisteredModels {
+			if database.Migrator().HasTable(model) {
+				t.Errorf("Table for %T still exists after rolling back", model)
+			}
+		}
+
+		if _, err := migrator.Up(); err != nil {
+			t.Fatalf("Up() after rolling back error = %v", err)
+		}
+		expectModelColumns(t, database)
+	})
+}
+
+func TestUpAdoptsAutoMigratedDatabase(t *testing.T) {
+	dbtest.ForEachDriverUnmigrated(t, func(t *testing.T, _ *config.Config, database *gorm.DB) {
+		// Databases created before migrations existed were set up with AutoMigrate
+		if err := database.AutoMigrate(models.RegisteredModels...); err != nil {
+			t.Fatalf("AutoMigrate() error = %v", err)
+		}
+
+		migrator := migrations.NewMigrator(database)
+		if _, err := migrator.Up(); err != nil {
+			t.Fatalf("Up() error = %v", err)
+		}
+		expectVersion(t, migrator, migrator.LatestVersion())
+	})
+}
+
+func TestRefusesNewerSchema(t *testing.T) {
+	dbtest.ForEachDriverUnmigrated(t, func(t *testing.T, _ *config.Config, database *gorm.DB) {
+		migrator := migrations.NewMigrator(database)
+		if _, err := migrator.Up(); err != nil {
+			t.Fatalf("Up() error = %v", err)
+		}
+
+		newer := migrations.SchemaMigrationRecord{Version: migrator.LatestVersion() + 1, Name: "from_the_future", AppliedAt: time.Now()}
+		if err := database.Create(&newer).Error; err != nil {
+			t.Fatalf("Failed to record newer migration: %v", err)
+		}
+
+		if _, err := migrator.Up(); !errors.Is(err, migrations.ErrSchemaTooNew) {
+			t.Errorf("Up() error = %v, want %v", err, migrations.ErrSchemaTooNew)
+		}
+		if err := migrator.CheckUpToDate(); !errors.Is(err, migrations.ErrSchemaTooNew) {
+			t.Errorf("CheckUpToDate() error = %v, want %v", err, migrations.ErrSchemaTooNew)
+		}
+		if _, err := migrator.Down(); !errors.Is(err, migrations.ErrSchemaTooNew) {
+			t.Errorf("Down() error = %v, want %v", err, migrations.ErrSchemaTooNew)
+		}
+	})
+}
+
+func TestCheckUpToDateReportsPendingMigrations(t *testing.T) {
+	dbtest.ForEachDriverUnmigrated(t, func(t *testing.T, _ *config.Config, database *gorm.DB) {
+		err := migrations.NewMigrator(database).CheckUpToDate()
+		if !errors.Is(err, migrations.ErrSchemaOutdated) {
+			t.Errorf("CheckUpToDate() error = %v, want %v", err, migrations.ErrSchemaOutdated)
+		}
+	})
+}
+
+func expectVersion(t *testing.T, migrator *migrations.Migrator, want int) {
+	t.Helper()
+
+	version, err := migrator.CurrentVersion()
+	if err != nil {
+		t.Fatalf("CurrentVersion() error = %v", err)
+	}
+	if version != want {
+		t.Errorf("CurrentVersion() = %d, want %d", version, want)
+	}
+}
+
+// expectModelColumns fails when a model has a field that no migration created a column for
+func expectModelColumns(t *testing.T, database *gorm.DB) {
+	t.Helper()
+
+	for _, model := range models.RegisteredModels {
+		statement := &gorm.Statement{DB: database}
+		if err := statement.Parse(model); err != nil {
+			t.Fatalf("Failed to parse model %T: %v", model, err)
+		}
+
+		for _, field := range statement.Schema.Fields {
+			if field.DBName != "" && !database.Migrator().HasColumn(model, field.DBName) {
+				t.Errorf("Column %s.%s was not created by migrations", statement.Schema.Table, field.DBName)
+			}
+		}
+	}
+}
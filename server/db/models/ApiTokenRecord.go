@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+type ApiTokenRecord struct {
+	Id        string    `gorm:"primarykey;column:id" json:"id"`
+	Name      string    `gorm:"column:name;not null" json:"name"`
+	TokenHash string    `gorm:"column:token_hash;not null;uniqueIndex" json:"token_hash"`
+	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+
+	// Quotas - 0 means no token-specific limit
+	MaxLiveKeys        int `gorm:"column:max_live_keys;not null;default:0" json:"max_live_keys"`
+	MaxExpirationHours int `gorm:"column:max_expiration_hours;not null;default:0" json:"max_expiration_hours"`
+	DailyKeyCap        int `gorm:"column:daily_key_cap;not null;default:0" json:"daily_key_cap"`
+}
+
+func (ApiTokenRecord) TableName() string {
+	return "api_tokens"
+}
+
+func init() {
+	RegisterModel(&ApiTokenRecord{})
+}
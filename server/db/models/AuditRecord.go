@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// AuditRecord is an entry of the append-only audit log. Every entry includes the hash of the previous one,
+// so that changing or removing entries breaks the chain.
+type AuditRecord struct {
+	Sequence int64     `gorm:"primarykey;autoIncrement:false;column:sequence" json:"sequence"`
+	Time     time.Time `gorm:"column:time;not null;index" json:"time"`
+	Event    string    `gorm:"column:event;not null" json:"event"`
+	KeyId    string    `gorm:"column:key_id;not null;default:'';index" json:"key_id"`
+	Details  string    `gorm:"column:details;not null;default:''" json:"details"` // JSON object
+	PrevHash string    `gorm:"column:prev_hash;not null" json:"prev_hash"`
+	Hash     string    `gorm:"column:hash;not null" json:"hash"`
+}
+
+func (AuditRecord) TableName() string {
+	return "audit_log"
+}
+
+func init() {
+	RegisterModel(&AuditRecord{})
+}
@@ -7,6 +7,9 @@ type KeyRecord struct {
 	Expiration    time.Time `gorm:"column:expiration;not null" json:"expiration"`
 	SerializedKey string    `gorm:"column:serialized_key;not null" json:"serialized_key"`
 	CreatedAt     time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	OwnerTokenId  string    `gorm:"column:owner_token_id;not null;default:'';index;uniqueIndex:idx_keys_owner_group,priority:1" json:"owner_token_id"`
+	// GroupName is nil for keys outside of a group, so that they do not collide in the unique index
+	GroupName *string `gorm:"column:group_name;uniqueIndex:idx_keys_owner_group,priority:2" json:"group_name"`
 }
 
 func (KeyRecord) TableName() string {
@@ -0,0 +1,15 @@
+package models
+
+type TokenUsageRecord struct {
+	TokenId     string `gorm:"primarykey;column:token_id" json:"token_id"`
+	Day         string `gorm:"primarykey;column:day" json:"day"` // UTC date, YYYY-MM-DD
+	KeysCreated int64  `gorm:"column:keys_created;not null;default:0" json:"keys_created"`
+}
+
+func (TokenUsageRecord) TableName() string {
+	return "token_usage"
+}
+
+func init() {
+	RegisterModel(&TokenUsageRecord{})
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// WebhookDeliveryRecord is a notification waiting to be delivered. It carries its own copy of the target, so it can
+// still be delivered after the webhook of the key was deleted.
+type WebhookDeliveryRecord struct {
+	Id            int64     `gorm:"primarykey;column:id" json:"id"`
+	KeyId         string    `gorm:"column:key_id;not null" json:"key_id"`
+	Event         string    `gorm:"column:event;not null" json:"event"`
+	Payload       string    `gorm:"column:payload;not null" json:"payload"`
+	Target        string    `gorm:"column:target;not null" json:"target"` // protected URL and secret
+	Attempts      int       `gorm:"column:attempts;not null;default:0" json:"attempts"`
+	NextAttemptAt time.Time `gorm:"column:next_attempt_at;not null;index" json:"next_attempt_at"`
+	LastError     string    `gorm:"column:last_error;not null;default:''" json:"last_error"`
+	CreatedAt     time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
+
+func (WebhookDeliveryRecord) TableName() string {
+	return "webhook_deliveries"
+}
+
+func init() {
+	RegisterModel(&WebhookDeliveryRecord{})
+}
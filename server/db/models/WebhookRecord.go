@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// WebhookRecord is the webhook of a key, it is deleted once the key is destroyed
+type WebhookRecord struct {
+	KeyId            string    `gorm:"primarykey;column:key_id" json:"key_id"`
+	Expiration       time.Time `gorm:"column:expiration;not null;index" json:"expiration"`
+	Target           string    `gorm:"column:target;not null" json:"target"` // protected URL and secret
+	ExpiringSoonSent bool      `gorm:"column:expiring_soon_sent;not null;default:false" json:"expiring_soon_sent"`
+	ExpiredSent      bool      `gorm:"column:expired_sent;not null;default:false" json:"expired_sent"`
+	CreatedAt        time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
+
+func (WebhookRecord) TableName() string {
+	return "webhooks"
+}
+
+func init() {
+	RegisterModel(&WebhookRecord{})
+}
@@ -1,7 +1,8 @@
 package models
 
-var ModelsToMigrate = []any{}
+// RegisteredModels lists every model, so startup can check that migrations created their tables
+var RegisteredModels = []any{}
 
 func RegisterModel[T any](model *T) {
-	ModelsToMigrate = append(ModelsToMigrate, model)
+	RegisteredModels = append(RegisteredModels, model)
 }
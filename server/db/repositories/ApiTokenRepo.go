@@ -0,0 +1,93 @@
+package repositories
+
+import (
+	"ForgettiServer/db/models"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+type ApiTokenRepo struct {
+	db *gorm.DB
+}
+
+func NewApiTokenRepo(db *gorm.DB) *ApiTokenRepo {
+	return &ApiTokenRepo{db: db}
+}
+
+func (s *ApiTokenRepo) Create(
+	id string,
+	name string,
+	tokenHash string,
+	maxLiveKeys int,
+	maxExpirationHours int,
+	dailyKeyCap int,
+) (*models.ApiTokenRecord, error) {
+	record := models.ApiTokenRecord{
+		Id:                 id,
+		Name:               name,
+		TokenHash:          tokenHash,
+		MaxLiveKeys:        maxLiveKeys,
+		MaxExpirationHours: maxExpirationHours,
+		DailyKeyCap:        dailyKeyCap,
+	}
+
+	if err := s.db.Create(&record).Error; err != nil {
+		return nil, fmt.Errorf("failed to create api token record: %w", err)
+	}
+
+	return &record, nil
+}
+
+func (s *ApiTokenRepo) GetById(id string) (*models.ApiTokenRecord, error) {
+	var record models.ApiTokenRecord
+	err := s.db.Where("id = ?", id).First(&record).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get api token record: %w", err)
+	}
+
+	return &record, nil
+}
+
+func (s *ApiTokenRepo) GetByHash(tokenHash string) (*models.ApiTokenRecord, error) {
+	var record models.ApiTokenRecord
+	err := s.db.Where("token_hash = ?", tokenHash).First(&record).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get api token record: %w", err)
+	}
+
+	return &record, nil
+}
+
+func (s *ApiTokenRepo) List() ([]models.ApiTokenRecord, error) {
+	var records []models.ApiTokenRecord
+	if err := s.db.Order("created_at").Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to list api token records: %w", err)
+	}
+
+	return records, nil
+}
+
+func (s *ApiTokenRepo) Delete(id string) (bool, error) {
+	result := s.db.Where("id = ?", id).Delete(&models.ApiTokenRecord{})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to delete api token record: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (s *ApiTokenRepo) UpdateQuota(id string, maxLiveKeys int, maxExpirationHours int, dailyKeyCap int) (bool, error) {
+	result := s.db.Model(&models.ApiTokenRecord{}).Where("id = ?", id).Updates(map[string]any{
+		"max_live_keys":        maxLiveKeys,
+		"max_expiration_hours": maxExpirationHours,
+		"daily_key_cap":        dailyKeyCap,
+	})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to update api token quota: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
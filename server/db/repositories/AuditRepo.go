@@ -0,0 +1,91 @@
+package repositories
+
+import (
+	"ForgettiServer/db/models"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// auditLockId identifies the PostgreSQL lock that keeps replicas from appending to the audit log concurrently
+const auditLockId = 7340212
+
+type AuditRepo struct {
+	db *gorm.DB
+}
+
+func NewAuditRepo(db *gorm.DB) *AuditRepo {
+	return &AuditRepo{db: db}
+}
+
+// Append stores the record built from the last one (nil if the log is empty). Appends are serialized, so that
+// every record is built from the record that actually precedes it.
+func (s *AuditRepo) Append(build func(last *models.AuditRecord) (*models.AuditRecord, error)) (*models.AuditRecord, error) {
+	var record *models.AuditRecord
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// SQLite needs no extra lock, because it serializes write transactions (see db.OpenDb)
+		if tx.Dialector.Name() == "postgres" {
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", auditLockId).Error; err != nil {
+				return fmt.Errorf("failed to lock audit log: %w", err)
+			}
+		}
+
+		var last *models.AuditRecord
+		var existing models.AuditRecord
+		err := tx.Order("sequence DESC").First(&existing).Error
+		if err == nil {
+			last = &existing
+		} else if err != gorm.ErrRecordNotFound {
+			return fmt.Errorf("failed to get last audit record: %w", err)
+		}
+
+		record, err = build(last)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Create(record).Error; err != nil {
+			return fmt.Errorf("failed to create audit record: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+// ListAfter returns up to limit records, ordered by sequence and starting after afterSequence
+func (s *AuditRepo) ListAfter(afterSequence int64, limit int) ([]models.AuditRecord, error) {
+	var records []models.AuditRecord
+	err := s.db.Where("sequence > ?", afterSequence).Order("sequence").Limit(limit).Find(&records).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit records: %w", err)
+	}
+
+	return records, nil
+}
+
+// LastBefore returns the newest record written before the given time, nil if there is none
+func (s *AuditRepo) LastBefore(cutoffTime time.Time) (*models.AuditRecord, error) {
+	var record models.AuditRecord
+	err := s.db.Where("time < ?", cutoffTime).Order("sequence DESC").First(&record).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get audit record: %w", err)
+	}
+
+	return &record, nil
+}
+
+// DeleteThrough deletes the records up to and including the given sequence
+func (s *AuditRepo) DeleteThrough(sequence int64) (int64, error) {
+	result := s.db.Where("sequence <= ?", sequence).Delete(&models.AuditRecord{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to delete audit records: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
@@ -2,12 +2,21 @@ package repositories
 
 import (
 	"ForgettiServer/db/models"
+	"errors"
 	"fmt"
 	"time"
+	"unicode/utf8"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// ErrKeyGroupTaken is returned when a live key of the same owner already uses the group name
+var ErrKeyGroupTaken = errors.New("key group is already in use")
+
+// ErrLiveKeyLimitReached is returned when the owner already has as many live keys as allowed
+var ErrLiveKeyLimitReached = errors.New("live key limit reached")
+
 type KeyRepo struct {
 	db *gorm.DB
 }
@@ -16,7 +25,16 @@ func NewKeyRepo(db *gorm.DB) *KeyRepo {
 	return &KeyRepo{db: db}
 }
 
-func (s *KeyRepo) Create(id string, expiration time.Time, serializedKey string) error {
+// Create stores the key, in the given group unless the group is empty. Returns ErrKeyGroupTaken if a live key of the
+// owner already uses the group.
+func (s *KeyRepo) Create(id string, expiration time.Time, serializedKey string, ownerTokenId string, group string) error {
+	return s.CreateWithinLimit(id, expiration, serializedKey, ownerTokenId, group, 0)
+}
+
+// CreateWithinLimit is Create for owners with a live key limit (0 = no limit). Returns ErrLiveKeyLimitReached if the
+// owner already has maxLiveKeys live keys. The keys are counted in the transaction of the insert, with the token of
+// the owner locked, so concurrent requests cannot exceed the limit.
+func (s *KeyRepo) CreateWithinLimit(id string, expiration time.Time, serializedKey string, ownerTokenId string, group string, maxLiveKeys int64) error {
 	var existing models.KeyRecord
 	err := s.db.Where("id = ?", id).First(&existing).Error
 	if err == nil {
@@ -29,13 +47,53 @@ func (s *KeyRepo) Create(id string, expiration time.Time, serializedKey string)
 		Id:            id,
 		Expiration:    expiration,
 		SerializedKey: serializedKey,
+		OwnerTokenId:  ownerTokenId,
+	}
+	if group != "" {
+		record.GroupName = &group
 	}
 
-	if err := s.db.Create(&record).Error; err != nil {
-		return fmt.Errorf("failed to create key record: %w", err)
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if maxLiveKeys > 0 {
+			if err := forUpdate(tx).Where("id = ?", ownerTokenId).Find(&[]models.ApiTokenRecord{}).Error; err != nil {
+				return fmt.Errorf("failed to lock API token: %w", err)
+			}
+
+			var liveKeys int64
+			err := tx.Model(&models.KeyRecord{}).
+				Where("owner_token_id = ? AND expiration >= ?", ownerTokenId, time.Now()).
+				Count(&liveKeys).Error
+			if err != nil {
+				return fmt.Errorf("failed to count live keys: %w", err)
+			}
+			if liveKeys >= maxLiveKeys {
+				return ErrLiveKeyLimitReached
+			}
+		}
+
+		if group != "" {
+			// Expired keys give up their group before the cleanup job removes them
+			err := tx.Model(&models.KeyRecord{}).
+				Where("owner_token_id = ? AND group_name = ? AND expiration < ?", ownerTokenId, group, time.Now()).
+				Update("group_name", nil).Error
+			if err != nil {
+				return fmt.Errorf("failed to release group of expired key: %w", err)
+			}
+		}
+
+		return tx.Create(&record).Error
+	})
+	if err == nil || errors.Is(err, ErrLiveKeyLimitReached) {
+		return err
 	}
 
-	return nil
+	// The unique index rejects a second live key in the group, also when it is created concurrently
+	if group != "" {
+		if taken, lookupErr := s.GetByGroup(ownerTokenId, group); lookupErr == nil && taken != nil {
+			return ErrKeyGroupTaken
+		}
+	}
+	return fmt.Errorf("failed to create key record: %w", err)
 }
 
 func (s *KeyRepo) GetById(id string) (*models.KeyRecord, error) {
@@ -50,18 +108,131 @@ func (s *KeyRepo) GetById(id string) (*models.KeyRecord, error) {
 	return &record, nil
 }
 
-func (s *KeyRepo) Delete(id string) error {
+// GetByGroup returns the key of the owner in the group, or nil if the group has no key
+func (s *KeyRepo) GetByGroup(ownerTokenId string, group string) (*models.KeyRecord, error) {
+	var record models.KeyRecord
+	err := s.db.Where("owner_token_id = ? AND group_name = ?", ownerTokenId, group).First(&record).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get key record of group: %w", err)
+	}
+
+	return &record, nil
+}
+
+func (s *KeyRepo) CountLiveByOwner(ownerTokenId string, now time.Time) (int64, error) {
+	var count int64
+	err := s.db.Model(&models.KeyRecord{}).
+		Where("owner_token_id = ? AND expiration >= ?", ownerTokenId, now).
+		Count(&count).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to count live keys: %w", err)
+	}
+
+	return count, nil
+}
+
+// MoveToRecentlyExpired replaces the key with a recently expired record.
+// Returns false if the key was already moved or deleted by someone else.
+func (s *KeyRepo) MoveToRecentlyExpired(id string) (bool, error) {
+	moved := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var record models.KeyRecord
+		err := forUpdate(tx).Where("id = ?", id).First(&record).Error
+		if err == gorm.ErrRecordNotFound {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to lock key record: %w", err)
+		}
+
+		expiredRecord := models.RecentlyExpiredRecord{
+			Id:         record.Id,
+			Expiration: record.Expiration,
+		}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&expiredRecord).Error; err != nil {
+			return fmt.Errorf("failed to create recently expired record: %w", err)
+		}
+
+		if err := tx.Where("id = ?", id).Delete(&models.KeyRecord{}).Error; err != nil {
+			return fmt.Errorf("failed to delete key record: %w", err)
+		}
+
+		moved = true
+		return nil
+	})
+
+	return moved, err
+}
+
+// Delete returns false if the key was already deleted by someone else
+func (s *KeyRepo) Delete(id string) (bool, error) {
 	result := s.db.Where("id = ?", id).Delete(&models.KeyRecord{})
 	if result.Error != nil {
-		return fmt.Errorf("failed to delete key record: %w", result.Error)
+		return false, fmt.Errorf("failed to delete key record: %w", result.Error)
 	}
-	return nil
+	return result.RowsAffected > 0, nil
 }
 
-func (s *KeyRepo) DeleteExpiredBefore(cutoffTime time.Time) error {
-	result := s.db.Where("expiration < ?", cutoffTime).Delete(&models.KeyRecord{})
+// DeleteOwned deletes the key only if it belongs to the owner. Returns false if there is no such key.
+func (s *KeyRepo) DeleteOwned(id string, ownerTokenId string) (bool, error) {
+	result := s.db.Where("id = ? AND owner_token_id = ?", id, ownerTokenId).Delete(&models.KeyRecord{})
 	if result.Error != nil {
-		return fmt.Errorf("failed to delete expired keys: %w", result.Error)
+		return false, fmt.Errorf("failed to delete key record: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// ListExpiredBefore returns up to limit keys that expired before the given time, oldest first
+func (s *KeyRepo) ListExpiredBefore(now time.Time, limit int) ([]models.KeyRecord, error) {
+	var records []models.KeyRecord
+	err := s.db.Where("expiration < ?", now).Order("expiration").Limit(limit).Find(&records).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list expired keys: %w", err)
+	}
+
+	return records, nil
+}
+
+// ListNotProtectedWith returns up to limit keys, ordered by id and starting after afterId, whose serialized key does not
+// start with the given data protection prefix
+func (s *KeyRepo) ListNotProtectedWith(prefix string, afterId string, limit int) ([]models.KeyRecord, error) {
+	var records []models.KeyRecord
+	err := notProtectedWith(s.db, prefix).
+		Where("id > ?", afterId).
+		Order("id").
+		Limit(limit).
+		Find(&records).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list keys to re-protect: %w", err)
 	}
-	return nil
+
+	return records, nil
+}
+
+func (s *KeyRepo) CountNotProtectedWith(prefix string) (int64, error) {
+	var count int64
+	if err := notProtectedWith(s.db.Model(&models.KeyRecord{}), prefix).Count(&count).Error; err != nil {
+		return 0, fmt.Errorf("failed to count keys to re-protect: %w", err)
+	}
+
+	return count, nil
+}
+
+// ReplaceSerializedKey stores a re-protected key, unless the stored value changed since it was read.
+// Returns false if the key was changed or deleted in the meantime.
+func (s *KeyRepo) ReplaceSerializedKey(id string, oldSerializedKey string, newSerializedKey string) (bool, error) {
+	result := s.db.Model(&models.KeyRecord{}).
+		Where("id = ? AND serialized_key = ?", id, oldSerializedKey).
+		Update("serialized_key", newSerializedKey)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to update serialized key: %w", result.Error)
+	}
+
+	return result.RowsAffected > 0, nil
+}
+
+// notProtectedWith compares a substring instead of using LIKE, so that key ids may contain wildcard characters
+func notProtectedWith(tx *gorm.DB, prefix string) *gorm.DB {
+	return tx.Where("SUBSTR(serialized_key, 1, ?) <> ?", utf8.RuneCountInString(prefix), prefix)
 }
@@ -0,0 +1,91 @@
+package repositories
+
+import (
+	"ForgettiServer/db/models"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type TokenUsageRepo struct {
+	db *gorm.DB
+}
+
+func NewTokenUsageRepo(db *gorm.DB) *TokenUsageRepo {
+	return &TokenUsageRepo{db: db}
+}
+
+// TryIncrementKeysCreated increments the daily counter of the token, unless it already reached the limit (0 = no limit).
+// The counter row is locked, so concurrent requests cannot exceed the limit.
+func (s *TokenUsageRepo) TryIncrementKeysCreated(tokenId string, day string, limit int64) (bool, error) {
+	incremented := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		record := models.TokenUsageRecord{
+			TokenId: tokenId,
+			Day:     day,
+		}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&record).Error; err != nil {
+			return fmt.Errorf("failed to create token usage record: %w", err)
+		}
+
+		if err := forUpdate(tx).Where("token_id = ? AND day = ?", tokenId, day).First(&record).Error; err != nil {
+			return fmt.Errorf("failed to lock token usage record: %w", err)
+		}
+
+		if limit > 0 && record.KeysCreated >= limit {
+			return nil
+		}
+
+		err := tx.Model(&models.TokenUsageRecord{}).
+			Where("token_id = ? AND day = ?", tokenId, day).
+			Update("keys_created", gorm.Expr("keys_created + 1")).Error
+		if err != nil {
+			return fmt.Errorf("failed to increment token usage: %w", err)
+		}
+
+		incremented = true
+		return nil
+	})
+
+	return incremented, err
+}
+
+// DecrementKeysCreated gives back a key counted by TryIncrementKeysCreated that was not created after all
+func (s *TokenUsageRepo) DecrementKeysCreated(tokenId string, day string) error {
+	err := s.db.Model(&models.TokenUsageRecord{}).
+		Where("token_id = ? AND day = ? AND keys_created > 0", tokenId, day).
+		Update("keys_created", gorm.Expr("keys_created - 1")).Error
+	if err != nil {
+		return fmt.Errorf("failed to decrement token usage: %w", err)
+	}
+	return nil
+}
+
+func (s *TokenUsageRepo) GetKeysCreated(tokenId string, day string) (int64, error) {
+	var record models.TokenUsageRecord
+	err := s.db.Where("token_id = ? AND day = ?", tokenId, day).First(&record).Error
+	if err == gorm.ErrRecordNotFound {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to get token usage: %w", err)
+	}
+
+	return record.KeysCreated, nil
+}
+
+func (s *TokenUsageRepo) DeleteForToken(tokenId string) error {
+	result := s.db.Where("token_id = ?", tokenId).Delete(&models.TokenUsageRecord{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete token usage: %w", result.Error)
+	}
+	return nil
+}
+
+func (s *TokenUsageRepo) DeleteBefore(day string) error {
+	result := s.db.Where("day < ?", day).Delete(&models.TokenUsageRecord{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete old token usage: %w", result.Error)
+	}
+	return nil
+}
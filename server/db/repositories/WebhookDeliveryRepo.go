@@ -0,0 +1,81 @@
+package repositories
+
+import (
+	"ForgettiServer/db/models"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type WebhookDeliveryRepo struct {
+	db *gorm.DB
+}
+
+func NewWebhookDeliveryRepo(db *gorm.DB) *WebhookDeliveryRepo {
+	return &WebhookDeliveryRepo{db: db}
+}
+
+// ClaimDue returns up to limit deliveries due at now, oldest first, and postpones them to leaseUntil, so that no other
+// replica delivers them at the same time. A delivery whose sender crashed is retried when the lease ends.
+func (s *WebhookDeliveryRepo) ClaimDue(now time.Time, leaseUntil time.Time, limit int) ([]models.WebhookDeliveryRecord, error) {
+	var records []models.WebhookDeliveryRecord
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		err := forUpdateSkipLocked(tx).Where("next_attempt_at <= ?", now).Order("id").Limit(limit).Find(&records).Error
+		if err != nil {
+			return fmt.Errorf("failed to list due webhook deliveries: %w", err)
+		}
+		if len(records) == 0 {
+			return nil
+		}
+
+		ids := make([]int64, len(records))
+		for i := range records {
+			ids[i] = records[i].Id
+		}
+		err = tx.Model(&models.WebhookDeliveryRecord{}).Where("id IN ?", ids).Update("next_attempt_at", leaseUntil).Error
+		if err != nil {
+			return fmt.Errorf("failed to claim webhook deliveries: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// Release gives up the claim of ClaimDue on deliveries that were not attempted, making them due at nextAttemptAt
+func (s *WebhookDeliveryRepo) Release(ids []int64, nextAttemptAt time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	err := s.db.Model(&models.WebhookDeliveryRecord{}).Where("id IN ?", ids).Update("next_attempt_at", nextAttemptAt).Error
+	if err != nil {
+		return fmt.Errorf("failed to release webhook deliveries: %w", err)
+	}
+	return nil
+}
+
+func (s *WebhookDeliveryRepo) Delete(id int64) error {
+	result := s.db.Where("id = ?", id).Delete(&models.WebhookDeliveryRecord{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete webhook delivery: %w", result.Error)
+	}
+	return nil
+}
+
+// RecordFailure stores a failed attempt and when to retry the delivery
+func (s *WebhookDeliveryRepo) RecordFailure(id int64, attempts int, nextAttemptAt time.Time, lastError string) error {
+	err := s.db.Model(&models.WebhookDeliveryRecord{}).Where("id = ?", id).Updates(map[string]any{
+		"attempts":        attempts,
+		"next_attempt_at": nextAttemptAt,
+		"last_error":      lastError,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to record webhook delivery failure: %w", err)
+	}
+	return nil
+}
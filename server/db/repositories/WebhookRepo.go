@@ -0,0 +1,128 @@
+package repositories
+
+import (
+	"ForgettiServer/db/models"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type WebhookRepo struct {
+	db *gorm.DB
+}
+
+func NewWebhookRepo(db *gorm.DB) *WebhookRepo {
+	return &WebhookRepo{db: db}
+}
+
+func (s *WebhookRepo) Create(keyId string, expiration time.Time, target string) error {
+	record := models.WebhookRecord{
+		KeyId:      keyId,
+		Expiration: expiration,
+		Target:     target,
+	}
+
+	if err := s.db.Create(&record).Error; err != nil {
+		return fmt.Errorf("failed to create webhook record: %w", err)
+	}
+
+	return nil
+}
+
+// GetByKeyId returns the webhook of the key, or nil if the key has none
+func (s *WebhookRepo) GetByKeyId(keyId string) (*models.WebhookRecord, error) {
+	var record models.WebhookRecord
+	err := s.db.Where("key_id = ?", keyId).First(&record).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get webhook record: %w", err)
+	}
+
+	return &record, nil
+}
+
+// ListExpiringSoon returns up to limit webhooks of keys expiring between now and threshold, that were not notified yet
+func (s *WebhookRepo) ListExpiringSoon(now time.Time, threshold time.Time, limit int) ([]models.WebhookRecord, error) {
+	var records []models.WebhookRecord
+	err := s.db.Where("expiring_soon_sent = ? AND expired_sent = ? AND expiration > ? AND expiration <= ?", false, false, now, threshold).
+		Order("expiration").
+		Limit(limit).
+		Find(&records).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhooks of keys expiring soon: %w", err)
+	}
+
+	return records, nil
+}
+
+// ListExpired returns up to limit webhooks of keys that expired before now, that were not notified yet
+func (s *WebhookRepo) ListExpired(now time.Time, limit int) ([]models.WebhookRecord, error) {
+	var records []models.WebhookRecord
+	err := s.db.Where("expired_sent = ? AND expiration <= ?", false, now).Order("expiration").Limit(limit).Find(&records).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhooks of expired keys: %w", err)
+	}
+
+	return records, nil
+}
+
+// ListExpiredBefore returns up to limit webhooks of keys that expired before the cutoff and were notified of it
+func (s *WebhookRepo) ListExpiredBefore(cutoffTime time.Time, limit int) ([]models.WebhookRecord, error) {
+	var records []models.WebhookRecord
+	err := s.db.Where("expired_sent = ? AND expiration < ?", true, cutoffTime).Order("expiration").Limit(limit).Find(&records).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhooks of destroyed keys: %w", err)
+	}
+
+	return records, nil
+}
+
+// MarkAndEnqueue sets the given sent flag of the webhook and queues the delivery, unless the flag was already set.
+// Returns false if another replica set it first.
+func (s *WebhookRepo) MarkAndEnqueue(keyId string, sentColumn string, delivery *models.WebhookDeliveryRecord) (bool, error) {
+	enqueued := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.WebhookRecord{}).
+			Where("key_id = ? AND "+sentColumn+" = ?", keyId, false).
+			Update(sentColumn, true)
+		if result.Error != nil {
+			return fmt.Errorf("failed to mark webhook: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		if err := tx.Create(delivery).Error; err != nil {
+			return fmt.Errorf("failed to queue webhook delivery: %w", err)
+		}
+		enqueued = true
+		return nil
+	})
+
+	return enqueued, err
+}
+
+// DeleteAndEnqueue deletes the webhook and queues its last delivery, unless it was already deleted.
+// Returns false if another replica deleted it first.
+func (s *WebhookRepo) DeleteAndEnqueue(keyId string, delivery *models.WebhookDeliveryRecord) (bool, error) {
+	enqueued := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("key_id = ?", keyId).Delete(&models.WebhookRecord{})
+		if result.Error != nil {
+			return fmt.Errorf("failed to delete webhook: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		if err := tx.Create(delivery).Error; err != nil {
+			return fmt.Errorf("failed to queue webhook delivery: %w", err)
+		}
+		enqueued = true
+		return nil
+	})
+
+	return enqueued, err
+}
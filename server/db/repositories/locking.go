@@ -0,0 +1,26 @@
+package repositories
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// forUpdate locks the selected rows until the end of the transaction, so that concurrent
+// replicas cannot both act on the same row. SQLite has no row locks, but it serializes
+// write transactions (see db.CreateDb), which gives the same guarantee.
+func forUpdate(tx *gorm.DB) *gorm.DB {
+	if tx.Dialector.Name() == "postgres" {
+		return tx.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate})
+	}
+
+	return tx
+}
+
+// forUpdateSkipLocked is forUpdate for work queues: rows locked by another replica are skipped instead of waited for
+func forUpdateSkipLocked(tx *gorm.DB) *gorm.DB {
+	if tx.Dialector.Name() == "postgres" {
+		return tx.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate, Options: clause.LockingOptionsSkipLocked})
+	}
+
+	return tx
+}
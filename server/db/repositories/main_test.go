@@ -0,0 +1,10 @@
+package repositories
+
+import (
+	"ForgettiServer/db/dbtest"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	dbtest.Main(m)
+}
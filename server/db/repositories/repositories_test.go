@@ -0,0 +1,255 @@
+package repositories
+
+import (
+	"ForgettiServer/config"
+	"ForgettiServer/db/dbtest"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func TestKeyRepoCreateGetDelete(t *testing.T) {
+	dbtest.ForEachDriver(t, func(t *testing.T, _ *config.Config, database *gorm.DB) {
+		repo := NewKeyRepo(database)
+		id := uuid.New().String()
+		expiration := time.Now().Add(time.Hour).Truncate(time.Second)
+
+		if err := repo.Create(id, expiration, "serialized", "owner", ""); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+		if err := repo.Create(id, expiration, "serialized", "owner", ""); err == nil {
+			t.Error("Create() with duplicate id did not fail")
+		}
+
+		record, err := repo.GetById(id)
+		if err != nil || record == nil {
+			t.Fatalf("GetById() = %v, %v", record, err)
+		}
+		if record.SerializedKey != "serialized" || record.OwnerTokenId != "owner" || !record.Expiration.Equal(expiration) {
+			t.Errorf("GetById() returned %+v", record)
+		}
+
+		if deleted, err := repo.Delete(id); err != nil || !deleted {
+			t.Fatalf("Delete() = %v, %v, want true, nil", deleted, err)
+		}
+		if record, err := repo.GetById(id); err != nil || record != nil {
+			t.Errorf("GetById() after Delete() = %v, %v, want nil, nil", record, err)
+		}
+	})
+}
+
+func TestKeyRepoCountLiveByOwner(t *testing.T) {
+	dbtest.ForEachDriver(t, func(t *testing.T, _ *config.Config, database *gorm.DB) {
+		repo := NewKeyRepo(database)
+		now := time.Now()
+
+		keys := []struct {
+			owner      string
+			expiration time.Time
+		}{
+			{"a", now.Add(time.Hour)},
+			{"a", now.Add(2 * time.Hour)},
+			{"a", now.Add(-time.Hour)},
+			{"b", now.Add(time.Hour)},
+			{"", now.Add(time.Hour)},
+		}
+		for _, key := range keys {
+			if err := repo.Create(uuid.New().String(), key.expiration, "serialized", key.owner, ""); err != nil {
+				t.Fatalf("Create() error = %v", err)
+			}
+		}
+
+		count, err := repo.CountLiveByOwner("a", now)
+		if err != nil {
+			t.Fatalf("CountLiveByOwner() error = %v", err)
+		}
+		if count != 2 {
+			t.Errorf("CountLiveByOwner() = %d, want 2", count)
+		}
+	})
+}
+
+func TestKeyRepoGroups(t *testing.T) {
+	dbtest.ForEachDriver(t, func(t *testing.T, _ *config.Config, database *gorm.DB) {
+		repo := NewKeyRepo(database)
+		now := time.Now()
+
+		expired := uuid.New().String()
+		if err := repo.Create(expired, now.Add(-time.Hour), "serialized", "a", "project"); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+
+		// The expired key releases the group
+		live := uuid.New().String()
+		if err := repo.Create(live, now.Add(time.Hour), "serialized", "a", "project"); err != nil {
+			t.Fatalf("Create() in group of expired key error = %v", err)
+		}
+		if err := repo.Create(uuid.New().String(), now.Add(time.Hour), "serialized", "a", "project"); !errors.Is(err, ErrKeyGroupTaken) {
+			t.Errorf("Create() in taken group error = %v, want %v", err, ErrKeyGroupTaken)
+		}
+
+		// Groups are per owner, and keys without a group never collide
+		for _, owner := range []string{"b", "a", "a"} {
+			group := "project"
+			if owner == "a" {
+				group = ""
+			}
+			if err := repo.Create(uuid.New().String(), now.Add(time.Hour), "serialized", owner, group); err != nil {
+				t.Errorf("Create() for owner %q in group %q error = %v", owner, group, err)
+			}
+		}
+
+		record, err := repo.GetByGroup("a", "project")
+		if err != nil || record == nil || record.Id != live {
+			t.Fatalf("GetByGroup() = %+v, %v, want key %s", record, err, live)
+		}
+
+		if deleted, err := repo.DeleteOwned(live, "b"); err != nil || deleted {
+			t.Errorf("DeleteOwned() by another owner = %v, %v, want false, nil", deleted, err)
+		}
+		if deleted, err := repo.DeleteOwned(live, "a"); err != nil || !deleted {
+			t.Errorf("DeleteOwned() = %v, %v, want true, nil", deleted, err)
+		}
+		if record, err := repo.GetByGroup("a", "project"); err != nil || record != nil {
+			t.Errorf("GetByGroup() after DeleteOwned() = %+v, %v, want nil, nil", record, err)
+		}
+	})
+}
+
+func TestKeyRepoMoveToRecentlyExpiredIsAtomic(t *testing.T) {
+	dbtest.ForEachDriver(t, func(t *testing.T, _ *config.Config, database *gorm.DB) {
+		keyRepo := NewKeyRepo(database)
+		recentlyExpiredRepo := NewRecentlyExpiredRepo(database)
+		id := uuid.New().String()
+		expiration := time.Now().Add(-time.Minute).Truncate(time.Second)
+
+		if err := keyRepo.Create(id, expiration, "serialized", "", ""); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+
+		const workers = 8
+		var wg sync.WaitGroup
+		results := make(chan bool, workers)
+		errors := make(chan error, workers)
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				moved, err := keyRepo.MoveToRecentlyExpired(id)
+				if err != nil {
+					errors <- err
+					return
+				}
+				results <- moved
+			}()
+		}
+		wg.Wait()
+		close(results)
+		close(errors)
+
+		for err := range errors {
+			t.Errorf("MoveToRecentlyExpired() error = %v", err)
+		}
+
+		movedCount := 0
+		for moved := range results {
+			if moved {
+				movedCount++
+			}
+		}
+		if movedCount != 1 {
+			t.Errorf("MoveToRecentlyExpired() succeeded %d times, want 1", movedCount)
+		}
+
+		if record, err := keyRepo.GetById(id); err != nil || record != nil {
+			t.Errorf("Key still present after move: %v, %v", record, err)
+		}
+		expiredRecord, err := recentlyExpiredRepo.GetById(id)
+		if err != nil || expiredRecord == nil {
+			t.Fatalf("Recently expired record missing: %v, %v", expiredRecord, err)
+		}
+		if !expiredRecord.Expiration.Equal(expiration) {
+			t.Errorf("Recently expired record has expiration %s, want %s", expiredRecord.Expiration, expiration)
+		}
+	})
+}
+
+func TestTokenUsageTryIncrementRespectsLimitUnderConcurrency(t *testing.T) {
+	dbtest.ForEachDriver(t, func(t *testing.T, _ *config.Config, database *gorm.DB) {
+		repo := NewTokenUsageRepo(database)
+		const limit = 5
+		const workers = 12
+
+		var wg sync.WaitGroup
+		results := make(chan bool, workers)
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				incremented, err := repo.TryIncrementKeysCreated("token", "2025-01-01", limit)
+				if err != nil {
+					t.Errorf("TryIncrementKeysCreated() error = %v", err)
+					return
+				}
+				results <- incremented
+			}()
+		}
+		wg.Wait()
+		close(results)
+
+		incrementedCount := 0
+		for incremented := range results {
+			if incremented {
+				incrementedCount++
+			}
+		}
+		if incrementedCount != limit {
+			t.Errorf("TryIncrementKeysCreated() succeeded %d times, want %d", incrementedCount, limit)
+		}
+
+		count, err := repo.GetKeysCreated("token", "2025-01-01")
+		if err != nil {
+			t.Fatalf("GetKeysCreated() error = %v", err)
+		}
+		if count != limit {
+			t.Errorf("GetKeysCreated() = %d, want %d", count, limit)
+		}
+	})
+}
+
+func TestApiTokenRepo(t *testing.T) {
+	dbtest.ForEachDriver(t, func(t *testing.T, _ *config.Config, database *gorm.DB) {
+		repo := NewApiTokenRepo(database)
+		id := uuid.New().String()
+
+		if _, err := repo.Create(id, "team", "hash", 1, 2, 3); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+
+		record, err := repo.GetByHash("hash")
+		if err != nil || record == nil || record.Id != id {
+			t.Fatalf("GetByHash() = %v, %v", record, err)
+		}
+
+		updated, err := repo.UpdateQuota(id, 10, 20, 30)
+		if err != nil || !updated {
+			t.Fatalf("UpdateQuota() = %t, %v", updated, err)
+		}
+		record, _ = repo.GetById(id)
+		if record.MaxLiveKeys != 10 || record.MaxExpirationHours != 20 || record.DailyKeyCap != 30 {
+			t.Errorf("Quota after UpdateQuota() = %d/%d/%d, want 10/20/30", record.MaxLiveKeys, record.MaxExpirationHours, record.DailyKeyCap)
+		}
+
+		deleted, err := repo.Delete(id)
+		if err != nil || !deleted {
+			t.Fatalf("Delete() = %t, %v", deleted, err)
+		}
+		if record, _ := repo.GetByHash("hash"); record != nil {
+			t.Error("Token still present after Delete()")
+		}
+	})
+}
@@ -2,8 +2,10 @@ package errors
 
 import (
 	"fmt"
+	"math"
 	"net/http"
 	"forgetti-common/dto"
+	"strconv"
 	"time"
 )
 
@@ -18,6 +20,11 @@ func (e *ApiError) Error() string {
 	return fmt.Sprintf("%s: %s", e.ErrorCode, e.Message)
 }
 
+// LoggedKeyIds lets loggers apply the key id privacy policy to the message
+func (e *ApiError) LoggedKeyIds() []string {
+	return []string{e.Data["key_id"]}
+}
+
 func (e *ApiError) ToResponse() *dto.ErrorResponse {
 	return &dto.ErrorResponse{
 		Message: e.Message,
@@ -49,6 +56,30 @@ func KeyExpiredError(keyId string, expiration time.Time) *ApiError {
 	}
 }
 
+func KeyGroupExistsError(group string, keyId string, expiration time.Time) *ApiError {
+	return &ApiError{
+		Message: fmt.Sprintf("key group %s already has the live key %s", group, keyId),
+		ErrorCode: "key-group-exists",
+		StatusCode: http.StatusConflict,
+		Data: map[string]string{
+			"group": group,
+			"key_id": keyId,
+			"expiration": expiration.Format(time.RFC3339),
+		},
+	}
+}
+
+func KeyGroupNotFoundError(group string) *ApiError {
+	return &ApiError{
+		Message: fmt.Sprintf("key group not found: %s", group),
+		ErrorCode: "key-group-not-found",
+		StatusCode: http.StatusNotFound,
+		Data: map[string]string{
+			"group": group,
+		},
+	}
+}
+
 func BadRequestError(err error) *ApiError {
 	return &ApiError{
 		Message: fmt.Sprintf("failed to parse request: %s", err.Error()),
@@ -60,6 +91,47 @@ func BadRequestError(err error) *ApiError {
 	}
 }
 
+func UnauthorizedError(reason string) *ApiError {
+	return &ApiError{
+		Message: fmt.Sprintf("unauthorized: %s", reason),
+		ErrorCode: "unauthorized",
+		StatusCode: http.StatusUnauthorized,
+		Data: map[string]string{
+			"reason": reason,
+		},
+	}
+}
+
+func QuotaExceededError(quota string, limit string) *ApiError {
+	return &ApiError{
+		Message: fmt.Sprintf("quota exceeded: %s (limit: %s)", quota, limit),
+		ErrorCode: "quota-exceeded",
+		StatusCode: http.StatusForbidden,
+		Data: map[string]string{
+			"quota": quota,
+			"limit": limit,
+		},
+	}
+}
+
+func RateLimitedError(scope string, retryAfter time.Duration) *ApiError {
+	retryAfterSeconds := RetryAfterSeconds(retryAfter)
+	return &ApiError{
+		Message: fmt.Sprintf("too many requests (%s), retry after %d seconds", scope, retryAfterSeconds),
+		ErrorCode: "rate-limited",
+		StatusCode: http.StatusTooManyRequests,
+		Data: map[string]string{
+			"scope": scope,
+			"retry_after": strconv.Itoa(retryAfterSeconds),
+		},
+	}
+}
+
+// RetryAfterSeconds rounds the duration up to whole seconds, as used by the Retry-After header
+func RetryAfterSeconds(retryAfter time.Duration) int {
+	return max(1, int(math.Ceil(retryAfter.Seconds())))
+}
+
 func InternalServerError(err error) *ApiError {
 	return &ApiError{
 		Message: fmt.Sprintf("internal server error: %s", err.Error()),
@@ -0,0 +1,57 @@
+package keywrap
+
+import (
+	"encoding/base64"
+	"fmt"
+	"forgetti-common/crypto"
+	"os"
+	"strings"
+)
+
+// FileKeyWrapper wraps data keys with a master secret read from a file, which can live on a different volume
+// or secrets mount than the database
+type FileKeyWrapper struct {
+	masterKey []byte
+}
+
+func NewFileKeyWrapper(path string) (*FileKeyWrapper, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read master key file: %w", err)
+	}
+
+	secret := strings.TrimSpace(string(contents))
+	if secret == "" {
+		return nil, fmt.Errorf("master key file %s is empty", path)
+	}
+
+	masterKey, err := crypto.HashToSize(secret, "key_wrap", 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive master key: %w", err)
+	}
+
+	return &FileKeyWrapper{masterKey: masterKey}, nil
+}
+
+func (f *FileKeyWrapper) WrapKey(dataKey []byte) (string, error) {
+	wrapped, err := crypto.EncryptAes256(dataKey, f.masterKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to wrap data key: %w", err)
+	}
+
+	return base64.StdEncoding.EncodeToString(wrapped), nil
+}
+
+func (f *FileKeyWrapper) UnwrapKey(wrappedKey string) ([]byte, error) {
+	wrapped, err := base64.StdEncoding.DecodeString(wrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode wrapped data key: %w", err)
+	}
+
+	dataKey, err := crypto.DecryptAes256(wrapped, f.masterKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+
+	return dataKey, nil
+}
@@ -0,0 +1,30 @@
+// Package keywrap encrypts data keys with a master key that is kept outside of the database.
+package keywrap
+
+import (
+	"ForgettiServer/config"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// KeyWrapper encrypts and decrypts data keys with a master key it manages
+type KeyWrapper interface {
+	// WrapKey returns the encrypted data key. The result never contains '$'.
+	WrapKey(dataKey []byte) (string, error)
+	UnwrapKey(wrappedKey string) ([]byte, error)
+}
+
+// NewKeyWrapper creates the provider configured in data_protection.envelope
+func NewKeyWrapper(cfg *config.Config) (KeyWrapper, error) {
+	envelope := cfg.DataProtection.Envelope
+	switch envelope.Provider {
+	case "file":
+		return NewFileKeyWrapper(envelope.KeyFile)
+	case "vault":
+		client := &http.Client{Timeout: time.Duration(envelope.Vault.TimeoutSeconds) * time.Second}
+		return NewVaultTransitKeyWrapper(envelope.Vault.Address, envelope.Vault.Token, envelope.Vault.Mount, envelope.Vault.KeyName, client), nil
+	default:
+		return nil, fmt.Errorf("unsupported key wrapping provider: '%s'", envelope.Provider)
+	}
+}
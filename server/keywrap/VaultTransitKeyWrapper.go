@@ -0,0 +1,111 @@
+package keywrap
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// VaultTransitKeyWrapper wraps data keys with a key that never leaves a Vault transit secrets engine
+type VaultTransitKeyWrapper struct {
+	address string
+	token   string
+	mount   string
+	keyName string
+	client  *http.Client
+}
+
+type vaultEncryptRequest struct {
+	Plaintext string `json:"plaintext"`
+}
+
+type vaultDecryptRequest struct {
+	Ciphertext string `json:"ciphertext"`
+}
+
+type vaultResponse struct {
+	Data struct {
+		Ciphertext string `json:"ciphertext"`
+		Plaintext  string `json:"plaintext"`
+	} `json:"data"`
+	Errors []string `json:"errors"`
+}
+
+func NewVaultTransitKeyWrapper(address string, token string, mount string, keyName string, client *http.Client) *VaultTransitKeyWrapper {
+	return &VaultTransitKeyWrapper{
+		address: strings.TrimSuffix(address, "/"),
+		token:   token,
+		mount:   strings.Trim(mount, "/"),
+		keyName: keyName,
+		client:  client,
+	}
+}
+
+func (v *VaultTransitKeyWrapper) WrapKey(dataKey []byte) (string, error) {
+	response, err := v.post("encrypt", vaultEncryptRequest{Plaintext: base64.StdEncoding.EncodeToString(dataKey)})
+	if err != nil {
+		return "", fmt.Errorf("failed to wrap data key: %w", err)
+	}
+
+	ciphertext := response.Data.Ciphertext
+	if ciphertext == "" || strings.Contains(ciphertext, "$") {
+		return "", fmt.Errorf("failed to wrap data key: unexpected ciphertext '%s'", ciphertext)
+	}
+
+	return ciphertext, nil
+}
+
+func (v *VaultTransitKeyWrapper) UnwrapKey(wrappedKey string) ([]byte, error) {
+	response, err := v.post("decrypt", vaultDecryptRequest{Ciphertext: wrappedKey})
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+
+	dataKey, err := base64.StdEncoding.DecodeString(response.Data.Plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode unwrapped data key: %w", err)
+	}
+
+	return dataKey, nil
+}
+
+func (v *VaultTransitKeyWrapper) post(operation string, body any) (*vaultResponse, error) {
+	requestBody, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("%s/v1/%s/%s/%s", v.address, v.mount, operation, v.keyName)
+	request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(requestBody))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Vault-Token", v.token)
+
+	response, err := v.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("vault request failed: %w", err)
+	}
+	defer response.Body.Close()
+
+	responseBody, err := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vault response: %w", err)
+	}
+
+	var result vaultResponse
+	if err := json.Unmarshal(responseBody, &result); err != nil && response.StatusCode == http.StatusOK {
+		return nil, fmt.Errorf("failed to parse vault response: %w", err)
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("vault %s returned status %d: %s", operation, response.StatusCode, strings.Join(result.Errors, "; "))
+	}
+
+	return &result, nil
+}
@@ -0,0 +1,120 @@
+package keywrap
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestFileKeyWrapper(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "master.key")
+	otherKeyFile := filepath.Join(dir, "other.key")
+	os.WriteFile(keyFile, []byte("master secret\n"), 0600)
+	os.WriteFile(otherKeyFile, []byte("other secret"), 0600)
+
+	wrapper, err := NewFileKeyWrapper(keyFile)
+	if err != nil {
+		t.Fatalf("NewFileKeyWrapper() error = %v", err)
+	}
+
+	dataKey := bytes.Repeat([]byte{7}, 32)
+	wrapped, err := wrapper.WrapKey(dataKey)
+	if err != nil {
+		t.Fatalf("WrapKey() error = %v", err)
+	}
+	if strings.Contains(wrapped, "$") {
+		t.Errorf("WrapKey() = %s, must not contain '$'", wrapped)
+	}
+
+	unwrapped, err := wrapper.UnwrapKey(wrapped)
+	if err != nil || !bytes.Equal(unwrapped, dataKey) {
+		t.Errorf("UnwrapKey() = %v, %v, want %v", unwrapped, err, dataKey)
+	}
+
+	otherWrapper, _ := NewFileKeyWrapper(otherKeyFile)
+	if _, err := otherWrapper.UnwrapKey(wrapped); err == nil {
+		t.Error("UnwrapKey() with another master key did not fail")
+	}
+
+	if _, err := NewFileKeyWrapper(filepath.Join(dir, "missing.key")); err == nil {
+		t.Error("NewFileKeyWrapper() with missing file did not fail")
+	}
+}
+
+// vaultTransitStub implements the encrypt and decrypt endpoints of the Vault transit secrets engine
+type vaultTransitStub struct {
+	token string
+	mutex sync.Mutex
+	keys  map[string]string // ciphertext -> base64 plaintext
+}
+
+func (v *vaultTransitStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Vault-Token") != v.token {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]any{"errors": []string{"permission denied"}})
+		return
+	}
+
+	var body map[string]string
+	json.NewDecoder(r.Body).Decode(&body)
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	switch r.URL.Path {
+	case "/v1/transit/encrypt/forgetti":
+		ciphertext := "vault:v1:" + base64.StdEncoding.EncodeToString([]byte(body["plaintext"]))[:16] + string(rune('a'+len(v.keys)))
+		v.keys[ciphertext] = body["plaintext"]
+		json.NewEncoder(w).Encode(map[string]any{"data": map[string]string{"ciphertext": ciphertext}})
+	case "/v1/transit/decrypt/forgetti":
+		plaintext, ok := v.keys[body["ciphertext"]]
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]any{"errors": []string{"invalid ciphertext"}})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"data": map[string]string{"plaintext": plaintext}})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]any{"errors": []string{}})
+	}
+}
+
+func TestVaultTransitKeyWrapper(t *testing.T) {
+	stub := &vaultTransitStub{token: "vault-token", keys: map[string]string{}}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	wrapper := NewVaultTransitKeyWrapper(server.URL+"/", "vault-token", "/transit/", "forgetti", server.Client())
+
+	dataKey := bytes.Repeat([]byte{42}, 32)
+	wrapped, err := wrapper.WrapKey(dataKey)
+	if err != nil {
+		t.Fatalf("WrapKey() error = %v", err)
+	}
+	if !strings.HasPrefix(wrapped, "vault:v1:") {
+		t.Errorf("WrapKey() = %s, want vault ciphertext", wrapped)
+	}
+
+	unwrapped, err := wrapper.UnwrapKey(wrapped)
+	if err != nil || !bytes.Equal(unwrapped, dataKey) {
+		t.Errorf("UnwrapKey() = %v, %v, want %v", unwrapped, err, dataKey)
+	}
+
+	if _, err := wrapper.UnwrapKey("vault:v1:unknown"); err == nil || !strings.Contains(err.Error(), "invalid ciphertext") {
+		t.Errorf("UnwrapKey() of unknown ciphertext error = %v, want vault error", err)
+	}
+
+	unauthorized := NewVaultTransitKeyWrapper(server.URL, "wrong-token", "transit", "forgetti", server.Client())
+	if _, err := unauthorized.WrapKey(dataKey); err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Errorf("WrapKey() with wrong token error = %v, want permission denied", err)
+	}
+}
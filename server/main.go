@@ -1,12 +1,17 @@
 package main
 
 import (
+	"ForgettiServer/admin"
 	"ForgettiServer/config"
 	"ForgettiServer/routes"
 	"ForgettiServer/services"
 	"fmt"
 	"log"
+	"net"
+	"net/http"
+	"os"
 	"path/filepath"
+	"time"
 
 	"forgetti-common/logging"
 
@@ -22,6 +27,16 @@ func main() {
 	}
 	
 	setupLogging(cfg)
+
+	if args := os.Args[1:]; admin.IsAdminCommand(args) {
+		err := admin.Run(args, cfg)
+		logging.Close()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 	
 	logger := logging.MakeLogger("main")
 	logger.Verbose("Logging configured successfully")
@@ -30,7 +45,8 @@ func main() {
 	gin.SetMode(cfg.Server.Mode)
 	logger.Verbose("Gin mode set to: %s", cfg.Server.Mode)
 
-	r := gin.Default()
+	r := gin.New()
+	r.Use(gin.Recovery(), routes.RequestId(), routes.AccessLog())
 	logger.Verbose("Gin router initialized")
 
 	logger.Verbose("Creating service container...")
@@ -47,9 +63,53 @@ func main() {
 
 	addr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
 	logger.Info("Starting server on %s in %s mode", addr, cfg.Server.Mode)
-	if err := r.Run(addr); err != nil {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
 		logger.Error("Failed to start server: %v", err)
+		shutdown(serviceContainer)
+		os.Exit(1)
+	}
+
+	serviceContainer.Sweeper.Start()
+	serviceContainer.WebhookDispatcher.Start()
+
+	srv := &http.Server{Handler: r}
+	drainTimeout := time.Duration(cfg.Server.ShutdownTimeoutSeconds) * time.Second
+	if err := serve(srv, listener, drainTimeout, nil); err != nil {
+		logger.Error("%v", err)
 	}
+
+	shutdown(serviceContainer)
+}
+
+func shutdown(serviceContainer *services.ServiceContainer) {
+	logger := logging.MakeLogger("main.shutdown")
+	logger.Info("Shutting down Forgetti Server...")
+
+	serviceContainer.WebhookDispatcher.Stop()
+	serviceContainer.Sweeper.Stop()
+
+	logger.Verbose("Closing database connection")
+	if err := serviceContainer.DatabaseService.Close(); err != nil {
+		logger.Error("Failed to close database connection: %v", err)
+	}
+
+	logger.Info("Shutdown complete")
+	if err := logging.Close(); err != nil {
+		log.Printf("Failed to close log file: %v", err)
+	}
+}
+
+var keyIdPolicies = map[string]logging.KeyIdPolicy{
+	"plain": logging.KeyIdsPlain,
+	"hash":  logging.KeyIdsHashed,
+	"drop":  logging.KeyIdsDropped,
+}
+
+var clientIpPolicies = map[string]logging.ClientIpPolicy{
+	"plain":    logging.ClientIpsPlain,
+	"truncate": logging.ClientIpsTruncated,
+	"drop":     logging.ClientIpsDropped,
 }
 
 func setupLogging(cfg *config.Config) {
@@ -65,19 +125,39 @@ func setupLogging(cfg *config.Config) {
 		logLevel = logging.LogLevelVerbose
 	case "info":
 		logLevel = logging.LogLevelInfo
-	case "warn", "error":
+	case "warn":
+		logLevel = logging.LogLevelWarning
+	case "error":
 		logLevel = logging.LogLevelError
 	}
 
+	logFormat := logging.LogFormatText
+	if cfg.Logging.Format == "json" {
+		logFormat = logging.LogFormatJson
+	}
+
+	privacy, err := logging.NewPrivacy(keyIdPolicies[cfg.Logging.Privacy.KeyIds], clientIpPolicies[cfg.Logging.Privacy.ClientIps], cfg.Logging.Privacy.KeyIdHashSecret)
+	if err != nil {
+		logger.Error("Failed to configure logging privacy: %v", err)
+		privacy = logging.Privacy{KeyIds: logging.KeyIdsDropped, ClientIps: logging.ClientIpsDropped}
+	}
+
 	logFile := ""
 	if cfg.Logging.LogFile != "" {
 		logFile = filepath.Join(cfg.Logging.LogDirectory, cfg.Logging.LogFile)
 		logger.Info("Configuring file logging to: %s", logFile)
 	}
 
-	err := logging.SetGlobalConfig(logging.Config{
+	err = logging.SetGlobalConfig(logging.Config{
 		LogLevel: logLevel,
+		Format:   logFormat,
 		LogFile:  logFile,
+		Rotation: logging.RotationConfig{
+			MaxSizeBytes: int64(cfg.Logging.MaxSizeMB) * 1024 * 1024,
+			MaxAge:       time.Duration(cfg.Logging.MaxAgeHours) * time.Hour,
+			MaxBackups:   cfg.Logging.MaxBackups,
+		},
+		Privacy: privacy,
 	})
 	if err != nil {
 		logger.Error("Failed to configure logging: %v", err)
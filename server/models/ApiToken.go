@@ -0,0 +1,33 @@
+package models
+
+import (
+	"ForgettiServer/db/models"
+	"time"
+)
+
+type ApiToken struct {
+	Id        string
+	Name      string
+	CreatedAt time.Time
+	Quota     TokenQuota
+}
+
+// TokenQuota holds the limits of a token - zero values mean no token-specific limit
+type TokenQuota struct {
+	MaxLiveKeys   int
+	MaxExpiration time.Duration
+	DailyKeyCap   int
+}
+
+func ApiTokenFromDbModel(model *models.ApiTokenRecord) *ApiToken {
+	return &ApiToken{
+		Id:        model.Id,
+		Name:      model.Name,
+		CreatedAt: model.CreatedAt,
+		Quota: TokenQuota{
+			MaxLiveKeys:   model.MaxLiveKeys,
+			MaxExpiration: time.Duration(model.MaxExpirationHours) * time.Hour,
+			DailyKeyCap:   model.DailyKeyCap,
+		},
+	}
+}
@@ -13,6 +13,8 @@ type BoradcastKey struct {
 	KeyId uuid.UUID
 	Expiration time.Time
 	Key *crypto.PublicKey
+	OwnerTokenId string // empty for keys created without an API token
+	Group string // empty for keys outside of a group
 }
 
 func FromDbModel(model *models.KeyRecord, unprotect func(string) (string, error)) (*BoradcastKey, error) {
@@ -31,9 +33,16 @@ func FromDbModel(model *models.KeyRecord, unprotect func(string) (string, error)
 		return nil, fmt.Errorf("failed to parse key ID: %w", err)
 	}
 
+	group := ""
+	if model.GroupName != nil {
+		group = *model.GroupName
+	}
+
 	return &BoradcastKey{
 		KeyId: parsedKeyId,
 		Expiration: model.Expiration,
 		Key: publicKey,
+		OwnerTokenId: model.OwnerTokenId,
+		Group: group,
 	}, nil
 }
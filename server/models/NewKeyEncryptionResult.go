@@ -10,4 +10,5 @@ type NewKeyEncryptionResult struct {
 	Expiration time.Time
 	VerificationKey *crypto.PrivateKey
 	EncryptedContent string
+	Group string
 }
@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+type TokenUsage struct {
+	Token            *ApiToken
+	LiveKeys         int64
+	KeysCreatedToday int64
+	MaxExpiration    time.Duration
+}
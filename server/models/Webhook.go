@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// WebhookTarget is where the notifications about a key are sent
+type WebhookTarget struct {
+	Url    string `json:"url"`
+	Secret string `json:"secret"`
+}
+
+// WebhookPayload is the body of a webhook notification
+type WebhookPayload struct {
+	Event      string    `json:"event"`
+	KeyId      string    `json:"key_id"`
+	Expiration time.Time `json:"expiration"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
@@ -0,0 +1,128 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const pruneInterval = time.Minute
+
+type Config struct {
+	RequestsPerMinute int
+	Burst             int
+	LockoutThreshold  int // rejections within LockoutDuration that lock the key out; 0 disables lockout
+	LockoutDuration   time.Duration
+}
+
+// Limiter keeps a separate token bucket for every key (client IP, key id, ...)
+type Limiter struct {
+	config    Config
+	buckets   map[string]*bucket
+	mutex     sync.Mutex
+	now       func() time.Time
+	lastPrune time.Time
+}
+
+type bucket struct {
+	tokens          float64
+	updatedAt       time.Time
+	rejections      int
+	firstRejectedAt time.Time
+	lockedUntil     time.Time
+}
+
+func NewLimiter(config Config) *Limiter {
+	return newLimiterWithClock(config, time.Now)
+}
+
+func newLimiterWithClock(config Config, now func() time.Time) *Limiter {
+	return &Limiter{
+		config:    config,
+		buckets:   make(map[string]*bucket),
+		now:       now,
+		lastPrune: now(),
+	}
+}
+
+// Allow consumes a token for the given key.
+// If the request is rejected, the returned duration says how long the client should wait before retrying.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	l.pruneIfNeeded(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.config.Burst), updatedAt: now}
+		l.buckets[key] = b
+	}
+
+	if now.Before(b.lockedUntil) {
+		return false, b.lockedUntil.Sub(now)
+	}
+
+	b.tokens = math.Min(float64(l.config.Burst), b.tokens+now.Sub(b.updatedAt).Minutes()*float64(l.config.RequestsPerMinute))
+	b.updatedAt = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	if l.registerRejection(b, now) {
+		return false, b.lockedUntil.Sub(now)
+	}
+
+	return false, l.timeUntilNextToken(b)
+}
+
+// registerRejection counts the rejection and locks the bucket out if there were too many of them
+func (l *Limiter) registerRejection(b *bucket, now time.Time) bool {
+	if l.config.LockoutThreshold <= 0 {
+		return false
+	}
+
+	if !l.countsRejections(b, now) {
+		b.rejections = 0
+		b.firstRejectedAt = now
+	}
+
+	b.rejections++
+	if b.rejections < l.config.LockoutThreshold {
+		return false
+	}
+
+	b.rejections = 0
+	b.lockedUntil = now.Add(l.config.LockoutDuration)
+	return true
+}
+
+// countsRejections reports whether earlier rejections of the bucket still count towards a lockout
+func (l *Limiter) countsRejections(b *bucket, now time.Time) bool {
+	return b.rejections > 0 && now.Sub(b.firstRejectedAt) <= l.config.LockoutDuration
+}
+
+func (l *Limiter) timeUntilNextToken(b *bucket) time.Duration {
+	missing := 1 - b.tokens
+	perToken := time.Minute / time.Duration(l.config.RequestsPerMinute)
+	return time.Duration(missing * float64(perToken))
+}
+
+// pruneIfNeeded drops buckets that are full, not locked and whose rejections no longer count - they behave the same
+// as new ones
+func (l *Limiter) pruneIfNeeded(now time.Time) {
+	if now.Sub(l.lastPrune) < pruneInterval {
+		return
+	}
+	l.lastPrune = now
+
+	for key, b := range l.buckets {
+		refilled := b.tokens + now.Sub(b.updatedAt).Minutes()*float64(l.config.RequestsPerMinute)
+		if refilled >= float64(l.config.Burst) && !now.Before(b.lockedUntil) && !l.countsRejections(b, now) {
+			delete(l.buckets, key)
+		}
+	}
+}
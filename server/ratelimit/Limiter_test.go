@@ -0,0 +1,139 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestLimiter(config Config) (*Limiter, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	return newLimiterWithClock(config, clock.Now), clock
+}
+
+func TestAllowsBurstThenRejects(t *testing.T) {
+	limiter, _ := newTestLimiter(Config{RequestsPerMinute: 60, Burst: 3})
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := limiter.Allow("client"); !ok {
+			t.Fatalf("Allow() rejected request %d within burst", i+1)
+		}
+	}
+
+	ok, retryAfter := limiter.Allow("client")
+	if ok {
+		t.Fatal("Allow() accepted request over burst")
+	}
+	if retryAfter <= 0 || retryAfter > time.Second {
+		t.Errorf("Allow() retryAfter = %s, want (0, 1s]", retryAfter)
+	}
+}
+
+func TestRefillsOverTime(t *testing.T) {
+	limiter, clock := newTestLimiter(Config{RequestsPerMinute: 60, Burst: 1})
+
+	if ok, _ := limiter.Allow("client"); !ok {
+		t.Fatal("Allow() rejected first request")
+	}
+	if ok, _ := limiter.Allow("client"); ok {
+		t.Fatal("Allow() accepted request with empty bucket")
+	}
+
+	clock.Advance(time.Second)
+	if ok, _ := limiter.Allow("client"); !ok {
+		t.Error("Allow() rejected request after refill")
+	}
+}
+
+func TestKeysAreIndependent(t *testing.T) {
+	limiter, _ := newTestLimiter(Config{RequestsPerMinute: 1, Burst: 1})
+
+	if ok, _ := limiter.Allow("a"); !ok {
+		t.Fatal("Allow() rejected first request for 'a'")
+	}
+	if ok, _ := limiter.Allow("b"); !ok {
+		t.Error("Allow() rejected first request for 'b' after 'a' was exhausted")
+	}
+}
+
+func TestLocksOutAfterRepeatedRejections(t *testing.T) {
+	limiter, clock := newTestLimiter(Config{
+		RequestsPerMinute: 60,
+		Burst:             1,
+		LockoutThreshold:  3,
+		LockoutDuration:   10 * time.Minute,
+	})
+
+	limiter.Allow("key")
+	for i := 0; i < 2; i++ {
+		if ok, retryAfter := limiter.Allow("key"); ok || retryAfter > time.Second {
+			t.Fatalf("Allow() = %t, %s before lockout threshold", ok, retryAfter)
+		}
+	}
+
+	ok, retryAfter := limiter.Allow("key")
+	if ok || retryAfter != 10*time.Minute {
+		t.Fatalf("Allow() = %t, %s, want lockout for 10m", ok, retryAfter)
+	}
+
+	clock.Advance(5 * time.Minute)
+	if ok, retryAfter := limiter.Allow("key"); ok || retryAfter != 5*time.Minute {
+		t.Errorf("Allow() = %t, %s during lockout, want rejection for 5m", ok, retryAfter)
+	}
+
+	clock.Advance(5 * time.Minute)
+	if ok, _ := limiter.Allow("key"); !ok {
+		t.Error("Allow() rejected request after lockout ended")
+	}
+}
+
+func TestPrunesIdleBuckets(t *testing.T) {
+	limiter, clock := newTestLimiter(Config{RequestsPerMinute: 60, Burst: 1})
+
+	limiter.Allow("idle")
+	clock.Advance(2 * pruneInterval)
+	limiter.Allow("active")
+
+	if _, ok := limiter.buckets["idle"]; ok {
+		t.Error("Idle bucket was not pruned")
+	}
+	if _, ok := limiter.buckets["active"]; !ok {
+		t.Error("Active bucket was pruned")
+	}
+}
+
+func TestPrunesBucketsWithExpiredRejections(t *testing.T) {
+	limiter, clock := newTestLimiter(Config{
+		RequestsPerMinute: 60,
+		Burst:             1,
+		LockoutThreshold:  3,
+		LockoutDuration:   10 * time.Minute,
+	})
+
+	// Rejected once below the lockout threshold, and never seen again
+	limiter.Allow("rejected")
+	limiter.Allow("rejected")
+
+	clock.Advance(2 * pruneInterval)
+	limiter.Allow("active")
+	if _, ok := limiter.buckets["rejected"]; !ok {
+		t.Fatal("Bucket was pruned while its rejection still counts towards a lockout")
+	}
+
+	clock.Advance(10 * time.Minute)
+	limiter.Allow("active")
+	if _, ok := limiter.buckets["rejected"]; ok {
+		t.Error("Bucket was not pruned after its rejection expired")
+	}
+}
@@ -0,0 +1,65 @@
+package routes
+
+import (
+	apiErrors "ForgettiServer/errors"
+	"ForgettiServer/models"
+	"ForgettiServer/services"
+	"forgetti-common/logging"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const apiTokenContextKey = "api_token"
+
+// authenticate resolves the bearer token of the request, if any.
+// Invalid tokens are always rejected, missing ones only if the token is required.
+func authenticate(s *services.ServiceContainer, required bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		logger := requestLogger(c, "routes.authenticate")
+
+		header := c.GetHeader("Authorization")
+		if header == "" {
+			if required {
+				logger.Info("Rejected request without API token from %s", logging.ClientIp(c.ClientIP()))
+				abortWithError(c, apiErrors.UnauthorizedError("API token is required"))
+				return
+			}
+
+			c.Next()
+			return
+		}
+
+		token, found := strings.CutPrefix(header, "Bearer ")
+		if !found || token == "" {
+			abortWithError(c, apiErrors.UnauthorizedError("malformed Authorization header, expected 'Bearer <token>'"))
+			return
+		}
+
+		apiToken, err := s.TokenService.Authenticate(token)
+		if err != nil {
+			logger.Error("Failed to authenticate API token: %v", err)
+			abortWithError(c, err)
+			return
+		}
+		if apiToken == nil {
+			logger.Info("Rejected request with invalid API token from %s", logging.ClientIp(c.ClientIP()))
+			abortWithError(c, apiErrors.UnauthorizedError("invalid API token"))
+			return
+		}
+
+		logger.Verbose("Authenticated API token '%s' (%s)", apiToken.Name, apiToken.Id)
+		c.Set(apiTokenContextKey, apiToken)
+		c.Next()
+	}
+}
+
+// getApiToken returns the token authenticated for the request, or nil for anonymous requests
+func getApiToken(c *gin.Context) *models.ApiToken {
+	value, ok := c.Get(apiTokenContextKey)
+	if !ok {
+		return nil
+	}
+
+	return value.(*models.ApiToken)
+}
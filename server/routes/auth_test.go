@@ -0,0 +1,120 @@
+package routes
+
+import (
+	"ForgettiServer/config"
+	"ForgettiServer/db/dbtest"
+	"ForgettiServer/models"
+	"ForgettiServer/services"
+	"encoding/json"
+	"forgetti-common/constants"
+	"forgetti-common/dto"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// newEncRouter serves the encryption routes of a new service container
+func newEncRouter(t *testing.T, cfg *config.Config) (*gin.Engine, *services.ServiceContainer) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	container, err := services.CreateServiceContainer(cfg)
+	if err != nil {
+		t.Fatalf("CreateServiceContainer() error = %v", err)
+	}
+
+	router := gin.New()
+	AddEncRoutes(router, container)
+	return router, container
+}
+
+// get sends a GET request with the given Authorization header, if any
+func get(router *gin.Engine, route string, authorization string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodGet, route, nil)
+	if authorization != "" {
+		request.Header.Set("Authorization", authorization)
+	}
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestAuthenticateRejectsInvalidTokens(t *testing.T) {
+	dbtest.ForEachDriver(t, func(t *testing.T, cfg *config.Config, database *gorm.DB) {
+		router, container := newEncRouter(t, cfg)
+
+		revoked, record, err := container.TokenService.CreateToken("revoked", models.TokenQuota{})
+		if err != nil {
+			t.Fatalf("CreateToken() error = %v", err)
+		}
+		if err := container.TokenService.RevokeToken(record.Id); err != nil {
+			t.Fatalf("RevokeToken() error = %v", err)
+		}
+
+		tests := []struct {
+			name          string
+			authorization string
+		}{
+			{"missing", ""},
+			{"malformed", "Basic dXNlcjpwYXNz"},
+			{"empty", "Bearer "},
+			{"unknown", "Bearer fgt_unknown"},
+			{"revoked", "Bearer " + revoked},
+		}
+
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				recorder := get(router, constants.UsageRoute, test.authorization)
+				if recorder.Code != http.StatusUnauthorized {
+					t.Fatalf("Response = %d %s, want %d", recorder.Code, recorder.Body.String(), http.StatusUnauthorized)
+				}
+
+				var response dto.ErrorResponse
+				if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil || response.ErrorCode != "unauthorized" {
+					t.Errorf("Response body = %s, want error code unauthorized", recorder.Body.String())
+				}
+			})
+		}
+	})
+}
+
+func TestAuthenticateAcceptsValidToken(t *testing.T) {
+	dbtest.ForEachDriver(t, func(t *testing.T, cfg *config.Config, database *gorm.DB) {
+		router, container := newEncRouter(t, cfg)
+
+		token, _, err := container.TokenService.CreateToken("ci", models.TokenQuota{MaxLiveKeys: 5})
+		if err != nil {
+			t.Fatalf("CreateToken() error = %v", err)
+		}
+
+		recorder := get(router, constants.UsageRoute, "Bearer "+token)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("Response = %d %s, want %d", recorder.Code, recorder.Body.String(), http.StatusOK)
+		}
+
+		var response dto.UsageResponse
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to parse response %s: %v", recorder.Body.String(), err)
+		}
+		if response.TokenName != "ci" || response.MaxLiveKeys != 5 {
+			t.Errorf("Usage = %+v, want token ci with 5 live keys at most", response)
+		}
+	})
+}
+
+func TestAuthenticateAllowsAnonymousWhenOptional(t *testing.T) {
+	dbtest.ForEachDriver(t, func(t *testing.T, cfg *config.Config, database *gorm.DB) {
+		router, _ := newEncRouter(t, cfg)
+
+		if recorder := get(router, constants.InfoRoute, ""); recorder.Code != http.StatusOK {
+			t.Errorf("Response without token = %d, want %d", recorder.Code, http.StatusOK)
+		}
+		if recorder := get(router, constants.InfoRoute, "Bearer fgt_unknown"); recorder.Code != http.StatusUnauthorized {
+			t.Errorf("Response with unknown token = %d, want %d", recorder.Code, http.StatusUnauthorized)
+		}
+	})
+}
@@ -2,6 +2,7 @@ package routes
 
 import (
 	apiErrors "ForgettiServer/errors"
+	"ForgettiServer/models"
 	"ForgettiServer/services"
 	"fmt"
 	"forgetti-common/constants"
@@ -13,30 +14,40 @@ import (
 )
 
 func newKeyRoute(c *gin.Context, s *services.ServiceContainer) (*dto.NewKeyResponse, error) {
-	logger := logging.MakeLogger("routes.newKeyRoute")
-	logger.Verbose("Received new key request from %s", c.ClientIP())
+	logger := requestLogger(c, "routes.newKeyRoute")
+	logger.Verbose("Received new key request from %s", logging.ClientIp(c.ClientIP()))
+	apiToken := getApiToken(c)
+	if apiToken != nil {
+		logger.Verbose("Request authenticated with API token '%s'", apiToken.Name)
+	}
 
 	var request dto.NewKeyRequest
 	if err := c.ShouldBindJSON(&request); err != nil {
-		logger.Error("Failed to bind JSON request: %v", err)
+		logger.Warning("Failed to bind JSON request: %v", err)
 		return nil, apiErrors.BadRequestError(err)
 	}
 	logger.Verbose("Request bound successfully, expiration: %s", request.Expiration.Format("2006-01-02 15:04:05"))
 
 	logger.Verbose("Validating new key request")
 	if err := request.Validate(); err != nil {
-		logger.Error("Request validation failed: %v", err)
+		logger.Warning("Request validation failed: %v", err)
 		return nil, apiErrors.BadRequestError(err)
 	}
 	logger.Verbose("Request validation successful")
 
+	var webhook *models.WebhookTarget
+	if request.WebhookUrl != "" {
+		webhook = &models.WebhookTarget{Url: request.WebhookUrl, Secret: request.WebhookSecret}
+	}
+
 	logger.Verbose("Calling Encryptor to create new key and encrypt")
-	newKey, err := s.Encryptor.CreateNewKeyAndEncrypt(request.Content, request.Expiration)
+	newKey, err := s.Encryptor.CreateNewKeyAndEncrypt(request.Content, request.Expiration, apiToken, webhook, request.Group)
 	if err != nil {
-		logger.Error("Failed to create new key and encrypt: %v", err)
+		logFailure(logger, "Failed to create new key and encrypt", err)
 		return nil, err
 	}
 	logger.Verbose("New key created and content encrypted successfully")
+	setLogKeyId(c, newKey.KeyId)
 
 	logger.Verbose("Serializing verification key")
 	verificationKey, err := crypto.SerializePrivateKey(newKey.VerificationKey)
@@ -52,28 +63,30 @@ func newKeyRoute(c *gin.Context, s *services.ServiceContainer) (*dto.NewKeyRespo
 			KeyId:           newKey.KeyId,
 			Expiration:      newKey.Expiration,
 			VerificationKey: verificationKey,
+			Group:           newKey.Group,
 		},
 	}
 
-	logger.Info("New key request completed successfully. KeyId: %s, Client: %s", newKey.KeyId, c.ClientIP())
+	logger.Info("New key request completed successfully. KeyId: %s, Client: %s", logging.KeyId(newKey.KeyId), logging.ClientIp(c.ClientIP()))
 	return &response, nil
 }
 
 func encryptRoute(c *gin.Context, s *services.ServiceContainer) (*dto.EncryptResponse, error) {
-	logger := logging.MakeLogger("routes.encryptRoute")
-	logger.Verbose("Received encrypt request from %s", c.ClientIP())
+	logger := requestLogger(c, "routes.encryptRoute")
+	logger.Verbose("Received encrypt request from %s", logging.ClientIp(c.ClientIP()))
 
 	var request dto.EncryptRequest
 	if err := c.ShouldBindJSON(&request); err != nil {
-		logger.Error("Failed to bind JSON request: %v", err)
+		logger.Warning("Failed to bind JSON request: %v", err)
 		return nil, apiErrors.BadRequestError(err)
 	}
-	logger.Verbose("Request bound successfully, KeyId: %s", request.KeyId)
+	logger.Verbose("Request bound successfully, KeyId: %s", logging.KeyId(request.KeyId))
+	setLogKeyId(c, request.KeyId)
 
 	logger.Verbose("Calling Encryptor to encrypt with existing key")
 	encryptedContent, err := s.Encryptor.EncryptWithExistingKey(request.Content, request.KeyId)
 	if err != nil {
-		logger.Error("Failed to encrypt with existing key: %v", err)
+		logFailure(logger, "Failed to encrypt with existing key", err)
 		return nil, err
 	}
 	logger.Verbose("Content encrypted successfully with existing key")
@@ -82,15 +95,88 @@ func encryptRoute(c *gin.Context, s *services.ServiceContainer) (*dto.EncryptRes
 		EncryptedContent: encryptedContent,
 	}
 
-	logger.Info("Encrypt request completed successfully. KeyId: %s, Client: %s", request.KeyId, c.ClientIP())
+	logger.Info("Encrypt request completed successfully. KeyId: %s, Client: %s", logging.KeyId(request.KeyId), logging.ClientIp(c.ClientIP()))
 	return &response, nil
 }
 
+func destroyKeyRoute(c *gin.Context, s *services.ServiceContainer) (*dto.DestroyKeyResponse, error) {
+	logger := requestLogger(c, "routes.destroyKeyRoute")
+	apiToken := getApiToken(c)
+	logger.Verbose("Received destroy key request for API token '%s'", apiToken.Name)
+
+	var request dto.DestroyKeyRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		logger.Warning("Failed to bind JSON request: %v", err)
+		return nil, apiErrors.BadRequestError(err)
+	}
+	if err := request.Validate(); err != nil {
+		logger.Warning("Request validation failed: %v", err)
+		return nil, apiErrors.BadRequestError(err)
+	}
+	setLogKeyId(c, request.KeyId)
+
+	keyId, err := s.Encryptor.DestroyKey(apiToken, request.KeyId, request.Group)
+	if err != nil {
+		logFailure(logger, "Failed to destroy key", err)
+		return nil, err
+	}
+	setLogKeyId(c, keyId)
+
+	logger.Info("Destroy key request completed successfully. KeyId: %s, Client: %s", logging.KeyId(keyId), logging.ClientIp(c.ClientIP()))
+	return &dto.DestroyKeyResponse{KeyId: keyId, Group: request.Group}, nil
+}
+
+func usageRoute(c *gin.Context, s *services.ServiceContainer) (*dto.UsageResponse, error) {
+	logger := requestLogger(c, "routes.usageRoute")
+	apiToken := getApiToken(c)
+	logger.Verbose("Received usage request for API token '%s'", apiToken.Name)
+
+	usage, err := s.QuotaService.GetUsage(apiToken)
+	if err != nil {
+		logFailure(logger, "Failed to get token usage", err)
+		return nil, err
+	}
+
+	return &dto.UsageResponse{
+		TokenName:            apiToken.Name,
+		LiveKeys:             usage.LiveKeys,
+		MaxLiveKeys:          apiToken.Quota.MaxLiveKeys,
+		KeysCreatedToday:     usage.KeysCreatedToday,
+		DailyKeyCap:          apiToken.Quota.DailyKeyCap,
+		MaxExpirationSeconds: int64(usage.MaxExpiration.Seconds()),
+	}, nil
+}
+
+func infoRoute(c *gin.Context, s *services.ServiceContainer) (*dto.InfoResponse, error) {
+	logger := requestLogger(c, "routes.infoRoute")
+	logger.Verbose("Received info request from %s", logging.ClientIp(c.ClientIP()))
+
+	return &dto.InfoResponse{
+		MinExpirationSeconds:   int64(s.Config.MinExpiration().Seconds()),
+		MaxExpirationSeconds:   int64(s.QuotaService.MaxExpiration(getApiToken(c)).Seconds()),
+		SupportedAlgVersions:   s.Config.KeyPolicy.SupportedAlgVersions,
+		TokenRequiredForNewKey: s.Config.Auth.RequireTokenForNewKey,
+		WebhooksEnabled:        s.WebhookService.Enabled(),
+	}, nil
+}
+
 func AddEncRoutes(router *gin.Engine, serviceContainer *services.ServiceContainer) {
 	logger := logging.MakeLogger("routes.AddEncRoutes")
+	limits := newRateLimits(serviceContainer.Config)
+	logger.Verbose("Rate limiting enabled: %t", limits.enabled)
+
 	logger.Verbose("Adding route: POST %s", constants.NewKeyRoute)
-	router.POST(constants.NewKeyRoute, createEndpoint(serviceContainer, newKeyRoute))
+	requireToken := serviceContainer.Config.Auth.RequireTokenForNewKey
+	logger.Verbose("API token required for new keys: %t", requireToken)
+	newKeyHandlers := append(limits.forNewKey(), authenticate(serviceContainer, requireToken))
+	router.POST(constants.NewKeyRoute, append(newKeyHandlers, createEndpoint(serviceContainer, newKeyRoute))...)
 	logger.Verbose("Adding route: POST %s", constants.EncryptRoute)
-	router.POST(constants.EncryptRoute, createEndpoint(serviceContainer, encryptRoute))
+	router.POST(constants.EncryptRoute, append(limits.forEncrypt(), createEndpoint(serviceContainer, encryptRoute))...)
+	logger.Verbose("Adding route: POST %s", constants.DestroyKeyRoute)
+	router.POST(constants.DestroyKeyRoute, limits.forClient(), authenticate(serviceContainer, true), createEndpoint(serviceContainer, destroyKeyRoute))
+	logger.Verbose("Adding route: GET %s", constants.UsageRoute)
+	router.GET(constants.UsageRoute, limits.forClient(), authenticate(serviceContainer, true), createEndpoint(serviceContainer, usageRoute))
+	logger.Verbose("Adding route: GET %s", constants.InfoRoute)
+	router.GET(constants.InfoRoute, limits.forClient(), authenticate(serviceContainer, false), createEndpoint(serviceContainer, infoRoute))
 	logger.Verbose("Encryption routes added successfully")
 }
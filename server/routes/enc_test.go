@@ -0,0 +1,76 @@
+package routes
+
+import (
+	"ForgettiServer/config"
+	"ForgettiServer/db/dbtest"
+	"ForgettiServer/models"
+	"encoding/json"
+	"forgetti-common/constants"
+	"forgetti-common/dto"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// getInfo parses the response of the info route
+func getInfo(t *testing.T, recorder *httptest.ResponseRecorder) dto.InfoResponse {
+	t.Helper()
+
+	response := recorder.Result()
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("Response = %d, want %d", response.StatusCode, http.StatusOK)
+	}
+
+	var info dto.InfoResponse
+	if err := json.NewDecoder(response.Body).Decode(&info); err != nil {
+		t.Fatalf("Failed to parse info response: %v", err)
+	}
+	return info
+}
+
+func TestInfoRouteAdvertisesPolicy(t *testing.T) {
+	dbtest.ForEachDriver(t, func(t *testing.T, cfg *config.Config, database *gorm.DB) {
+		cfg.KeyPolicy.MinExpirationMinutes = 5
+		cfg.KeyPolicy.MaxExpirationHours = 48
+		cfg.KeyPolicy.SupportedAlgVersions = []string{"1:1:1:1", "2:1:1:1"}
+		cfg.Auth.RequireTokenForNewKey = true
+		cfg.Webhooks.Disabled = true
+		router, _ := newEncRouter(t, cfg)
+
+		info := getInfo(t, get(router, constants.InfoRoute, ""))
+		if info.MinExpirationSeconds != int64((5*time.Minute).Seconds()) || info.MaxExpirationSeconds != int64((48*time.Hour).Seconds()) {
+			t.Errorf("Expiration limits = %d..%d, want 5 minutes..48 hours", info.MinExpirationSeconds, info.MaxExpirationSeconds)
+		}
+		if !slices.Equal(info.SupportedAlgVersions, cfg.KeyPolicy.SupportedAlgVersions) {
+			t.Errorf("SupportedAlgVersions = %v, want %v", info.SupportedAlgVersions, cfg.KeyPolicy.SupportedAlgVersions)
+		}
+		if !info.TokenRequiredForNewKey || info.WebhooksEnabled {
+			t.Errorf("Info = %+v, want token required and webhooks disabled", info)
+		}
+	})
+}
+
+func TestInfoRouteIncludesTokenMaxExpiration(t *testing.T) {
+	dbtest.ForEachDriver(t, func(t *testing.T, cfg *config.Config, database *gorm.DB) {
+		router, container := newEncRouter(t, cfg)
+
+		token, _, err := container.TokenService.CreateToken("ci", models.TokenQuota{MaxExpiration: 2 * time.Hour})
+		if err != nil {
+			t.Fatalf("CreateToken() error = %v", err)
+		}
+
+		info := getInfo(t, get(router, constants.InfoRoute, "Bearer "+token))
+		if info.MaxExpirationSeconds != int64((2 * time.Hour).Seconds()) {
+			t.Errorf("MaxExpirationSeconds = %d, want the 2 hours of the token", info.MaxExpirationSeconds)
+		}
+
+		info = getInfo(t, get(router, constants.InfoRoute, ""))
+		if info.MaxExpirationSeconds != int64(cfg.MaxExpiration().Seconds()) {
+			t.Errorf("MaxExpirationSeconds = %d, want the server limit without token", info.MaxExpirationSeconds)
+		}
+	})
+}
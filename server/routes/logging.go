@@ -0,0 +1,85 @@
+package routes
+
+import (
+	apiErrors "ForgettiServer/errors"
+	"errors"
+	"forgetti-common/logging"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	requestIdHeader     = "X-Request-ID"
+	requestIdContextKey = "request_id"
+	keyIdContextKey     = "log_key_id"
+)
+
+// Incoming request ids are logged, so only accept reasonably short ids without control or quote characters
+var validRequestId = regexp.MustCompile(`^[A-Za-z0-9._:/+=-]{1,128}$`)
+
+// RequestId propagates the X-Request-ID of the request, or assigns a new one, and returns it in the response
+func RequestId() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestId := c.GetHeader(requestIdHeader)
+		if !validRequestId.MatchString(requestId) {
+			requestId = uuid.New().String()
+		}
+
+		c.Set(requestIdContextKey, requestId)
+		c.Header(requestIdHeader, requestId)
+		c.Next()
+	}
+}
+
+// AccessLog logs every request once it completed
+func AccessLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		fields := logging.Fields{
+			"method":             c.Request.Method,
+			"path":               c.Request.URL.Path,
+			"status":             c.Writer.Status(),
+			logging.FieldLatency: time.Since(start),
+		}
+		if keyId := c.GetString(keyIdContextKey); keyId != "" {
+			fields[logging.FieldKeyId] = keyId
+		}
+
+		logger := requestLogger(c, "routes.AccessLog").WithFields(fields)
+		if c.Writer.Status() >= http.StatusInternalServerError {
+			logger.Error("%s %s -> %d", c.Request.Method, c.Request.URL.Path, c.Writer.Status())
+		} else {
+			logger.Info("%s %s -> %d", c.Request.Method, c.Request.URL.Path, c.Writer.Status())
+		}
+	}
+}
+
+// requestLogger creates a logger that adds the request id and client address to every entry
+func requestLogger(c *gin.Context, context string) logging.Logger {
+	return logging.MakeLogger(context).WithFields(logging.Fields{
+		logging.FieldRequestId: c.GetString(requestIdContextKey),
+		logging.FieldClientIp:  c.ClientIP(),
+	})
+}
+
+// setLogKeyId adds the key id to the access log entry of the request
+func setLogKeyId(c *gin.Context, keyId string) {
+	c.Set(keyIdContextKey, keyId)
+}
+
+// logFailure logs errors caused by the client as warnings, and other errors as errors
+func logFailure(logger logging.Logger, message string, err error) {
+	var apiError *apiErrors.ApiError
+	if errors.As(err, &apiError) && apiError.StatusCode < http.StatusInternalServerError {
+		logger.Warning("%s: %v", message, err)
+		return
+	}
+
+	logger.Error("%s: %v", message, err)
+}
@@ -0,0 +1,140 @@
+package routes
+
+import (
+	"ForgettiServer/config"
+	apiErrors "ForgettiServer/errors"
+	"ForgettiServer/ratelimit"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"forgetti-common/logging"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxPeekedBodyBytes bounds the bodies read to find the key id, far above the size of any valid request
+const maxPeekedBodyBytes = 1 << 20
+
+type rateLimits struct {
+	enabled     bool
+	perIp       *ratelimit.Limiter
+	newKeyPerIp *ratelimit.Limiter
+	perKey      *ratelimit.Limiter
+}
+
+func newRateLimits(cfg *config.Config) *rateLimits {
+	limits := cfg.RateLimit
+	return &rateLimits{
+		enabled: !limits.Disabled,
+		perIp: ratelimit.NewLimiter(ratelimit.Config{
+			RequestsPerMinute: limits.PerIpRequestsPerMinute,
+			Burst:             limits.PerIpBurst,
+		}),
+		newKeyPerIp: ratelimit.NewLimiter(ratelimit.Config{
+			RequestsPerMinute: limits.NewKeyPerIpRequestsPerMinute,
+			Burst:             limits.NewKeyPerIpBurst,
+		}),
+		perKey: ratelimit.NewLimiter(ratelimit.Config{
+			RequestsPerMinute: limits.PerKeyRequestsPerMinute,
+			Burst:             limits.PerKeyBurst,
+			LockoutThreshold:  limits.KeyLockoutThreshold,
+			LockoutDuration:   time.Duration(limits.KeyLockoutMinutes) * time.Minute,
+		}),
+	}
+}
+
+func (r *rateLimits) forClient() gin.HandlerFunc {
+	if !r.enabled {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	return rateLimitByClientIp(r.perIp, "client")
+}
+
+func (r *rateLimits) forNewKey() []gin.HandlerFunc {
+	if !r.enabled {
+		return nil
+	}
+
+	return []gin.HandlerFunc{
+		rateLimitByClientIp(r.perIp, "client"),
+		rateLimitByClientIp(r.newKeyPerIp, "new-key"),
+	}
+}
+
+func (r *rateLimits) forEncrypt() []gin.HandlerFunc {
+	if !r.enabled {
+		return nil
+	}
+
+	return []gin.HandlerFunc{
+		rateLimitByClientIp(r.perIp, "client"),
+		rateLimitByKeyId(r.perKey),
+	}
+}
+
+func rateLimitByClientIp(limiter *ratelimit.Limiter, scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if ok, retryAfter := limiter.Allow(c.ClientIP()); !ok {
+			logger := requestLogger(c, "routes.rateLimitByClientIp")
+			logger.Warning("Rate limit (%s) exceeded by %s", scope, logging.ClientIp(c.ClientIP()))
+			abortRateLimited(c, scope, retryAfter)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// rateLimitByKeyId limits requests per key id taken from the JSON body, leaving the body intact for the handler
+func rateLimitByKeyId(limiter *ratelimit.Limiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		keyId, err := peekKeyId(c)
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			// The body was consumed, so the handler cannot be left to reject it
+			abortWithError(c, apiErrors.BadRequestError(err))
+			return
+		}
+		if err != nil || keyId == "" {
+			// Malformed requests are rejected by the handler
+			c.Next()
+			return
+		}
+
+		if ok, retryAfter := limiter.Allow(keyId); !ok {
+			logger := requestLogger(c, "routes.rateLimitByKeyId")
+			logger.Warning("Rate limit (key) exceeded for KeyId: %s, Client: %s", logging.KeyId(keyId), logging.ClientIp(c.ClientIP()))
+			abortRateLimited(c, "key", retryAfter)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func peekKeyId(c *gin.Context) (string, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxPeekedBodyBytes))
+	if err != nil {
+		return "", err
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	var request struct {
+		KeyId string `json:"key_id"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		return "", err
+	}
+
+	return request.KeyId, nil
+}
+
+func abortRateLimited(c *gin.Context, scope string, retryAfter time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(apiErrors.RetryAfterSeconds(retryAfter)))
+	abortWithError(c, apiErrors.RateLimitedError(scope, retryAfter))
+}
@@ -0,0 +1,59 @@
+package routes
+
+import (
+	"ForgettiServer/db/dbtest"
+	"ForgettiServer/ratelimit"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newKeyIdRouter limits requests by key id in front of a handler that echoes the body it receives
+func newKeyIdRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	limiter := ratelimit.NewLimiter(ratelimit.Config{RequestsPerMinute: 60, Burst: 10})
+
+	router := gin.New()
+	router.POST("/", rateLimitByKeyId(limiter), func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, string(body))
+	})
+	return router
+}
+
+func TestRateLimitByKeyIdKeepsBody(t *testing.T) {
+	body := `{"key_id": "key", "content": "content"}`
+	recorder := httptest.NewRecorder()
+	newKeyIdRouter().ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+
+	if recorder.Code != http.StatusOK || recorder.Body.String() != body {
+		t.Errorf("Response = %d %s, want 200 %s", recorder.Code, recorder.Body.String(), body)
+	}
+}
+
+func TestRateLimitByKeyIdRejectsOversizedBody(t *testing.T) {
+	body := `{"key_id": "key", "content": "` + strings.Repeat("a", maxPeekedBodyBytes) + `"}`
+	recorder := httptest.NewRecorder()
+	newKeyIdRouter().ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("Response = %d, want %d", recorder.Code, http.StatusBadRequest)
+	}
+}
+
+func TestKeyLockoutCanBeDisabled(t *testing.T) {
+	cfg := dbtest.NewConfig()
+	cfg.RateLimit.KeyLockoutThreshold = 0
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() error = %v, want lockout threshold 0 to be accepted", err)
+	}
+
+	cfg.RateLimit.KeyLockoutThreshold = -1
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate() accepted a negative lockout threshold")
+	}
+}
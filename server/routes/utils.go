@@ -31,4 +31,9 @@ func handleError(c *gin.Context, err error) {
 	}
 
 	c.JSON(http.StatusInternalServerError, apiErrors.InternalServerError(err).ToResponse())
-}
\ No newline at end of file
+}
+
+func abortWithError(c *gin.Context, err error) {
+	handleError(c, err)
+	c.Abort()
+}
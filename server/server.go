@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"forgetti-common/logging"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// serve runs the server on the given listener until it fails or a termination signal is received.
+// On a signal, in-flight requests are given up to drainTimeout to complete before serve returns.
+// If ready is not nil, it is closed once signal handling is in place.
+func serve(srv *http.Server, listener net.Listener, drainTimeout time.Duration, ready chan<- struct{}) error {
+	logger := logging.MakeLogger("main.serve")
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	serveErrors := make(chan error, 1)
+	go func() {
+		serveErrors <- srv.Serve(listener)
+	}()
+
+	if ready != nil {
+		close(ready)
+	}
+
+	select {
+	case err := <-serveErrors:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return fmt.Errorf("server failed: %w", err)
+	case sig := <-signals:
+		logger.Info("Received signal %s, draining in-flight requests (timeout: %s)", sig.String(), drainTimeout.String())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		return fmt.Errorf("failed to drain in-flight requests: %w", err)
+	}
+	logger.Info("All in-flight requests completed")
+
+	return nil
+}
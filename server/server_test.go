@@ -0,0 +1,91 @@
+//go:build unix
+
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestServeDrainsInFlightRequestOnSigterm(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	requestStarted := make(chan struct{})
+	router := gin.New()
+	router.GET("/slow", func(c *gin.Context) {
+		close(requestStarted)
+		time.Sleep(500 * time.Millisecond)
+		c.String(http.StatusOK, "done")
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to create listener: %v", err)
+	}
+
+	ready := make(chan struct{})
+	serveResult := make(chan error, 1)
+	go func() {
+		serveResult <- serve(&http.Server{Handler: router}, listener, 5*time.Second, ready)
+	}()
+	<-ready
+
+	type response struct {
+		status int
+		body   string
+		err    error
+	}
+	responses := make(chan response, 1)
+	go func() {
+		resp, err := http.Get("http://" + listener.Addr().String() + "/slow")
+		if err != nil {
+			responses <- response{err: err}
+			return
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		responses <- response{status: resp.StatusCode, body: string(body), err: err}
+	}()
+
+	select {
+	case <-requestStarted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Request did not reach the handler")
+	}
+
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatalf("Failed to send SIGTERM: %v", err)
+	}
+
+	select {
+	case resp := <-responses:
+		if resp.err != nil {
+			t.Fatalf("In-flight request failed: %v", resp.err)
+		}
+		if resp.status != http.StatusOK || resp.body != "done" {
+			t.Errorf("In-flight request returned %d %q, want 200 \"done\"", resp.status, resp.body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("In-flight request did not complete")
+	}
+
+	select {
+	case err := <-serveResult:
+		if err != nil {
+			t.Errorf("serve() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve() did not return after SIGTERM")
+	}
+
+	if _, err := http.Get("http://" + listener.Addr().String() + "/slow"); err == nil {
+		t.Error("Server still accepts requests after shutdown")
+	}
+}
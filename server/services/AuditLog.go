@@ -0,0 +1,220 @@
+package services
+
+import (
+	"ForgettiServer/config"
+	"ForgettiServer/db/models"
+	"ForgettiServer/db/repositories"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Audit events
+const (
+	AuditKeyCreated   = "key.created"
+	AuditKeyUsed      = "key.used"
+	AuditKeyExpired   = "key.expired"   // the key expired and was replaced by a recently expired record
+	AuditKeyDeleted   = "key.deleted"   // the key was deleted long after it expired, without a recently expired record
+	AuditKeyDestroyed = "key.destroyed" // the owner destroyed the key before it expired
+	AuditLogPruned    = "audit.pruned"
+)
+
+// auditVerifyBatchSize is the number of records verified per query
+const auditVerifyBatchSize = 1000
+
+// ErrAuditChainBroken is returned when the audit log was changed after it was written
+var ErrAuditChainBroken = errors.New("audit log chain is broken")
+
+type AuditLog interface {
+	// Record appends an event about the key to the audit log. Details must not contain secrets.
+	Record(event string, keyId string, details map[string]string) error
+}
+
+// AuditLogImpl is a hash-chained, append-only log of key lifecycle events
+type AuditLogImpl struct {
+	auditRepo *repositories.AuditRepo
+	disabled  bool
+	retention time.Duration
+	now       func() time.Time
+}
+
+type AuditVerification struct {
+	Entries       int64
+	FirstSequence int64
+	LastSequence  int64
+	// LastHash identifies the whole chain, keeping it elsewhere reveals later rewrites of the log
+	LastHash string
+}
+
+func NewAuditLog(auditRepo *repositories.AuditRepo, cfg *config.Config) *AuditLogImpl {
+	return &AuditLogImpl{
+		auditRepo: auditRepo,
+		disabled:  cfg.Audit.Disabled,
+		retention: time.Duration(cfg.Audit.RetentionDays) * 24 * time.Hour,
+		now:       time.Now,
+	}
+}
+
+func (a *AuditLogImpl) Record(event string, keyId string, details map[string]string) error {
+	if a.disabled {
+		return nil
+	}
+
+	_, err := a.append(event, keyId, details)
+	return err
+}
+
+func (a *AuditLogImpl) append(event string, keyId string, details map[string]string) (*models.AuditRecord, error) {
+	serializedDetails := ""
+	if len(details) > 0 {
+		// Map keys are sorted, so the details always serialize the same way
+		serialized, err := json.Marshal(details)
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize audit details: %w", err)
+		}
+		serializedDetails = string(serialized)
+	}
+
+	record, err := a.auditRepo.Append(func(last *models.AuditRecord) (*models.AuditRecord, error) {
+		record := &models.AuditRecord{
+			Sequence: 1,
+			// Both databases keep microseconds, so the hash is computed from the time as it is read back
+			Time:    a.now().UTC().Truncate(time.Microsecond),
+			Event:   event,
+			KeyId:   keyId,
+			Details: serializedDetails,
+		}
+		if last != nil {
+			record.Sequence = last.Sequence + 1
+			record.PrevHash = last.Hash
+		}
+		record.Hash = auditHash(record)
+		return record, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to record audit event %s: %w", event, err)
+	}
+
+	return record, nil
+}
+
+// Verify checks that no record was changed, inserted or removed, except for records removed by the retention policy.
+// Removing the newest records cannot be detected from the log alone, compare the result with a LastHash kept elsewhere.
+func (a *AuditLogImpl) Verify() (*AuditVerification, error) {
+	result := &AuditVerification{}
+	var previous *models.AuditRecord
+	var first *models.AuditRecord
+	// sequence of the last pruned record -> its hash, for every prune event in the log
+	prunedThrough := map[int64]string{}
+
+	for {
+		records, err := a.auditRepo.ListAfter(result.LastSequence, auditVerifyBatchSize)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range records {
+			record := &records[i]
+			if record.Hash != auditHash(record) {
+				return nil, fmt.Errorf("%w: entry %d was modified", ErrAuditChainBroken, record.Sequence)
+			}
+
+			if previous == nil {
+				first = record
+			} else if record.Sequence != previous.Sequence+1 {
+				return nil, fmt.Errorf("%w: entries %d to %d are missing", ErrAuditChainBroken, previous.Sequence+1, record.Sequence-1)
+			} else if record.PrevHash != previous.Hash {
+				return nil, fmt.Errorf("%w: entry %d does not follow entry %d", ErrAuditChainBroken, record.Sequence, previous.Sequence)
+			}
+
+			if record.Event == AuditLogPruned {
+				sequence, hash, err := parsePruneDetails(record.Details)
+				if err != nil {
+					return nil, fmt.Errorf("%w: entry %d: %v", ErrAuditChainBroken, record.Sequence, err)
+				}
+				prunedThrough[sequence] = hash
+			}
+
+			previous = record
+			result.Entries++
+			result.LastSequence = record.Sequence
+			result.LastHash = record.Hash
+		}
+
+		if len(records) < auditVerifyBatchSize {
+			break
+		}
+	}
+
+	if first == nil {
+		return result, nil
+	}
+	result.FirstSequence = first.Sequence
+
+	// The oldest entry must either start the chain, or follow the entries removed by the retention policy
+	if first.Sequence == 1 && first.PrevHash == "" {
+		return result, nil
+	}
+	if hash, ok := prunedThrough[first.Sequence-1]; !ok || hash != first.PrevHash {
+		return nil, fmt.Errorf("%w: entries before %d were removed without being pruned", ErrAuditChainBroken, first.Sequence)
+	}
+
+	return result, nil
+}
+
+// ApplyRetention removes the records older than the retention period, and records which ones were removed, so that
+// the chain can still be verified. Returns the number of removed records.
+func (a *AuditLogImpl) ApplyRetention() (int64, error) {
+	if a.retention == 0 {
+		return 0, nil
+	}
+
+	last, err := a.auditRepo.LastBefore(a.now().Add(-a.retention))
+	if err != nil || last == nil {
+		return 0, err
+	}
+
+	// Recorded even when auditing is disabled, otherwise the remaining chain could not be verified
+	_, err = a.append(AuditLogPruned, "", map[string]string{
+		"through":   strconv.FormatInt(last.Sequence, 10),
+		"last_hash": last.Hash,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return a.auditRepo.DeleteThrough(last.Sequence)
+}
+
+func auditHash(record *models.AuditRecord) string {
+	// A JSON array keeps field boundaries unambiguous
+	payload, _ := json.Marshal([]any{
+		record.Sequence,
+		record.Time.UTC().Format(time.RFC3339Nano),
+		record.Event,
+		record.KeyId,
+		record.Details,
+		record.PrevHash,
+	})
+
+	hash := sha256.Sum256(payload)
+	return hex.EncodeToString(hash[:])
+}
+
+func parsePruneDetails(details string) (int64, string, error) {
+	var values map[string]string
+	if err := json.Unmarshal([]byte(details), &values); err != nil {
+		return 0, "", fmt.Errorf("invalid prune details: %w", err)
+	}
+
+	sequence, err := strconv.ParseInt(values["through"], 10, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid pruned sequence: %w", err)
+	}
+
+	return sequence, values["last_hash"], nil
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"ForgettiServer/config"
+	"ForgettiServer/db/dbtest"
+	"ForgettiServer/db/models"
+	"ForgettiServer/db/repositories"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func newTestAuditLog(t *testing.T, cfg *config.Config, database *gorm.DB, entries int) *AuditLogImpl {
+	t.Helper()
+
+	auditLog := NewAuditLog(repositories.NewAuditRepo(database), cfg)
+	for i := 0; i < entries; i++ {
+		err := auditLog.Record(AuditKeyCreated, fmt.Sprintf("key-%d", i), map[string]string{"expiration": "2030-01-01T00:00:00Z"})
+		if err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+	return auditLog
+}
+
+func TestAuditLogVerifiesIntactChain(t *testing.T) {
+	dbtest.ForEachDriver(t, func(t *testing.T, cfg *config.Config, database *gorm.DB) {
+		auditLog := newTestAuditLog(t, cfg, database, 0)
+
+		result, err := auditLog.Verify()
+		if err != nil || result.Entries != 0 {
+			t.Fatalf("Verify() of empty log = %+v, %v", result, err)
+		}
+
+		newTestAuditLog(t, cfg, database, 5)
+		result, err = auditLog.Verify()
+		if err != nil {
+			t.Fatalf("Verify() error = %v", err)
+		}
+		if result.Entries != 5 || result.FirstSequence != 1 || result.LastSequence != 5 || result.LastHash == "" {
+			t.Errorf("Verify() = %+v", result)
+		}
+	})
+}
+
+func TestAuditLogDetectsTampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(database *gorm.DB) error
+	}{
+		{"modified entry", func(database *gorm.DB) error {
+			return database.Model(&models.AuditRecord{}).Where("sequence = ?", 3).Update("key_id", "other").Error
+		}},
+		{"removed entry", func(database *gorm.DB) error {
+			return database.Where("sequence = ?", 3).Delete(&models.AuditRecord{}).Error
+		}},
+		{"removed oldest entries", func(database *gorm.DB) error {
+			return database.Where("sequence <= ?", 2).Delete(&models.AuditRecord{}).Error
+		}},
+		{"rehashed entry", func(database *gorm.DB) error {
+			var record models.AuditRecord
+			if err := database.Where("sequence = ?", 3).First(&record).Error; err != nil {
+				return err
+			}
+			record.KeyId = "other"
+			record.Hash = auditHash(&record)
+			return database.Save(&record).Error
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dbtest.ForEachDriver(t, func(t *testing.T, cfg *config.Config, database *gorm.DB) {
+				auditLog := newTestAuditLog(t, cfg, database, 5)
+
+				if err := tt.tamper(database); err != nil {
+					t.Fatalf("Failed to tamper with audit log: %v", err)
+				}
+
+				if _, err := auditLog.Verify(); !errors.Is(err, ErrAuditChainBroken) {
+					t.Errorf("Verify() error = %v, want %v", err, ErrAuditChainBroken)
+				}
+			})
+		})
+	}
+}
+
+func TestAuditLogRetention(t *testing.T) {
+	dbtest.ForEachDriver(t, func(t *testing.T, cfg *config.Config, database *gorm.DB) {
+		cfg.Audit.RetentionDays = 30
+		auditLog := NewAuditLog(repositories.NewAuditRepo(database), cfg)
+
+		current := time.Now().Add(-60 * 24 * time.Hour)
+		auditLog.now = func() time.Time { return current }
+		for i := 0; i < 3; i++ {
+			auditLog.Record(AuditKeyUsed, "old", nil)
+		}
+		current = time.Now()
+		auditLog.Record(AuditKeyUsed, "new", nil)
+
+		removed, err := auditLog.ApplyRetention()
+		if err != nil {
+			t.Fatalf("ApplyRetention() error = %v", err)
+		}
+		if removed != 3 {
+			t.Errorf("ApplyRetention() = %d, want 3", removed)
+		}
+
+		// Retention applies again after more entries expired, without breaking the chain
+		current = time.Now().Add(31 * 24 * time.Hour)
+		auditLog.Record(AuditKeyUsed, "newer", nil)
+		if _, err := auditLog.ApplyRetention(); err != nil {
+			t.Fatalf("ApplyRetention() error = %v", err)
+		}
+
+		result, err := auditLog.Verify()
+		if err != nil {
+			t.Fatalf("Verify() after retention error = %v", err)
+		}
+		if result.FirstSequence != 6 || result.LastSequence != 7 {
+			t.Errorf("Verify() = %+v, want the newest entry and the last prune entry", result)
+		}
+	})
+}
+
+func TestAuditLogConcurrentRecords(t *testing.T) {
+	dbtest.ForEachDriver(t, func(t *testing.T, cfg *config.Config, database *gorm.DB) {
+		auditLog := NewAuditLog(repositories.NewAuditRepo(database), cfg)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				if err := auditLog.Record(AuditKeyUsed, fmt.Sprintf("key-%d", i), nil); err != nil {
+					t.Errorf("Record() error = %v", err)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		result, err := auditLog.Verify()
+		if err != nil {
+			t.Fatalf("Verify() error = %v", err)
+		}
+		if result.Entries != 10 {
+			t.Errorf("Verify() found %d entries, want 10", result.Entries)
+		}
+	})
+}
+
+func TestAuditLogDisabled(t *testing.T) {
+	dbtest.ForEachDriver(t, func(t *testing.T, cfg *config.Config, database *gorm.DB) {
+		cfg.Audit.Disabled = true
+
+		result, err := newTestAuditLog(t, cfg, database, 3).Verify()
+		if err != nil || result.Entries != 0 {
+			t.Errorf("Verify() = %+v, %v, want no entries", result, err)
+		}
+	})
+}
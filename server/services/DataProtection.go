@@ -2,52 +2,107 @@ package services
 
 import (
 	"ForgettiServer/config"
+	"ForgettiServer/keywrap"
 	"encoding/base64"
+	"fmt"
 	"forgetti-common/crypto"
+	"strings"
 )
 
+// keyIdSeparator separates the key id from the protected value, it is not part of the base64 alphabet
+const keyIdSeparator = "$"
+
 type DataProtection interface {
 	Protect(data string) (string, error)
 	Unprotect(data string) (string, error)
+	// ActiveKeyPrefix returns the prefix of values protected with the key Protect currently uses
+	ActiveKeyPrefix() string
 }
 
+// DataProtectionImpl protects values with the active key of a keyring, and unprotects them with the key they were
+// protected with, so that keys can be rotated without losing stored values
 type DataProtectionImpl struct {
-	key string
+	keys        map[string][]byte
+	activeKeyId string
 }
 
-func NewDataProtection(config *config.Config) DataProtection {
-	return &DataProtectionImpl{key: config.DataProtection.Key}
-}
+// NewDataProtection creates envelope encryption when a key wrapping provider is configured, the keyring otherwise
+func NewDataProtection(config *config.Config) (DataProtection, error) {
+	keyring, err := newKeyringDataProtection(config)
+	if err != nil {
+		return nil, err
+	}
 
-func (d *DataProtectionImpl) Protect(data string) (string, error) {
-	keyHash, err := crypto.HashToSize(d.key, "data_protection", 32)
+	if config.DataProtection.Envelope.Provider == "" {
+		return keyring, nil
+	}
+
+	wrapper, err := keywrap.NewKeyWrapper(config)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	// Values protected with the keyring before envelope encryption was enabled stay readable
+	var fallback DataProtection
+	if keyring != nil {
+		fallback = keyring
+	}
+	return NewEnvelopeDataProtection(wrapper, fallback), nil
+}
+
+// newKeyringDataProtection returns nil if the keyring is empty, which is only allowed with envelope encryption
+func newKeyringDataProtection(config *config.Config) (*DataProtectionImpl, error) {
+	secrets, activeKeyId := config.DataProtectionKeys()
+	if len(secrets) == 0 {
+		return nil, nil
 	}
 
-	encrypted, err := crypto.EncryptAes256([]byte(data), keyHash)
+	keys := make(map[string][]byte, len(secrets))
+	for keyId, secret := range secrets {
+		keyHash, err := crypto.HashToSize(secret, "data_protection", 32)
+		if err != nil {
+			return nil, fmt.Errorf("failed to derive data protection key '%s': %w", keyId, err)
+		}
+		keys[keyId] = keyHash
+	}
+
+	return &DataProtectionImpl{keys: keys, activeKeyId: activeKeyId}, nil
+}
+
+func (d *DataProtectionImpl) Protect(data string) (string, error) {
+	encrypted, err := crypto.EncryptAes256([]byte(data), d.keys[d.activeKeyId])
 	if err != nil {
 		return "", err
 	}
 
-	return base64.StdEncoding.EncodeToString(encrypted), nil
+	return d.ActiveKeyPrefix() + base64.StdEncoding.EncodeToString(encrypted), nil
 }
 
 func (d *DataProtectionImpl) Unprotect(data string) (string, error) {
-	encrypted, err := base64.StdEncoding.DecodeString(data)
-	if err != nil {
-		return "", err
+	// Values protected before key rotation was supported carry no key id
+	keyId := config.LegacyDataProtectionKeyId
+	if prefix, value, found := strings.Cut(data, keyIdSeparator); found {
+		keyId, data = prefix, value
+	}
+
+	key, ok := d.keys[keyId]
+	if !ok {
+		return "", fmt.Errorf("unknown data protection key id '%s'", keyId)
 	}
 
-	keyHash, err := crypto.HashToSize(d.key, "data_protection", 32)
+	encrypted, err := base64.StdEncoding.DecodeString(data)
 	if err != nil {
 		return "", err
 	}
 
-	decrypted, err := crypto.DecryptAes256(encrypted, keyHash)
+	decrypted, err := crypto.DecryptAes256(encrypted, key)
 	if err != nil {
 		return "", err
 	}
 
 	return string(decrypted), nil
 }
+
+func (d *DataProtectionImpl) ActiveKeyPrefix() string {
+	return d.activeKeyId + keyIdSeparator
+}
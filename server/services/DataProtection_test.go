@@ -0,0 +1,167 @@
+package services
+
+import (
+	"ForgettiServer/config"
+	"ForgettiServer/db/dbtest"
+	"ForgettiServer/db/repositories"
+	"encoding/base64"
+	"forgetti-common/crypto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func newTestDataProtection(t *testing.T, legacyKey string, keys map[string]string, activeKeyId string) DataProtection {
+	t.Helper()
+
+	cfg := dbtest.NewConfig()
+	cfg.DataProtection.Key = legacyKey
+	cfg.DataProtection.Keys = keys
+	cfg.DataProtection.ActiveKeyId = activeKeyId
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	dataProtection, err := NewDataProtection(cfg)
+	if err != nil {
+		t.Fatalf("NewDataProtection() error = %v", err)
+	}
+	return dataProtection
+}
+
+func TestDataProtectionRotation(t *testing.T) {
+	before := newTestDataProtection(t, "", map[string]string{"2024": "old secret"}, "2024")
+	protected, err := before.Protect("content")
+	if err != nil {
+		t.Fatalf("Protect() error = %v", err)
+	}
+	if !strings.HasPrefix(protected, "2024$") {
+		t.Errorf("Protect() = %s, want prefix 2024$", protected)
+	}
+
+	after := newTestDataProtection(t, "", map[string]string{"2024": "old secret", "2025": "new secret"}, "2025")
+	unprotected, err := after.Unprotect(protected)
+	if err != nil || unprotected != "content" {
+		t.Errorf("Unprotect() with retired key = %s, %v, want content", unprotected, err)
+	}
+
+	reprotected, err := after.Protect("content")
+	if err != nil {
+		t.Fatalf("Protect() error = %v", err)
+	}
+	if !strings.HasPrefix(reprotected, after.ActiveKeyPrefix()) || after.ActiveKeyPrefix() != "2025$" {
+		t.Errorf("Protect() = %s, want prefix 2025$", reprotected)
+	}
+
+	withoutOldKey := newTestDataProtection(t, "", map[string]string{"2025": "new secret"}, "")
+	if _, err := withoutOldKey.Unprotect(protected); err == nil {
+		t.Error("Unprotect() with removed key did not fail")
+	}
+}
+
+func TestDataProtectionUnprotectsLegacyValues(t *testing.T) {
+	keyHash, err := crypto.HashToSize("legacy secret", "data_protection", 32)
+	if err != nil {
+		t.Fatalf("HashToSize() error = %v", err)
+	}
+	encrypted, err := crypto.EncryptAes256([]byte("content"), keyHash)
+	if err != nil {
+		t.Fatalf("EncryptAes256() error = %v", err)
+	}
+	legacyValue := base64.StdEncoding.EncodeToString(encrypted)
+
+	dataProtection := newTestDataProtection(t, "legacy secret", map[string]string{"2025": "new secret"}, "2025")
+	unprotected, err := dataProtection.Unprotect(legacyValue)
+	if err != nil || unprotected != "content" {
+		t.Errorf("Unprotect() of legacy value = %s, %v, want content", unprotected, err)
+	}
+}
+
+func TestDataProtectionKeyValidation(t *testing.T) {
+	tests := []struct {
+		name        string
+		legacyKey   string
+		keys        map[string]string
+		activeKeyId string
+	}{
+		{"no keys", "", nil, ""},
+		{"several keys without active key", "", map[string]string{"a": "1", "b": "2"}, ""},
+		{"unknown active key", "", map[string]string{"a": "1"}, "b"},
+		{"separator in key id", "", map[string]string{"a$b": "1"}, "a$b"},
+		{"empty secret", "", map[string]string{"a": ""}, "a"},
+		{"legacy key id taken", "1", map[string]string{config.LegacyDataProtectionKeyId: "2"}, config.LegacyDataProtectionKeyId},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := dbtest.NewConfig()
+			cfg.DataProtection.Key = tt.legacyKey
+			cfg.DataProtection.Keys = tt.keys
+			cfg.DataProtection.ActiveKeyId = tt.activeKeyId
+			if err := cfg.Validate(); err == nil {
+				t.Error("Validate() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestReprotectorReprotectsOutdatedKeys(t *testing.T) {
+	dbtest.ForEachDriver(t, func(t *testing.T, cfg *config.Config, database *gorm.DB) {
+		keyRepo := repositories.NewKeyRepo(database)
+		expiration := time.Now().Add(time.Hour)
+
+		before := newTestDataProtection(t, "legacy secret", map[string]string{"2024": "old secret"}, "2024")
+		after := newTestDataProtection(t, "legacy secret", map[string]string{"2024": "old secret", "2025": "new secret"}, "2025")
+		withUnknownKey := newTestDataProtection(t, "", map[string]string{"removed": "secret"}, "")
+
+		ids := []string{}
+		for _, dataProtection := range []DataProtection{before, before, before, after, withUnknownKey} {
+			protected, err := dataProtection.Protect("serialized key")
+			if err != nil {
+				t.Fatalf("Protect() error = %v", err)
+			}
+
+			id := uuid.New().String()
+			if err := keyRepo.Create(id, expiration, protected, "", ""); err != nil {
+				t.Fatalf("Create() error = %v", err)
+			}
+			ids = append(ids, id)
+		}
+
+		cfg.DataProtection.ReprotectBatchSize = 2
+		reprotector := NewReprotector(keyRepo, after, cfg)
+
+		status, err := reprotector.Status()
+		if err != nil || status.Outdated != 4 {
+			t.Fatalf("Status() = %+v, %v, want 4 outdated", status, err)
+		}
+
+		result, err := reprotector.ReprotectAll()
+		if err != nil {
+			t.Fatalf("ReprotectAll() error = %v", err)
+		}
+		if result.Reprotected != 3 || result.Failed != 1 {
+			t.Errorf("ReprotectAll() = %+v, want 3 re-protected and 1 failed", result)
+		}
+
+		for _, id := range ids[:4] {
+			record, err := keyRepo.GetById(id)
+			if err != nil {
+				t.Fatalf("GetById() error = %v", err)
+			}
+			if !strings.HasPrefix(record.SerializedKey, "2025$") {
+				t.Errorf("Key %s is protected as %s, want prefix 2025$", id, record.SerializedKey)
+			}
+			if unprotected, err := after.Unprotect(record.SerializedKey); err != nil || unprotected != "serialized key" {
+				t.Errorf("Unprotect() of re-protected key = %s, %v", unprotected, err)
+			}
+		}
+
+		status, err = reprotector.Status()
+		if err != nil || status.Outdated != 1 {
+			t.Errorf("Status() after re-protecting = %+v, %v, want 1 outdated", status, err)
+		}
+	})
+}
@@ -1,7 +1,9 @@
 package services
 
 import (
+	apiErrors "ForgettiServer/errors"
 	"ForgettiServer/models"
+	"errors"
 	"forgetti-common/crypto"
 	"forgetti-common/logging"
 	"time"
@@ -10,71 +12,179 @@ import (
 )
 
 type Encryptor interface {
-	CreateNewKeyAndEncrypt(content string, expiration time.Time) (*models.NewKeyEncryptionResult, error)
+	CreateNewKeyAndEncrypt(content string, expiration time.Time, owner *models.ApiToken, webhook *models.WebhookTarget, group string) (*models.NewKeyEncryptionResult, error)
 	EncryptWithExistingKey(content string, keyId string) (string, error)
+	DestroyKey(owner *models.ApiToken, keyId string, group string) (string, error)
 }
 
 type EncryptorImpl struct {
 	keyStore KeyStore
+	quotas   QuotaService
+	auditLog AuditLog
+	webhooks WebhookService
 }
 
-func CreateEncryptor(keyStore KeyStore) Encryptor {
+func CreateEncryptor(keyStore KeyStore, quotas QuotaService, auditLog AuditLog, webhooks WebhookService) Encryptor {
 	logger := logging.MakeLogger("services.CreateEncryptor")
 	logger.Verbose("Creating new Encryptor service")
 	return &EncryptorImpl{
 		keyStore: keyStore,
+		quotas:   quotas,
+		auditLog: auditLog,
+		webhooks: webhooks,
 	}
 }
 
-func (e *EncryptorImpl) CreateNewKeyAndEncrypt(content string, expiration time.Time) (*models.NewKeyEncryptionResult, error) {
+// CreateNewKeyAndEncrypt creates a key owned by the given token (nil for anonymous requests), enforcing its quota.
+// The webhook, if not nil, is notified about the lifecycle of the key. A non-empty group names the key, which requires
+// an API token, as group names are unique per token.
+func (e *EncryptorImpl) CreateNewKeyAndEncrypt(content string, expiration time.Time, owner *models.ApiToken, webhook *models.WebhookTarget, group string) (*models.NewKeyEncryptionResult, error) {
 	logger := logging.MakeLogger("services.Encryptor.CreateNewKeyAndEncrypt")
 	logger.Verbose("Creating new key with expiration: %s", expiration.Format("2006-01-02 15:04:05"))
 
+	ownerTokenId := ""
+	if owner != nil {
+		ownerTokenId = owner.Id
+	}
+
+	if webhook != nil && !e.webhooks.Enabled() {
+		return nil, apiErrors.BadRequestError(errors.New("webhooks are disabled on this server"))
+	}
+
+	if group != "" {
+		if owner == nil {
+			return nil, apiErrors.UnauthorizedError("API token is required for key groups")
+		}
+
+		// Checked before reserving the quota, StoreKey still rejects keys created concurrently in the same group
+		if err := e.checkGroupAvailable(ownerTokenId, group); err != nil {
+			return nil, err
+		}
+	}
+
+	logger.Verbose("Reserving key in quota")
+	if err := e.quotas.ReserveNewKey(owner, expiration); err != nil {
+		logger.Error("Quota check failed: %v", err)
+		return nil, err
+	}
+	logger.Verbose("Key reserved in quota")
+
 	logger.Verbose("Generating RSA key pair")
 	keyPair, err := crypto.GenerateKeyPair()
 	if err != nil {
 		logger.Error("Failed to generate key pair: %v", err)
+		e.quotas.ReleaseNewKey(owner)
 		return nil, err
 	}
 	logger.Verbose("Key pair generated successfully")
 
 	keyId := uuid.New()
 	key := models.BoradcastKey{
-		KeyId:      keyId,
-		Expiration: expiration,
-		Key:        keyPair.BroadcastKey,
+		KeyId:        keyId,
+		Expiration:   expiration,
+		Key:          keyPair.BroadcastKey,
+		OwnerTokenId: ownerTokenId,
+		Group:        group,
 	}
-	logger.Verbose("Generated KeyId: %s", keyId.String())
+	logger.Verbose("Generated KeyId: %s", logging.KeyId(keyId.String()))
+
+	// Encrypted before the key is stored, so that no key is left behind if this fails
+	logger.Verbose("Encrypting content with RSA key")
+	encryptedContent, err := crypto.EncryptRsa(content, key.Key)
+	if err != nil {
+		logger.Error("Failed to encrypt content: %v", err)
+		e.quotas.ReleaseNewKey(owner)
+		return nil, err
+	}
+	logger.Verbose("Content encrypted successfully")
 
 	logger.Verbose("Storing key in key store")
-	err = e.keyStore.StoreKey(key)
+	err = e.quotas.StoreNewKey(owner, key)
 	if err != nil {
 		logger.Error("Failed to store key: %v", err)
 		return nil, err
 	}
 	logger.Verbose("Key stored successfully")
 
-	logger.Verbose("Encrypting content with RSA key")
-	encryptedContent, err := crypto.EncryptRsa(content, key.Key)
+	details := map[string]string{
+		"expiration":     expiration.UTC().Format(time.RFC3339),
+		"owner_token_id": ownerTokenId,
+	}
+	if group != "" {
+		details["group"] = group
+	}
+	err = e.auditLog.Record(AuditKeyCreated, keyId.String(), details)
 	if err != nil {
-		logger.Error("Failed to encrypt content: %v", err)
+		logger.Error("Failed to audit key creation: %v", err)
+		e.discardNewKey(owner, keyId.String(), false)
 		return nil, err
 	}
-	logger.Verbose("Content encrypted successfully")
+
+	if webhook != nil {
+		logger.Verbose("Registering webhook")
+		if err := e.webhooks.Register(keyId.String(), expiration, *webhook); err != nil {
+			logger.Error("Failed to register webhook: %v", err)
+			e.discardNewKey(owner, keyId.String(), true)
+			return nil, err
+		}
+	}
 
 	result := &models.NewKeyEncryptionResult{
 		KeyId:            key.KeyId.String(),
 		Expiration:       key.Expiration,
 		VerificationKey:  keyPair.VerificationKey,
 		EncryptedContent: encryptedContent,
+		Group:            group,
 	}
-	logger.Info("Successfully created new key and encrypted content. KeyId: %s", result.KeyId)
+	logger.Info("Successfully created new key and encrypted content. KeyId: %s", logging.KeyId(result.KeyId))
 	return result, nil
 }
 
+// discardNewKey forgets a key that was stored but could not be handed out, and gives back its quota. An audited key is
+// recorded as destroyed, so that the audit log does not show it as live.
+func (e *EncryptorImpl) discardNewKey(owner *models.ApiToken, keyId string, audited bool) {
+	logger := logging.MakeLogger("services.Encryptor.discardNewKey")
+	logger.Verbose("Discarding KeyId: %s", logging.KeyId(keyId))
+
+	ownerTokenId := ""
+	if owner != nil {
+		ownerTokenId = owner.Id
+	}
+
+	if _, err := e.keyStore.DestroyKey(keyId, ownerTokenId); err != nil {
+		logger.Error("Failed to discard key: %v", err)
+	}
+	e.quotas.ReleaseNewKey(owner)
+
+	if audited {
+		details := map[string]string{"owner_token_id": ownerTokenId, "reason": "creation_failed"}
+		if err := e.auditLog.Record(AuditKeyDestroyed, keyId, details); err != nil {
+			logger.Error("Failed to audit discarded key: %v", err)
+		}
+	}
+}
+
+func (e *EncryptorImpl) checkGroupAvailable(ownerTokenId string, group string) error {
+	keyId, err := e.keyStore.GetGroupKeyId(ownerTokenId, group)
+	if err != nil || keyId == "" {
+		return err
+	}
+
+	key, err := e.keyStore.GetKey(keyId)
+	var apiError *apiErrors.ApiError
+	if errors.As(err, &apiError) {
+		// The key of the group expired, so the group can be reused
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	return apiErrors.KeyGroupExistsError(group, keyId, key.Expiration)
+}
+
 func (e *EncryptorImpl) EncryptWithExistingKey(content string, keyId string) (string, error) {
 	logger := logging.MakeLogger("services.Encryptor.EncryptWithExistingKey")
-	logger.Verbose("Encrypting with existing KeyId: %s", keyId)
+	logger.Verbose("Encrypting with existing KeyId: %s", logging.KeyId(keyId))
 
 	logger.Verbose("Retrieving key from key store")
 	key, err := e.keyStore.GetKey(keyId)
@@ -84,6 +194,11 @@ func (e *EncryptorImpl) EncryptWithExistingKey(content string, keyId string) (st
 	}
 	logger.Verbose("Key retrieved successfully from store")
 
+	if err := e.auditLog.Record(AuditKeyUsed, keyId, nil); err != nil {
+		logger.Error("Failed to audit key use: %v", err)
+		return "", err
+	}
+
 	logger.Verbose("Encrypting content with existing RSA key")
 	encryptedContent, err := crypto.EncryptRsa(content, key.Key)
 	if err != nil {
@@ -91,7 +206,54 @@ func (e *EncryptorImpl) EncryptWithExistingKey(content string, keyId string) (st
 		return "", err
 	}
 	logger.Verbose("Content encrypted successfully with existing key")
-	logger.Info("Successfully encrypted with existing key. KeyId: %s", keyId)
+	logger.Info("Successfully encrypted with existing key. KeyId: %s", logging.KeyId(keyId))
 
 	return encryptedContent, nil
 }
+
+// DestroyKey forgets a key of the owner before it expires, making every file encrypted with it unreadable. The key is
+// named either by its id or by its group. Returns the id of the destroyed key.
+func (e *EncryptorImpl) DestroyKey(owner *models.ApiToken, keyId string, group string) (string, error) {
+	logger := logging.MakeLogger("services.Encryptor.DestroyKey")
+
+	if owner == nil {
+		return "", apiErrors.UnauthorizedError("API token is required to destroy keys")
+	}
+
+	if group != "" {
+		logger.Verbose("Looking up key of group '%s'", group)
+		groupKeyId, err := e.keyStore.GetGroupKeyId(owner.Id, group)
+		if err != nil {
+			logger.Error("Failed to get key of group: %v", err)
+			return "", err
+		}
+		if groupKeyId == "" {
+			return "", apiErrors.KeyGroupNotFoundError(group)
+		}
+		keyId = groupKeyId
+	}
+
+	logger.Verbose("Destroying KeyId: %s", logging.KeyId(keyId))
+	destroyed, err := e.keyStore.DestroyKey(keyId, owner.Id)
+	if err != nil {
+		logger.Error("Failed to destroy key: %v", err)
+		return "", err
+	}
+	if !destroyed {
+		// Keys of other tokens are reported as missing, so that their ids cannot be probed
+		return "", apiErrors.KeyNotFoundError(keyId)
+	}
+
+	if err := e.auditLog.Record(AuditKeyDestroyed, keyId, map[string]string{"owner_token_id": owner.Id}); err != nil {
+		logger.Error("Failed to audit key destruction: %v", err)
+		return "", err
+	}
+
+	if err := e.webhooks.KeyDestroyed(keyId); err != nil {
+		logger.Error("Failed to notify webhook about key destruction: %v", err)
+		return "", err
+	}
+
+	logger.Info("Destroyed key. KeyId: %s", logging.KeyId(keyId))
+	return keyId, nil
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"ForgettiServer/models"
+	"errors"
+	"testing"
+	"time"
+)
+
+type failingAuditLog struct{}
+
+func (failingAuditLog) Record(event string, keyId string, details map[string]string) error {
+	return errors.New("audit log unavailable")
+}
+
+type failingWebhookService struct{}
+
+func (failingWebhookService) Enabled() bool {
+	return true
+}
+
+func (failingWebhookService) Register(keyId string, expiration time.Time, target models.WebhookTarget) error {
+	return errors.New("webhook store unavailable")
+}
+
+func (failingWebhookService) KeyDestroyed(keyId string) error {
+	return nil
+}
+
+func TestCreateNewKeyDiscardsKeyOnFailureAfterStore(t *testing.T) {
+	tests := []struct {
+		name      string
+		encryptor func(container *ServiceContainer) Encryptor
+		webhook   *models.WebhookTarget
+	}{
+		{
+			name: "audit",
+			encryptor: func(container *ServiceContainer) Encryptor {
+				return CreateEncryptor(container.KeyStore, container.QuotaService, failingAuditLog{}, container.WebhookService)
+			},
+		},
+		{
+			name: "webhook",
+			encryptor: func(container *ServiceContainer) Encryptor {
+				return CreateEncryptor(container.KeyStore, container.QuotaService, container.AuditLog, failingWebhookService{})
+			},
+			webhook: &models.WebhookTarget{Url: "https://example.com/hook"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			forEachKeyStore(t, func(t *testing.T, container *ServiceContainer) {
+				_, owner, err := container.TokenService.CreateToken("ci", models.TokenQuota{DailyKeyCap: 1})
+				if err != nil {
+					t.Fatalf("CreateToken() error = %v", err)
+				}
+
+				_, err = test.encryptor(container).CreateNewKeyAndEncrypt("content", time.Now().Add(time.Hour), owner, test.webhook, "")
+				if err == nil {
+					t.Fatal("CreateNewKeyAndEncrypt() succeeded, want the injected failure")
+				}
+
+				usage, err := container.QuotaService.GetUsage(owner)
+				if err != nil {
+					t.Fatalf("GetUsage() error = %v", err)
+				}
+				if usage.LiveKeys != 0 || usage.KeysCreatedToday != 0 {
+					t.Errorf("Usage = %d live keys, %d created today, want the failed key discarded", usage.LiveKeys, usage.KeysCreatedToday)
+				}
+
+				// The released quota allows the key to be created again
+				if _, err := container.Encryptor.CreateNewKeyAndEncrypt("content", time.Now().Add(time.Hour), owner, nil, ""); err != nil {
+					t.Errorf("CreateNewKeyAndEncrypt() error = %v, want the daily cap to be released", err)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package services
+
+import (
+	"ForgettiServer/config"
+	"ForgettiServer/keywrap"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"forgetti-common/crypto"
+	"forgetti-common/logging"
+	"strings"
+	"sync"
+)
+
+const envelopePrefix = config.EnvelopeDataProtectionKeyId + keyIdSeparator
+
+// EnvelopeDataProtection encrypts values with a data key that is stored wrapped next to them, so reading the
+// database is not enough to decrypt them. Protected values look like env$<wrapped data key>$<base64 value>.
+//
+// Each server process creates one data key on first use, and caches unwrapped data keys, so the provider is only
+// called once per data key instead of once per value.
+type EnvelopeDataProtection struct {
+	wrapper  keywrap.KeyWrapper
+	fallback DataProtection // unprotects values without the envelope prefix, nil if there are none
+
+	mutex          sync.Mutex
+	dataKey        []byte
+	wrappedDataKey string
+	unwrappedKeys  map[string][]byte
+}
+
+func NewEnvelopeDataProtection(wrapper keywrap.KeyWrapper, fallback DataProtection) *EnvelopeDataProtection {
+	return &EnvelopeDataProtection{
+		wrapper:       wrapper,
+		fallback:      fallback,
+		unwrappedKeys: make(map[string][]byte),
+	}
+}
+
+func (e *EnvelopeDataProtection) Protect(data string) (string, error) {
+	dataKey, wrappedDataKey, err := e.currentDataKey()
+	if err != nil {
+		return "", err
+	}
+
+	encrypted, err := crypto.EncryptAes256([]byte(data), dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	return envelopePrefix + wrappedDataKey + keyIdSeparator + base64.StdEncoding.EncodeToString(encrypted), nil
+}
+
+func (e *EnvelopeDataProtection) Unprotect(data string) (string, error) {
+	envelope, isEnvelope := strings.CutPrefix(data, envelopePrefix)
+	if !isEnvelope {
+		if e.fallback == nil {
+			return "", fmt.Errorf("value is not protected with envelope encryption, and no data protection keyring is configured")
+		}
+		return e.fallback.Unprotect(data)
+	}
+
+	wrappedDataKey, value, found := strings.Cut(envelope, keyIdSeparator)
+	if !found {
+		return "", fmt.Errorf("malformed envelope protected value")
+	}
+
+	dataKey, err := e.unwrap(wrappedDataKey)
+	if err != nil {
+		return "", err
+	}
+
+	encrypted, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return "", err
+	}
+
+	decrypted, err := crypto.DecryptAes256(encrypted, dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	return string(decrypted), nil
+}
+
+func (e *EnvelopeDataProtection) ActiveKeyPrefix() string {
+	return envelopePrefix
+}
+
+// currentDataKey returns the data key of this process, creating and wrapping it on first use
+func (e *EnvelopeDataProtection) currentDataKey() ([]byte, string, error) {
+	logger := logging.MakeLogger("services.EnvelopeDataProtection.currentDataKey")
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.dataKey != nil {
+		return e.dataKey, e.wrappedDataKey, nil
+	}
+
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, "", fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	wrappedDataKey, err := e.wrapper.WrapKey(dataKey)
+	if err != nil {
+		return nil, "", err
+	}
+	if strings.Contains(wrappedDataKey, keyIdSeparator) {
+		return nil, "", fmt.Errorf("wrapped data key contains '%s'", keyIdSeparator)
+	}
+
+	logger.Verbose("Created new data key")
+	e.dataKey = dataKey
+	e.wrappedDataKey = wrappedDataKey
+	e.unwrappedKeys[wrappedDataKey] = dataKey
+	return dataKey, wrappedDataKey, nil
+}
+
+func (e *EnvelopeDataProtection) unwrap(wrappedDataKey string) ([]byte, error) {
+	e.mutex.Lock()
+	dataKey, cached := e.unwrappedKeys[wrappedDataKey]
+	e.mutex.Unlock()
+	if cached {
+		return dataKey, nil
+	}
+
+	dataKey, err := e.wrapper.UnwrapKey(wrappedDataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	e.mutex.Lock()
+	e.unwrappedKeys[wrappedDataKey] = dataKey
+	e.mutex.Unlock()
+	return dataKey, nil
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"ForgettiServer/config"
+	"ForgettiServer/db/dbtest"
+	"ForgettiServer/db/repositories"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// countingKeyWrapper wraps keys by encoding them, and counts the calls
+type countingKeyWrapper struct {
+	wraps   int
+	unwraps int
+}
+
+func (c *countingKeyWrapper) WrapKey(dataKey []byte) (string, error) {
+	c.wraps++
+	return base64.StdEncoding.EncodeToString(dataKey), nil
+}
+
+func (c *countingKeyWrapper) UnwrapKey(wrappedKey string) ([]byte, error) {
+	c.unwraps++
+	return base64.StdEncoding.DecodeString(wrappedKey)
+}
+
+func TestEnvelopeDataProtection(t *testing.T) {
+	wrapper := &countingKeyWrapper{}
+	dataProtection := NewEnvelopeDataProtection(wrapper, nil)
+
+	first, err := dataProtection.Protect("first")
+	if err != nil {
+		t.Fatalf("Protect() error = %v", err)
+	}
+	second, _ := dataProtection.Protect("second")
+	if !strings.HasPrefix(first, "env$") || strings.Count(first, "$") != 2 {
+		t.Errorf("Protect() = %s, want env$<wrapped key>$<value>", first)
+	}
+	if wrapper.wraps != 1 {
+		t.Errorf("Data key wrapped %d times, want once per process", wrapper.wraps)
+	}
+
+	// A new process unwraps the data key once, then uses its cache
+	restarted := NewEnvelopeDataProtection(wrapper, nil)
+	for protected, want := range map[string]string{first: "first", second: "second"} {
+		unprotected, err := restarted.Unprotect(protected)
+		if err != nil || unprotected != want {
+			t.Errorf("Unprotect() = %s, %v, want %s", unprotected, err, want)
+		}
+	}
+	if wrapper.unwraps != 1 {
+		t.Errorf("Data key unwrapped %d times, want 1", wrapper.unwraps)
+	}
+
+	if _, err := restarted.Unprotect("default$abc"); err == nil {
+		t.Error("Unprotect() of keyring value without a keyring did not fail")
+	}
+}
+
+func TestEnvelopeDataProtectionReadsAndReprotectsKeyringValues(t *testing.T) {
+	dbtest.ForEachDriver(t, func(t *testing.T, cfg *config.Config, database *gorm.DB) {
+		keyring := newTestDataProtection(t, "legacy secret", nil, "")
+		keyRepo := repositories.NewKeyRepo(database)
+
+		protected, err := keyring.Protect("serialized key")
+		if err != nil {
+			t.Fatalf("Protect() error = %v", err)
+		}
+		id := uuid.New().String()
+		if err := keyRepo.Create(id, time.Now().Add(time.Hour), protected, "", ""); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+
+		envelope := NewEnvelopeDataProtection(&countingKeyWrapper{}, keyring)
+		if unprotected, err := envelope.Unprotect(protected); err != nil || unprotected != "serialized key" {
+			t.Errorf("Unprotect() of keyring value = %s, %v", unprotected, err)
+		}
+
+		result, err := NewReprotector(keyRepo, envelope, cfg).ReprotectAll()
+		if err != nil || result.Reprotected != 1 {
+			t.Fatalf("ReprotectAll() = %+v, %v, want 1 re-protected", result, err)
+		}
+
+		record, _ := keyRepo.GetById(id)
+		if !strings.HasPrefix(record.SerializedKey, "env$") {
+			t.Errorf("Re-protected key = %s, want envelope", record.SerializedKey)
+		}
+		if unprotected, err := envelope.Unprotect(record.SerializedKey); err != nil || unprotected != "serialized key" {
+			t.Errorf("Unprotect() of re-protected key = %s, %v", unprotected, err)
+		}
+	})
+}
@@ -6,20 +6,33 @@ import (
 	dbModels "ForgettiServer/db/models"
 	"ForgettiServer/errors"
 	"ForgettiServer/models"
+	stdErrors "errors"
 	"fmt"
 	"forgetti-common/crypto"
 	"time"
 )
 
+// expiredKeyBatchSize is the number of expired keys the cleanup job handles per query
+const expiredKeyBatchSize = 100
+
 type KeyStore interface {
-	StoreKey(key models.BoradcastKey) error
+	// StoreKey fails with a quota error if the owner of the key already has maxLiveKeys live keys (0 = no limit). The
+	// limit holds for concurrent requests.
+	StoreKey(key models.BoradcastKey, maxLiveKeys int) error
 	GetKey(keyId string) (*models.BoradcastKey, error)
+	CountLiveKeys(ownerTokenId string) (int64, error)
+	// GetGroupKeyId returns the id of the key in the group of the owner, or an empty string if the group has no key
+	GetGroupKeyId(ownerTokenId string, group string) (string, error)
+	// DestroyKey forgets the key of the owner right away. Returns false if the owner has no such key.
+	DestroyKey(keyId string, ownerTokenId string) (bool, error)
+	CleanupExpiredKeys() error
 }
 
 type KeyStoreImpl struct {
 	keyRepo                 *repositories.KeyRepo
 	recentlyExpiredRepo     *repositories.RecentlyExpiredRepo
 	dataProtection          DataProtection
+	auditLog                AuditLog
 	recentlyExpiredDuration time.Duration
 }
 
@@ -27,17 +40,19 @@ func NewKeyStore(
 	keyRepo *repositories.KeyRepo,
 	recentlyExpiredRepo *repositories.RecentlyExpiredRepo,
 	dataProtection DataProtection,
+	auditLog AuditLog,
 	cfg *config.Config,
 ) KeyStore {
 	return &KeyStoreImpl{
 		keyRepo:                 keyRepo,
 		recentlyExpiredRepo:     recentlyExpiredRepo,
 		dataProtection:          dataProtection,
+		auditLog:                auditLog,
 		recentlyExpiredDuration: time.Duration(cfg.KeyStore.RecentlyExpiredDurationHours) * time.Hour,
 	}
 }
 
-func (k *KeyStoreImpl) StoreKey(key models.BoradcastKey) error {
+func (k *KeyStoreImpl) StoreKey(key models.BoradcastKey, maxLiveKeys int) error {
 	serializedKey, err := crypto.SerializePublicKey(key.Key)
 	if err != nil {
 		return fmt.Errorf("failed to serialize key: %w", err)
@@ -48,7 +63,46 @@ func (k *KeyStoreImpl) StoreKey(key models.BoradcastKey) error {
 		return fmt.Errorf("failed to protect key: %w", err)
 	}
 
-	return k.keyRepo.Create(key.KeyId.String(), key.Expiration, protectedKey)
+	err = k.keyRepo.CreateWithinLimit(key.KeyId.String(), key.Expiration, protectedKey, key.OwnerTokenId, key.Group, int64(maxLiveKeys))
+	if stdErrors.Is(err, repositories.ErrKeyGroupTaken) {
+		return k.groupTakenError(key.OwnerTokenId, key.Group)
+	}
+	if stdErrors.Is(err, repositories.ErrLiveKeyLimitReached) {
+		return errors.QuotaExceededError("max_live_keys", fmt.Sprint(maxLiveKeys))
+	}
+	return err
+}
+
+func (k *KeyStoreImpl) groupTakenError(ownerTokenId string, group string) error {
+	record, err := k.keyRepo.GetByGroup(ownerTokenId, group)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		// The key was destroyed in the meantime
+		return errors.KeyGroupExistsError(group, "", time.Time{})
+	}
+	return errors.KeyGroupExistsError(group, record.Id, record.Expiration)
+}
+
+func (k *KeyStoreImpl) GetGroupKeyId(ownerTokenId string, group string) (string, error) {
+	record, err := k.keyRepo.GetByGroup(ownerTokenId, group)
+	if err != nil || record == nil {
+		return "", err
+	}
+	return record.Id, nil
+}
+
+func (k *KeyStoreImpl) DestroyKey(keyId string, ownerTokenId string) (bool, error) {
+	destroyed, err := k.keyRepo.DeleteOwned(keyId, ownerTokenId)
+	if err != nil {
+		return false, fmt.Errorf("failed to destroy key: %w", err)
+	}
+	return destroyed, nil
+}
+
+func (k *KeyStoreImpl) CountLiveKeys(ownerTokenId string) (int64, error) {
+	return k.keyRepo.CountLiveByOwner(ownerTokenId, time.Now())
 }
 
 func (k *KeyStoreImpl) GetKey(keyId string) (*models.BoradcastKey, error) {
@@ -89,32 +143,76 @@ func (k *KeyStoreImpl) checkExpiration(record *dbModels.KeyRecord) (*dbModels.Ke
 
 	// Expired too long ago, treat as not found
 	if record.Expiration.Before(time.Now().Add(-k.recentlyExpiredDuration)) {
-		if err := k.keyRepo.Delete(record.Id); err != nil {
-			return nil, fmt.Errorf("failed to delete expired key: %w", err)
+		if err := k.deleteExpiredKey(record); err != nil {
+			return nil, err
 		}
 		return nil, errors.KeyNotFoundError(record.Id)
 	}
 
-	// Move to recently expired
-	if err := k.recentlyExpiredRepo.Create(record.Id, record.Expiration); err != nil {
-		return nil, fmt.Errorf("failed to create recently expired record: %w", err)
-	}
-	if err := k.keyRepo.Delete(record.Id); err != nil {
-		return nil, fmt.Errorf("failed to delete expired key: %w", err)
+	// Move to recently expired - if another request already did it, the result is the same
+	if err := k.moveToRecentlyExpired(record); err != nil {
+		return nil, err
 	}
 
 	return nil, errors.KeyExpiredError(record.Id, record.Expiration)
 }
 
 func (k *KeyStoreImpl) CleanupExpiredKeys() error {
-	cutoffTime := time.Now().Add(-k.recentlyExpiredDuration)
+	now := time.Now()
+	cutoffTime := now.Add(-k.recentlyExpiredDuration)
 	if err := k.recentlyExpiredRepo.DeleteBefore(cutoffTime); err != nil {
 		return fmt.Errorf("failed to cleanup recently expired records: %w", err)
 	}
 
-	if err := k.keyRepo.DeleteExpiredBefore(cutoffTime); err != nil {
-		return fmt.Errorf("failed to cleanup old expired keys: %w", err)
+	// Every handled key is removed from the keys table, so each batch starts at the beginning
+	for {
+		records, err := k.keyRepo.ListExpiredBefore(now, expiredKeyBatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to cleanup expired keys: %w", err)
+		}
+
+		for i := range records {
+			if records[i].Expiration.Before(cutoffTime) {
+				err = k.deleteExpiredKey(&records[i])
+			} else {
+				err = k.moveToRecentlyExpired(&records[i])
+			}
+			if err != nil {
+				return fmt.Errorf("failed to cleanup expired keys: %w", err)
+			}
+		}
+
+		if len(records) < expiredKeyBatchSize {
+			return nil
+		}
+	}
+}
+
+// deleteExpiredKey records the deletion only if this call deleted the key, so concurrent callers record it once
+func (k *KeyStoreImpl) deleteExpiredKey(record *dbModels.KeyRecord) error {
+	deleted, err := k.keyRepo.Delete(record.Id)
+	if err != nil {
+		return fmt.Errorf("failed to delete expired key: %w", err)
 	}
+	if !deleted {
+		return nil
+	}
+
+	return k.auditLog.Record(AuditKeyDeleted, record.Id, expirationDetails(record.Expiration))
+}
+
+func (k *KeyStoreImpl) moveToRecentlyExpired(record *dbModels.KeyRecord) error {
+	moved, err := k.keyRepo.MoveToRecentlyExpired(record.Id)
+	if err != nil {
+		return fmt.Errorf("failed to move expired key: %w", err)
+	}
+	if !moved {
+		return nil
+	}
+
+	return k.auditLog.Record(AuditKeyExpired, record.Id, expirationDetails(record.Expiration))
+}
 
-	return nil
+func expirationDetails(expiration time.Time) map[string]string {
+	return map[string]string{"expiration": expiration.UTC().Format(time.RFC3339)}
 }
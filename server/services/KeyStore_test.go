@@ -0,0 +1,278 @@
+package services
+
+import (
+	"ForgettiServer/config"
+	"ForgettiServer/db/dbtest"
+	"ForgettiServer/db/repositories"
+	apiErrors "ForgettiServer/errors"
+	"ForgettiServer/models"
+	"errors"
+	"forgetti-common/crypto"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func TestDatabaseKeyStore(t *testing.T) {
+	dbtest.ForEachDriver(t, func(t *testing.T, cfg *config.Config, database *gorm.DB) {
+		dataProtection, err := NewDataProtection(cfg)
+		if err != nil {
+			t.Fatalf("NewDataProtection() error = %v", err)
+		}
+
+		auditLog := &recordingAuditLog{}
+		keyStore := NewKeyStore(
+			repositories.NewKeyRepo(database),
+			repositories.NewRecentlyExpiredRepo(database),
+			dataProtection,
+			auditLog,
+			cfg,
+		)
+		runKeyStoreConformance(t, keyStore, auditLog)
+	})
+}
+
+func TestMemoryKeyStore(t *testing.T) {
+	auditLog := &recordingAuditLog{}
+	runKeyStoreConformance(t, NewMemoryKeyStore(auditLog, dbtest.NewConfig()), auditLog)
+}
+
+// recordingAuditLog keeps the recorded events as "<event> <key id>"
+type recordingAuditLog struct {
+	mutex  sync.Mutex
+	events []string
+}
+
+func (r *recordingAuditLog) Record(event string, keyId string, _ map[string]string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.events = append(r.events, event+" "+keyId)
+	return nil
+}
+
+func (r *recordingAuditLog) count(event string, keyId string) int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	count := 0
+	for _, recorded := range r.events {
+		if recorded == event+" "+keyId {
+			count++
+		}
+	}
+	return count
+}
+
+// runKeyStoreConformance checks the behavior every KeyStore implementation must have.
+// The store is configured with a recently expired duration of 24 hours.
+func runKeyStoreConformance(t *testing.T, keyStore KeyStore, auditLog *recordingAuditLog) {
+	keyPair, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair() error = %v", err)
+	}
+
+	storeKey := func(t *testing.T, expiresIn time.Duration, owner string) string {
+		key := models.BoradcastKey{
+			KeyId:        uuid.New(),
+			Expiration:   time.Now().Add(expiresIn).Truncate(time.Second),
+			Key:          keyPair.BroadcastKey,
+			OwnerTokenId: owner,
+		}
+		if err := keyStore.StoreKey(key, 0); err != nil {
+			t.Fatalf("StoreKey() error = %v", err)
+		}
+		return key.KeyId.String()
+	}
+
+	t.Run("returns live key", func(t *testing.T) {
+		expiration := time.Now().Add(time.Hour).Truncate(time.Second)
+		key := models.BoradcastKey{
+			KeyId:        uuid.New(),
+			Expiration:   expiration,
+			Key:          keyPair.BroadcastKey,
+			OwnerTokenId: "owner",
+		}
+		if err := keyStore.StoreKey(key, 0); err != nil {
+			t.Fatalf("StoreKey() error = %v", err)
+		}
+
+		result, err := keyStore.GetKey(key.KeyId.String())
+		if err != nil {
+			t.Fatalf("GetKey() error = %v", err)
+		}
+		if result.KeyId != key.KeyId || !result.Expiration.Equal(expiration) || result.OwnerTokenId != "owner" {
+			t.Errorf("GetKey() = %+v, want %+v", result, key)
+		}
+		if result.Key.N.Cmp(keyPair.BroadcastKey.N) != 0 || result.Key.E.Cmp(keyPair.BroadcastKey.E) != 0 {
+			t.Error("GetKey() returned a different public key")
+		}
+	})
+
+	t.Run("rejects duplicate key id", func(t *testing.T) {
+		key := models.BoradcastKey{
+			KeyId:      uuid.New(),
+			Expiration: time.Now().Add(time.Hour),
+			Key:        keyPair.BroadcastKey,
+		}
+		if err := keyStore.StoreKey(key, 0); err != nil {
+			t.Fatalf("StoreKey() error = %v", err)
+		}
+		if err := keyStore.StoreKey(key, 0); err == nil {
+			t.Error("StoreKey() with duplicate key id did not fail")
+		}
+	})
+
+	t.Run("unknown key is not found", func(t *testing.T) {
+		_, err := keyStore.GetKey(uuid.New().String())
+		expectApiError(t, err, "key-not-found")
+	})
+
+	t.Run("recently expired key stays expired", func(t *testing.T) {
+		keyId := storeKey(t, -time.Hour, "")
+
+		for i := 0; i < 2; i++ {
+			_, err := keyStore.GetKey(keyId)
+			expectApiError(t, err, "key-expired")
+		}
+		if count := auditLog.count(AuditKeyExpired, keyId); count != 1 {
+			t.Errorf("Recorded %d expiry events, want 1", count)
+		}
+	})
+
+	t.Run("recently expired key is expired for concurrent readers", func(t *testing.T) {
+		keyId := storeKey(t, -time.Minute, "")
+
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := keyStore.GetKey(keyId)
+				expectApiError(t, err, "key-expired")
+			}()
+		}
+		wg.Wait()
+
+		if count := auditLog.count(AuditKeyExpired, keyId); count != 1 {
+			t.Errorf("Recorded %d expiry events, want 1", count)
+		}
+	})
+
+	t.Run("long expired key is not found", func(t *testing.T) {
+		keyId := storeKey(t, -48*time.Hour, "")
+
+		_, err := keyStore.GetKey(keyId)
+		expectApiError(t, err, "key-not-found")
+		if count := auditLog.count(AuditKeyDeleted, keyId); count != 1 {
+			t.Errorf("Recorded %d deletion events, want 1", count)
+		}
+	})
+
+	t.Run("counts live keys of owner", func(t *testing.T) {
+		owner := uuid.New().String()
+		storeKey(t, time.Hour, owner)
+		storeKey(t, 2*time.Hour, owner)
+		storeKey(t, -time.Hour, owner)
+		storeKey(t, time.Hour, "")
+
+		count, err := keyStore.CountLiveKeys(owner)
+		if err != nil {
+			t.Fatalf("CountLiveKeys() error = %v", err)
+		}
+		if count != 2 {
+			t.Errorf("CountLiveKeys() = %d, want 2", count)
+		}
+	})
+
+	t.Run("group has one live key per owner", func(t *testing.T) {
+		owner := uuid.New().String()
+		storeGroupKey := func(expiresIn time.Duration, owner string) (string, error) {
+			key := models.BoradcastKey{
+				KeyId:        uuid.New(),
+				Expiration:   time.Now().Add(expiresIn),
+				Key:          keyPair.BroadcastKey,
+				OwnerTokenId: owner,
+				Group:        "project",
+			}
+			return key.KeyId.String(), keyStore.StoreKey(key, 0)
+		}
+
+		if _, err := storeGroupKey(-time.Hour, owner); err != nil {
+			t.Fatalf("StoreKey() error = %v", err)
+		}
+		keyId, err := storeGroupKey(time.Hour, owner)
+		if err != nil {
+			t.Fatalf("StoreKey() in group of expired key error = %v", err)
+		}
+		_, err = storeGroupKey(time.Hour, owner)
+		expectApiError(t, err, "key-group-exists")
+		if _, err := storeGroupKey(time.Hour, uuid.New().String()); err != nil {
+			t.Errorf("StoreKey() in group of another owner error = %v", err)
+		}
+
+		groupKeyId, err := keyStore.GetGroupKeyId(owner, "project")
+		if err != nil || groupKeyId != keyId {
+			t.Errorf("GetGroupKeyId() = %s, %v, want %s", groupKeyId, err, keyId)
+		}
+		result, err := keyStore.GetKey(keyId)
+		if err != nil || result.Group != "project" {
+			t.Errorf("GetKey() = %+v, %v, want key in group project", result, err)
+		}
+	})
+
+	t.Run("destroys keys of owner only", func(t *testing.T) {
+		owner := uuid.New().String()
+		keyId := storeKey(t, time.Hour, owner)
+
+		if destroyed, err := keyStore.DestroyKey(keyId, "other"); err != nil || destroyed {
+			t.Errorf("DestroyKey() by another owner = %t, %v, want false", destroyed, err)
+		}
+		if destroyed, err := keyStore.DestroyKey(keyId, owner); err != nil || !destroyed {
+			t.Fatalf("DestroyKey() = %t, %v, want true", destroyed, err)
+		}
+
+		_, err := keyStore.GetKey(keyId)
+		expectApiError(t, err, "key-not-found")
+		if destroyed, err := keyStore.DestroyKey(keyId, owner); err != nil || destroyed {
+			t.Errorf("DestroyKey() of destroyed key = %t, %v, want false", destroyed, err)
+		}
+	})
+
+	t.Run("cleanup keeps recently expired keys", func(t *testing.T) {
+		liveKeyId := storeKey(t, time.Hour, "")
+		recentKeyId := storeKey(t, -time.Hour, "")
+		oldKeyId := storeKey(t, -48*time.Hour, "")
+
+		if err := keyStore.CleanupExpiredKeys(); err != nil {
+			t.Fatalf("CleanupExpiredKeys() error = %v", err)
+		}
+		if auditLog.count(AuditKeyExpired, recentKeyId) != 1 || auditLog.count(AuditKeyDeleted, oldKeyId) != 1 {
+			t.Errorf("Recorded events %v, want expiry of %s and deletion of %s", auditLog.events, recentKeyId, oldKeyId)
+		}
+
+		if _, err := keyStore.GetKey(liveKeyId); err != nil {
+			t.Errorf("GetKey() of live key error = %v", err)
+		}
+		_, err := keyStore.GetKey(recentKeyId)
+		expectApiError(t, err, "key-expired")
+		_, err = keyStore.GetKey(oldKeyId)
+		expectApiError(t, err, "key-not-found")
+	})
+}
+
+func expectApiError(t *testing.T, err error, errorCode string) {
+	t.Helper()
+
+	var apiError *apiErrors.ApiError
+	if !errors.As(err, &apiError) {
+		t.Errorf("error = %v, want API error %s", err, errorCode)
+		return
+	}
+	if apiError.ErrorCode != errorCode {
+		t.Errorf("error code = %s, want %s", apiError.ErrorCode, errorCode)
+	}
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"ForgettiServer/config"
+	"ForgettiServer/db/dbtest"
+	"ForgettiServer/models"
+	"bytes"
+	"forgetti-common/logging"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// lockedBuffer collects the log output of loggers that write concurrently
+type lockedBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.String()
+}
+
+// captureLogs sends all log entries to the returned buffer, with the given privacy policy
+func captureLogs(t *testing.T, privacy logging.Privacy) *lockedBuffer {
+	t.Helper()
+
+	previous := logging.GetGlobalConfig()
+	output := &lockedBuffer{}
+	if err := logging.SetGlobalConfig(logging.Config{LogLevel: logging.LogLevelVerbose, Console: output, Privacy: privacy}); err != nil {
+		t.Fatalf("SetGlobalConfig() error = %v", err)
+	}
+	t.Cleanup(func() { logging.SetGlobalConfig(previous) })
+	return output
+}
+
+func TestServicesDoNotLogKeyIdsInPrivacyMode(t *testing.T) {
+	dbtest.ForEachDriver(t, func(t *testing.T, cfg *config.Config, database *gorm.DB) {
+		privacy, err := logging.NewPrivacy(logging.KeyIdsHashed, logging.ClientIpsDropped, "secret")
+		if err != nil {
+			t.Fatalf("NewPrivacy() error = %v", err)
+		}
+		output := captureLogs(t, privacy)
+
+		container, err := CreateServiceContainer(cfg)
+		if err != nil {
+			t.Fatalf("CreateServiceContainer() error = %v", err)
+		}
+		_, owner, err := container.TokenService.CreateToken("privacy", models.TokenQuota{})
+		if err != nil {
+			t.Fatalf("CreateToken() error = %v", err)
+		}
+
+		var keyIds []string
+		created, err := container.Encryptor.CreateNewKeyAndEncrypt("content", time.Now().Add(time.Hour), owner, nil, "backups")
+		if err != nil {
+			t.Fatalf("CreateNewKeyAndEncrypt() error = %v", err)
+		}
+		keyIds = append(keyIds, created.KeyId)
+
+		if _, err := container.Encryptor.EncryptWithExistingKey("content", created.KeyId); err != nil {
+			t.Fatalf("EncryptWithExistingKey() error = %v", err)
+		}
+
+		unknownKeyId := uuid.New().String()
+		keyIds = append(keyIds, unknownKeyId)
+		if _, err := container.Encryptor.EncryptWithExistingKey("content", unknownKeyId); err == nil {
+			t.Error("EncryptWithExistingKey() of an unknown key succeeded")
+		}
+
+		// The group already has a live key
+		if _, err := container.Encryptor.CreateNewKeyAndEncrypt("content", time.Now().Add(time.Hour), owner, nil, "backups"); err == nil {
+			t.Error("CreateNewKeyAndEncrypt() of a second key of the group succeeded")
+		}
+
+		if _, err := container.Encryptor.DestroyKey(owner, "", "backups"); err != nil {
+			t.Fatalf("DestroyKey() error = %v", err)
+		}
+		if _, err := container.Encryptor.DestroyKey(owner, created.KeyId, ""); err == nil {
+			t.Error("DestroyKey() of a destroyed key succeeded")
+		}
+
+		// A key protected with a data protection key that is not in the keyring fails to re-protect
+		withUnknownKey := newTestDataProtection(t, "", map[string]string{"removed": "secret"}, "")
+		protected, err := withUnknownKey.Protect("serialized key")
+		if err != nil {
+			t.Fatalf("Protect() error = %v", err)
+		}
+		unprotectableKeyId := uuid.New().String()
+		keyIds = append(keyIds, unprotectableKeyId)
+		if err := container.KeyRepo.Create(unprotectableKeyId, time.Now().Add(time.Hour), protected, "", ""); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+		if result, err := container.Reprotector.ReprotectAll(); err != nil || result.Failed != 1 {
+			t.Errorf("ReprotectAll() = %+v, %v, want 1 failed", result, err)
+		}
+
+		logs := output.String()
+		for _, keyId := range keyIds {
+			if strings.Contains(logs, keyId) {
+				t.Errorf("Logs contain the raw key id %s:\n%s", keyId, logs)
+			}
+			if !strings.Contains(logs, privacy.KeyId(keyId)) {
+				t.Errorf("Logs do not mention key %s as %s:\n%s", keyId, privacy.KeyId(keyId), logs)
+			}
+		}
+	})
+}
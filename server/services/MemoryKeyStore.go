@@ -0,0 +1,175 @@
+package services
+
+import (
+	"ForgettiServer/config"
+	"ForgettiServer/errors"
+	"ForgettiServer/models"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// MemoryKeyStore keeps keys only in RAM, so they are forgotten when the server stops
+type MemoryKeyStore struct {
+	mutex                   sync.Mutex
+	keys                    map[string]models.BoradcastKey
+	recentlyExpired         map[string]time.Time
+	auditLog                AuditLog
+	recentlyExpiredDuration time.Duration
+}
+
+func NewMemoryKeyStore(auditLog AuditLog, cfg *config.Config) KeyStore {
+	return &MemoryKeyStore{
+		keys:                    make(map[string]models.BoradcastKey),
+		recentlyExpired:         make(map[string]time.Time),
+		auditLog:                auditLog,
+		recentlyExpiredDuration: time.Duration(cfg.KeyStore.RecentlyExpiredDurationHours) * time.Hour,
+	}
+}
+
+func (k *MemoryKeyStore) StoreKey(key models.BoradcastKey, maxLiveKeys int) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	keyId := key.KeyId.String()
+	if _, exists := k.keys[keyId]; exists {
+		return fmt.Errorf("key with id '%s' already exists", keyId)
+	}
+
+	if key.Group != "" {
+		// Expired keys give up their group before the cleanup job removes them
+		if existing := k.groupKey(key.OwnerTokenId, key.Group); existing != nil && !existing.Expiration.Before(time.Now()) {
+			return errors.KeyGroupExistsError(key.Group, existing.KeyId.String(), existing.Expiration)
+		}
+	}
+
+	if maxLiveKeys > 0 && k.countLiveKeys(key.OwnerTokenId) >= int64(maxLiveKeys) {
+		return errors.QuotaExceededError("max_live_keys", fmt.Sprint(maxLiveKeys))
+	}
+
+	k.keys[keyId] = key
+	return nil
+}
+
+func (k *MemoryKeyStore) CountLiveKeys(ownerTokenId string) (int64, error) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	return k.countLiveKeys(ownerTokenId), nil
+}
+
+// countLiveKeys must be called with the mutex held
+func (k *MemoryKeyStore) countLiveKeys(ownerTokenId string) int64 {
+	now := time.Now()
+	var count int64
+	for _, key := range k.keys {
+		if key.OwnerTokenId == ownerTokenId && key.Expiration.After(now) {
+			count++
+		}
+	}
+	return count
+}
+
+func (k *MemoryKeyStore) GetGroupKeyId(ownerTokenId string, group string) (string, error) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if key := k.groupKey(ownerTokenId, group); key != nil {
+		return key.KeyId.String(), nil
+	}
+	return "", nil
+}
+
+// groupKey returns the newest key in the group, it must be called with the mutex held
+func (k *MemoryKeyStore) groupKey(ownerTokenId string, group string) *models.BoradcastKey {
+	var result *models.BoradcastKey
+	for _, key := range k.keys {
+		if key.OwnerTokenId == ownerTokenId && key.Group == group && (result == nil || key.Expiration.After(result.Expiration)) {
+			result = &key
+		}
+	}
+	return result
+}
+
+func (k *MemoryKeyStore) DestroyKey(keyId string, ownerTokenId string) (bool, error) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	key, exists := k.keys[keyId]
+	if !exists || key.OwnerTokenId != ownerTokenId {
+		return false, nil
+	}
+
+	delete(k.keys, keyId)
+	return true, nil
+}
+
+func (k *MemoryKeyStore) GetKey(keyId string) (*models.BoradcastKey, error) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	key, exists := k.keys[keyId]
+	if exists {
+		if !key.Expiration.Before(time.Now()) {
+			return &key, nil
+		}
+
+		// Expired too long ago, treat as not found
+		if key.Expiration.Before(time.Now().Add(-k.recentlyExpiredDuration)) {
+			if err := k.deleteExpiredKey(keyId, key.Expiration); err != nil {
+				return nil, err
+			}
+			return nil, errors.KeyNotFoundError(keyId)
+		}
+
+		if err := k.moveToRecentlyExpired(keyId, key.Expiration); err != nil {
+			return nil, err
+		}
+		return nil, errors.KeyExpiredError(keyId, key.Expiration)
+	}
+
+	if expiration, exists := k.recentlyExpired[keyId]; exists {
+		return nil, errors.KeyExpiredError(keyId, expiration)
+	}
+	return nil, errors.KeyNotFoundError(keyId)
+}
+
+func (k *MemoryKeyStore) CleanupExpiredKeys() error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	cutoffTime := time.Now().Add(-k.recentlyExpiredDuration)
+	for keyId, expiration := range k.recentlyExpired {
+		if expiration.Before(cutoffTime) {
+			delete(k.recentlyExpired, keyId)
+		}
+	}
+
+	now := time.Now()
+	for keyId, key := range k.keys {
+		var err error
+		if key.Expiration.Before(cutoffTime) {
+			err = k.deleteExpiredKey(keyId, key.Expiration)
+		} else if key.Expiration.Before(now) {
+			err = k.moveToRecentlyExpired(keyId, key.Expiration)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to cleanup expired keys: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// deleteExpiredKey must be called with the mutex held
+func (k *MemoryKeyStore) deleteExpiredKey(keyId string, expiration time.Time) error {
+	delete(k.keys, keyId)
+	return k.auditLog.Record(AuditKeyDeleted, keyId, expirationDetails(expiration))
+}
+
+// moveToRecentlyExpired must be called with the mutex held
+func (k *MemoryKeyStore) moveToRecentlyExpired(keyId string, expiration time.Time) error {
+	delete(k.keys, keyId)
+	k.recentlyExpired[keyId] = expiration
+	return k.auditLog.Record(AuditKeyExpired, keyId, expirationDetails(expiration))
+}
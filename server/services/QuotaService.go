@@ -0,0 +1,160 @@
+package services
+
+import (
+	"ForgettiServer/config"
+	"ForgettiServer/db/repositories"
+	apiErrors "ForgettiServer/errors"
+	"ForgettiServer/models"
+	"errors"
+	"fmt"
+	"forgetti-common/logging"
+	"time"
+)
+
+const usageDayFormat = "2006-01-02"
+
+type QuotaService interface {
+	ReserveNewKey(owner *models.ApiToken, expiration time.Time) error
+	StoreNewKey(owner *models.ApiToken, key models.BoradcastKey) error
+	ReleaseNewKey(owner *models.ApiToken)
+	MaxExpiration(owner *models.ApiToken) time.Duration
+	GetUsage(owner *models.ApiToken) (*models.TokenUsage, error)
+	CleanupOldUsage() error
+}
+
+type QuotaServiceImpl struct {
+	keyStore       KeyStore
+	tokenUsageRepo *repositories.TokenUsageRepo
+	minExpiration  time.Duration
+	maxExpiration  time.Duration
+}
+
+func NewQuotaService(keyStore KeyStore, tokenUsageRepo *repositories.TokenUsageRepo, cfg *config.Config) QuotaService {
+	return &QuotaServiceImpl{
+		keyStore:       keyStore,
+		tokenUsageRepo: tokenUsageRepo,
+		minExpiration:  cfg.MinExpiration(),
+		maxExpiration:  cfg.MaxExpiration(),
+	}
+}
+
+// ReserveNewKey verifies that a key with the given expiration may be created by the owner (nil for anonymous requests),
+// and counts it towards the daily cap of the owner. The key must then be stored with StoreNewKey, or the reservation
+// given back with ReleaseNewKey.
+func (q *QuotaServiceImpl) ReserveNewKey(owner *models.ApiToken, expiration time.Time) error {
+	logger := logging.MakeLogger("services.QuotaService.ReserveNewKey")
+
+	if expiration.Before(time.Now().Add(q.minExpiration)) {
+		return apiErrors.BadRequestError(fmt.Errorf("expiration must be at least %s in the future", q.minExpiration.String()))
+	}
+
+	maxExpiration := q.MaxExpiration(owner)
+	if expiration.After(time.Now().Add(maxExpiration)) {
+		if owner == nil || owner.Quota.MaxExpiration == 0 {
+			return apiErrors.BadRequestError(fmt.Errorf("expiration must be less than %s in the future", maxExpiration.String()))
+		}
+
+		logger.Info("Token '%s' requested expiration beyond its limit of %s", owner.Name, maxExpiration.String())
+		return apiErrors.QuotaExceededError("max_expiration", maxExpiration.String())
+	}
+
+	if owner == nil {
+		return nil
+	}
+
+	usage, err := q.GetUsage(owner)
+	if err != nil {
+		return err
+	}
+
+	// Checked before the daily cap is counted, StoreNewKey enforces the limit for concurrent requests
+	if owner.Quota.MaxLiveKeys > 0 && usage.LiveKeys >= int64(owner.Quota.MaxLiveKeys) {
+		logger.Info("Token '%s' reached its live key limit of %d", owner.Name, owner.Quota.MaxLiveKeys)
+		return apiErrors.QuotaExceededError("max_live_keys", fmt.Sprint(owner.Quota.MaxLiveKeys))
+	}
+
+	reserved, err := q.tokenUsageRepo.TryIncrementKeysCreated(owner.Id, usageDay(time.Now()), int64(owner.Quota.DailyKeyCap))
+	if err != nil {
+		return err
+	}
+	if !reserved {
+		logger.Info("Token '%s' reached its daily key cap of %d", owner.Name, owner.Quota.DailyKeyCap)
+		return apiErrors.QuotaExceededError("daily_key_cap", fmt.Sprint(owner.Quota.DailyKeyCap))
+	}
+
+	return nil
+}
+
+// StoreNewKey stores the key reserved with ReserveNewKey, within the live key limit of the owner. The reservation is
+// given back if the key is not stored.
+func (q *QuotaServiceImpl) StoreNewKey(owner *models.ApiToken, key models.BoradcastKey) error {
+	logger := logging.MakeLogger("services.QuotaService.StoreNewKey")
+
+	maxLiveKeys := 0
+	if owner != nil {
+		maxLiveKeys = owner.Quota.MaxLiveKeys
+	}
+
+	err := q.keyStore.StoreKey(key, maxLiveKeys)
+	if err != nil {
+		var apiErr *apiErrors.ApiError
+		if errors.As(err, &apiErr) && apiErr.Data["quota"] == "max_live_keys" {
+			logger.Info("Token '%s' reached its live key limit of %d", owner.Name, maxLiveKeys)
+		}
+		q.ReleaseNewKey(owner)
+		return err
+	}
+
+	return nil
+}
+
+// ReleaseNewKey gives back the reservation of a key that was not created, so that it does not count towards the daily
+// cap of the owner
+func (q *QuotaServiceImpl) ReleaseNewKey(owner *models.ApiToken) {
+	logger := logging.MakeLogger("services.QuotaService.ReleaseNewKey")
+
+	if owner == nil {
+		return
+	}
+
+	if err := q.tokenUsageRepo.DecrementKeysCreated(owner.Id, usageDay(time.Now())); err != nil {
+		logger.Error("Failed to give back the key reserved by token '%s': %v", owner.Name, err)
+	}
+}
+
+func (q *QuotaServiceImpl) GetUsage(owner *models.ApiToken) (*models.TokenUsage, error) {
+	liveKeys, err := q.keyStore.CountLiveKeys(owner.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	keysCreatedToday, err := q.tokenUsageRepo.GetKeysCreated(owner.Id, usageDay(time.Now()))
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.TokenUsage{
+		Token:            owner,
+		LiveKeys:         liveKeys,
+		KeysCreatedToday: keysCreatedToday,
+		MaxExpiration:    q.MaxExpiration(owner),
+	}, nil
+}
+
+// CleanupOldUsage drops daily usage counters that no longer affect any quota
+func (q *QuotaServiceImpl) CleanupOldUsage() error {
+	return q.tokenUsageRepo.DeleteBefore(usageDay(time.Now()))
+}
+
+// MaxExpiration returns the expiration limit of the owner (nil for anonymous requests), or the server default
+func (q *QuotaServiceImpl) MaxExpiration(owner *models.ApiToken) time.Duration {
+	if owner != nil && owner.Quota.MaxExpiration > 0 {
+		return owner.Quota.MaxExpiration
+	}
+
+	return q.maxExpiration
+}
+
+func usageDay(t time.Time) string {
+	return t.UTC().Format(usageDayFormat)
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"ForgettiServer/config"
+	"ForgettiServer/db/dbtest"
+	apiErrors "ForgettiServer/errors"
+	"ForgettiServer/models"
+	"errors"
+	"forgetti-common/crypto"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// forEachKeyStore runs the test against the service container of every key store backend
+func forEachKeyStore(t *testing.T, test func(t *testing.T, container *ServiceContainer)) {
+	dbtest.ForEachDriver(t, func(t *testing.T, cfg *config.Config, database *gorm.DB) {
+		for _, backend := range []string{"database", "memory"} {
+			t.Run(backend, func(t *testing.T) {
+				cfg.KeyStore.Backend = backend
+				container, err := CreateServiceContainer(cfg)
+				if err != nil {
+					t.Fatalf("CreateServiceContainer() error = %v", err)
+				}
+				test(t, container)
+			})
+		}
+	})
+}
+
+// createKeysConcurrently creates the keys at the same time, returning the number of keys created and the errors of the
+// others
+func createKeysConcurrently(container *ServiceContainer, owner *models.ApiToken, keys int) (int, []error) {
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	created := 0
+	var errs []error
+	for range keys {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := container.Encryptor.CreateNewKeyAndEncrypt("content", time.Now().Add(time.Hour), owner, nil, "")
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+			} else {
+				created++
+			}
+		}()
+	}
+	wg.Wait()
+	return created, errs
+}
+
+func expectQuotaExceeded(t *testing.T, errs []error, quota string) {
+	t.Helper()
+
+	for _, err := range errs {
+		var apiErr *apiErrors.ApiError
+		if !errors.As(err, &apiErr) || apiErr.ErrorCode != "quota-exceeded" || apiErr.Data["quota"] != quota {
+			t.Errorf("Error = %v, want %s quota exceeded", err, quota)
+		}
+	}
+}
+
+func TestQuotaServiceLimitsLiveKeysOfConcurrentRequests(t *testing.T) {
+	forEachKeyStore(t, func(t *testing.T, container *ServiceContainer) {
+		_, owner, err := container.TokenService.CreateToken("limited", models.TokenQuota{MaxLiveKeys: 3})
+		if err != nil {
+			t.Fatalf("CreateToken() error = %v", err)
+		}
+
+		created, errs := createKeysConcurrently(container, owner, 10)
+		if created != 3 {
+			t.Errorf("Created %d keys, want 3", created)
+		}
+		expectQuotaExceeded(t, errs, "max_live_keys")
+
+		usage, err := container.QuotaService.GetUsage(owner)
+		if err != nil {
+			t.Fatalf("GetUsage() error = %v", err)
+		}
+		if usage.LiveKeys != 3 || usage.KeysCreatedToday != 3 {
+			t.Errorf("GetUsage() = %d live keys and %d created today, want 3 and 3", usage.LiveKeys, usage.KeysCreatedToday)
+		}
+	})
+}
+
+func TestQuotaServiceLimitsDailyKeysOfConcurrentRequests(t *testing.T) {
+	forEachKeyStore(t, func(t *testing.T, container *ServiceContainer) {
+		_, owner, err := container.TokenService.CreateToken("capped", models.TokenQuota{DailyKeyCap: 4})
+		if err != nil {
+			t.Fatalf("CreateToken() error = %v", err)
+		}
+
+		created, errs := createKeysConcurrently(container, owner, 10)
+		if created != 4 {
+			t.Errorf("Created %d keys, want 4", created)
+		}
+		expectQuotaExceeded(t, errs, "daily_key_cap")
+	})
+}
+
+func TestQuotaServiceReleasesReservationOfKeyNotStored(t *testing.T) {
+	keyPair, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair() error = %v", err)
+	}
+
+	forEachKeyStore(t, func(t *testing.T, container *ServiceContainer) {
+		_, owner, err := container.TokenService.CreateToken("released", models.TokenQuota{MaxLiveKeys: 1, DailyKeyCap: 2})
+		if err != nil {
+			t.Fatalf("CreateToken() error = %v", err)
+		}
+		newKey := func() models.BoradcastKey {
+			return models.BoradcastKey{KeyId: uuid.New(), Expiration: time.Now().Add(time.Hour), Key: keyPair.BroadcastKey, OwnerTokenId: owner.Id}
+		}
+
+		// Both reservations pass, as no key is live yet
+		for range 2 {
+			if err := container.QuotaService.ReserveNewKey(owner, time.Now().Add(time.Hour)); err != nil {
+				t.Fatalf("ReserveNewKey() error = %v", err)
+			}
+		}
+		if err := container.QuotaService.StoreNewKey(owner, newKey()); err != nil {
+			t.Fatalf("StoreNewKey() error = %v", err)
+		}
+		err = container.QuotaService.StoreNewKey(owner, newKey())
+		expectQuotaExceeded(t, []error{err}, "max_live_keys")
+		if err == nil {
+			t.Error("StoreNewKey() beyond the live key limit succeeded")
+		}
+
+		usage, err := container.QuotaService.GetUsage(owner)
+		if err != nil {
+			t.Fatalf("GetUsage() error = %v", err)
+		}
+		if usage.LiveKeys != 1 || usage.KeysCreatedToday != 1 {
+			t.Errorf("GetUsage() = %d live keys and %d created today, want 1 and 1", usage.LiveKeys, usage.KeysCreatedToday)
+		}
+
+		// Releasing more than was reserved leaves the counter at zero
+		container.QuotaService.ReleaseNewKey(owner)
+		container.QuotaService.ReleaseNewKey(owner)
+		if usage, err := container.QuotaService.GetUsage(owner); err != nil || usage.KeysCreatedToday != 0 {
+			t.Errorf("GetUsage() = %+v, %v, want no keys created today", usage, err)
+		}
+	})
+}
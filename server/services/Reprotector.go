@@ -0,0 +1,93 @@
+package services
+
+import (
+	"ForgettiServer/config"
+	"ForgettiServer/db/repositories"
+	"fmt"
+	"forgetti-common/logging"
+)
+
+type ReprotectResult struct {
+	Reprotected int
+	Failed      int
+}
+
+type ReprotectStatus struct {
+	ActiveKeyPrefix string
+	Outdated        int64
+}
+
+// Reprotector rewrites stored keys under the active data protection key, so that retired keys can be removed
+type Reprotector struct {
+	keyRepo        *repositories.KeyRepo
+	dataProtection DataProtection
+	batchSize      int
+}
+
+func NewReprotector(keyRepo *repositories.KeyRepo, dataProtection DataProtection, cfg *config.Config) *Reprotector {
+	return &Reprotector{
+		keyRepo:        keyRepo,
+		dataProtection: dataProtection,
+		batchSize:      cfg.DataProtection.ReprotectBatchSize,
+	}
+}
+
+// Status counts the stored keys that are not protected with the active key yet
+func (r *Reprotector) Status() (*ReprotectStatus, error) {
+	prefix := r.dataProtection.ActiveKeyPrefix()
+	outdated, err := r.keyRepo.CountNotProtectedWith(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ReprotectStatus{ActiveKeyPrefix: prefix, Outdated: outdated}, nil
+}
+
+// ReprotectAll re-protects every stored key that is not protected with the active key. Keys that cannot be
+// unprotected, for example because their key was removed from the keyring, are counted as failed and skipped.
+func (r *Reprotector) ReprotectAll() (*ReprotectResult, error) {
+	logger := logging.MakeLogger("services.Reprotector.ReprotectAll")
+
+	prefix := r.dataProtection.ActiveKeyPrefix()
+	result := &ReprotectResult{}
+	afterId := ""
+	for {
+		records, err := r.keyRepo.ListNotProtectedWith(prefix, afterId, r.batchSize)
+		if err != nil {
+			return result, err
+		}
+		if len(records) == 0 {
+			break
+		}
+
+		for _, record := range records {
+			afterId = record.Id
+
+			serializedKey, err := r.dataProtection.Unprotect(record.SerializedKey)
+			if err != nil {
+				logger.Error("Failed to unprotect key %s: %v", logging.KeyId(record.Id), err)
+				result.Failed++
+				continue
+			}
+
+			// The error is logged by the caller, which does not know that it names a key
+			protectedKey, err := r.dataProtection.Protect(serializedKey)
+			if err != nil {
+				logger.Error("Failed to protect key %s: %v", logging.KeyId(record.Id), err)
+				return result, fmt.Errorf("failed to protect key: %w", err)
+			}
+
+			// A key that changed or was deleted concurrently needs no re-protection by this run
+			replaced, err := r.keyRepo.ReplaceSerializedKey(record.Id, record.SerializedKey, protectedKey)
+			if err != nil {
+				return result, err
+			}
+			if replaced {
+				result.Reprotected++
+			}
+		}
+	}
+
+	logger.Info("Re-protected %d keys with the active data protection key, %d failed", result.Reprotected, result.Failed)
+	return result, nil
+}
@@ -11,13 +11,25 @@ type ServiceContainer struct {
 	DatabaseService     *db.DatabaseService
 	KeyRepo             *repositories.KeyRepo
 	RecentlyExpiredRepo *repositories.RecentlyExpiredRepo
+	ApiTokenRepo        *repositories.ApiTokenRepo
+	TokenUsageRepo      *repositories.TokenUsageRepo
+	AuditRepo           *repositories.AuditRepo
+	WebhookRepo         *repositories.WebhookRepo
+	WebhookDeliveryRepo *repositories.WebhookDeliveryRepo
 	Encryptor           Encryptor
 	KeyStore            KeyStore
 	DataProtection      DataProtection
+	TokenService        TokenService
+	QuotaService        QuotaService
+	AuditLog            *AuditLogImpl
+	WebhookService      *WebhookServiceImpl
+	WebhookDispatcher   *WebhookDispatcher
+	Reprotector         *Reprotector
+	Sweeper             *Sweeper
 }
 
 func CreateServiceContainer(cfg *config.Config) (*ServiceContainer, error) {
-	database, err := db.CreateDb(cfg)
+	database, err := db.CreateDb(databaseConfig(cfg))
 	if err != nil {
 		return nil, err
 	}
@@ -25,19 +37,83 @@ func CreateServiceContainer(cfg *config.Config) (*ServiceContainer, error) {
 	databaseService := db.NewDatabaseService(database)
 	keyRepo := repositories.NewKeyRepo(database)
 	recentlyExpiredRepo := repositories.NewRecentlyExpiredRepo(database)
-	
-	dataProtection := NewDataProtection(cfg)
-	keyStore := NewKeyStore(keyRepo, recentlyExpiredRepo, dataProtection, cfg)
-	encryptor := CreateEncryptor(keyStore)
+	apiTokenRepo := repositories.NewApiTokenRepo(database)
+	tokenUsageRepo := repositories.NewTokenUsageRepo(database)
+	auditRepo := repositories.NewAuditRepo(database)
+	webhookRepo := repositories.NewWebhookRepo(database)
+	webhookDeliveryRepo := repositories.NewWebhookDeliveryRepo(database)
 
+	dataProtection, err := NewDataProtection(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	auditLog := NewAuditLog(auditRepo, cfg)
+	keyStore := createKeyStore(keyRepo, recentlyExpiredRepo, dataProtection, auditLog, cfg)
+	quotaService := NewQuotaService(keyStore, tokenUsageRepo, cfg)
+	webhookService := NewWebhookService(webhookRepo, webhookDeliveryRepo, dataProtection, cfg)
+	encryptor := CreateEncryptor(keyStore, quotaService, auditLog, webhookService)
+	reprotector := NewReprotector(keyRepo, dataProtection, cfg)
+	sweeper := NewSweeper(keyStore, quotaService, backgroundReprotector(reprotector, cfg), auditLog, cfg)
+	tokenService := NewTokenService(apiTokenRepo, tokenUsageRepo)
+	webhookDispatcher := NewWebhookDispatcher(webhookService, cfg)
 
 	return &ServiceContainer{
 		Config:              cfg,
 		DatabaseService:     databaseService,
 		KeyRepo:             keyRepo,
 		RecentlyExpiredRepo: recentlyExpiredRepo,
+		ApiTokenRepo:        apiTokenRepo,
+		TokenUsageRepo:      tokenUsageRepo,
+		AuditRepo:           auditRepo,
+		WebhookRepo:         webhookRepo,
+		WebhookDeliveryRepo: webhookDeliveryRepo,
 		DataProtection:      dataProtection,
 		KeyStore:            keyStore,
 		Encryptor:           encryptor,
+		Reprotector:         reprotector,
+		Sweeper:             sweeper,
+		TokenService:        tokenService,
+		QuotaService:        quotaService,
+		AuditLog:            auditLog,
+		WebhookService:      webhookService,
+		WebhookDispatcher:   webhookDispatcher,
 	}, nil
 }
+
+// databaseConfig returns the configuration of the database used by the services. The memory key store writes nothing to
+// disk, so the token usage, audit log and webhooks of its keys are kept in an in-memory database as well.
+func databaseConfig(cfg *config.Config) *config.Config {
+	if cfg.KeyStore.Backend != "memory" {
+		return cfg
+	}
+
+	memoryCfg := *cfg
+	memoryCfg.Database.Driver = "sqlite"
+	memoryCfg.Database.Path = db.InMemorySqlitePath
+	memoryCfg.Database.ManualMigrations = false
+	return &memoryCfg
+}
+
+func createKeyStore(
+	keyRepo *repositories.KeyRepo,
+	recentlyExpiredRepo *repositories.RecentlyExpiredRepo,
+	dataProtection DataProtection,
+	auditLog AuditLog,
+	cfg *config.Config,
+) KeyStore {
+	if cfg.KeyStore.Backend == "memory" {
+		return NewMemoryKeyStore(auditLog, cfg)
+	}
+
+	return NewKeyStore(keyRepo, recentlyExpiredRepo, dataProtection, auditLog, cfg)
+}
+
+// backgroundReprotector returns the reprotector when the sweeper should run it, nil otherwise
+func backgroundReprotector(reprotector *Reprotector, cfg *config.Config) *Reprotector {
+	if !cfg.DataProtection.BackgroundReprotect || cfg.KeyStore.Backend == "memory" {
+		return nil
+	}
+
+	return reprotector
+}
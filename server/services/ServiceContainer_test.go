@@ -0,0 +1,53 @@
+package services
+
+import (
+	"ForgettiServer/db/dbtest"
+	"ForgettiServer/models"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMemoryKeyStoreCreatesNoDatabaseFile(t *testing.T) {
+	for _, backend := range []string{"database", "memory"} {
+		t.Run(backend, func(t *testing.T) {
+			cfg := dbtest.NewConfig()
+			cfg.KeyStore.Backend = backend
+			cfg.Database.Driver = "sqlite"
+			cfg.Database.Path = filepath.Join(t.TempDir(), "forgetti.db")
+
+			container, err := CreateServiceContainer(cfg)
+			if err != nil {
+				t.Fatalf("CreateServiceContainer() error = %v", err)
+			}
+			defer container.DatabaseService.Close()
+
+			_, owner, err := container.TokenService.CreateToken("ci", models.TokenQuota{})
+			if err != nil {
+				t.Fatalf("CreateToken() error = %v", err)
+			}
+			if _, err := container.Encryptor.CreateNewKeyAndEncrypt("content", time.Now().Add(time.Hour), owner, nil, ""); err != nil {
+				t.Fatalf("CreateNewKeyAndEncrypt() error = %v", err)
+			}
+
+			_, err = os.Stat(cfg.Database.Path)
+			if backend == "memory" && !os.IsNotExist(err) {
+				t.Errorf("Stat() error = %v, want no database file for the memory key store", err)
+			}
+			if backend == "database" && err != nil {
+				t.Errorf("Stat() error = %v, want the database file", err)
+			}
+		})
+	}
+}
+
+func TestMemoryKeyStoreRejectsRequiredTokens(t *testing.T) {
+	cfg := dbtest.NewConfig()
+	cfg.KeyStore.Backend = "memory"
+	cfg.Auth.RequireTokenForNewKey = true
+
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate() accepted required API tokens with the memory key store")
+	}
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"ForgettiServer/config"
+	"forgetti-common/logging"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Sweeper struct {
+	keyStore KeyStore
+	quotas   QuotaService
+	// reprotector is nil unless keys are re-protected in the background
+	reprotector *Reprotector
+	auditLog    *AuditLogImpl
+	interval    time.Duration
+	started     atomic.Bool
+	stop        chan struct{}
+	done        chan struct{}
+	once        sync.Once
+}
+
+func NewSweeper(keyStore KeyStore, quotas QuotaService, reprotector *Reprotector, auditLog *AuditLogImpl, cfg *config.Config) *Sweeper {
+	return &Sweeper{
+		keyStore:    keyStore,
+		quotas:      quotas,
+		reprotector: reprotector,
+		auditLog:    auditLog,
+		interval:    time.Duration(cfg.KeyStore.CleanupIntervalMinutes) * time.Minute,
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+func (s *Sweeper) Start() {
+	logger := logging.MakeLogger("services.Sweeper.Start")
+	logger.Verbose("Starting expired key sweeper with interval: %s", s.interval.String())
+	s.started.Store(true)
+	go s.run()
+}
+
+// Stop signals the sweeper to exit and waits for a sweep in progress to finish. Does nothing if the sweeper was not
+// started.
+func (s *Sweeper) Stop() {
+	logger := logging.MakeLogger("services.Sweeper.Stop")
+
+	s.once.Do(func() {
+		close(s.stop)
+		if !s.started.Load() {
+			return
+		}
+
+		logger.Verbose("Stopping expired key sweeper")
+		<-s.done
+		logger.Verbose("Expired key sweeper stopped")
+	})
+}
+
+func (s *Sweeper) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.sweep()
+		}
+	}
+}
+
+func (s *Sweeper) sweep() {
+	logger := logging.MakeLogger("services.Sweeper.sweep")
+	logger.Verbose("Cleaning up expired keys")
+
+	if err := s.keyStore.CleanupExpiredKeys(); err != nil {
+		logger.Error("Failed to clean up expired keys: %v", err)
+	} else {
+		logger.Verbose("Expired keys cleaned up successfully")
+	}
+
+	logger.Verbose("Cleaning up old token usage")
+	if err := s.quotas.CleanupOldUsage(); err != nil {
+		logger.Error("Failed to clean up old token usage: %v", err)
+	} else {
+		logger.Verbose("Old token usage cleaned up successfully")
+	}
+
+	logger.Verbose("Applying audit log retention")
+	if removed, err := s.auditLog.ApplyRetention(); err != nil {
+		logger.Error("Failed to apply audit log retention: %v", err)
+	} else if removed > 0 {
+		logger.Info("Removed %d audit log entries past retention", removed)
+	}
+
+	if s.reprotector != nil {
+		logger.Verbose("Re-protecting keys")
+		if _, err := s.reprotector.ReprotectAll(); err != nil {
+			logger.Error("Failed to re-protect keys: %v", err)
+		}
+	}
+}
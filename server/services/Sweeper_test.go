@@ -0,0 +1,54 @@
+package services
+
+import (
+	"ForgettiServer/config"
+	"ForgettiServer/db/dbtest"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// expectReturns fails the test if stop does not return in time
+func expectReturns(t *testing.T, name string, stop func()) {
+	t.Helper()
+
+	stopped := make(chan struct{})
+	go func() {
+		stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("%s did not return", name)
+	}
+}
+
+func TestSweeperStopWithoutStart(t *testing.T) {
+	dbtest.ForEachDriver(t, func(t *testing.T, cfg *config.Config, database *gorm.DB) {
+		container, err := CreateServiceContainer(cfg)
+		if err != nil {
+			t.Fatalf("CreateServiceContainer() error = %v", err)
+		}
+		defer container.DatabaseService.Close()
+
+		// As on shutdown after the listener could not be opened
+		expectReturns(t, "WebhookDispatcher.Stop()", container.WebhookDispatcher.Stop)
+		expectReturns(t, "Sweeper.Stop()", container.Sweeper.Stop)
+		expectReturns(t, "Sweeper.Stop() called twice", container.Sweeper.Stop)
+	})
+}
+
+func TestSweeperStop(t *testing.T) {
+	dbtest.ForEachDriver(t, func(t *testing.T, cfg *config.Config, database *gorm.DB) {
+		container, err := CreateServiceContainer(cfg)
+		if err != nil {
+			t.Fatalf("CreateServiceContainer() error = %v", err)
+		}
+		defer container.DatabaseService.Close()
+
+		container.Sweeper.Start()
+		expectReturns(t, "Sweeper.Stop()", container.Sweeper.Stop)
+	})
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"ForgettiServer/db/repositories"
+	"ForgettiServer/models"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"forgetti-common/crypto"
+	"forgetti-common/logging"
+
+	"github.com/google/uuid"
+)
+
+const tokenPrefix = "fgt_"
+const tokenBytes = 32
+
+type TokenService interface {
+	CreateToken(name string, quota models.TokenQuota) (string, *models.ApiToken, error)
+	Authenticate(token string) (*models.ApiToken, error)
+	ListTokens() ([]models.ApiToken, error)
+	SetQuota(id string, quota models.TokenQuota) error
+	RevokeToken(id string) error
+}
+
+type TokenServiceImpl struct {
+	apiTokenRepo   *repositories.ApiTokenRepo
+	tokenUsageRepo *repositories.TokenUsageRepo
+}
+
+func NewTokenService(apiTokenRepo *repositories.ApiTokenRepo, tokenUsageRepo *repositories.TokenUsageRepo) TokenService {
+	return &TokenServiceImpl{
+		apiTokenRepo:   apiTokenRepo,
+		tokenUsageRepo: tokenUsageRepo,
+	}
+}
+
+// CreateToken generates a new token and returns it in plain text - only its hash is stored
+func (t *TokenServiceImpl) CreateToken(name string, quota models.TokenQuota) (string, *models.ApiToken, error) {
+	logger := logging.MakeLogger("services.TokenService.CreateToken")
+	logger.Verbose("Creating API token '%s'", name)
+
+	randomBytes := make([]byte, tokenBytes)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+	token := tokenPrefix + base64.RawURLEncoding.EncodeToString(randomBytes)
+
+	tokenHash, err := hashToken(token)
+	if err != nil {
+		return "", nil, err
+	}
+
+	record, err := t.apiTokenRepo.Create(
+		uuid.New().String(),
+		name,
+		tokenHash,
+		quota.MaxLiveKeys,
+		int(quota.MaxExpiration.Hours()),
+		quota.DailyKeyCap,
+	)
+	if err != nil {
+		return "", nil, err
+	}
+
+	logger.Info("Created API token '%s' with id: %s", name, record.Id)
+	return token, models.ApiTokenFromDbModel(record), nil
+}
+
+// Authenticate returns the token matching the given plain text value, or nil if there is none
+func (t *TokenServiceImpl) Authenticate(token string) (*models.ApiToken, error) {
+	tokenHash, err := hashToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	record, err := t.apiTokenRepo.GetByHash(tokenHash)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, nil
+	}
+
+	return models.ApiTokenFromDbModel(record), nil
+}
+
+func (t *TokenServiceImpl) ListTokens() ([]models.ApiToken, error) {
+	records, err := t.apiTokenRepo.List()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]models.ApiToken, 0, len(records))
+	for _, record := range records {
+		result = append(result, *models.ApiTokenFromDbModel(&record))
+	}
+
+	return result, nil
+}
+
+func (t *TokenServiceImpl) SetQuota(id string, quota models.TokenQuota) error {
+	logger := logging.MakeLogger("services.TokenService.SetQuota")
+
+	updated, err := t.apiTokenRepo.UpdateQuota(id, quota.MaxLiveKeys, int(quota.MaxExpiration.Hours()), quota.DailyKeyCap)
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return fmt.Errorf("token not found: %s", id)
+	}
+
+	logger.Info("Updated quota of API token: %s", id)
+	return nil
+}
+
+func (t *TokenServiceImpl) RevokeToken(id string) error {
+	logger := logging.MakeLogger("services.TokenService.RevokeToken")
+
+	deleted, err := t.apiTokenRepo.Delete(id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return fmt.Errorf("token not found: %s", id)
+	}
+
+	if err := t.tokenUsageRepo.DeleteForToken(id); err != nil {
+		return err
+	}
+
+	logger.Info("Revoked API token: %s", id)
+	return nil
+}
+
+func hashToken(token string) (string, error) {
+	hash, err := crypto.HashToSize(token, "api_token", 32)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash token: %w", err)
+	}
+
+	return hex.EncodeToString(hash), nil
+}
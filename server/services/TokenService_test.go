@@ -0,0 +1,76 @@
+package services
+
+import (
+	"ForgettiServer/config"
+	"ForgettiServer/db/dbtest"
+	"ForgettiServer/models"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestTokenServiceStoresOnlyHash(t *testing.T) {
+	dbtest.ForEachDriver(t, func(t *testing.T, cfg *config.Config, database *gorm.DB) {
+		container, err := CreateServiceContainer(cfg)
+		if err != nil {
+			t.Fatalf("CreateServiceContainer() error = %v", err)
+		}
+
+		token, created, err := container.TokenService.CreateToken("ci", models.TokenQuota{})
+		if err != nil {
+			t.Fatalf("CreateToken() error = %v", err)
+		}
+		if !strings.HasPrefix(token, tokenPrefix) {
+			t.Errorf("CreateToken() token = %s, want prefix %s", token, tokenPrefix)
+		}
+
+		record, err := container.ApiTokenRepo.GetById(created.Id)
+		if err != nil || record == nil {
+			t.Fatalf("GetById() = %v, %v, want the created token", record, err)
+		}
+		tokenHash, err := hashToken(token)
+		if err != nil {
+			t.Fatalf("hashToken() error = %v", err)
+		}
+		if record.TokenHash != tokenHash || strings.Contains(record.TokenHash, token) {
+			t.Errorf("Stored hash = %s, want %s", record.TokenHash, tokenHash)
+		}
+	})
+}
+
+func TestTokenServiceAuthenticate(t *testing.T) {
+	dbtest.ForEachDriver(t, func(t *testing.T, cfg *config.Config, database *gorm.DB) {
+		container, err := CreateServiceContainer(cfg)
+		if err != nil {
+			t.Fatalf("CreateServiceContainer() error = %v", err)
+		}
+
+		token, created, err := container.TokenService.CreateToken("ci", models.TokenQuota{MaxLiveKeys: 3})
+		if err != nil {
+			t.Fatalf("CreateToken() error = %v", err)
+		}
+
+		found, err := container.TokenService.Authenticate(token)
+		if err != nil || found == nil {
+			t.Fatalf("Authenticate() = %v, %v, want the created token", found, err)
+		}
+		if found.Id != created.Id || found.Name != "ci" || found.Quota.MaxLiveKeys != 3 {
+			t.Errorf("Authenticate() = %+v, want %+v", found, created)
+		}
+
+		if found, err := container.TokenService.Authenticate(token + "x"); err != nil || found != nil {
+			t.Errorf("Authenticate() of an unknown token = %v, %v, want nil", found, err)
+		}
+
+		if err := container.TokenService.RevokeToken(created.Id); err != nil {
+			t.Fatalf("RevokeToken() error = %v", err)
+		}
+		if found, err := container.TokenService.Authenticate(token); err != nil || found != nil {
+			t.Errorf("Authenticate() of a revoked token = %v, %v, want nil", found, err)
+		}
+		if err := container.TokenService.RevokeToken(created.Id); err == nil {
+			t.Error("RevokeToken() of a revoked token succeeded")
+		}
+	})
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"ForgettiServer/config"
+	"context"
+	"forgetti-common/logging"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WebhookDispatcher periodically queues and sends webhook notifications
+type WebhookDispatcher struct {
+	webhooks *WebhookServiceImpl
+	interval time.Duration
+	started  atomic.Bool
+	// ctx is cancelled on Stop, which also interrupts the delivery in progress
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+	once   sync.Once
+}
+
+func NewWebhookDispatcher(webhooks *WebhookServiceImpl, cfg *config.Config) *WebhookDispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &WebhookDispatcher{
+		webhooks: webhooks,
+		interval: time.Duration(cfg.Webhooks.PollIntervalSeconds) * time.Second,
+		ctx:      ctx,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+}
+
+// Start does nothing if webhooks are disabled
+func (d *WebhookDispatcher) Start() {
+	logger := logging.MakeLogger("services.WebhookDispatcher.Start")
+	if !d.webhooks.Enabled() {
+		logger.Verbose("Webhooks are disabled, not starting the dispatcher")
+		return
+	}
+
+	logger.Verbose("Starting webhook dispatcher with interval: %s", d.interval.String())
+	d.started.Store(true)
+	go d.run()
+}
+
+// Stop interrupts the delivery in progress and waits for the dispatcher to exit. Deliveries that were not completed
+// are sent again by the next run.
+func (d *WebhookDispatcher) Stop() {
+	logger := logging.MakeLogger("services.WebhookDispatcher.Stop")
+
+	d.once.Do(func() {
+		d.cancel()
+		if !d.started.Load() {
+			return
+		}
+
+		logger.Verbose("Stopping webhook dispatcher")
+		<-d.done
+		logger.Verbose("Webhook dispatcher stopped")
+	})
+}
+
+func (d *WebhookDispatcher) run() {
+	defer close(d.done)
+
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-ticker.C:
+			d.dispatch()
+		}
+	}
+}
+
+func (d *WebhookDispatcher) dispatch() {
+	logger := logging.MakeLogger("services.WebhookDispatcher.dispatch")
+
+	if err := d.webhooks.Schedule(); err != nil {
+		logger.Error("Failed to schedule webhook notifications: %v", err)
+	}
+
+	delivered, err := d.webhooks.Deliver(d.ctx)
+	if err != nil {
+		logger.Error("Failed to deliver webhook notifications: %v", err)
+	}
+	if delivered > 0 {
+		logger.Verbose("Delivered %d webhook notifications", delivered)
+	}
+}
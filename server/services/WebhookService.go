@@ -0,0 +1,355 @@
+package services
+
+import (
+	"ForgettiServer/config"
+	dbModels "ForgettiServer/db/models"
+	"ForgettiServer/db/repositories"
+	apiErrors "ForgettiServer/errors"
+	"ForgettiServer/models"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"forgetti-common/logging"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Webhook events
+const (
+	WebhookKeyExpiringSoon = "key.expiring_soon"
+	WebhookKeyExpired      = "key.expired"
+	WebhookKeyDestroyed    = "key.destroyed" // the server forgot the key, it is no longer reported as expired
+)
+
+// Webhook request headers
+const (
+	WebhookEventHeader     = "X-Forgetti-Event"
+	WebhookDeliveryHeader  = "X-Forgetti-Delivery"
+	WebhookSignatureHeader = "X-Forgetti-Signature"
+)
+
+// webhookBatchSize is the number of webhooks scheduled, and deliveries sent, per query
+const webhookBatchSize = 100
+
+const maxWebhookRetryDelay = 6 * time.Hour
+
+type WebhookService interface {
+	Enabled() bool
+	// Register notifies the target about the lifecycle of the key
+	Register(keyId string, expiration time.Time, target models.WebhookTarget) error
+	// KeyDestroyed notifies the target of the key, if any, that the key was destroyed before it expired
+	KeyDestroyed(keyId string) error
+}
+
+type WebhookServiceImpl struct {
+	webhookRepo             *repositories.WebhookRepo
+	deliveryRepo            *repositories.WebhookDeliveryRepo
+	dataProtection          DataProtection
+	client                  *http.Client
+	enabled                 bool
+	expiringSoon            time.Duration
+	recentlyExpiredDuration time.Duration
+	timeout                 time.Duration
+	maxAttempts             int
+	retryBase               time.Duration
+	now                     func() time.Time
+}
+
+func NewWebhookService(
+	webhookRepo *repositories.WebhookRepo,
+	deliveryRepo *repositories.WebhookDeliveryRepo,
+	dataProtection DataProtection,
+	cfg *config.Config,
+) *WebhookServiceImpl {
+	timeout := time.Duration(cfg.Webhooks.TimeoutSeconds) * time.Second
+	return &WebhookServiceImpl{
+		webhookRepo:             webhookRepo,
+		deliveryRepo:            deliveryRepo,
+		dataProtection:          dataProtection,
+		client:                  newWebhookClient(timeout, cfg.Webhooks.AllowPrivateNetworks),
+		enabled:                 !cfg.Webhooks.Disabled,
+		expiringSoon:            time.Duration(cfg.Webhooks.ExpiringSoonHours) * time.Hour,
+		recentlyExpiredDuration: time.Duration(cfg.KeyStore.RecentlyExpiredDurationHours) * time.Hour,
+		timeout:                 timeout,
+		maxAttempts:             cfg.Webhooks.MaxAttempts,
+		retryBase:               time.Duration(cfg.Webhooks.RetryBaseSeconds) * time.Second,
+		now:                     time.Now,
+	}
+}
+
+func (w *WebhookServiceImpl) Enabled() bool {
+	return w.enabled
+}
+
+func (w *WebhookServiceImpl) Register(keyId string, expiration time.Time, target models.WebhookTarget) error {
+	if !w.enabled {
+		return apiErrors.BadRequestError(errors.New("webhooks are disabled on this server"))
+	}
+
+	serializedTarget, err := json.Marshal(target)
+	if err != nil {
+		return fmt.Errorf("failed to serialize webhook target: %w", err)
+	}
+
+	protectedTarget, err := w.dataProtection.Protect(string(serializedTarget))
+	if err != nil {
+		return fmt.Errorf("failed to protect webhook target: %w", err)
+	}
+
+	return w.webhookRepo.Create(keyId, expiration, protectedTarget)
+}
+
+func (w *WebhookServiceImpl) KeyDestroyed(keyId string) error {
+	record, err := w.webhookRepo.GetByKeyId(keyId)
+	if err != nil || record == nil {
+		return err
+	}
+
+	_, err = w.webhookRepo.DeleteAndEnqueue(keyId, w.newDelivery(WebhookKeyDestroyed, record, w.now()))
+	return err
+}
+
+// Schedule queues the notifications of keys that started expiring soon, expired or were destroyed since the last call
+func (w *WebhookServiceImpl) Schedule() error {
+	now := w.now()
+
+	err := scheduleWebhookBatches(
+		func() ([]dbModels.WebhookRecord, error) {
+			return w.webhookRepo.ListExpiringSoon(now, now.Add(w.expiringSoon), webhookBatchSize)
+		},
+		func(record *dbModels.WebhookRecord) (bool, error) {
+			return w.webhookRepo.MarkAndEnqueue(record.KeyId, "expiring_soon_sent", w.newDelivery(WebhookKeyExpiringSoon, record, now))
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	err = scheduleWebhookBatches(
+		func() ([]dbModels.WebhookRecord, error) {
+			return w.webhookRepo.ListExpired(now, webhookBatchSize)
+		},
+		func(record *dbModels.WebhookRecord) (bool, error) {
+			return w.webhookRepo.MarkAndEnqueue(record.KeyId, "expired_sent", w.newDelivery(WebhookKeyExpired, record, now))
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	// Keys are forgotten once their recently expired period ends, see KeyStore.GetKey
+	return scheduleWebhookBatches(
+		func() ([]dbModels.WebhookRecord, error) {
+			return w.webhookRepo.ListExpiredBefore(now.Add(-w.recentlyExpiredDuration), webhookBatchSize)
+		},
+		func(record *dbModels.WebhookRecord) (bool, error) {
+			return w.webhookRepo.DeleteAndEnqueue(record.KeyId, w.newDelivery(WebhookKeyDestroyed, record, now))
+		},
+	)
+}
+
+// scheduleWebhookBatches enqueues every listed webhook. Enqueued webhooks are no longer listed, so each batch starts at
+// the beginning.
+func scheduleWebhookBatches(
+	list func() ([]dbModels.WebhookRecord, error),
+	enqueue func(record *dbModels.WebhookRecord) (bool, error),
+) error {
+	for {
+		records, err := list()
+		if err != nil {
+			return err
+		}
+
+		for i := range records {
+			if _, err := enqueue(&records[i]); err != nil {
+				return err
+			}
+		}
+
+		if len(records) < webhookBatchSize {
+			return nil
+		}
+	}
+}
+
+func (w *WebhookServiceImpl) newDelivery(event string, record *dbModels.WebhookRecord, now time.Time) *dbModels.WebhookDeliveryRecord {
+	// Marshaling a struct of strings and times cannot fail
+	payload, _ := json.Marshal(models.WebhookPayload{
+		Event:      event,
+		KeyId:      record.KeyId,
+		Expiration: record.Expiration.UTC(),
+		OccurredAt: now.UTC(),
+	})
+
+	return &dbModels.WebhookDeliveryRecord{
+		KeyId:         record.KeyId,
+		Event:         event,
+		Payload:       string(payload),
+		Target:        record.Target,
+		NextAttemptAt: now,
+	}
+}
+
+// Deliver sends the due notifications until ctx is cancelled. Returns the number of successful deliveries.
+func (w *WebhookServiceImpl) Deliver(ctx context.Context) (int, error) {
+	delivered := 0
+	for {
+		now := w.now()
+		// The lease outlasts the attempts of the batch, so no other replica sends the same notifications meanwhile
+		records, err := w.deliveryRepo.ClaimDue(now, now.Add(webhookBatchSize*w.timeout), webhookBatchSize)
+		if err != nil {
+			return delivered, err
+		}
+
+		for i := range records {
+			if ctx.Err() != nil {
+				// The remaining deliveries are due again right away, for the next run or another replica
+				return delivered, w.deliveryRepo.Release(deliveryIds(records[i:]), w.now())
+			}
+
+			ok, err := w.deliver(ctx, &records[i])
+			if err != nil {
+				return delivered, err
+			}
+			if ok {
+				delivered++
+			}
+		}
+
+		if len(records) < webhookBatchSize {
+			return delivered, nil
+		}
+	}
+}
+
+func deliveryIds(records []dbModels.WebhookDeliveryRecord) []int64 {
+	ids := make([]int64, len(records))
+	for i := range records {
+		ids[i] = records[i].Id
+	}
+	return ids
+}
+
+// deliver returns an error only if the result of the attempt could not be stored. An attempt cut short by ctx does not
+// count as an attempt.
+func (w *WebhookServiceImpl) deliver(ctx context.Context, record *dbModels.WebhookDeliveryRecord) (bool, error) {
+	logger := logging.MakeLogger("services.WebhookService.deliver")
+
+	sendErr := w.send(ctx, record)
+	if sendErr == nil {
+		logger.Verbose("Delivered %s notification for KeyId: %s", record.Event, logging.KeyId(record.KeyId))
+		return true, w.deliveryRepo.Delete(record.Id)
+	}
+	if ctx.Err() != nil {
+		logger.Verbose("Interrupted %s notification for KeyId: %s", record.Event, logging.KeyId(record.KeyId))
+		return false, w.deliveryRepo.Release([]int64{record.Id}, w.now())
+	}
+
+	attempts := record.Attempts + 1
+	if attempts >= w.maxAttempts {
+		logger.Warning("Giving up on %s notification for KeyId: %s after %d attempts: %v", record.Event, logging.KeyId(record.KeyId), attempts, sendErr)
+		return false, w.deliveryRepo.Delete(record.Id)
+	}
+
+	logger.Info("Failed to deliver %s notification for KeyId: %s (attempt %d): %v", record.Event, logging.KeyId(record.KeyId), attempts, sendErr)
+	return false, w.deliveryRepo.RecordFailure(record.Id, attempts, w.now().Add(w.retryDelay(attempts)), sendErr.Error())
+}
+
+func (w *WebhookServiceImpl) send(ctx context.Context, record *dbModels.WebhookDeliveryRecord) error {
+	serializedTarget, err := w.dataProtection.Unprotect(record.Target)
+	if err != nil {
+		return fmt.Errorf("failed to unprotect webhook target: %w", err)
+	}
+
+	var target models.WebhookTarget
+	if err := json.Unmarshal([]byte(serializedTarget), &target); err != nil {
+		return fmt.Errorf("failed to deserialize webhook target: %w", err)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, target.Url, bytes.NewBufferString(record.Payload))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "Forgetti-Webhook")
+	request.Header.Set(WebhookEventHeader, record.Event)
+	request.Header.Set(WebhookDeliveryHeader, strconv.FormatInt(record.Id, 10))
+	request.Header.Set(WebhookSignatureHeader, SignWebhookPayload(target.Secret, w.now(), []byte(record.Payload)))
+
+	response, err := w.client.Do(request)
+	if err != nil {
+		// The error contains the URL, which may carry credentials of the receiver
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64*1024))
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status %d", response.StatusCode)
+	}
+	return nil
+}
+
+func (w *WebhookServiceImpl) retryDelay(attempts int) time.Duration {
+	delay := w.retryBase
+	for i := 1; i < attempts && delay < maxWebhookRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxWebhookRetryDelay)
+}
+
+// SignWebhookPayload returns the signature header of a notification: "t=<unix time>,v1=<hex HMAC-SHA256>", where the
+// HMAC of "<unix time>.<payload>" is keyed with the webhook secret. Receivers should reject old timestamps.
+func SignWebhookPayload(secret string, timestamp time.Time, payload []byte) string {
+	unixTime := strconv.FormatInt(timestamp.Unix(), 10)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unixTime + "."))
+	mac.Write(payload)
+	return fmt.Sprintf("t=%s,v1=%s", unixTime, hex.EncodeToString(mac.Sum(nil)))
+}
+
+func newWebhookClient(timeout time.Duration, allowPrivateNetworks bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivateNetworks {
+		// Checked when connecting, so that DNS answers cannot point a public name at a private address
+		dialer.Control = rejectPrivateAddress
+	}
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext},
+		// A redirect counts as a failed delivery
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func rejectPrivateAddress(_ string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return fmt.Errorf("webhook address %s is not public", host)
+	}
+	return nil
+}
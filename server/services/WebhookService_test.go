@@ -0,0 +1,355 @@
+package services
+
+import (
+	"ForgettiServer/config"
+	"ForgettiServer/db/dbtest"
+	"ForgettiServer/db/repositories"
+	"ForgettiServer/models"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const testWebhookSecret = "0123456789abcdef"
+
+type receivedWebhook struct {
+	event   string
+	payload models.WebhookPayload
+}
+
+// webhookStub records the notifications it receives, answering with the queued status codes and 200 afterwards
+type webhookStub struct {
+	t        *testing.T
+	server   *httptest.Server
+	mutex    sync.Mutex
+	received []receivedWebhook
+	statuses []int
+}
+
+func newWebhookStub(t *testing.T, statuses ...int) *webhookStub {
+	stub := &webhookStub{t: t, statuses: statuses}
+	stub.server = httptest.NewServer(http.HandlerFunc(stub.handle))
+	t.Cleanup(stub.server.Close)
+	return stub
+}
+
+func (s *webhookStub) handle(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	if !validWebhookSignature(r.Header.Get(WebhookSignatureHeader), body) {
+		s.t.Errorf("Invalid signature %s for payload %s", r.Header.Get(WebhookSignatureHeader), body)
+	}
+
+	if len(s.statuses) > 0 {
+		status := s.statuses[0]
+		s.statuses = s.statuses[1:]
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+	}
+
+	var payload models.WebhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		s.t.Errorf("Invalid payload %s: %v", body, err)
+	}
+	if payload.Event != r.Header.Get(WebhookEventHeader) {
+		s.t.Errorf("Event header = %s, payload event = %s", r.Header.Get(WebhookEventHeader), payload.Event)
+	}
+	s.received = append(s.received, receivedWebhook{event: payload.Event, payload: payload})
+}
+
+func (s *webhookStub) events() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	events := []string{}
+	for _, received := range s.received {
+		events = append(events, received.event+" "+received.payload.KeyId)
+	}
+	return events
+}
+
+// validWebhookSignature verifies a signature the way receivers are expected to
+func validWebhookSignature(header string, body []byte) bool {
+	timestamp, _, _ := strings.Cut(strings.TrimPrefix(header, "t="), ",")
+	unixTime, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	return header == SignWebhookPayload(testWebhookSecret, time.Unix(unixTime, 0), body)
+}
+
+func newTestWebhookService(t *testing.T, cfg *config.Config, database *gorm.DB) (*WebhookServiceImpl, *time.Time) {
+	t.Helper()
+
+	dataProtection, err := NewDataProtection(cfg)
+	if err != nil {
+		t.Fatalf("NewDataProtection() error = %v", err)
+	}
+
+	cfg.Webhooks.AllowPrivateNetworks = true
+	webhooks := NewWebhookService(repositories.NewWebhookRepo(database), repositories.NewWebhookDeliveryRepo(database), dataProtection, cfg)
+	current := time.Now()
+	webhooks.now = func() time.Time { return current }
+	return webhooks, &current
+}
+
+func runWebhooks(t *testing.T, webhooks *WebhookServiceImpl) {
+	t.Helper()
+
+	if err := webhooks.Schedule(); err != nil {
+		t.Fatalf("Schedule() error = %v", err)
+	}
+	if _, err := webhooks.Deliver(context.Background()); err != nil {
+		t.Fatalf("Deliver() error = %v", err)
+	}
+}
+
+func expectWebhookEvents(t *testing.T, stub *webhookStub, want ...string) {
+	t.Helper()
+
+	if got := stub.events(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Received %v, want %v", got, want)
+	}
+}
+
+func TestWebhookLifecycleNotifications(t *testing.T) {
+	dbtest.ForEachDriver(t, func(t *testing.T, cfg *config.Config, database *gorm.DB) {
+		webhooks, now := newTestWebhookService(t, cfg, database)
+		stub := newWebhookStub(t)
+
+		target := models.WebhookTarget{Url: stub.server.URL + "/hook", Secret: testWebhookSecret}
+		if err := webhooks.Register("later", now.Add(72*time.Hour), target); err != nil {
+			t.Fatalf("Register() error = %v", err)
+		}
+		expiration := now.Add(time.Hour).Truncate(time.Second)
+		if err := webhooks.Register("soon", expiration, target); err != nil {
+			t.Fatalf("Register() error = %v", err)
+		}
+
+		runWebhooks(t, webhooks)
+		runWebhooks(t, webhooks)
+		expectWebhookEvents(t, stub, "key.expiring_soon soon")
+
+		*now = now.Add(2 * time.Hour)
+		runWebhooks(t, webhooks)
+		expectWebhookEvents(t, stub, "key.expiring_soon soon", "key.expired soon")
+
+		// The key is destroyed when its recently expired period of 24 hours ends
+		*now = now.Add(24 * time.Hour)
+		runWebhooks(t, webhooks)
+		runWebhooks(t, webhooks)
+		expectWebhookEvents(t, stub, "key.expiring_soon soon", "key.expired soon", "key.destroyed soon")
+
+		if received := stub.received[2].payload; !received.Expiration.Equal(expiration) {
+			t.Errorf("Payload expiration = %s, want %s", received.Expiration, expiration)
+		}
+	})
+}
+
+func TestWebhookKeyDestroyed(t *testing.T) {
+	dbtest.ForEachDriver(t, func(t *testing.T, cfg *config.Config, database *gorm.DB) {
+		webhooks, now := newTestWebhookService(t, cfg, database)
+		stub := newWebhookStub(t)
+
+		target := models.WebhookTarget{Url: stub.server.URL, Secret: testWebhookSecret}
+		if err := webhooks.Register("key", now.Add(72*time.Hour), target); err != nil {
+			t.Fatalf("Register() error = %v", err)
+		}
+		if err := webhooks.KeyDestroyed("key"); err != nil {
+			t.Fatalf("KeyDestroyed() error = %v", err)
+		}
+		if err := webhooks.KeyDestroyed("unknown"); err != nil {
+			t.Fatalf("KeyDestroyed() of key without webhook error = %v", err)
+		}
+
+		// Nothing else is sent once the key was destroyed
+		runWebhooks(t, webhooks)
+		*now = now.Add(100 * time.Hour)
+		runWebhooks(t, webhooks)
+		expectWebhookEvents(t, stub, "key.destroyed key")
+	})
+}
+
+func TestWebhookDeliveryRetries(t *testing.T) {
+	dbtest.ForEachDriver(t, func(t *testing.T, cfg *config.Config, database *gorm.DB) {
+		cfg.Webhooks.MaxAttempts = 3
+		cfg.Webhooks.RetryBaseSeconds = 60
+		webhooks, now := newTestWebhookService(t, cfg, database)
+		stub := newWebhookStub(t, http.StatusInternalServerError, http.StatusBadGateway)
+
+		target := models.WebhookTarget{Url: stub.server.URL, Secret: testWebhookSecret}
+		if err := webhooks.Register("key", now.Add(time.Hour), target); err != nil {
+			t.Fatalf("Register() error = %v", err)
+		}
+
+		runWebhooks(t, webhooks)
+		expectWebhookEvents(t, stub)
+
+		// Not retried before the delay passed, then failing again
+		*now = now.Add(30 * time.Second)
+		runWebhooks(t, webhooks)
+		*now = now.Add(31 * time.Second)
+		runWebhooks(t, webhooks)
+		expectWebhookEvents(t, stub)
+
+		// The delay doubled
+		*now = now.Add(time.Minute)
+		runWebhooks(t, webhooks)
+		expectWebhookEvents(t, stub)
+		*now = now.Add(time.Minute)
+		runWebhooks(t, webhooks)
+		expectWebhookEvents(t, stub, "key.expiring_soon key")
+	})
+}
+
+func TestWebhookDeliveryGivesUp(t *testing.T) {
+	dbtest.ForEachDriver(t, func(t *testing.T, cfg *config.Config, database *gorm.DB) {
+		cfg.Webhooks.MaxAttempts = 2
+		webhooks, now := newTestWebhookService(t, cfg, database)
+		stub := newWebhookStub(t, http.StatusInternalServerError, http.StatusInternalServerError)
+
+		target := models.WebhookTarget{Url: stub.server.URL, Secret: testWebhookSecret}
+		if err := webhooks.Register("key", now.Add(time.Hour), target); err != nil {
+			t.Fatalf("Register() error = %v", err)
+		}
+
+		for i := 0; i < 3; i++ {
+			runWebhooks(t, webhooks)
+			*now = now.Add(time.Hour)
+		}
+
+		// Only the expiry is delivered, after the expiring soon notification was given up on
+		expectWebhookEvents(t, stub, "key.expired key")
+	})
+}
+
+func TestWebhookRejectsPrivateNetworks(t *testing.T) {
+	dbtest.ForEachDriver(t, func(t *testing.T, cfg *config.Config, database *gorm.DB) {
+		webhooks, now := newTestWebhookService(t, cfg, database)
+		webhooks.client = newWebhookClient(time.Second, false)
+		stub := newWebhookStub(t)
+
+		target := models.WebhookTarget{Url: stub.server.URL, Secret: testWebhookSecret}
+		if err := webhooks.Register("key", now.Add(time.Hour), target); err != nil {
+			t.Fatalf("Register() error = %v", err)
+		}
+
+		runWebhooks(t, webhooks)
+		expectWebhookEvents(t, stub)
+	})
+}
+
+func TestWebhookRegisterWhenDisabled(t *testing.T) {
+	dbtest.ForEachDriver(t, func(t *testing.T, cfg *config.Config, database *gorm.DB) {
+		cfg.Webhooks.Disabled = true
+		webhooks, now := newTestWebhookService(t, cfg, database)
+
+		err := webhooks.Register("key", now.Add(time.Hour), models.WebhookTarget{Url: "https://example.com", Secret: testWebhookSecret})
+		expectApiError(t, err, "bad-request")
+	})
+}
+
+func TestWebhookDeliverStopsWhenCancelled(t *testing.T) {
+	dbtest.ForEachDriver(t, func(t *testing.T, cfg *config.Config, database *gorm.DB) {
+		webhooks, now := newTestWebhookService(t, cfg, database)
+		stub := newWebhookStub(t)
+
+		target := models.WebhookTarget{Url: stub.server.URL, Secret: testWebhookSecret}
+		for _, keyId := range []string{"first", "second"} {
+			if err := webhooks.Register(keyId, now.Add(time.Hour), target); err != nil {
+				t.Fatalf("Register() error = %v", err)
+			}
+		}
+		if err := webhooks.Schedule(); err != nil {
+			t.Fatalf("Schedule() error = %v", err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if delivered, err := webhooks.Deliver(ctx); err != nil || delivered != 0 {
+			t.Fatalf("Deliver() with cancelled context = %d, %v, want nothing delivered", delivered, err)
+		}
+		expectWebhookEvents(t, stub)
+
+		// The claimed deliveries are due again right away, without a counted attempt
+		runWebhooks(t, webhooks)
+		expectWebhookEvents(t, stub, "key.expiring_soon first", "key.expiring_soon second")
+	})
+}
+
+func TestWebhookDispatcherStopInterruptsDelivery(t *testing.T) {
+	dbtest.ForEachDriver(t, func(t *testing.T, cfg *config.Config, database *gorm.DB) {
+		cfg.Webhooks.PollIntervalSeconds = 1
+		cfg.Webhooks.TimeoutSeconds = 60
+		cfg.Webhooks.MaxAttempts = 1
+		webhooks, now := newTestWebhookService(t, cfg, database)
+		webhooks.client = newWebhookClient(time.Minute, true)
+		stub := newWebhookStub(t)
+
+		// The receiver hangs until the request is cancelled or the test ends, as long as blocking is set
+		var blocking atomic.Bool
+		blocking.Store(true)
+		requested := make(chan struct{}, 1)
+		released := make(chan struct{})
+		receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if blocking.Load() {
+				select {
+				case requested <- struct{}{}:
+				default:
+				}
+				select {
+				case <-r.Context().Done():
+				case <-released:
+				}
+				return
+			}
+			stub.handle(w, r)
+		}))
+		t.Cleanup(receiver.Close)
+		t.Cleanup(func() { close(released) })
+
+		target := models.WebhookTarget{Url: receiver.URL, Secret: testWebhookSecret}
+		if err := webhooks.Register("key", now.Add(time.Hour), target); err != nil {
+			t.Fatalf("Register() error = %v", err)
+		}
+
+		dispatcher := NewWebhookDispatcher(webhooks, cfg)
+		dispatcher.Start()
+		select {
+		case <-requested:
+		case <-time.After(5 * time.Second):
+			dispatcher.Stop()
+			t.Fatal("Dispatcher did not deliver the notification")
+		}
+
+		stopped := make(chan struct{})
+		go func() {
+			dispatcher.Stop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Stop() waited for the delivery in progress")
+		}
+
+		// The interrupted delivery is not given up on, even though only one attempt is allowed
+		blocking.Store(false)
+		runWebhooks(t, webhooks)
+		expectWebhookEvents(t, stub, "key.expiring_soon key")
+	})
+}